@@ -5,26 +5,36 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"net/http"
 	"time"
 
+	"github.com/openfaas/faas-netes/pkg/audit"
+	"github.com/openfaas/faas-netes/pkg/auth"
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	informers "github.com/openfaas/faas-netes/pkg/client/informers/externalversions"
 	v1 "github.com/openfaas/faas-netes/pkg/client/informers/externalversions/openfaas/v1"
 	"github.com/openfaas/faas-netes/pkg/config"
+	"github.com/openfaas/faas-netes/pkg/connector"
 	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/cron"
 	"github.com/openfaas/faas-netes/pkg/handlers"
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/queue"
+	"github.com/openfaas/faas-netes/pkg/secretstore"
 	"github.com/openfaas/faas-netes/pkg/server"
 	"github.com/openfaas/faas-netes/pkg/signals"
+	"github.com/openfaas/faas-netes/pkg/trigger"
+	"github.com/openfaas/faas-netes/pkg/webhook"
 	version "github.com/openfaas/faas-netes/version"
 	faasProvider "github.com/openfaas/faas-provider"
-	"github.com/openfaas/faas-provider/logs"
 	"github.com/openfaas/faas-provider/proxy"
 	providertypes "github.com/openfaas/faas-provider/types"
 	metricsCS "k8s.io/metrics/pkg/client/clientset/versioned"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	v1apps "k8s.io/client-go/informers/apps/v1"
 	v1core "k8s.io/client-go/informers/core/v1"
@@ -114,6 +124,12 @@ func main() {
 		},
 		ImagePullPolicy:   config.ImagePullPolicy,
 		ProfilesNamespace: config.ProfilesNamespace,
+		DomainNamespace:   watchNamespace(config),
+		NetworkPolicy: k8s.NetworkPolicyConfig{
+			Mode:                     config.NetworkPolicyMode,
+			IngressNamespaceSelector: config.NetworkPolicyNamespaceSelector,
+			IngressPodSelector:       config.NetworkPolicyPodSelector,
+		},
 	}
 
 	// the sync interval does not affect the scale to/from zero feature
@@ -138,6 +154,14 @@ func main() {
 	profileLister := profileInformerFactory.Openfaas().V1().Profiles().Lister()
 	factory := k8s.NewFunctionFactory(kubeClient, deployConfig, profileLister)
 
+	store, err := secretstore.New(config)
+	if err != nil {
+		log.Fatalf("Error starting secret store: %s", err.Error())
+	}
+	if store != nil {
+		factory.Secrets = k8s.NewStoreSecretsClient(kubeClient, store, config.SecretStoreTTL)
+	}
+
 	setup := serverSetup{
 		config:                 config,
 		functionFactory:        factory,
@@ -235,21 +259,77 @@ func runController(setup serverSetup) {
 	// wire BucketService
 	bucketService := handlers.NewFunctionBucketService(listers.DeploymentInformer.Lister())
 
+	authenticator := auth.Start(config, kubeClient, stopCh)
+	authorize := handlers.NewAuthorize(authenticator, loadPolicy(config), config.DefaultFunctionNamespace)
+	audited := handlers.NewAudit(startAuditor(config, kubeClient), authenticator, listers.DeploymentInformer.Lister(), config.DefaultFunctionNamespace)
+	logStore := startLogCollector(kubeClient, config, stopCh)
+
+	// the caller is authenticated before the rate limiter, so that it can use its identity
+	functionProxy := handlers.MakeRateLimitedHandler(handlers.MakeCanaryRoutingHandler(proxy.NewHandlerFunc(config.FaaSConfig, functionResolver)), bucketService, config.DefaultFunctionNamespace)
+	functionProxy = handlers.MakeAuthHandler(functionProxy, authenticator, listers.DeploymentInformer.Lister(), config.DefaultFunctionNamespace)
+
+	// blue/green updates that were interrupted by a restart are completed or rolled back
+	blueGreen := handlers.NewBlueGreenUpdater(factory, functionResolver)
+	if err := blueGreen.Recover(context.Background(), watchNamespace(config)); err != nil {
+		log.Printf("Unable to recover blue/green updates: %s\n", err.Error())
+	}
+
 	bootstrapHandlers := providertypes.FaaSHandlers{
-		FunctionProxy:        handlers.MakeRateLimitedHandler(proxy.NewHandlerFunc(config.FaaSConfig, functionResolver), bucketService, config.DefaultFunctionNamespace),
-		DeleteHandler:        handlers.MakeDeleteHandler(config.DefaultFunctionNamespace, kubeClient),
-		DeployHandler:        handlers.MakeDeployHandler(config.DefaultFunctionNamespace, factory),
-		FunctionReader:       handlers.MakeFunctionReader(config.DefaultFunctionNamespace, listers.DeploymentInformer.Lister()),
-		ReplicaReader:        handlers.MakeReplicaReader(config.DefaultFunctionNamespace, listers.DeploymentInformer.Lister()),
-		ReplicaUpdater:       handlers.MakeReplicaUpdater(config.DefaultFunctionNamespace, kubeClient),
-		UpdateHandler:        handlers.MakeUpdateHandler(config.DefaultFunctionNamespace, factory),
+		FunctionProxy:        functionProxy,
+		DeleteHandler:        audited(audit.KindFunction, auth.VerbDelete, handlers.NamespaceFromQuery, authorize(auth.VerbDelete, handlers.NamespaceFromQuery, handlers.MakeDeleteHandler(config.DefaultFunctionNamespace, kubeClient))),
+		DeployHandler:        audited(audit.KindFunction, auth.VerbDeploy, handlers.NamespaceFromBody, authorize(auth.VerbDeploy, handlers.NamespaceFromBody, handlers.MakeDeployHandler(config.DefaultFunctionNamespace, factory))),
+		FunctionReader:       authorize(auth.VerbRead, handlers.NamespaceFromQuery, handlers.MakeFunctionReader(config.DefaultFunctionNamespace, listers.DeploymentInformer.Lister())),
+		ReplicaReader:        authorize(auth.VerbRead, handlers.NamespaceFromQuery, handlers.MakeReplicaReader(config.DefaultFunctionNamespace, listers.DeploymentInformer.Lister())),
+		ReplicaUpdater:       audited(audit.KindFunction, auth.VerbScale, handlers.NamespaceFromQuery, authorize(auth.VerbScale, handlers.NamespaceFromQuery, handlers.MakeReplicaUpdater(config.DefaultFunctionNamespace, kubeClient))),
+		UpdateHandler:        audited(audit.KindFunction, "update", handlers.NamespaceFromBody, authorize(auth.VerbDeploy, handlers.NamespaceFromBody, handlers.MakeUpdateHandler(config.DefaultFunctionNamespace, factory, blueGreen))),
 		HealthHandler:        handlers.MakeHealthHandler(),
 		InfoHandler:          handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit),
-		SecretHandler:        handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient),
-		LogHandler:           logs.NewLogHandlerFunc(k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace), config.FaaSConfig.WriteTimeout),
+		SecretHandler:        audited(audit.KindSecret, "", handlers.NamespaceFromQueryOrBody, authorize(auth.VerbSecrets, handlers.NamespaceFromQueryOrBody, handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient, factory.SecretsClient(), listers.DeploymentInformer.Lister()))),
+		LogHandler:           authorize(auth.VerbLogs, handlers.NamespaceFromQuery, handlers.MakeLogHandler(k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace, logStore), config.FaaSConfig.WriteTimeout)),
 		ListNamespaceHandler: handlers.MakeNamespacesLister(config.DefaultFunctionNamespace, config.ClusterRole, kubeClient),
 	}
 
+	handlers.RegisterSystemRoute("/system/function/{name:["+faasProvider.NameExpression+"]+}/revisions",
+		authorize(auth.VerbRead, handlers.NamespaceFromQuery, handlers.MakeRevisionsHandler(config.DefaultFunctionNamespace, factory)), config.FaaSConfig, http.MethodGet)
+	handlers.RegisterSystemRoute("/system/function/{name:["+faasProvider.NameExpression+"]+}/rollback",
+		audited(audit.KindFunction, "rollback", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, handlers.MakeRollbackHandler(config.DefaultFunctionNamespace, factory))), config.FaaSConfig, http.MethodPost)
+	handlers.RegisterSystemRoute("/system/function/{name:["+faasProvider.NameExpression+"]+}/bluegreen",
+		authorize(auth.VerbRead, handlers.NamespaceFromQuery, handlers.MakeBlueGreenStatusHandler(config.DefaultFunctionNamespace, factory)), config.FaaSConfig, http.MethodGet)
+	handlers.RegisterSystemRoute("/system/function/{name:["+faasProvider.NameExpression+"]+}/canary/promote",
+		audited(audit.KindFunction, "canary-promote", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, handlers.MakeCanaryPromoteHandler(config.DefaultFunctionNamespace, factory))), config.FaaSConfig, http.MethodPost)
+	handlers.RegisterSystemRoute("/system/function/{name:["+faasProvider.NameExpression+"]+}/canary/abort",
+		audited(audit.KindFunction, "canary-abort", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, handlers.MakeCanaryAbortHandler(config.DefaultFunctionNamespace, kubeClient))), config.FaaSConfig, http.MethodPost)
+
+	// namespaces can only be created and deleted with a ClusterRole
+	if config.ClusterRole {
+		namespaces := k8s.NewNamespacesClient(factory, config.DefaultFunctionNamespace, listers.DeploymentInformer.Lister())
+		handlers.RegisterSystemRoute("/system/namespaces",
+			audited(audit.KindNamespace, "", handlers.NamespaceFromName, authorize(auth.VerbNamespaces, handlers.NamespaceFromName, handlers.MakeNamespaceHandler(namespaces))), config.FaaSConfig, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+
+	if config.AsyncEnabled {
+		// asynchronous invocations are checked against the auth and rate limits of the
+		// function before they are queued, the same as synchronous invocations
+		asyncHandler := handlers.MakeRateLimitedHandler(handlers.MakeAsyncHandler(queue.Start(config, functionResolver, stopCh)), bucketService, config.DefaultFunctionNamespace)
+		asyncHandler = handlers.MakeAuthHandler(asyncHandler, authenticator, listers.DeploymentInformer.Lister(), config.DefaultFunctionNamespace)
+		handlers.RegisterAsyncRoutes(asyncHandler)
+	}
+
+	if config.CronEnabled {
+		cron.Start(config, kubeClient, functionResolver, cron.DeploymentJobs(listers.DeploymentInformer.Lister()), stopCh)
+	}
+
+	if len(config.ConnectorNATSURL) > 0 {
+		connector.StartNATS(config, listers.DeploymentInformer.Informer(), functionResolver, stopCh)
+	}
+
+	if config.TriggersEnabled {
+		trigger.Start(config, kubeClient, listers.DeploymentInformer.Informer(), functionResolver, stopCh)
+	}
+
+	k8s.StartSecretRollout(kubeClient, watchNamespace(config), listers.DeploymentInformer.Lister(), stopCh)
+	startSecretStoreSync(factory, config, stopCh)
+
 	faasProvider.Serve(&bootstrapHandlers, &config.FaaSConfig)
 }
 
@@ -273,22 +353,135 @@ func runOperator(setup serverSetup, cfg config.BootstrapConfig) {
 	operator := true
 	listers := startInformers(setup, stopCh, operator)
 
+	auditor := startAuditor(cfg, kubeClient)
+
 	ctrl := controller.NewController(
 		kubeClient,
 		faasClient,
 		kubeInformerFactory,
 		faasInformerFactory,
 		factory,
+		auditor,
 	)
 
-	srv := server.New(faasClient, kubeClient, listers.EndpointsInformer, listers.DeploymentInformer.Lister(), cfg.ClusterRole, cfg)
+	authenticator := auth.Start(cfg, kubeClient, stopCh)
+
+	logStore := startLogCollector(kubeClient, cfg, stopCh)
+
+	srv := server.New(faasClient, kubeClient, listers.EndpointsInformer, listers.DeploymentInformer.Lister(), cfg.ClusterRole, cfg, setup.functionFactory, authenticator, loadPolicy(cfg), auditor, logStore, stopCh)
 
 	go srv.Start()
+
+	if cfg.WebhookEnabled {
+		startWebhook(kubeClient, factory, cfg, stopCh)
+	}
+
+	functionLookup := k8s.NewFunctionLookup(cfg.DefaultFunctionNamespace, listers.EndpointsInformer.Lister())
+	functionLookup.DeploymentLister = listers.DeploymentInformer.Lister()
+
+	if cfg.CronEnabled {
+		cron.Start(cfg, kubeClient, functionLookup, cron.FunctionJobs(listers.FunctionsInformer.Lister()), stopCh)
+	}
+
+	if len(cfg.ConnectorNATSURL) > 0 {
+		connector.StartNATS(cfg, listers.DeploymentInformer.Informer(), functionLookup, stopCh)
+	}
+
+	if cfg.TriggersEnabled {
+		trigger.Start(cfg, kubeClient, listers.DeploymentInformer.Informer(), functionLookup, stopCh)
+	}
+
+	k8s.StartSecretRollout(kubeClient, watchNamespace(cfg), listers.DeploymentInformer.Lister(), stopCh)
+	startSecretStoreSync(setup.functionFactory, cfg, stopCh)
+
 	if err := ctrl.Run(1, stopCh); err != nil {
 		glog.Fatalf("Error running controller: %s", err.Error())
 	}
 }
 
+// startWebhook bootstraps the certificates of the admission webhook, registers it with
+// the API server and then serves it in the background, rotating its certificates
+// before they expire
+func startWebhook(kubeClient kubernetes.Interface, factory controller.FunctionFactory, cfg config.BootstrapConfig, stopCh <-chan struct{}) {
+	webhookConfig := webhook.Config{
+		Name:        cfg.WebhookName,
+		Namespace:   cfg.WebhookNamespace,
+		Service:     cfg.WebhookService,
+		ServicePort: 443,
+		SecretName:  cfg.WebhookSecret,
+	}
+
+	ctx := context.Background()
+	certs, err := webhook.EnsureCertificates(ctx, kubeClient, webhookConfig)
+	if err != nil {
+		glog.Fatalf("Error creating webhook certificates: %s", err.Error())
+	}
+
+	if err := webhook.RegisterWebhooks(ctx, kubeClient, webhookConfig, certs.CACert); err != nil {
+		glog.Fatalf("Error registering webhooks: %s", err.Error())
+	}
+
+	srv := webhook.New(factory, cfg.WebhookPort)
+	go func() {
+		if err := srv.Start(certs, stopCh); err != nil {
+			glog.Fatalf("Error running webhook server: %s", err.Error())
+		}
+	}()
+	go srv.Rotate(kubeClient, webhookConfig, certs, webhook.CertCheckInterval, stopCh)
+}
+
+// loadPolicy reads the policy of the REST API, it returns nil when none is configured
+func loadPolicy(cfg config.BootstrapConfig) *auth.Policy {
+	if len(cfg.AuthPolicy) == 0 {
+		return nil
+	}
+
+	policy, err := auth.LoadPolicy(cfg.AuthPolicy)
+	if err != nil {
+		log.Fatalf("Error loading auth policy: %s", err.Error())
+	}
+	return policy
+}
+
+// startAuditor returns the auditor of the calls that change functions and secrets, it
+// returns nil when auditing is disabled
+func startAuditor(cfg config.BootstrapConfig, kubeClient kubernetes.Interface) *audit.Auditor {
+	auditor, err := audit.Start(cfg, kubeClient)
+	if err != nil {
+		log.Fatalf("Error starting audit log: %s", err.Error())
+	}
+	return auditor
+}
+
+// watchNamespace returns the namespace whose secrets and Pods are watched to roll out
+// functions and collect their logs, which is every namespace with a ClusterRole
+func watchNamespace(cfg config.BootstrapConfig) string {
+	if cfg.ClusterRole {
+		return metav1.NamespaceAll
+	}
+	return cfg.DefaultFunctionNamespace
+}
+
+// startSecretStoreSync refreshes the Secrets that are materialised from the secret
+// store, when one is configured
+func startSecretStoreSync(factory k8s.FunctionFactory, cfg config.BootstrapConfig, stopCh <-chan struct{}) {
+	if client, ok := factory.Secrets.(*k8s.StoreSecretsClient); ok {
+		client.Start(watchNamespace(cfg), stopCh)
+	}
+}
+
+// startLogCollector tails the logs of functions into a store when the log collector is
+// enabled, it returns nil otherwise
+func startLogCollector(kubeClient kubernetes.Interface, cfg config.BootstrapConfig, stopCh <-chan struct{}) *k8s.LogStore {
+	if !cfg.LogCollectorEnabled {
+		return nil
+	}
+
+	store := k8s.NewLogStore(cfg.LogRetentionBytes, cfg.LogRetentionPeriod)
+	k8s.StartLogCollector(kubeClient, watchNamespace(cfg), store, stopCh)
+	return store
+}
+
 // serverSetup is a container for the config and clients needed to start the
 // faas-netes controller or operator
 type serverSetup struct {
@@ -0,0 +1,196 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KindFunction is a record of a call that acts on a function
+	KindFunction = "function"
+	// KindSecret is a record of a call that acts on a secret
+	KindSecret = "secret"
+	// KindNamespace is a record of a call that acts on a namespace
+	KindNamespace = "namespace"
+)
+
+const (
+	// SourceAPI is a record of a call to the REST API
+	SourceAPI = "api"
+	// SourceOperator is a record of the reconciliation of a Function by the operator
+	SourceOperator = "operator"
+)
+
+const (
+	// OutcomeSuccess is a call that succeeded
+	OutcomeSuccess = "success"
+	// OutcomeDenied is a call that was rejected because of the identity of the caller
+	OutcomeDenied = "denied"
+	// OutcomeFailure is a call that failed
+	OutcomeFailure = "failure"
+)
+
+// Redacted replaces the values of secrets in the diff of a record
+const Redacted = "<redacted>"
+
+// redactedFields are the fields of a request that hold the value of a secret
+var redactedFields = map[string]bool{
+	"value":      true,
+	"rawValue":   true,
+	"stringData": true,
+	"data":       true,
+}
+
+// identifyingFields are the fields of a request that name what it acts on, they are
+// recorded in the Name and Namespace of a record rather than in its diff
+var identifyingFields = map[string]bool{
+	"service":      true,
+	"serviceName":  true,
+	"functionName": true,
+	"name":         true,
+	"namespace":    true,
+}
+
+// Change is a field that a call changed
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
+
+// Record is who did what to which function or secret, and how it went
+type Record struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	Caller    string    `json:"caller"`
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name,omitempty"`
+	Verb      string    `json:"verb"`
+	Diff      []Change  `json:"diff,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(record Record) error
+}
+
+// Auditor writes each record to all of its sinks
+type Auditor struct {
+	Sinks []Sink
+}
+
+// New returns an Auditor that writes to sinks
+func New(sinks ...Sink) *Auditor {
+	return &Auditor{Sinks: sinks}
+}
+
+// Record writes record to the sinks, errors are logged so that the call that is
+// audited is not affected by them
+func (a *Auditor) Record(record Record) {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	for _, sink := range a.Sinks {
+		if err := sink.Write(record); err != nil {
+			log.Printf("Unable to write audit record of %s %s: %s\n", record.Verb, record.Name, err.Error())
+		}
+	}
+}
+
+// Start returns an Auditor with the sinks that are enabled in cfg, or nil when
+// auditing is disabled
+func Start(cfg config.BootstrapConfig, kube kubernetes.Interface) (*Auditor, error) {
+	sinks := []Sink{}
+
+	switch cfg.AuditLog {
+	case "":
+	case "stdout", "-":
+		sinks = append(sinks, NewWriterSink(os.Stdout))
+	default:
+		file, err := os.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log: %s", err.Error())
+		}
+		sinks = append(sinks, NewWriterSink(file))
+	}
+
+	if cfg.AuditEvents {
+		sinks = append(sinks, NewEventSink(kube))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return New(sinks...), nil
+}
+
+// OutcomeFor returns the outcome of a call that was answered with status
+func OutcomeFor(status int) string {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// Diff returns the fields of the JSON request that differ from previous, which may be
+// nil for calls that create something. The values of secrets are redacted.
+func Diff(previous interface{}, request []byte) []Change {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(request, &fields); err != nil {
+		return nil
+	}
+
+	before := map[string]interface{}{}
+	if previous != nil {
+		if data, err := json.Marshal(previous); err == nil {
+			json.Unmarshal(data, &before)
+		}
+	}
+
+	keys := []string{}
+	for key := range fields {
+		if !identifyingFields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []Change{}
+	for _, key := range keys {
+		from, to := before[key], fields[key]
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+
+		if redactedFields[key] {
+			if from != nil {
+				from = Redacted
+			}
+			if to != nil {
+				to = Redacted
+			}
+		}
+		changes = append(changes, Change{Field: key, From: from, To: to})
+	}
+	return changes
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_Diff(t *testing.T) {
+	previous := types.FunctionStatus{
+		Name:     "env",
+		Image:    "functions/alpine:0.1",
+		Replicas: 1,
+	}
+
+	t.Run("lists the changed fields of a function", func(t *testing.T) {
+		request := []byte(`{"service":"env","namespace":"openfaas-fn","image":"functions/alpine:0.2","envProcess":"env"}`)
+
+		changes := Diff(previous, request)
+		if len(changes) != 2 {
+			t.Fatalf("want 2 changes, got: %v", changes)
+		}
+		if changes[0].Field != "envProcess" || changes[0].From != nil || changes[0].To != "env" {
+			t.Errorf("want envProcess to be set, got: %v", changes[0])
+		}
+		if changes[1].Field != "image" || changes[1].From != "functions/alpine:0.1" || changes[1].To != "functions/alpine:0.2" {
+			t.Errorf("want the image to change, got: %v", changes[1])
+		}
+	})
+
+	t.Run("skips unchanged fields", func(t *testing.T) {
+		changes := Diff(previous, []byte(`{"serviceName":"env","replicas":1}`))
+		if len(changes) != 0 {
+			t.Errorf("want no changes, got: %v", changes)
+		}
+	})
+
+	t.Run("redacts the values of secrets", func(t *testing.T) {
+		changes := Diff(nil, []byte(`{"name":"db-password","value":"s3cr3t"}`))
+		if len(changes) != 1 || changes[0].To != Redacted {
+			t.Fatalf("want the value to be redacted, got: %v", changes)
+		}
+
+		data, _ := json.Marshal(changes)
+		if strings.Contains(string(data), "s3cr3t") {
+			t.Errorf("want no secret in the diff, got: %s", data)
+		}
+
+		changes = Diff(nil, []byte(`{"name":"tls","type":"kubernetes.io/tls","stringData":{"tls.key":"s3cr3t"},"data":{"tls.crt":"czNjcjN0"}}`))
+		data, _ = json.Marshal(changes)
+		if len(changes) != 3 || strings.Contains(string(data), "s3cr3t") || strings.Contains(string(data), "czNjcjN0") {
+			t.Errorf("want the keys of the secret to be redacted, got: %s", data)
+		}
+	})
+}
+
+func Test_OutcomeFor(t *testing.T) {
+	cases := map[int]string{
+		http.StatusOK:                  OutcomeSuccess,
+		http.StatusAccepted:            OutcomeSuccess,
+		http.StatusUnauthorized:        OutcomeDenied,
+		http.StatusForbidden:           OutcomeDenied,
+		http.StatusNotFound:            OutcomeFailure,
+		http.StatusInternalServerError: OutcomeFailure,
+	}
+
+	for status, want := range cases {
+		if got := OutcomeFor(status); got != want {
+			t.Errorf("status %d: want %s, got %s", status, want, got)
+		}
+	}
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(record Record) error {
+	return errors.New("disk full")
+}
+
+func Test_Auditor_WritesJSONLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	auditor := New(failingSink{}, NewWriterSink(out))
+
+	auditor.Record(Record{Source: SourceAPI, Caller: "jwt:alice", Namespace: "openfaas-fn", Kind: KindFunction, Name: "env", Verb: "deploy", Outcome: OutcomeSuccess})
+	auditor.Record(Record{Source: SourceAPI, Caller: "anonymous", Namespace: "openfaas-fn", Kind: KindFunction, Name: "env", Verb: "delete", Outcome: OutcomeDenied})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got: %q", out.String())
+	}
+
+	record := Record{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("want a JSON record, got: %s", err.Error())
+	}
+	if record.Caller != "jwt:alice" || record.Verb != "deploy" || record.Time.IsZero() {
+		t.Errorf("want the record with a time, got: %+v", record)
+	}
+}
+
+func Test_EventSink(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	sink := &EventSink{Recorder: recorder}
+
+	sink.Write(Record{Source: SourceAPI, Caller: "api-key:ci", Namespace: "openfaas-fn", Kind: KindFunction, Name: "env", Verb: "deploy", Outcome: OutcomeSuccess,
+		Diff: []Change{{Field: "image"}}})
+	sink.Write(Record{Source: SourceAPI, Caller: "anonymous", Namespace: "openfaas-fn", Kind: KindSecret, Verb: "list", Outcome: OutcomeSuccess})
+	sink.Write(Record{Source: SourceAPI, Caller: "anonymous", Namespace: "openfaas-fn", Kind: KindSecret, Name: "db-password", Verb: "update", Outcome: OutcomeDenied})
+
+	want := []string{
+		"Normal Audit api-key:ci deploy function via api: success, changed [image]",
+		"Warning Audit anonymous update secret via api: denied",
+	}
+	for _, w := range want {
+		select {
+		case event := <-recorder.Events:
+			if event != w {
+				t.Errorf("want event %q, got %q", w, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("want event %q", w)
+		}
+	}
+
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("want no more events, got %q", event)
+	default:
+	}
+}
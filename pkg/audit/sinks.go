@@ -0,0 +1,99 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventReason is the reason of the Kubernetes Events written by EventSink
+const EventReason = "Audit"
+
+// WriterSink writes each record as a line of JSON
+type WriterSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriterSink returns a WriterSink that writes to w, such as stdout or a file
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+// Write implements Sink
+func (s *WriterSink) Write(record Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.encoder.Encode(record)
+}
+
+// EventSink records each record as a Kubernetes Event on the Deployment of the
+// function, on the secret or on the namespace
+type EventSink struct {
+	Recorder record.EventRecorder
+}
+
+// NewEventSink returns an EventSink that writes Events with kube
+func NewEventSink(kube kubernetes.Interface) *EventSink {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kube.CoreV1().Events("")})
+
+	return &EventSink{
+		Recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "faas-netes-audit"}),
+	}
+}
+
+// Write implements Sink, records without a name, such as the listing of secrets,
+// have no object to be recorded on and are skipped
+func (s *EventSink) Write(record Record) error {
+	if len(record.Name) == 0 {
+		return nil
+	}
+
+	object := &corev1.ObjectReference{
+		Kind:       "Deployment",
+		APIVersion: "apps/v1",
+		Namespace:  record.Namespace,
+		Name:       record.Name,
+	}
+	if record.Kind == KindSecret {
+		object.Kind = "Secret"
+		object.APIVersion = "v1"
+	}
+	if record.Kind == KindNamespace {
+		object.Kind = "Namespace"
+		object.APIVersion = "v1"
+		object.Namespace = ""
+	}
+
+	eventType := corev1.EventTypeNormal
+	if record.Outcome != OutcomeSuccess {
+		eventType = corev1.EventTypeWarning
+	}
+
+	message := fmt.Sprintf("%s %s %s via %s: %s", record.Caller, record.Verb, record.Kind, record.Source, record.Outcome)
+	if len(record.Diff) > 0 {
+		fields := make([]string, len(record.Diff))
+		for i, change := range record.Diff {
+			fields[i] = change.Field
+		}
+		message += fmt.Sprintf(", changed %v", fields)
+	}
+	if len(record.Error) > 0 {
+		message += ": " + record.Error
+	}
+
+	s.Recorder.Event(object, eventType, EventReason, message)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// APIKeyLabel marks the Secrets that hold an API key
+	APIKeyLabel = "openfaas.com/api-key"
+
+	// APIKeySecretKey is the key of the Secret data with the API key
+	APIKeySecretKey = "key"
+
+	// APIKeySubjectKey is the optional key of the Secret data with the subject of the
+	// caller, the name of the Secret is used when it is not set
+	APIKeySubjectKey = "subject"
+
+	// APIKeyScopesKey is the optional key of the Secret data with the scopes of the
+	// caller, separated by commas or spaces
+	APIKeyScopesKey = "scopes"
+)
+
+// APIKeyAuthenticator accepts the API keys held in the Secrets with the APIKeyLabel in
+// the namespace of the function
+type APIKeyAuthenticator struct {
+	Secrets corelisters.SecretLister
+}
+
+// NewAPIKeyAuthenticator returns an APIKeyAuthenticator that reads keys from secrets
+func NewAPIKeyAuthenticator(secrets corelisters.SecretLister) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Secrets: secrets}
+}
+
+// Authenticate implements Authenticator for requests with an APIKeyHeader
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request, namespace string) (*Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{APIKeyLabel: "true"})
+	secrets, err := a.Secrets.Secrets(namespace).List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list API keys: %s", err.Error())
+	}
+
+	for _, secret := range secrets {
+		stored := secret.Data[APIKeySecretKey]
+		if len(stored) == 0 || subtle.ConstantTimeCompare(stored, []byte(key)) != 1 {
+			continue
+		}
+
+		subject := string(secret.Data[APIKeySubjectKey])
+		if len(subject) == 0 {
+			subject = secret.Name
+		}
+
+		return &Identity{
+			Subject: subject,
+			Method:  MethodAPIKey,
+			Scopes:  splitScopes(string(secret.Data[APIKeyScopesKey])),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+}
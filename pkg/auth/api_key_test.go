@@ -0,0 +1,96 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func apiKeyLister(t *testing.T, secrets ...*corev1.Secret) corelisters.SecretLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, secret := range secrets {
+		if err := indexer.Add(secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return corelisters.NewSecretLister(indexer)
+}
+
+func apiKeySecret(name, namespace, key string, data map[string][]byte) *corev1.Secret {
+	if data == nil {
+		data = map[string][]byte{}
+	}
+	data[APIKeySecretKey] = []byte(key)
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{APIKeyLabel: "true"}},
+		Data:       data,
+	}
+}
+
+func Test_APIKeyAuthenticator(t *testing.T) {
+	unlabelled := apiKeySecret("unlabelled", "openfaas-fn", "unlabelled-key", nil)
+	unlabelled.Labels = nil
+
+	authenticator := NewAPIKeyAuthenticator(apiKeyLister(t,
+		apiKeySecret("ci", "openfaas-fn", "ci-key", map[string][]byte{APIKeyScopesKey: []byte("deploy, read")}),
+		apiKeySecret("bot", "openfaas-fn", "bot-key", map[string][]byte{APIKeySubjectKey: []byte("chat-bot")}),
+		apiKeySecret("other", "team-a", "other-key", nil),
+		unlabelled,
+	))
+
+	cases := []struct {
+		name    string
+		key     string
+		subject string
+		scopes  []string
+		err     bool
+	}{
+		{name: "no key"},
+		{name: "key with scopes", key: "ci-key", subject: "ci", scopes: []string{"deploy", "read"}},
+		{name: "key with subject", key: "bot-key", subject: "chat-bot"},
+		{name: "key of another namespace", key: "other-key", err: true},
+		{name: "Secret without label", key: "unlabelled-key", err: true},
+		{name: "unknown key", key: "guess", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/function/nodeinfo", nil)
+			if len(tc.key) > 0 {
+				r.Header.Set(APIKeyHeader, tc.key)
+			}
+
+			identity, err := authenticator.Authenticate(r, "openfaas-fn")
+			if tc.err {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("want ErrInvalidCredentials, got: %v, %v", identity, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(tc.subject) == 0 {
+				if identity != nil {
+					t.Errorf("want no identity, got: %+v", identity)
+				}
+				return
+			}
+			if identity.Subject != tc.subject || identity.Method != MethodAPIKey || !identity.HasScopes(tc.scopes) || len(identity.Scopes) != len(tc.scopes) {
+				t.Errorf("want %s with scopes %v, got: %+v", tc.subject, tc.scopes, identity)
+			}
+		})
+	}
+}
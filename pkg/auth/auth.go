@@ -0,0 +1,211 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// RequiredAnnotation set to true only lets authenticated callers invoke a function
+	RequiredAnnotation = "com.openfaas.auth"
+
+	// ScopesAnnotation lists the scopes, separated by commas or spaces, that a caller
+	// needs to invoke a function. Setting it implies RequiredAnnotation.
+	ScopesAnnotation = "com.openfaas.auth.scopes"
+)
+
+const (
+	// SubjectHeader forwards the subject of the caller to the function
+	SubjectHeader = "X-OpenFaaS-Auth-Subject"
+
+	// ScopesHeader forwards the scopes of the caller to the function, separated by spaces
+	ScopesHeader = "X-OpenFaaS-Auth-Scopes"
+
+	// MethodHeader forwards how the caller was authenticated to the function
+	MethodHeader = "X-OpenFaaS-Auth-Method"
+
+	// APIKeyHeader carries the API key of a caller
+	APIKeyHeader = "X-Api-Key"
+)
+
+const (
+	// MethodJWT is a caller that sent a bearer JWT
+	MethodJWT = "jwt"
+	// MethodAPIKey is a caller that sent an API key
+	MethodAPIKey = "api-key"
+)
+
+// ErrInvalidCredentials is returned when a caller sent credentials that could not be
+// verified
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+// String returns the method and subject of the caller, which identifies it across
+// authenticators
+func (i Identity) String() string {
+	return i.Method + ":" + i.Subject
+}
+
+// HasScopes returns true when the caller has all of the scopes
+func (i Identity) HasScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		found := false
+		for _, s := range i.Scopes {
+			if s == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Authenticator verifies the credentials of a request to a function in namespace. It
+// returns a nil Identity when the request has no credentials of its kind.
+type Authenticator interface {
+	Authenticate(r *http.Request, namespace string) (*Identity, error)
+}
+
+// Chain tries each authenticator in turn and returns the first identity or error
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request, namespace string) (*Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(r, namespace)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+	return nil, nil
+}
+
+// Start returns the authenticators that are enabled in cfg. The Secrets with API keys
+// are watched until stopCh is closed.
+func Start(cfg config.BootstrapConfig, kube kubernetes.Interface, stopCh <-chan struct{}) Chain {
+	chain := Chain{}
+
+	if len(cfg.AuthJWKS) > 0 {
+		keys := NewJWKSKeySet(cfg.AuthJWKS, &http.Client{Timeout: 10 * time.Second})
+		chain = append(chain, NewJWTAuthenticator(keys, cfg.AuthJWTIssuer, cfg.AuthJWTAudience))
+	}
+
+	if cfg.AuthAPIKeysEnabled {
+		namespace := cfg.DefaultFunctionNamespace
+		if cfg.ClusterRole {
+			namespace = metav1.NamespaceAll
+		}
+
+		informer := coreinformers.NewFilteredSecretInformer(kube, namespace, 5*time.Minute, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			func(options *metav1.ListOptions) {
+				options.LabelSelector = APIKeyLabel + "=true"
+			})
+		go informer.Run(stopCh)
+		if ok := cache.WaitForNamedCacheSync("faas-netes:api-keys", stopCh, informer.HasSynced); !ok {
+			log.Fatalf("failed to wait for cache to sync")
+		}
+
+		chain = append(chain, NewAPIKeyAuthenticator(corelisters.NewSecretLister(informer.GetIndexer())))
+	}
+
+	return chain
+}
+
+// Requirement is what a function asks of its callers
+type Requirement struct {
+	Required bool
+	Scopes   []string
+}
+
+// ParseRequirement reads the auth annotations of a function
+func ParseRequirement(annotations map[string]string) (Requirement, error) {
+	requirement := Requirement{}
+
+	if value, ok := annotations[RequiredAnnotation]; ok {
+		required, err := strconv.ParseBool(value)
+		if err != nil {
+			return requirement, fmt.Errorf("%s: must be true or false", RequiredAnnotation)
+		}
+		requirement.Required = required
+	}
+
+	if value, ok := annotations[ScopesAnnotation]; ok {
+		requirement.Scopes = splitScopes(value)
+		if len(requirement.Scopes) == 0 {
+			return requirement, fmt.Errorf("%s: must list at least one scope", ScopesAnnotation)
+		}
+		requirement.Required = true
+	}
+
+	return requirement, nil
+}
+
+// ValidateAnnotations returns an error when the auth annotations of a function are invalid
+func ValidateAnnotations(annotations map[string]string) error {
+	_, err := ParseRequirement(annotations)
+	return err
+}
+
+// ForwardIdentity replaces the identity headers of r, so that callers can not set them
+// themselves, and stores identity in the context of the request
+func ForwardIdentity(r *http.Request, identity *Identity) *http.Request {
+	r.Header.Del(SubjectHeader)
+	r.Header.Del(ScopesHeader)
+	r.Header.Del(MethodHeader)
+	r.Header.Del(APIKeyHeader)
+
+	if identity == nil {
+		return r
+	}
+
+	r.Header.Set(SubjectHeader, identity.Subject)
+	r.Header.Set(MethodHeader, identity.Method)
+	if len(identity.Scopes) > 0 {
+		r.Header.Set(ScopesHeader, strings.Join(identity.Scopes, " "))
+	}
+	return r.WithContext(WithIdentity(r.Context(), identity))
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context that carries identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity of the caller in ctx, or nil for anonymous callers
+func IdentityFrom(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func splitScopes(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
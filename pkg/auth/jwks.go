@@ -0,0 +1,207 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksMaxAge is how long the keys of a JWKSKeySet are used before they are reloaded
+	jwksMaxAge = time.Hour
+
+	// jwksMinRefresh limits how often an unknown key ID reloads the keys
+	jwksMinRefresh = time.Minute
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS reads the RSA and EC signing keys of a JSON Web Key Set, other keys are
+// skipped
+func ParseJWKS(data []byte) (StaticKeySet, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %s", err.Error())
+	}
+
+	keys := StaticKeySet{}
+	for _, jwk := range set.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaKey()
+		case "EC":
+			key, err = jwk.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %s", jwk.Kid, err.Error())
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() {
+		return nil, fmt.Errorf("exponent is too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid base64url value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// JWKSKeySet is a KeySet that is loaded from a file or an http(s) URL. The keys are
+// reloaded after an hour, or earlier when a token has a key ID that is not known, so
+// that rotated keys are picked up. The last keys that loaded are kept when a reload
+// fails.
+type JWKSKeySet struct {
+	source string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      StaticKeySet
+	loaded    time.Time
+	attempted time.Time
+}
+
+// NewJWKSKeySet returns a JWKSKeySet for source, which is a file path or an http(s) URL
+func NewJWKSKeySet(source string, client *http.Client) *JWKSKeySet {
+	return &JWKSKeySet{
+		source: source,
+		client: client,
+	}
+}
+
+// Key implements KeySet
+func (s *JWKSKeySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil || time.Since(s.loaded) > jwksMaxAge {
+		s.reload()
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("unable to load JWKS from %s", s.source)
+	}
+
+	key, err := s.keys.Key(kid)
+	if err != nil && s.reload() {
+		return s.keys.Key(kid)
+	}
+	return key, err
+}
+
+// reload loads the keys again, at most once per jwksMinRefresh, it returns true when
+// new keys were loaded
+func (s *JWKSKeySet) reload() bool {
+	if time.Since(s.attempted) < jwksMinRefresh {
+		return false
+	}
+	s.attempted = time.Now()
+
+	data, err := s.read()
+	if err != nil {
+		log.Printf("Unable to load JWKS from %s: %s\n", s.source, err.Error())
+		return false
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		log.Printf("Unable to load JWKS from %s: %s\n", s.source, err.Error())
+		return false
+	}
+
+	s.keys = keys
+	s.loaded = s.attempted
+	return true
+}
+
+func (s *JWKSKeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return ioutil.ReadFile(s.source)
+	}
+
+	res, err := s.client.Get(s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func testJWKS(rsaKey *rsa.PublicKey, ecKey *ecdsa.PublicKey) string {
+	return fmt.Sprintf(`{"keys": [
+	{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+	{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+	{"kty": "RSA", "kid": "enc", "use": "enc", "n": %q, "e": %q},
+	{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"}
+]}`, b64(rsaKey.N), b64(big.NewInt(int64(rsaKey.E))), b64(ecKey.X), b64(ecKey.Y), b64(rsaKey.N), b64(big.NewInt(int64(rsaKey.E))))
+}
+
+func Test_ParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	keys, err := ParseJWKS([]byte(testJWKS(&rsaKey.PublicKey, &ecKey.PublicKey)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("want the two signing keys, got: %d", len(keys))
+	}
+	if key, ok := keys["rsa"].(*rsa.PublicKey); !ok || key.N.Cmp(rsaKey.N) != 0 || key.E != rsaKey.E {
+		t.Errorf("want the RSA key, got: %v", keys["rsa"])
+	}
+	if key, ok := keys["ec"].(*ecdsa.PublicKey); !ok || !key.Equal(&ecKey.PublicKey) {
+		t.Errorf("want the EC key, got: %v", keys["ec"])
+	}
+
+	if _, err := ParseJWKS([]byte(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`)); err == nil {
+		t.Errorf("want error for a point that is not on the curve")
+	}
+}
+
+func Test_JWKSKeySet_LoadsFileAndURL(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := testJWKS(&rsaKey.PublicKey, &ecKey.PublicKey)
+
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(jwks))
+	}))
+	defer srv.Close()
+
+	for _, source := range []string{path, srv.URL} {
+		keys := NewJWKSKeySet(source, srv.Client())
+		if _, err := keys.Key("rsa"); err != nil {
+			t.Errorf("%s: want key rsa, got: %s", source, err)
+		}
+		if _, err := keys.Key("missing"); err == nil {
+			t.Errorf("%s: want error for an unknown key", source)
+		}
+	}
+
+	keys := NewJWKSKeySet(filepath.Join(dir, "missing.json"), nil)
+	if _, err := keys.Key("rsa"); err == nil {
+		t.Errorf("want error for a missing file")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far exp and nbf may be off
+const clockSkew = 30 * time.Second
+
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// KeySet returns the public key that a token is verified with
+type KeySet interface {
+	// Key returns the key with the key ID kid, kid is empty when the token has none
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a KeySet with fixed keys by their key ID
+type StaticKeySet map[string]crypto.PublicKey
+
+// Key implements KeySet, a token without a key ID uses the only key of the set
+func (s StaticKeySet) Key(kid string) (crypto.PublicKey, error) {
+	if len(kid) == 0 && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	key, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// JWTAuthenticator accepts bearer JWTs that are signed with RS* or ES* by a key of Keys
+type JWTAuthenticator struct {
+	Keys KeySet
+
+	// Issuer and Audience are checked against the iss and aud claims when set
+	Issuer   string
+	Audience string
+
+	now func() time.Time
+}
+
+// NewJWTAuthenticator returns a JWTAuthenticator that verifies tokens with keys
+func NewJWTAuthenticator(keys KeySet, issuer, audience string) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+		now:      time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  audience    `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+	Scope     string      `json:"scope"`
+	Scp       interface{} `json:"scp"`
+}
+
+// audience is the aud claim, which is either a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Authenticate implements Authenticator for requests with an Authorization: Bearer header
+func (j *JWTAuthenticator) Authenticate(r *http.Request, namespace string) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, nil
+	}
+
+	claims, err := j.verify(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err.Error())
+	}
+
+	return &Identity{
+		Subject: claims.Subject,
+		Method:  MethodJWT,
+		Scopes:  claims.scopes(),
+	}, nil
+}
+
+// verify checks the signature and the claims of token
+func (j *JWTAuthenticator) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err.Error())
+	}
+
+	hash, ok := signingHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+
+	key, err := j.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, hash, key, h.Sum(nil), signature); err != nil {
+		return nil, err
+	}
+
+	claims := jwtClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err.Error())
+	}
+
+	now := j.now()
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("token is expired")
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if len(claims.Subject) == 0 {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	if len(j.Issuer) > 0 && claims.Issuer != j.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if len(j.Audience) > 0 && !claims.Audience.contains(j.Audience) {
+		return nil, fmt.Errorf("token is not for audience %q", j.Audience)
+	}
+
+	return &claims, nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (a audience) contains(value string) bool {
+	for _, aud := range a {
+		if aud == value {
+			return true
+		}
+	}
+	return false
+}
+
+// scopes returns the space separated scope claim, or the scp claim that some issuers
+// use instead
+func (c jwtClaims) scopes() []string {
+	if len(c.Scope) > 0 {
+		return strings.Fields(c.Scope)
+	}
+
+	switch scp := c.Scp.(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes := []string{}
+		for _, s := range scp {
+			if value, ok := s.(string); ok {
+				scopes = append(scopes, value)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
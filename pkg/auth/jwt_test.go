@@ -0,0 +1,131 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1600000000, 0)
+
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "alice",
+		"iss":   "https://issuer.example.com",
+		"aud":   []string{"openfaas"},
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"scope": "read write",
+	}
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/function/nodeinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func Test_JWTAuthenticator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	authenticator := NewJWTAuthenticator(StaticKeySet{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}, "https://issuer.example.com", "openfaas")
+	authenticator.now = func() time.Time { return testNow }
+
+	expired := testClaims()
+	expired["exp"] = testNow.Add(-time.Hour).Unix()
+	wrongAudience := testClaims()
+	wrongAudience["aud"] = "other"
+	scp := testClaims()
+	delete(scp, "scope")
+	scp["scp"] = []string{"read"}
+
+	cases := []struct {
+		name   string
+		token  string
+		scopes []string
+		err    bool
+	}{
+		{name: "RS256", token: signToken(t, "RS256", "rsa", rsaKey, testClaims()), scopes: []string{"read", "write"}},
+		{name: "ES256", token: signToken(t, "ES256", "ec", ecKey, testClaims()), scopes: []string{"read", "write"}},
+		{name: "scp claim", token: signToken(t, "RS256", "rsa", rsaKey, scp), scopes: []string{"read"}},
+		{name: "unknown key", token: signToken(t, "RS256", "other", otherKey, testClaims()), err: true},
+		{name: "wrong key", token: signToken(t, "RS256", "rsa", otherKey, testClaims()), err: true},
+		{name: "key of another type", token: signToken(t, "RS256", "ec", rsaKey, testClaims()), err: true},
+		{name: "expired", token: signToken(t, "RS256", "rsa", rsaKey, expired), err: true},
+		{name: "wrong audience", token: signToken(t, "RS256", "rsa", rsaKey, wrongAudience), err: true},
+		{name: "alg none", token: "eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9.", err: true},
+		{name: "malformed", token: "abc", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := authenticator.Authenticate(bearerRequest(tc.token), "openfaas-fn")
+			if tc.err {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("want ErrInvalidCredentials, got: %v, %v", identity, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if identity.Subject != "alice" || identity.Method != MethodJWT || !identity.HasScopes(tc.scopes) {
+				t.Errorf("want alice with scopes %v, got: %+v", tc.scopes, identity)
+			}
+		})
+	}
+}
+
+func Test_JWTAuthenticator_NoBearer(t *testing.T) {
+	authenticator := NewJWTAuthenticator(StaticKeySet{}, "", "")
+
+	r := httptest.NewRequest(http.MethodPost, "/function/nodeinfo", nil)
+	r.Header.Set("Authorization", "Basic YWxpY2U6cGFzcw==")
+
+	identity, err := authenticator.Authenticate(r, "openfaas-fn")
+	if identity != nil || err != nil {
+		t.Errorf("want no identity and no error, got: %v, %v", identity, err)
+	}
+}
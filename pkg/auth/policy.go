@@ -0,0 +1,138 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// VerbRead lists functions and reads their replicas, revisions and blue/green status
+	VerbRead = "read"
+	// VerbDeploy deploys, updates, rolls back and promotes functions
+	VerbDeploy = "deploy"
+	// VerbDelete deletes functions
+	VerbDelete = "delete"
+	// VerbScale sets the replicas of functions
+	VerbScale = "scale"
+	// VerbSecrets lists, creates, updates and deletes secrets
+	VerbSecrets = "secrets"
+	// VerbLogs reads the logs of functions
+	VerbLogs = "logs"
+	// VerbNamespaces creates, updates and deletes namespaces
+	VerbNamespaces = "namespaces"
+)
+
+const (
+	// SubjectAny matches every authenticated caller, or every namespace or verb
+	SubjectAny = "*"
+
+	// SubjectAnonymous matches the callers without an identity, such as the gateway
+	// when it scales functions from zero
+	SubjectAnonymous = "anonymous"
+
+	// subjectScopePrefix matches the callers with a scope, as in scope:<name>
+	subjectScopePrefix = "scope:"
+)
+
+var validVerbs = map[string]bool{
+	VerbRead:       true,
+	VerbDeploy:     true,
+	VerbDelete:     true,
+	VerbScale:      true,
+	VerbSecrets:    true,
+	VerbLogs:       true,
+	VerbNamespaces: true,
+	SubjectAny:     true,
+}
+
+// PolicyRule grants the verbs in the namespaces to the subjects. A subject is the
+// method and subject of an identity, such as jwt:alice or api-key:ci, scope:<name>,
+// SubjectAny or SubjectAnonymous.
+type PolicyRule struct {
+	Subjects   []string `json:"subjects"`
+	Namespaces []string `json:"namespaces"`
+	Verbs      []string `json:"verbs"`
+}
+
+// Policy maps the callers of the REST API to the namespaces and verbs that they may use,
+// anything that no rule grants is denied
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// LoadPolicy reads a Policy from a YAML or JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a Policy from YAML or JSON
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %s", err.Error())
+	}
+
+	for i, rule := range policy.Rules {
+		if len(rule.Subjects) == 0 || len(rule.Namespaces) == 0 || len(rule.Verbs) == 0 {
+			return nil, fmt.Errorf("invalid policy: rules[%d] needs subjects, namespaces and verbs", i)
+		}
+		for _, verb := range rule.Verbs {
+			if !validVerbs[verb] {
+				return nil, fmt.Errorf("invalid policy: rules[%d] has unknown verb %q", i, verb)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Allows returns true when a rule grants verb in namespace to identity, identity is
+// nil for anonymous callers
+func (p *Policy) Allows(identity *Identity, namespace, verb string) bool {
+	for _, rule := range p.Rules {
+		if matchesSubject(rule.Subjects, identity) && contains(rule.Namespaces, namespace) && contains(rule.Verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSubject(subjects []string, identity *Identity) bool {
+	for _, subject := range subjects {
+		if identity == nil {
+			if subject == SubjectAnonymous {
+				return true
+			}
+			continue
+		}
+
+		switch {
+		case subject == SubjectAny, subject == identity.String():
+			return true
+		case strings.HasPrefix(subject, subjectScopePrefix):
+			if identity.HasScopes([]string{strings.TrimPrefix(subject, subjectScopePrefix)}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == SubjectAny || v == value {
+			return true
+		}
+	}
+	return false
+}
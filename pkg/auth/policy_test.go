@@ -0,0 +1,81 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"testing"
+)
+
+const testPolicy = `
+rules:
+- subjects: ["jwt:alice", "scope:team-a"]
+  namespaces: ["team-a"]
+  verbs: ["read", "deploy", "delete", "logs"]
+- subjects: ["api-key:ci"]
+  namespaces: ["*"]
+  verbs: ["*"]
+- subjects: ["anonymous"]
+  namespaces: ["*"]
+  verbs: ["scale"]
+`
+
+func Test_Policy_Allows(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	alice := &Identity{Subject: "alice", Method: MethodJWT}
+	bob := &Identity{Subject: "bob", Method: MethodJWT, Scopes: []string{"team-a"}}
+	mallory := &Identity{Subject: "mallory", Method: MethodJWT}
+	ci := &Identity{Subject: "ci", Method: MethodAPIKey}
+	ciJWT := &Identity{Subject: "ci", Method: MethodJWT}
+
+	cases := []struct {
+		name      string
+		identity  *Identity
+		namespace string
+		verb      string
+		want      bool
+	}{
+		{name: "subject", identity: alice, namespace: "team-a", verb: VerbDeploy, want: true},
+		{name: "other namespace", identity: alice, namespace: "team-b", verb: VerbDeploy},
+		{name: "verb not granted", identity: alice, namespace: "team-a", verb: VerbSecrets},
+		{name: "read", identity: alice, namespace: "team-a", verb: VerbRead, want: true},
+		{name: "read other namespace", identity: alice, namespace: "team-b", verb: VerbRead},
+		{name: "anonymous read", namespace: "openfaas-fn", verb: VerbRead},
+		{name: "scope", identity: bob, namespace: "team-a", verb: VerbLogs, want: true},
+		{name: "no rule", identity: mallory, namespace: "team-a", verb: VerbDeploy},
+		{name: "wildcards", identity: ci, namespace: "team-b", verb: VerbSecrets, want: true},
+		{name: "same subject with another method", identity: ciJWT, namespace: "team-b", verb: VerbSecrets},
+		{name: "anonymous scale", namespace: "openfaas-fn", verb: VerbScale, want: true},
+		{name: "anonymous deploy", namespace: "openfaas-fn", verb: VerbDeploy},
+		{name: "anonymous is not authenticated", identity: mallory, namespace: "openfaas-fn", verb: VerbScale},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := policy.Allows(tc.identity, tc.namespace, tc.verb); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParsePolicy_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown verb":   `rules: [{subjects: ["*"], namespaces: ["*"], verbs: ["admin"]}]`,
+		"no namespaces":  `rules: [{subjects: ["*"], verbs: ["deploy"]}]`,
+		"unknown field":  `rules: [{subject: ["*"], namespaces: ["*"], verbs: ["deploy"]}]`,
+		"not a document": `- rules`,
+	}
+
+	for name, policy := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePolicy([]byte(policy)); err == nil {
+				t.Errorf("want error")
+			}
+		})
+	}
+}
@@ -6,8 +6,11 @@ package config
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	ftypes "github.com/openfaas/faas-provider/types"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 var validPullPolicyOptions = map[string]bool{
@@ -16,6 +19,12 @@ var validPullPolicyOptions = map[string]bool{
 	"Never":        true,
 }
 
+var validNetworkPolicyModes = map[string]bool{
+	"":          true,
+	"function":  true,
+	"namespace": true,
+}
+
 // ReadConfig constitutes config from env variables
 type ReadConfig struct {
 }
@@ -51,6 +60,71 @@ func (ReadConfig) Read(hasEnv ftypes.HasEnv) (BootstrapConfig, error) {
 	cfg.ProfilesNamespace = ftypes.ParseString(hasEnv.Getenv("profiles_namespace"), cfg.DefaultFunctionNamespace)
 	cfg.ClusterRole = ftypes.ParseBoolValue(hasEnv.Getenv("cluster_role"), false)
 
+	cfg.WebhookEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("webhook_enabled"), false)
+	cfg.WebhookPort = ftypes.ParseIntValue(hasEnv.Getenv("webhook_port"), 8443)
+	cfg.WebhookNamespace = ftypes.ParseString(hasEnv.Getenv("webhook_namespace"), "openfaas")
+	cfg.WebhookService = ftypes.ParseString(hasEnv.Getenv("webhook_service"), "faas-netes-webhook")
+	cfg.WebhookName = ftypes.ParseString(hasEnv.Getenv("webhook_name"), "openfaas-functions")
+	cfg.WebhookSecret = ftypes.ParseString(hasEnv.Getenv("webhook_secret"), "faas-netes-webhook-certs")
+
+	cfg.AsyncEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("async_enabled"), false)
+	cfg.AsyncQueueSize = ftypes.ParseIntValue(hasEnv.Getenv("async_queue_size"), 1000)
+	cfg.AsyncMaxWorkers = ftypes.ParseIntValue(hasEnv.Getenv("async_max_workers"), 100)
+	cfg.AsyncMaxInflight = ftypes.ParseIntValue(hasEnv.Getenv("async_max_inflight"), 10)
+	cfg.AsyncMaxRetries = ftypes.ParseIntValue(hasEnv.Getenv("async_max_retries"), 3)
+	cfg.AsyncRetryBackoff = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("async_retry_backoff"), time.Second)
+
+	cfg.CronEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("cron_enabled"), false)
+
+	cfg.TriggersEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("triggers_enabled"), false)
+	for _, namespace := range strings.Split(hasEnv.Getenv("triggers_namespaces"), ",") {
+		if namespace = strings.TrimSpace(namespace); len(namespace) > 0 {
+			cfg.TriggersNamespaces = append(cfg.TriggersNamespaces, namespace)
+		}
+	}
+
+	cfg.NetworkPolicyMode = hasEnv.Getenv("network_policy_mode")
+	if !validNetworkPolicyModes[cfg.NetworkPolicyMode] {
+		return cfg, fmt.Errorf("invalid network_policy_mode configured: %s", cfg.NetworkPolicyMode)
+	}
+	cfg.NetworkPolicyNamespaceSelector = ftypes.ParseString(hasEnv.Getenv("network_policy_namespace_selector"), "role=openfaas-system")
+	if _, err := labels.Parse(cfg.NetworkPolicyNamespaceSelector); err != nil {
+		return cfg, fmt.Errorf("invalid network_policy_namespace_selector configured: %s", err.Error())
+	}
+	cfg.NetworkPolicyPodSelector = ftypes.ParseString(hasEnv.Getenv("network_policy_pod_selector"), "app=gateway")
+	if _, err := labels.Parse(cfg.NetworkPolicyPodSelector); err != nil {
+		return cfg, fmt.Errorf("invalid network_policy_pod_selector configured: %s", err.Error())
+	}
+
+	cfg.ConnectorNATSURL = hasEnv.Getenv("connector_nats_url")
+	cfg.ConnectorQueueGroup = ftypes.ParseString(hasEnv.Getenv("connector_queue_group"), "faas-netes")
+	cfg.ConnectorDeadLetterTopic = ftypes.ParseString(hasEnv.Getenv("connector_dead_letter_topic"), "faas-netes.dead-letter")
+	cfg.ConnectorMaxRetries = ftypes.ParseIntValue(hasEnv.Getenv("connector_max_retries"), 3)
+	cfg.ConnectorRetryBackoff = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("connector_retry_backoff"), time.Second)
+
+	cfg.AuthJWKS = hasEnv.Getenv("auth_jwks")
+	cfg.AuthJWTIssuer = hasEnv.Getenv("auth_jwt_issuer")
+	cfg.AuthJWTAudience = hasEnv.Getenv("auth_jwt_audience")
+	cfg.AuthAPIKeysEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("auth_api_keys_enabled"), false)
+	cfg.AuthPolicy = hasEnv.Getenv("auth_policy")
+
+	cfg.AuditLog = hasEnv.Getenv("audit_log")
+	cfg.AuditEvents = ftypes.ParseBoolValue(hasEnv.Getenv("audit_events"), false)
+
+	cfg.SecretStore = hasEnv.Getenv("secret_store")
+	cfg.SecretStoreURL = hasEnv.Getenv("secret_store_url")
+	cfg.SecretStoreTokenFile = hasEnv.Getenv("secret_store_token_file")
+	cfg.SecretStoreKeyFile = hasEnv.Getenv("secret_store_key_file")
+	cfg.SecretStoreMount = hasEnv.Getenv("secret_store_mount")
+	if len(cfg.SecretStoreMount) == 0 {
+		cfg.SecretStoreMount = "secret"
+	}
+	cfg.SecretStoreTTL = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("secret_store_ttl"), 5*time.Minute)
+
+	cfg.LogCollectorEnabled = ftypes.ParseBoolValue(hasEnv.Getenv("log_collector_enabled"), false)
+	cfg.LogRetentionBytes = ftypes.ParseIntValue(hasEnv.Getenv("log_retention_bytes"), 1024*1024)
+	cfg.LogRetentionPeriod = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("log_retention_period"), 24*time.Hour)
+
 	cfg.HTTPProbe = httpProbe
 	cfg.SetNonRootUser = setNonRootUser
 
@@ -120,6 +194,170 @@ type BootstrapConfig struct {
 
 	// ClusterRole determines whether the operator should have cluster wide access
 	ClusterRole bool
+
+	// WebhookEnabled starts the validating and mutating admission webhook for
+	// Functions and Profiles. Value is set via the webhook_enabled environment variable.
+	WebhookEnabled bool
+
+	// WebhookPort is the HTTPS port that the admission webhook listens on.
+	WebhookPort int
+
+	// WebhookNamespace is the namespace of the webhook Service and certificate Secret.
+	WebhookNamespace string
+
+	// WebhookService is the name of the Service that routes to the admission webhook.
+	WebhookService string
+
+	// WebhookName is the name of the ValidatingWebhookConfiguration and
+	// MutatingWebhookConfiguration registered with the API server.
+	WebhookName string
+
+	// WebhookSecret is the Secret used to store the self-signed webhook certificates.
+	WebhookSecret string
+
+	// AsyncEnabled serves the /async-function/ endpoint, which queues invocations in
+	// memory and dispatches them in the background.
+	// Value is set via the async_enabled environment variable.
+	AsyncEnabled bool
+
+	// AsyncQueueSize is the number of invocations that can be queued before new
+	// invocations are rejected.
+	AsyncQueueSize int
+
+	// AsyncMaxWorkers is the number of queued invocations that are dispatched at the
+	// same time across all functions.
+	AsyncMaxWorkers int
+
+	// AsyncMaxInflight is the number of queued invocations of a single function that
+	// are dispatched at the same time.
+	AsyncMaxInflight int
+
+	// AsyncMaxRetries is the number of times an invocation is retried when the function
+	// is unavailable.
+	AsyncMaxRetries int
+
+	// AsyncRetryBackoff is the delay before the first retry, it doubles for each retry.
+	AsyncRetryBackoff time.Duration
+
+	// CronEnabled invokes functions with the cron-function topic on the schedule set in
+	// their schedule annotation.
+	// Value is set via the cron_enabled environment variable.
+	CronEnabled bool
+
+	// TriggersEnabled invokes functions on the cluster events that are set in their
+	// com.openfaas.trigger.k8s annotation.
+	// Value is set via the triggers_enabled environment variable.
+	TriggersEnabled bool
+
+	// TriggersNamespaces are the namespaces, other than their own, that the triggers of
+	// functions may watch. * allows every namespace.
+	// Value is set via the triggers_namespaces environment variable, separated by commas.
+	TriggersNamespaces []string
+
+	// NetworkPolicyMode is function to create a NetworkPolicy for each function or
+	// namespace to create one for each namespace with functions, no policies are
+	// created when it is empty.
+	// Value is set via the network_policy_mode environment variable.
+	NetworkPolicyMode string
+
+	// NetworkPolicyNamespaceSelector selects the namespace of the Pods that may invoke
+	// functions when NetworkPolicyMode is set.
+	NetworkPolicyNamespaceSelector string
+
+	// NetworkPolicyPodSelector selects the Pods that may invoke functions when
+	// NetworkPolicyMode is set, which are the gateway and faas-netes.
+	NetworkPolicyPodSelector string
+
+	// ConnectorNATSURL is the NATS server that the built-in connector subscribes to,
+	// the connector is disabled when it is empty.
+	// Value is set via the connector_nats_url environment variable.
+	ConnectorNATSURL string
+
+	// ConnectorQueueGroup is the NATS queue group of the subscriptions, so that each
+	// message is delivered once across replicas.
+	ConnectorQueueGroup string
+
+	// ConnectorDeadLetterTopic receives the messages that could not be delivered.
+	ConnectorDeadLetterTopic string
+
+	// ConnectorMaxRetries is the number of times a delivery is retried when the
+	// function is unavailable.
+	ConnectorMaxRetries int
+
+	// ConnectorRetryBackoff is the delay before the first retry, it doubles for each retry.
+	ConnectorRetryBackoff time.Duration
+
+	// AuthJWKS is the file or http(s) URL of the JSON Web Key Set that bearer tokens
+	// are verified with, bearer tokens are not accepted when it is empty.
+	// Value is set via the auth_jwks environment variable.
+	AuthJWKS string
+
+	// AuthJWTIssuer is the iss claim that bearer tokens must have, when set.
+	AuthJWTIssuer string
+
+	// AuthJWTAudience is the aud claim that bearer tokens must have, when set.
+	AuthJWTAudience string
+
+	// AuthAPIKeysEnabled accepts the API keys held in the Secrets with the
+	// openfaas.com/api-key label in the namespace of the function.
+	// Value is set via the auth_api_keys_enabled environment variable.
+	AuthAPIKeysEnabled bool
+
+	// AuthPolicy is the file with the rules that map the callers of the REST API to the
+	// namespaces and verbs they may use, every caller may use the whole API when it
+	// is empty.
+	// Value is set via the auth_policy environment variable.
+	AuthPolicy string
+
+	// AuditLog is where the audit records of the calls that change functions and
+	// secrets are written as JSON lines, either a file or stdout.
+	// Value is set via the audit_log environment variable.
+	AuditLog string
+
+	// AuditEvents records the audit records as Kubernetes Events on the Deployments
+	// of functions and on secrets.
+	// Value is set via the audit_events environment variable.
+	AuditEvents bool
+
+	// SecretStore is the backend that holds the values of function secrets, either
+	// vault or file. Kubernetes Secrets are the store when it is empty.
+	// Value is set via the secret_store environment variable.
+	SecretStore string
+
+	// SecretStoreURL is the address of the Vault server, or the path of the encrypted
+	// file of the file store.
+	// Value is set via the secret_store_url environment variable.
+	SecretStoreURL string
+
+	// SecretStoreTokenFile is the file with the token used to call Vault.
+	// Value is set via the secret_store_token_file environment variable.
+	SecretStoreTokenFile string
+
+	// SecretStoreKeyFile is the file with the AES-256 key of the file store.
+	// Value is set via the secret_store_key_file environment variable.
+	SecretStoreKeyFile string
+
+	// SecretStoreMount is the path of the KV version 2 secrets engine in Vault.
+	// Value is set via the secret_store_mount environment variable.
+	SecretStoreMount string
+
+	// SecretStoreTTL is how long the Kubernetes Secrets that are materialised from the
+	// store are used before they are refreshed.
+	// Value is set via the secret_store_ttl environment variable.
+	SecretStoreTTL time.Duration
+
+	// LogCollectorEnabled tails the logs of all function Pods into a local store, so that
+	// they can be read after the Pods are gone.
+	// Value is set via the log_collector_enabled environment variable.
+	LogCollectorEnabled bool
+
+	// LogRetentionBytes is the size of the log messages kept for each function.
+	// Value is set via the log_retention_bytes environment variable.
+	LogRetentionBytes int
+
+	// LogRetentionPeriod is how long log messages are kept.
+	// Value is set via the log_retention_period environment variable.
+	LogRetentionPeriod time.Duration
 }
 
 // Fprint pretty-prints the config with the stdlib logger. One line per config value.
@@ -144,5 +382,57 @@ func (c BootstrapConfig) Fprint(verbose bool) {
 		log.Printf("LivenessProbeTimeoutSeconds: %d\n", c.LivenessProbeTimeoutSeconds)
 		log.Printf("LivenessProbePeriodSeconds: %d\n", c.LivenessProbePeriodSeconds)
 		log.Printf("ClusterRole: %v\n", c.ClusterRole)
+		log.Printf("WebhookEnabled: %v\n", c.WebhookEnabled)
+		if c.WebhookEnabled {
+			log.Printf("WebhookPort: %d\n", c.WebhookPort)
+			log.Printf("WebhookService: %s.%s\n", c.WebhookService, c.WebhookNamespace)
+			log.Printf("WebhookName: %s\n", c.WebhookName)
+			log.Printf("WebhookSecret: %s\n", c.WebhookSecret)
+		}
+		log.Printf("AsyncEnabled: %v\n", c.AsyncEnabled)
+		if c.AsyncEnabled {
+			log.Printf("AsyncQueueSize: %d\n", c.AsyncQueueSize)
+			log.Printf("AsyncMaxWorkers: %d\n", c.AsyncMaxWorkers)
+			log.Printf("AsyncMaxInflight: %d\n", c.AsyncMaxInflight)
+			log.Printf("AsyncMaxRetries: %d\n", c.AsyncMaxRetries)
+			log.Printf("AsyncRetryBackoff: %s\n", c.AsyncRetryBackoff)
+		}
+		log.Printf("CronEnabled: %v\n", c.CronEnabled)
+		log.Printf("TriggersEnabled: %v\n", c.TriggersEnabled)
+		if c.TriggersEnabled {
+			log.Printf("TriggersNamespaces: %v\n", c.TriggersNamespaces)
+		}
+		log.Printf("NetworkPolicyMode: %s\n", c.NetworkPolicyMode)
+		if len(c.NetworkPolicyMode) > 0 {
+			log.Printf("NetworkPolicyNamespaceSelector: %s\n", c.NetworkPolicyNamespaceSelector)
+			log.Printf("NetworkPolicyPodSelector: %s\n", c.NetworkPolicyPodSelector)
+		}
+		if len(c.ConnectorNATSURL) > 0 {
+			log.Printf("ConnectorNATSURL: %s\n", c.ConnectorNATSURL)
+			log.Printf("ConnectorQueueGroup: %s\n", c.ConnectorQueueGroup)
+			log.Printf("ConnectorDeadLetterTopic: %s\n", c.ConnectorDeadLetterTopic)
+			log.Printf("ConnectorMaxRetries: %d\n", c.ConnectorMaxRetries)
+			log.Printf("ConnectorRetryBackoff: %s\n", c.ConnectorRetryBackoff)
+		}
+		if len(c.AuthJWKS) > 0 {
+			log.Printf("AuthJWKS: %s\n", c.AuthJWKS)
+			log.Printf("AuthJWTIssuer: %s\n", c.AuthJWTIssuer)
+			log.Printf("AuthJWTAudience: %s\n", c.AuthJWTAudience)
+		}
+		log.Printf("AuthAPIKeysEnabled: %v\n", c.AuthAPIKeysEnabled)
+		log.Printf("AuthPolicy: %s\n", c.AuthPolicy)
+		log.Printf("AuditLog: %s\n", c.AuditLog)
+		log.Printf("AuditEvents: %v\n", c.AuditEvents)
+		if len(c.SecretStore) > 0 {
+			log.Printf("SecretStore: %s\n", c.SecretStore)
+			log.Printf("SecretStoreURL: %s\n", c.SecretStoreURL)
+			log.Printf("SecretStoreMount: %s\n", c.SecretStoreMount)
+			log.Printf("SecretStoreTTL: %s\n", c.SecretStoreTTL)
+		}
+		log.Printf("LogCollectorEnabled: %v\n", c.LogCollectorEnabled)
+		if c.LogCollectorEnabled {
+			log.Printf("LogRetentionBytes: %d\n", c.LogRetentionBytes)
+			log.Printf("LogRetentionPeriod: %s\n", c.LogRetentionPeriod)
+		}
 	}
 }
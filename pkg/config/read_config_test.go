@@ -6,6 +6,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 type EnvBucket struct {
@@ -102,3 +103,154 @@ func TestRead_ImagePullPolicy_empty(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRead_NetworkPolicyMode(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("network_policy_mode", "namespace")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.NetworkPolicyMode != "namespace" {
+		t.Errorf("NetworkPolicyMode incorrect, want: namespace, got: %s", config.NetworkPolicyMode)
+	}
+	if config.NetworkPolicyPodSelector != "app=gateway" {
+		t.Errorf("NetworkPolicyPodSelector incorrect, want: app=gateway, got: %s", config.NetworkPolicyPodSelector)
+	}
+
+	defaults.Setenv("network_policy_mode", "pod")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want error for an invalid network_policy_mode")
+	}
+}
+
+func TestRead_Auth(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if len(config.AuthJWKS) > 0 || config.AuthAPIKeysEnabled {
+		t.Errorf("want authentication to be disabled by default, got: %q, %v", config.AuthJWKS, config.AuthAPIKeysEnabled)
+	}
+
+	defaults.Setenv("auth_jwks", "https://issuer.example.com/.well-known/jwks.json")
+	defaults.Setenv("auth_jwt_audience", "openfaas")
+	defaults.Setenv("auth_api_keys_enabled", "true")
+	defaults.Setenv("auth_policy", "/var/openfaas/auth/policy.yaml")
+
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.AuthJWKS != "https://issuer.example.com/.well-known/jwks.json" || config.AuthJWTAudience != "openfaas" || !config.AuthAPIKeysEnabled {
+		t.Errorf("want the auth config to be read, got: %q, %q, %v", config.AuthJWKS, config.AuthJWTAudience, config.AuthAPIKeysEnabled)
+	}
+	if config.AuthPolicy != "/var/openfaas/auth/policy.yaml" {
+		t.Errorf("AuthPolicy incorrect, want: /var/openfaas/auth/policy.yaml, got: %s", config.AuthPolicy)
+	}
+}
+
+func TestRead_Audit(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if len(config.AuditLog) > 0 || config.AuditEvents {
+		t.Errorf("want auditing to be disabled by default, got: %q, %v", config.AuditLog, config.AuditEvents)
+	}
+
+	defaults.Setenv("audit_log", "stdout")
+	defaults.Setenv("audit_events", "true")
+
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.AuditLog != "stdout" || !config.AuditEvents {
+		t.Errorf("want the audit config to be read, got: %q, %v", config.AuditLog, config.AuditEvents)
+	}
+}
+
+func TestRead_SecretStore(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if len(config.SecretStore) > 0 || config.SecretStoreMount != "secret" || config.SecretStoreTTL != 5*time.Minute {
+		t.Errorf("want Kubernetes Secrets with the default mount and TTL, got: %q, %q, %s", config.SecretStore, config.SecretStoreMount, config.SecretStoreTTL)
+	}
+
+	defaults.Setenv("secret_store", "vault")
+	defaults.Setenv("secret_store_url", "http://vault:8200")
+	defaults.Setenv("secret_store_token_file", "/var/secrets/vault-token")
+	defaults.Setenv("secret_store_mount", "kv")
+	defaults.Setenv("secret_store_ttl", "1m")
+
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.SecretStore != "vault" || config.SecretStoreURL != "http://vault:8200" || config.SecretStoreTokenFile != "/var/secrets/vault-token" ||
+		config.SecretStoreMount != "kv" || config.SecretStoreTTL != time.Minute {
+		t.Errorf("want the secret store config to be read, got: %+v", config)
+	}
+}
+
+func TestRead_LogCollector(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.LogCollectorEnabled || config.LogRetentionBytes != 1024*1024 || config.LogRetentionPeriod != 24*time.Hour {
+		t.Errorf("want the log collector disabled with the default retention, got: %v, %d, %s", config.LogCollectorEnabled, config.LogRetentionBytes, config.LogRetentionPeriod)
+	}
+
+	defaults.Setenv("log_collector_enabled", "true")
+	defaults.Setenv("log_retention_bytes", "4096")
+	defaults.Setenv("log_retention_period", "1h")
+
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if !config.LogCollectorEnabled || config.LogRetentionBytes != 4096 || config.LogRetentionPeriod != time.Hour {
+		t.Errorf("want the log collector config to be read, got: %v, %d, %s", config.LogCollectorEnabled, config.LogRetentionBytes, config.LogRetentionPeriod)
+	}
+}
+
+func TestRead_TriggersNamespaces(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if len(config.TriggersNamespaces) != 0 {
+		t.Errorf("want no trigger namespaces by default, got: %v", config.TriggersNamespaces)
+	}
+
+	defaults.Setenv("triggers_namespaces", "batch, ,etl")
+
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if len(config.TriggersNamespaces) != 2 || config.TriggersNamespaces[0] != "batch" || config.TriggersNamespaces[1] != "etl" {
+		t.Errorf("want the trigger namespaces to be read, got: %v", config.TriggersNamespaces)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/openfaas/faas-netes/pkg/cron"
+)
+
+// MessageHandler receives the messages of a topic
+type MessageHandler func(ctx context.Context, topic string, body []byte, header http.Header)
+
+// Connector subscribes to the topics of an event source such as NATS, Kafka or MQTT
+// and passes their messages to a MessageHandler
+type Connector interface {
+	// Subscribe starts passing the messages of topic to handler
+	Subscribe(topic string, handler MessageHandler) error
+
+	// Unsubscribe stops passing the messages of topic
+	Unsubscribe(topic string) error
+}
+
+// Run keeps the subscriptions of connector in line with the topics of topics and
+// delivers their messages with invoker, until stopCh is closed. The cron-function
+// topic is left to the scheduler.
+func Run(connector Connector, topics *TopicMap, invoker *Invoker, stopCh <-chan struct{}) {
+	handler := func(ctx context.Context, topic string, body []byte, header http.Header) {
+		invoker.Invoke(ctx, topic, body, header)
+	}
+
+	subscribed := map[string]bool{}
+	resubscribe := func() {
+		wanted := map[string]bool{}
+		for _, topic := range topics.Topics() {
+			if topic == cron.CronTopic {
+				continue
+			}
+			wanted[topic] = true
+
+			if subscribed[topic] {
+				continue
+			}
+			if err := connector.Subscribe(topic, handler); err != nil {
+				log.Printf("Unable to subscribe to %s: %s\n", topic, err.Error())
+				continue
+			}
+			log.Printf("Subscribed to %s\n", topic)
+			subscribed[topic] = true
+		}
+
+		for topic := range subscribed {
+			if wanted[topic] {
+				continue
+			}
+			if err := connector.Unsubscribe(topic); err != nil {
+				log.Printf("Unable to unsubscribe from %s: %s\n", topic, err.Error())
+				continue
+			}
+			log.Printf("Unsubscribed from %s\n", topic)
+			delete(subscribed, topic)
+		}
+	}
+
+	resubscribe()
+	for {
+		select {
+		case <-topics.Changed():
+			resubscribe()
+		case <-stopCh:
+			for topic := range subscribed {
+				connector.Unsubscribe(topic)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas-provider/proxy"
+)
+
+// InvokerConfig configures how an Invoker retries failed invocations
+type InvokerConfig struct {
+	// MaxRetries is the number of times an invocation is retried when the function is
+	// unavailable, before the message is sent to the dead-letter queue
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, it doubles for each retry
+	RetryBackoff time.Duration
+}
+
+// DeadLetter is a message that could not be delivered to a function
+type DeadLetter struct {
+	Topic    string      `json:"topic"`
+	Function string      `json:"function"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body"`
+
+	// Status is the status code of the last attempt, it is 0 when the function could
+	// not be reached
+	Status   int       `json:"status"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Failed   time.Time `json:"failed"`
+}
+
+// DeadLetterQueue receives the messages that could not be delivered to a function
+type DeadLetterQueue interface {
+	Send(letter DeadLetter) error
+}
+
+// Result is the outcome of delivering a message to a function
+type Result struct {
+	Function string
+	Status   int
+	Body     []byte
+	Header   http.Header
+	Duration time.Duration
+	Error    error
+}
+
+// Invoker delivers the messages of a topic to the functions that subscribe to it
+type Invoker struct {
+	topics     *TopicMap
+	resolver   proxy.BaseURLResolver
+	client     *http.Client
+	config     InvokerConfig
+	deadLetter DeadLetterQueue
+}
+
+// NewInvoker creates an Invoker that resolves functions with resolver, deadLetter can
+// be nil in which case undelivered messages are only logged
+func NewInvoker(topics *TopicMap, resolver proxy.BaseURLResolver, client *http.Client, config InvokerConfig, deadLetter DeadLetterQueue) *Invoker {
+	return &Invoker{
+		topics:     topics,
+		resolver:   resolver,
+		client:     client,
+		config:     config,
+		deadLetter: deadLetter,
+	}
+}
+
+// Invoke delivers a message to every function that subscribes to topic and returns
+// the result of each function. It can be used as the MessageHandler of a Connector.
+func (i *Invoker) Invoke(ctx context.Context, topic string, body []byte, header http.Header) []Result {
+	functions := i.topics.Match(topic)
+	results := make([]Result, len(functions))
+
+	for n, function := range functions {
+		results[n] = i.deliver(ctx, topic, function, body, header)
+	}
+	return results
+}
+
+// deliver invokes a function, retrying with a backoff while it is unavailable, and
+// sends the message to the dead-letter queue when it still could not be delivered
+func (i *Invoker) deliver(ctx context.Context, topic, function string, body []byte, header http.Header) Result {
+	var res Result
+	attempts := 0
+
+	for {
+		res = i.invoke(ctx, topic, function, body, header)
+		attempts++
+
+		if !retryable(res) || attempts > i.config.MaxRetries {
+			break
+		}
+
+		delay := i.config.RetryBackoff * time.Duration(1<<uint(attempts-1))
+		log.Printf("Delivery of %s to %s will be retried in %s: %s\n", topic, function, delay, describe(res))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			res.Error = ctx.Err()
+			return res
+		}
+	}
+
+	if res.Error == nil && res.Status >= 200 && res.Status < 300 {
+		return res
+	}
+
+	log.Printf("Delivery of %s to %s failed after %d attempt(s): %s\n", topic, function, attempts, describe(res))
+
+	if i.deadLetter != nil {
+		letter := DeadLetter{
+			Topic:    topic,
+			Function: function,
+			Header:   header,
+			Body:     body,
+			Status:   res.Status,
+			Attempts: attempts,
+			Failed:   time.Now().UTC(),
+		}
+		if res.Error != nil {
+			letter.Error = res.Error.Error()
+		} else {
+			letter.Error = string(res.Body)
+		}
+
+		if err := i.deadLetter.Send(letter); err != nil {
+			log.Printf("Unable to send %s for %s to the dead-letter queue: %s\n", topic, function, err.Error())
+		}
+	}
+
+	return res
+}
+
+func (i *Invoker) invoke(ctx context.Context, topic, function string, body []byte, header http.Header) Result {
+	res := Result{Function: function}
+
+	functionURL, err := i.resolver.Resolve(function)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	functionURL.Path = "/"
+
+	req, err := http.NewRequest(http.MethodPost, functionURL.String(), bytes.NewReader(body))
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Topic", topic)
+
+	start := time.Now()
+	httpRes, err := i.client.Do(req.WithContext(ctx))
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	defer httpRes.Body.Close()
+
+	res.Status = httpRes.StatusCode
+	res.Header = httpRes.Header
+	res.Duration = time.Since(start)
+	res.Body, res.Error = ioutil.ReadAll(httpRes.Body)
+	return res
+}
+
+// retryable returns true when the function could not be reached or was overloaded,
+// errors returned by the function itself are not retried
+func retryable(res Result) bool {
+	if res.Error != nil {
+		return true
+	}
+
+	switch res.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func describe(res Result) string {
+	if res.Error != nil {
+		return res.Error.Error()
+	}
+	return fmt.Sprintf("status %d in %s", res.Status, res.Duration)
+}
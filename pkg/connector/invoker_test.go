@@ -0,0 +1,85 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+type memoryDeadLetterQueue struct {
+	lock    sync.Mutex
+	letters []DeadLetter
+}
+
+func (q *memoryDeadLetterQueue) Send(letter DeadLetter) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.letters = append(q.letters, letter)
+	return nil
+}
+
+func Test_Invoker_Retries(t *testing.T) {
+	cases := []struct {
+		name           string
+		statuses       []int
+		wantAttempts   int
+		wantDeadLetter bool
+	}{
+		{name: "delivered", statuses: []int{http.StatusOK}, wantAttempts: 1},
+		{name: "delivered after retry", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantAttempts: 2},
+		{name: "function error is not retried", statuses: []int{http.StatusInternalServerError}, wantAttempts: 1, wantDeadLetter: true},
+		{name: "retries exhausted", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, wantAttempts: 3, wantDeadLetter: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Topic") != "payments" {
+					t.Errorf("want X-Topic payments, got: %s", r.Header.Get("X-Topic"))
+				}
+				w.WriteHeader(tc.statuses[attempts])
+				attempts++
+			}))
+			defer srv.Close()
+			srvURL, _ := url.Parse(srv.URL)
+
+			topics := NewTopicMap()
+			topics.Set("orders.openfaas-fn", []string{"payments"})
+			deadLetter := &memoryDeadLetterQueue{}
+
+			invoker := NewInvoker(topics, staticResolver{url: *srvURL}, http.DefaultClient,
+				InvokerConfig{MaxRetries: 2, RetryBackoff: time.Millisecond}, deadLetter)
+
+			results := invoker.Invoke(context.Background(), "payments", []byte("{}"), nil)
+			if len(results) != 1 || results[0].Function != "orders.openfaas-fn" {
+				t.Fatalf("want a result for orders.openfaas-fn, got: %+v", results)
+			}
+
+			if attempts != tc.wantAttempts {
+				t.Errorf("want %d attempt(s), got: %d", tc.wantAttempts, attempts)
+			}
+			if tc.wantDeadLetter != (len(deadLetter.letters) == 1) {
+				t.Fatalf("want dead letter: %v, got: %+v", tc.wantDeadLetter, deadLetter.letters)
+			}
+			if tc.wantDeadLetter && deadLetter.letters[0].Attempts != tc.wantAttempts {
+				t.Errorf("want dead letter after %d attempt(s), got: %d", tc.wantAttempts, deadLetter.letters[0].Attempts)
+			}
+		})
+	}
+}
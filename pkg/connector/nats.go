@@ -0,0 +1,137 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/openfaas/faas-netes/pkg/config"
+	"github.com/openfaas/faas-provider/proxy"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NATSConnector subscribes to NATS subjects named after the topics. Subscriptions
+// join a queue group, so that each message is delivered once when faas-netes runs
+// with more than one replica.
+type NATSConnector struct {
+	conn       *nats.Conn
+	queueGroup string
+
+	lock          sync.Mutex
+	subscriptions map[string]*nats.Subscription
+}
+
+// NewNATSConnector connects to the NATS server at url, reconnecting for as long as
+// faas-netes runs
+func NewNATSConnector(url, queueGroup string) (*NATSConnector, error) {
+	conn, err := nats.Connect(url, nats.Name("faas-netes"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to NATS at %s: %s", url, err.Error())
+	}
+
+	return &NATSConnector{
+		conn:          conn,
+		queueGroup:    queueGroup,
+		subscriptions: map[string]*nats.Subscription{},
+	}, nil
+}
+
+// Subscribe passes the messages of the subject topic to handler, one at a time
+func (c *NATSConnector) Subscribe(topic string, handler MessageHandler) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.subscriptions[topic]; ok {
+		return nil
+	}
+
+	subscription, err := c.conn.QueueSubscribe(topic, c.queueGroup, func(msg *nats.Msg) {
+		handler(context.Background(), msg.Subject, msg.Data, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.subscriptions[topic] = subscription
+	return nil
+}
+
+// Unsubscribe stops passing the messages of the subject topic
+func (c *NATSConnector) Unsubscribe(topic string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	subscription, ok := c.subscriptions[topic]
+	if !ok {
+		return nil
+	}
+
+	delete(c.subscriptions, topic)
+	return subscription.Unsubscribe()
+}
+
+// Close drains the subscriptions and closes the connection
+func (c *NATSConnector) Close() error {
+	return c.conn.Drain()
+}
+
+// DeadLetterQueue returns a DeadLetterQueue that publishes undelivered messages as
+// JSON to subject on the connection of the connector
+func (c *NATSConnector) DeadLetterQueue(subject string) DeadLetterQueue {
+	return &natsDeadLetterQueue{conn: c.conn, subject: subject}
+}
+
+type natsDeadLetterQueue struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (q *natsDeadLetterQueue) Send(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	return q.conn.Publish(q.subject, data)
+}
+
+// StartNATS delivers the messages of the NATS subjects that functions subscribe to with
+// their topic annotation, until stopCh is closed. Functions are found through the
+// Deployments of informer and invoked through resolver with the provider's proxy
+// client. Connecting is retried in the background while the NATS server is unavailable.
+func StartNATS(cfg config.BootstrapConfig, informer cache.SharedIndexInformer, resolver proxy.BaseURLResolver, stopCh <-chan struct{}) {
+	topics := NewTopicMap()
+	topics.Watch(informer)
+
+	go func() {
+		var connector *NATSConnector
+		err := wait.PollImmediateUntil(5*time.Second, func() (bool, error) {
+			var err error
+			if connector, err = NewNATSConnector(cfg.ConnectorNATSURL, cfg.ConnectorQueueGroup); err != nil {
+				log.Printf("%s, retrying\n", err.Error())
+				return false, nil
+			}
+			return true, nil
+		}, stopCh)
+		if err != nil {
+			return
+		}
+		defer connector.Close()
+
+		log.Printf("Connected to NATS at %s\n", cfg.ConnectorNATSURL)
+
+		invoker := NewInvoker(topics, resolver, proxy.NewProxyClientFromConfig(cfg.FaaSConfig), InvokerConfig{
+			MaxRetries:   cfg.ConnectorMaxRetries,
+			RetryBackoff: cfg.ConnectorRetryBackoff,
+		}, connector.DeadLetterQueue(cfg.ConnectorDeadLetterTopic))
+
+		Run(connector, topics, invoker, stopCh)
+	}()
+}
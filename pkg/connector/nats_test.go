@@ -0,0 +1,96 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func Test_NATSConnector_DeliversMessages(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received <- string(body)
+	}))
+	defer srv.Close()
+	srvURL, _ := url.Parse(srv.URL)
+
+	connector, err := NewNATSConnector(server.ClientURL(), "faas-netes")
+	if err != nil {
+		t.Fatalf("want connection to the embedded server, got: %s", err)
+	}
+	defer connector.Close()
+
+	topics := NewTopicMap()
+	invoker := NewInvoker(topics, staticResolver{url: *srvURL}, http.DefaultClient,
+		InvokerConfig{MaxRetries: 0}, connector.DeadLetterQueue("faas-netes.dead-letter"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go Run(connector, topics, invoker, stopCh)
+
+	publisher, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("want publisher connection, got: %s", err)
+	}
+	defer publisher.Close()
+
+	deadLetters, err := publisher.SubscribeSync("faas-netes.dead-letter")
+	if err != nil {
+		t.Fatalf("want dead-letter subscription, got: %s", err)
+	}
+
+	topics.Set("orders.openfaas-fn", []string{"payments"})
+
+	// the subscription is made in the background, so publish until it is delivered
+	deadline := time.Now().Add(5 * time.Second)
+	delivered := false
+	for !delivered && time.Now().Before(deadline) {
+		publisher.Publish("payments", []byte("order-1"))
+		select {
+		case body := <-received:
+			if body != "order-1" {
+				t.Errorf("want order-1, got: %s", body)
+			}
+			delivered = true
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if !delivered {
+		t.Fatalf("want message to be delivered to the function")
+	}
+
+	publisher.Publish("payments", []byte("fail"))
+
+	msg, err := deadLetters.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("want dead letter, got: %s", err)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal(msg.Data, &letter); err != nil {
+		t.Fatalf("want JSON dead letter, got: %s", err)
+	}
+	if letter.Topic != "payments" || letter.Function != "orders.openfaas-fn" || letter.Status != http.StatusInternalServerError || string(letter.Body) != "fail" {
+		t.Errorf("want dead letter of the failed delivery, got: %+v", letter)
+	}
+}
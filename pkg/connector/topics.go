@@ -0,0 +1,154 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-netes/pkg/cron"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TopicMap maps topics to the functions that subscribe to them, in the form
+// <function_name>.<namespace>
+type TopicMap struct {
+	lock sync.RWMutex
+
+	// functions holds the topics of each function
+	functions map[string][]string
+	changed   chan struct{}
+}
+
+// NewTopicMap creates an empty TopicMap
+func NewTopicMap() *TopicMap {
+	return &TopicMap{
+		functions: map[string][]string{},
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+// Watch keeps the TopicMap up to date with the topic annotation of the function
+// Deployments of informer. The annotations of a Function are copied onto its
+// Deployment, so this works both as a controller and as an operator.
+func (m *TopicMap) Watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: m.update,
+		UpdateFunc: func(old, new interface{}) {
+			m.update(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				m.Set(deployment.Name+"."+deployment.Namespace, nil)
+			}
+		},
+	})
+}
+
+func (m *TopicMap) update(obj interface{}) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return
+	}
+
+	function := deployment.Name + "." + deployment.Namespace
+	if !k8s.IsFunctionDeployment(deployment) || k8s.IsCanary(deployment.Name) {
+		m.Set(function, nil)
+		return
+	}
+
+	m.Set(function, ParseTopics(deployment.Annotations[cron.TopicAnnotation]))
+}
+
+// ParseTopics splits the value of the topic annotation
+func ParseTopics(value string) []string {
+	topics := []string{}
+	for _, topic := range strings.Split(value, ",") {
+		if topic = strings.TrimSpace(topic); len(topic) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// Set replaces the topics of a function, a function without topics is removed
+func (m *TopicMap) Set(function string, topics []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if equalTopics(m.functions[function], topics) {
+		return
+	}
+
+	if len(topics) == 0 {
+		delete(m.functions, function)
+	} else {
+		m.functions[function] = topics
+	}
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Match returns the functions that subscribe to topic
+func (m *TopicMap) Match(topic string) []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	functions := []string{}
+	for function, topics := range m.functions {
+		for _, t := range topics {
+			if t == topic {
+				functions = append(functions, function)
+				break
+			}
+		}
+	}
+	sort.Strings(functions)
+	return functions
+}
+
+// Topics returns every topic that a function subscribes to
+func (m *TopicMap) Topics() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	seen := map[string]bool{}
+	topics := []string{}
+	for _, functionTopics := range m.functions {
+		for _, topic := range functionTopics {
+			if !seen[topic] {
+				seen[topic] = true
+				topics = append(topics, topic)
+			}
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Changed receives a value after the TopicMap has changed
+func (m *TopicMap) Changed() <-chan struct{} {
+	return m.changed
+}
+
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
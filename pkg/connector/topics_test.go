@@ -0,0 +1,74 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connector
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func functionDeployment(name, topics string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "openfaas-fn",
+			Labels:      map[string]string{"faas_function": name},
+			Annotations: map[string]string{"topic": topics},
+		},
+	}
+}
+
+func Test_TopicMap_Update(t *testing.T) {
+	m := NewTopicMap()
+
+	m.update(functionDeployment("orders", "payments, orders"))
+	m.update(functionDeployment("audit", "payments"))
+	m.update(functionDeployment("audit-canary", "payments"))
+	m.update(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "gateway", Annotations: map[string]string{"topic": "payments"}}})
+
+	// the operator only sets the faas_function label on the pod template
+	billing := functionDeployment("billing", "invoices")
+	billing.Labels = nil
+	billing.Spec.Template.Labels = map[string]string{"faas_function": "billing"}
+	m.update(billing)
+
+	if got, want := m.Match("payments"), []string{"audit.openfaas-fn", "orders.openfaas-fn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v to subscribe to payments, got: %v", want, got)
+	}
+	if got, want := m.Match("invoices"), []string{"billing.openfaas-fn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v to subscribe to invoices, got: %v", want, got)
+	}
+	if got, want := m.Topics(), []string{"invoices", "orders", "payments"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want topics %v, got: %v", want, got)
+	}
+
+	m.update(functionDeployment("orders", ""))
+	if got, want := m.Match("payments"), []string{"audit.openfaas-fn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v to subscribe to payments after update, got: %v", want, got)
+	}
+	if got := m.Match("orders"); len(got) != 0 {
+		t.Errorf("want no functions to subscribe to orders, got: %v", got)
+	}
+}
+
+func Test_TopicMap_Changed(t *testing.T) {
+	m := NewTopicMap()
+
+	m.Set("orders.openfaas-fn", []string{"payments"})
+	select {
+	case <-m.Changed():
+	default:
+		t.Fatalf("want a change to be signalled")
+	}
+
+	m.Set("orders.openfaas-fn", []string{"payments"})
+	select {
+	case <-m.Changed():
+		t.Errorf("want no change to be signalled when the topics are the same")
+	default:
+	}
+}
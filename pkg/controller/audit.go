@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"encoding/json"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/audit"
+)
+
+// recordAudit records that the Deployment of a Function was created or updated. The
+// caller is the operator, as the API server does not tell it who changed the Function.
+// previousSpec is the spec annotation of the Deployment before an update.
+func (c *Controller) recordAudit(function *faasv1.Function, verb, previousSpec string, err error) {
+	if c.auditor == nil {
+		return
+	}
+
+	var previous interface{}
+	if len(previousSpec) > 0 {
+		spec := faasv1.FunctionSpec{}
+		if json.Unmarshal([]byte(previousSpec), &spec) == nil {
+			previous = spec
+		}
+	}
+	current, _ := json.Marshal(function.Spec)
+
+	record := audit.Record{
+		Source:    audit.SourceOperator,
+		Caller:    controllerAgentName,
+		Namespace: function.Namespace,
+		Kind:      audit.KindFunction,
+		Name:      function.Spec.Name,
+		Verb:      verb,
+		Diff:      audit.Diff(previous, current),
+		Outcome:   audit.OutcomeSuccess,
+	}
+	if err != nil {
+		record.Outcome = audit.OutcomeFailure
+		record.Error = err.Error()
+	}
+
+	c.auditor.Record(record)
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/audit"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type memorySink []audit.Record
+
+func (s *memorySink) Write(record audit.Record) error {
+	*s = append(*s, record)
+	return nil
+}
+
+func Test_recordAudit(t *testing.T) {
+	sink := &memorySink{}
+	c := &Controller{auditor: audit.New(sink)}
+
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:  "nodeinfo",
+			Image: "functions/nodeinfo:0.2",
+		},
+	}
+
+	c.recordAudit(function, "deploy", "", nil)
+	c.recordAudit(function, "update", `{"name":"nodeinfo","image":"functions/nodeinfo:0.1"}`, errors.New("conflict"))
+
+	if len(*sink) != 2 {
+		t.Fatalf("want 2 records, got: %d", len(*sink))
+	}
+
+	deployed := (*sink)[0]
+	if deployed.Source != audit.SourceOperator || deployed.Caller != controllerAgentName || deployed.Namespace != "openfaas-fn" ||
+		deployed.Name != "nodeinfo" || deployed.Verb != "deploy" || deployed.Outcome != audit.OutcomeSuccess {
+		t.Errorf("want a successful deploy by the operator, got: %+v", deployed)
+	}
+
+	updated := (*sink)[1]
+	if updated.Outcome != audit.OutcomeFailure || updated.Error != "conflict" {
+		t.Errorf("want a failed update, got: %+v", updated)
+	}
+	if len(updated.Diff) != 1 || updated.Diff[0].Field != "image" || updated.Diff[0].From != "functions/nodeinfo:0.1" {
+		t.Errorf("want the image to change, got: %+v", updated.Diff)
+	}
+}
+
+func Test_recordAudit_Disabled(t *testing.T) {
+	c := &Controller{}
+	c.recordAudit(&faasv1.Function{}, "deploy", "", nil)
+}
@@ -24,10 +24,12 @@ import (
 	glog "k8s.io/klog"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/audit"
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	faasscheme "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/scheme"
 	informers "github.com/openfaas/faas-netes/pkg/client/informers/externalversions"
 	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 )
 
 const (
@@ -73,6 +75,10 @@ type Controller struct {
 
 	// OpenFaaS function factory
 	factory FunctionFactory
+
+	// auditor records the Deployments created and updated for Functions, it is nil
+	// when auditing is disabled
+	auditor *audit.Auditor
 }
 
 // NewController returns a new OpenFaaS controller
@@ -81,7 +87,8 @@ func NewController(
 	faasclientset clientset.Interface,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	faasInformerFactory informers.SharedInformerFactory,
-	factory FunctionFactory) *Controller {
+	factory FunctionFactory,
+	auditor *audit.Auditor) *Controller {
 
 	// obtain references to shared index informers for the Deployment and Function types
 	deploymentInformer := kubeInformerFactory.Apps().V1().Deployments()
@@ -107,6 +114,7 @@ func NewController(
 		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Functions"),
 		recorder:          recorder,
 		factory:           factory,
+		auditor:           auditor,
 	}
 
 	glog.Info("Setting up event handlers")
@@ -243,10 +251,12 @@ func (c *Controller) syncHandler(key string) error {
 
 	// Get the deployment with the name specified in Function.spec
 	deployment, err := c.deploymentsLister.Deployments(function.Namespace).Get(deploymentName)
+	// changed is set when the Deployment is created or updated from the Function spec
+	changed := false
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
 		err = nil
-		existingSecrets, err := c.getSecrets(function.Namespace, function.Spec.Secrets)
+		existingSecrets, err := c.getSecrets(function.Namespace, requiredSecrets(function))
 		if err != nil {
 			return err
 		}
@@ -257,9 +267,11 @@ func (c *Controller) syncHandler(key string) error {
 			newDeployment(function, deployment, existingSecrets, c.factory),
 			metav1.CreateOptions{},
 		)
+		c.recordAudit(function, "deploy", "", err)
 		if err != nil {
 			return err
 		}
+		changed = true
 	}
 
 	svcGetOptions := metav1.GetOptions{}
@@ -295,17 +307,20 @@ func (c *Controller) syncHandler(key string) error {
 	// Update the Deployment resource if the Function definition differs
 	if deploymentNeedsUpdate(function, deployment) {
 		glog.Infof("Updating deployment for '%s'", function.Spec.Name)
+		changed = true
 
-		existingSecrets, err := c.getSecrets(function.Namespace, function.Spec.Secrets)
+		existingSecrets, err := c.getSecrets(function.Namespace, requiredSecrets(function))
 		if err != nil {
 			return err
 		}
 
+		previousSpec := deployment.Annotations[annotationFunctionSpec]
 		deployment, err = c.kubeclientset.AppsV1().Deployments(function.Namespace).Update(
 			context.TODO(),
 			newDeployment(function, deployment, existingSecrets, c.factory),
 			metav1.UpdateOptions{},
 		)
+		c.recordAudit(function, "update", previousSpec, err)
 
 		if err != nil {
 			glog.Errorf("Updating deployment for '%s' failed: %v", function.Spec.Name, err)
@@ -330,6 +345,25 @@ func (c *Controller) syncHandler(key string) error {
 		return err
 	}
 
+	if err := c.syncScaling(function); err != nil {
+		glog.Errorf("Updating scaling for '%s' failed: %v", function.Spec.Name, err)
+		return err
+	}
+
+	if err := c.syncNetworkPolicy(function); err != nil {
+		glog.Errorf("Updating network policy for '%s' failed: %v", function.Spec.Name, err)
+		return err
+	}
+
+	if err := c.syncIngress(function, deployment); err != nil {
+		glog.Errorf("Updating ingress for '%s' failed: %v", function.Spec.Name, err)
+		return err
+	}
+
+	if changed {
+		c.recordRevision(function)
+	}
+
 	c.recorder.Event(function, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	return nil
 }
@@ -387,8 +421,23 @@ func (c *Controller) handleObject(obj interface{}) {
 	}
 }
 
+// requiredSecrets returns the secrets of function and those that its environment
+// variables are read from
+func requiredSecrets(function *faasv1.Function) []string {
+	var annotations map[string]string
+	if function.Spec.Annotations != nil {
+		annotations = *function.Spec.Annotations
+	}
+	return k8s.RequiredSecrets(function.Spec.Secrets, annotations)
+}
+
 // getSecrets queries Kubernetes for a list of secrets by name in the given k8s namespace.
+// Secrets of a secret store are materialised by the SecretsClient of the factory.
 func (c *Controller) getSecrets(namespace string, secretNames []string) (map[string]*corev1.Secret, error) {
+	if c.factory.Factory.Secrets != nil {
+		return c.factory.Factory.Secrets.GetSecrets(namespace, secretNames)
+	}
+
 	secrets := map[string]*corev1.Secret{}
 
 	for _, secretName := range secretNames {
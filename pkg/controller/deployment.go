@@ -46,6 +46,7 @@ func newDeployment(
 	}
 
 	annotations := makeAnnotations(function)
+	k8s.AddProfiles(annotations, k8s.NamespaceProfiles(ctx, factory.Factory.Client, function.Namespace))
 
 	var serviceAccount string
 
@@ -173,6 +174,12 @@ func newDeployment(
 	return deploymentSpec
 }
 
+// RenderFunction returns the Deployment and Service that the controller creates for a
+// new Function without applying them, it is used for dry-run requests to the REST API
+func RenderFunction(function *faasv1.Function, existingSecrets map[string]*corev1.Secret, factory FunctionFactory) (*appsv1.Deployment, *corev1.Service) {
+	return newDeployment(function, nil, existingSecrets, factory), newService(function)
+}
+
 func makeEnvVars(function *faasv1.Function) []corev1.EnvVar {
 	envVars := []corev1.EnvVar{}
 
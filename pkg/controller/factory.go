@@ -61,6 +61,30 @@ func functionToFunctionResources(in *faasv1.Function) (l *types.FunctionResource
 	return
 }
 
+// FunctionSpecToRequest converts the spec of a Function to the deploy request that
+// the REST API accepts for it, so that both are validated and applied in the same way
+func FunctionSpecToRequest(function *faasv1.Function) types.FunctionDeployment {
+	request := types.FunctionDeployment{
+		Service:                function.Spec.Name,
+		Image:                  function.Spec.Image,
+		Namespace:              function.Namespace,
+		EnvProcess:             function.Spec.Handler,
+		Constraints:            function.Spec.Constraints,
+		Secrets:                function.Spec.Secrets,
+		Labels:                 function.Spec.Labels,
+		Annotations:            function.Spec.Annotations,
+		ReadOnlyRootFilesystem: function.Spec.ReadOnlyRootFilesystem,
+	}
+
+	if function.Spec.Environment != nil {
+		request.EnvVars = *function.Spec.Environment
+	}
+
+	request.Limits, request.Requests = functionToFunctionResources(function)
+
+	return request
+}
+
 func (f *FunctionFactory) MakeProbes(function *faasv1.Function) (*k8s.FunctionProbes, error) {
 	req := functionToFunctionRequest(function)
 	return f.Factory.MakeProbes(req)
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"context"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncIngress brings the Ingress of a Function in line with its domain annotations, the
+// Ingress is owned by the Function's Deployment so that its lifecycle follows the
+// Deployment
+func (c *Controller) syncIngress(function *faasv1.Function, deployment *appsv1.Deployment) error {
+	owner := metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+
+	return k8s.ApplyIngress(context.TODO(), c.kubeclientset, c.factory.Factory.Config.DomainNamespace, function.Namespace, FunctionSpecToRequest(function), functionPort, *owner)
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"context"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// syncNetworkPolicy brings the NetworkPolicy of a Function in line with the configured
+// mode and its egress annotation, the policy is owned by the Function so that it is
+// removed with it
+func (c *Controller) syncNetworkPolicy(function *faasv1.Function) error {
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+
+	config := c.factory.Factory.Config.NetworkPolicy
+	return k8s.ApplyNetworkPolicy(context.TODO(), c.kubeclientset, config, function.Namespace, FunctionSpecToRequest(function), *owner)
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"context"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	glog "k8s.io/klog"
+)
+
+// recordRevision stores the spec of the Function in its revision history, the history
+// is owned by the Function so that it is removed with it
+func (c *Controller) recordRevision(function *faasv1.Function) {
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+
+	request := FunctionSpecToRequest(function)
+	revision, err := c.factory.Factory.RecordRevision(context.TODO(), function.Namespace, request, *owner)
+	if err != nil {
+		glog.Errorf("Recording revision for '%s' failed: %v", function.Spec.Name, err)
+		return
+	}
+
+	glog.V(2).Infof("Function '%s' is at revision %d", function.Spec.Name, revision.Revision)
+}
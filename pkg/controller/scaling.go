@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"context"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// syncScaling brings the HorizontalPodAutoscaler and PodDisruptionBudget of a Function
+// in line with its labels, both are owned by the Function so that they are removed
+// with it
+func (c *Controller) syncScaling(function *faasv1.Function) error {
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+
+	return k8s.ApplyScaling(context.TODO(), c.kubeclientset, function.Namespace, FunctionSpecToRequest(function), *owner)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -16,6 +17,8 @@ const (
 // in the kubernetes cluster.  For each requested secret, we inspect the type and add it to the
 // deployment spec as appropriate: secrets with type `SecretTypeDockercfg` are added as ImagePullSecrets
 // all other secrets are mounted as files in the deployments containers.
+// The keys of secrets are set as environment variables, see k8s.ConfigureSecretsEnv.
+// The checksum of the secrets is set on the pod template, see k8s.SetSecretsChecksum.
 func UpdateSecrets(function *faasv1.Function, deployment *appsv1.Deployment, existingSecrets map[string]*corev1.Secret) error {
 	// Add / reference pre-existing secrets within Kubernetes
 	secretVolumeProjections := []corev1.VolumeProjection{}
@@ -95,6 +98,15 @@ func UpdateSecrets(function *faasv1.Function, deployment *appsv1.Deployment, exi
 
 	deployment.Spec.Template.Spec.Containers = updatedContainers
 
+	annotations := map[string]string{}
+	if function.Spec.Annotations != nil {
+		annotations = *function.Spec.Annotations
+	}
+	if err := k8s.ConfigureSecretsEnv(deployment, annotations, existingSecrets); err != nil {
+		return err
+	}
+	k8s.SetSecretsChecksum(deployment, k8s.RequiredSecrets(function.Spec.Secrets, annotations), existingSecrets, annotations)
+
 	return nil
 }
 
@@ -158,6 +158,41 @@ func Test_UpdateSecrets_AddNewSecretVolume(t *testing.T) {
 
 }
 
+func Test_UpdateSecrets_AddsSecretEnvVars(t *testing.T) {
+	request := &faasv1.Function{
+		Spec: faasv1.FunctionSpec{
+			Name:        "testfunc",
+			Annotations: &map[string]string{"com.openfaas.secrets.env": "FILENAME=testsecret:filename"},
+		},
+	}
+	existingSecrets := map[string]*corev1.Secret{
+		"testsecret": {Type: corev1.SecretTypeOpaque, Data: map[string][]byte{"filename": []byte("contents")}},
+	}
+
+	deployment := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+				},
+			},
+		},
+	}
+	err := UpdateSecrets(request, deployment, existingSecrets)
+	if err != nil {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+
+	validateEmptySecretVolumesAndMounts(t, deployment)
+
+	env := deployment.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 1 || env[0].ValueFrom == nil || env[0].ValueFrom.SecretKeyRef.Name != "testsecret" || env[0].ValueFrom.SecretKeyRef.Key != "filename" {
+		t.Errorf("want FILENAME to reference testsecret:filename, got: %+v", env)
+	}
+}
+
 func Test_UpdateSecrets_ReplacesPreviousSecretMountWithNewMount(t *testing.T) {
 	request := &faasv1.Function{
 		Spec: faasv1.FunctionSpec{
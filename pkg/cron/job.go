@@ -0,0 +1,150 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// TopicAnnotation lists the topics that a function subscribes to, a function is
+	// scheduled when one of them is CronTopic
+	TopicAnnotation = "topic"
+
+	// CronTopic is the topic of functions that are invoked on a schedule
+	CronTopic = "cron-function"
+
+	// ScheduleAnnotation is the cron expression of a scheduled function
+	ScheduleAnnotation = "schedule"
+
+	// TimezoneAnnotation is the IANA time zone that the schedule is evaluated in,
+	// UTC by default
+	TimezoneAnnotation = "com.openfaas.cron.timezone"
+
+	// OverlapAnnotation sets what happens when a run is due while the previous run is
+	// still in progress
+	OverlapAnnotation = "com.openfaas.cron.overlap"
+
+	// CatchUpAnnotation disables catching up on a missed run after a restart when it
+	// is set to "false"
+	CatchUpAnnotation = "com.openfaas.cron.catchup"
+)
+
+// OverlapPolicy sets what happens when a run is due while the previous run is still
+// in progress
+type OverlapPolicy string
+
+const (
+	// AllowOverlap starts the new run next to the previous run
+	AllowOverlap OverlapPolicy = "allow"
+
+	// ForbidOverlap skips the new run
+	ForbidOverlap OverlapPolicy = "forbid"
+
+	// ReplaceOverlap cancels the previous run and starts the new run
+	ReplaceOverlap OverlapPolicy = "replace"
+)
+
+// Job is a function that is invoked on a schedule
+type Job struct {
+	Function  string
+	Namespace string
+
+	// Spec is the cron expression of the schedule
+	Spec     string
+	Timezone string
+	Overlap  OverlapPolicy
+	CatchUp  bool
+
+	Schedule *Schedule
+
+	// Object is the Deployment or Function that Events of each run are recorded on
+	Object runtime.Object
+
+	// Owner owns the ConfigMap that holds the time of the last run, so that it is
+	// removed together with the function
+	Owner metav1.OwnerReference
+}
+
+// IsCronFunction returns true when the annotations subscribe a function to CronTopic
+func IsCronFunction(annotations map[string]string) bool {
+	for _, topic := range strings.Split(annotations[TopicAnnotation], ",") {
+		if strings.TrimSpace(topic) == CronTopic {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAnnotations returns an error when the annotations subscribe a function to
+// CronTopic with an invalid schedule, time zone or overlap policy
+func ValidateAnnotations(annotations map[string]string) error {
+	if !IsCronFunction(annotations) {
+		return nil
+	}
+
+	_, err := NewJob("", "", annotations)
+	return err
+}
+
+// NewJob creates a Job from the annotations of a function, the caller sets the Object
+// and Owner of the Job
+func NewJob(function, namespace string, annotations map[string]string) (*Job, error) {
+	spec, ok := annotations[ScheduleAnnotation]
+	if !ok || len(strings.TrimSpace(spec)) == 0 {
+		return nil, fmt.Errorf("annotation %s is required for topic %s", ScheduleAnnotation, CronTopic)
+	}
+
+	location := time.UTC
+	timezone := annotations[TimezoneAnnotation]
+	if len(timezone) > 0 {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", TimezoneAnnotation, timezone, err)
+		}
+	}
+
+	schedule, err := ParseSchedule(spec, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %s", ScheduleAnnotation, spec, err)
+	}
+
+	overlap := AllowOverlap
+	if value, ok := annotations[OverlapAnnotation]; ok && len(value) > 0 {
+		overlap = OverlapPolicy(strings.ToLower(value))
+		switch overlap {
+		case AllowOverlap, ForbidOverlap, ReplaceOverlap:
+		default:
+			return nil, fmt.Errorf("invalid %s %q, expected %s, %s or %s", OverlapAnnotation, value, AllowOverlap, ForbidOverlap, ReplaceOverlap)
+		}
+	}
+
+	return &Job{
+		Function:  function,
+		Namespace: namespace,
+		Spec:      spec,
+		Timezone:  timezone,
+		Overlap:   overlap,
+		CatchUp:   annotations[CatchUpAnnotation] != "false",
+		Schedule:  schedule,
+	}, nil
+}
+
+// key identifies the function of a Job
+func (j *Job) key() string {
+	return j.Namespace + "/" + j.Function
+}
+
+// sameSchedule returns true when other runs at the same times and in the same way as j
+func (j *Job) sameSchedule(other *Job) bool {
+	return j.Spec == other.Spec &&
+		j.Timezone == other.Timezone &&
+		j.Overlap == other.Overlap &&
+		j.CatchUp == other.CatchUp
+}
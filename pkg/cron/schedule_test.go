@@ -0,0 +1,108 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseSchedule_Invalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+	}
+
+	for _, spec := range specs {
+		if _, err := ParseSchedule(spec, nil); err == nil {
+			t.Errorf("want error for schedule %q, got nil", spec)
+		}
+	}
+}
+
+func Test_Schedule_Next(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database is not available: %s", err)
+	}
+
+	from := time.Date(2020, 6, 15, 10, 7, 30, 0, time.UTC) // a Monday
+
+	cases := []struct {
+		spec     string
+		location *time.Location
+		want     time.Time
+	}{
+		{spec: "* * * * *", want: time.Date(2020, 6, 15, 10, 8, 0, 0, time.UTC)},
+		{spec: "*/5 * * * *", want: time.Date(2020, 6, 15, 10, 10, 0, 0, time.UTC)},
+		{spec: "5/10 * * * *", want: time.Date(2020, 6, 15, 10, 15, 0, 0, time.UTC)},
+		{spec: "0 9-17 * * *", want: time.Date(2020, 6, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2020, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * sun", want: time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 8 1 jan *", want: time.Date(2021, 1, 1, 8, 30, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week has to match
+		{spec: "0 0 1 * fri", want: time.Date(2020, 6, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 9 * * *", location: newYork, want: time.Date(2020, 6, 15, 13, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tc.spec, tc.location)
+			if err != nil {
+				t.Fatalf("want schedule to parse, got: %s", err)
+			}
+
+			if got := schedule.Next(from); !got.Equal(tc.want) {
+				t.Errorf("want next run at %s, got: %s", tc.want, got.UTC())
+			}
+		})
+	}
+}
+
+func Test_NewJob(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "defaults", annotations: map[string]string{"schedule": "*/5 * * * *"}},
+		{name: "all annotations", annotations: map[string]string{
+			"schedule":                   "0 9 * * mon-fri",
+			"com.openfaas.cron.timezone": "Europe/London",
+			"com.openfaas.cron.overlap":  "forbid",
+			"com.openfaas.cron.catchup":  "false",
+		}},
+		{name: "missing schedule", annotations: map[string]string{}, wantErr: true},
+		{name: "unknown time zone", annotations: map[string]string{"schedule": "@hourly", "com.openfaas.cron.timezone": "Mars/Olympus"}, wantErr: true},
+		{name: "unknown overlap policy", annotations: map[string]string{"schedule": "@hourly", "com.openfaas.cron.overlap": "queue"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewJob("nodeinfo", "openfaas-fn", tc.annotations)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("want error: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_IsCronFunction(t *testing.T) {
+	if !IsCronFunction(map[string]string{"topic": "payments, cron-function"}) {
+		t.Errorf("want cron-function in a list of topics to be scheduled")
+	}
+	if IsCronFunction(map[string]string{"topic": "payments", "schedule": "@hourly"}) {
+		t.Errorf("want a function without the cron-function topic not to be scheduled")
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package cron
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+	"github.com/openfaas/faas-provider/proxy"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// ReasonInvoked is the reason of the Event of a successful run
+	ReasonInvoked = "CronInvoked"
+
+	// ReasonFailed is the reason of the Event of a run that failed or returned an
+	// error status
+	ReasonFailed = "CronFailed"
+
+	// ReasonSkipped is the reason of the Event of a run that was skipped because the
+	// previous run was still in progress
+	ReasonSkipped = "CronSkipped"
+
+	// ReasonReplaced is the reason of the Event of a run that was cancelled in favour
+	// of the next run
+	ReasonReplaced = "CronReplaced"
+
+	stateConfigMapTmpl = "%s-cron"
+	lastScheduleKey    = "lastSchedule"
+)
+
+// StateConfigMapName returns the name of the ConfigMap that holds the time of the last
+// run of a scheduled function
+func StateConfigMapName(function string) string {
+	return fmt.Sprintf(stateConfigMapTmpl, function)
+}
+
+// Scheduler invokes functions on the schedule of their Job through the resolver, so
+// that scheduled invocations take the same path as invocations through the gateway
+type Scheduler struct {
+	kube     kubernetes.Interface
+	resolver proxy.BaseURLResolver
+	client   *http.Client
+	recorder record.EventRecorder
+	now      func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*entry
+	synced  bool
+	runs    sync.WaitGroup
+}
+
+// entry is a scheduled Job and its runs that are in progress
+type entry struct {
+	job  *Job
+	stop chan struct{}
+
+	// catchUp is set for the jobs that were found when the scheduler started
+	catchUp bool
+
+	lock    sync.Mutex
+	running int
+	cancel  context.CancelFunc
+}
+
+// NewScheduler creates a Scheduler, client is used to invoke the functions and
+// recorder records an Event for each run
+func NewScheduler(kube kubernetes.Interface, resolver proxy.BaseURLResolver, client *http.Client, recorder record.EventRecorder) *Scheduler {
+	return &Scheduler{
+		kube:     kube,
+		resolver: resolver,
+		client:   client,
+		recorder: recorder,
+		now:      time.Now,
+		entries:  map[string]*entry{},
+	}
+}
+
+// Run syncs the jobs returned by list every interval until stopCh is closed, then
+// stops all jobs
+func (s *Scheduler) Run(list func() ([]*Job, error), interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		jobs, err := list()
+		if err != nil {
+			log.Printf("Unable to list scheduled functions: %s\n", err.Error())
+			return
+		}
+		s.Sync(jobs)
+	}, interval, stopCh)
+
+	s.Sync(nil)
+}
+
+// Sync starts the jobs that are not scheduled yet, restarts the jobs whose schedule
+// changed and stops the jobs that are not in jobs. A missed run is only caught up on
+// for the jobs of the first Sync, which are the jobs that existed before a restart.
+func (s *Scheduler) Sync(jobs []*Job) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	wanted := map[string]bool{}
+	for _, job := range jobs {
+		key := job.key()
+		wanted[key] = true
+
+		if existing, ok := s.entries[key]; ok {
+			if existing.job.sameSchedule(job) {
+				continue
+			}
+			close(existing.stop)
+			log.Printf("Rescheduling %s with %q\n", key, job.Spec)
+		} else {
+			log.Printf("Scheduling %s with %q\n", key, job.Spec)
+		}
+
+		e := &entry{
+			job:     job,
+			stop:    make(chan struct{}),
+			catchUp: !s.synced && job.CatchUp,
+		}
+		s.entries[key] = e
+		go s.schedule(e)
+	}
+
+	for key, e := range s.entries {
+		if !wanted[key] {
+			log.Printf("Unscheduling %s\n", key)
+			close(e.stop)
+			delete(s.entries, key)
+		}
+	}
+
+	s.synced = true
+}
+
+// Wait blocks until the runs that were started have completed
+func (s *Scheduler) Wait() {
+	s.runs.Wait()
+}
+
+// schedule triggers the runs of a job until it is stopped
+func (s *Scheduler) schedule(e *entry) {
+	job := e.job
+	ctx := context.Background()
+	now := s.now()
+
+	last, err := s.lastSchedule(ctx, job)
+	if err != nil {
+		log.Printf("Unable to read the last run of %s: %s\n", job.key(), err.Error())
+	} else if last.IsZero() {
+		// nothing to catch up on, but a later restart will have a reference point
+		if err := s.recordSchedule(ctx, job, now); err != nil {
+			log.Printf("Unable to record the schedule of %s: %s\n", job.key(), err.Error())
+		}
+	} else if e.catchUp {
+		if missed := latestBetween(job.Schedule, last, now); !missed.IsZero() {
+			log.Printf("Catching up on the run of %s scheduled at %s\n", job.key(), missed)
+			s.trigger(e, missed)
+		}
+	}
+
+	next := job.Schedule.Next(now)
+	for !next.IsZero() {
+		timer := time.NewTimer(next.Sub(s.now()))
+
+		select {
+		case <-timer.C:
+			s.trigger(e, next)
+			next = job.Schedule.Next(next)
+		case <-e.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// latestBetween returns the latest scheduled time after from and up to to, or the
+// zero time when no run was scheduled
+func latestBetween(schedule *Schedule, from, to time.Time) time.Time {
+	var latest time.Time
+	for next := schedule.Next(from); !next.IsZero() && !next.After(to); next = schedule.Next(next) {
+		latest = next
+	}
+	return latest
+}
+
+// trigger starts a run of the job that was scheduled at scheduled, applying the
+// overlap policy when the previous run is still in progress
+func (s *Scheduler) trigger(e *entry, scheduled time.Time) {
+	job := e.job
+
+	e.lock.Lock()
+	if e.running > 0 {
+		switch job.Overlap {
+		case ForbidOverlap:
+			e.lock.Unlock()
+			s.event(job, corev1.EventTypeNormal, ReasonSkipped,
+				"Skipped run scheduled at %s, the previous run is still in progress", scheduled.Format(time.RFC3339))
+			return
+		case ReplaceOverlap:
+			e.cancel()
+			s.event(job, corev1.EventTypeNormal, ReasonReplaced,
+				"Cancelled the previous run in favour of the run scheduled at %s", scheduled.Format(time.RFC3339))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.running++
+	e.cancel = cancel
+	e.lock.Unlock()
+
+	if err := s.recordSchedule(ctx, job, scheduled); err != nil {
+		log.Printf("Unable to record the run of %s: %s\n", job.key(), err.Error())
+	}
+
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		defer cancel()
+
+		status, duration, err := s.invoke(ctx, job, scheduled)
+
+		e.lock.Lock()
+		e.running--
+		e.lock.Unlock()
+
+		switch {
+		case err != nil && ctx.Err() == context.Canceled:
+			log.Printf("Run of %s scheduled at %s was cancelled\n", job.key(), scheduled)
+		case err != nil:
+			s.event(job, corev1.EventTypeWarning, ReasonFailed,
+				"Run scheduled at %s failed: %s", scheduled.Format(time.RFC3339), err.Error())
+		case status < 200 || status > 299:
+			s.event(job, corev1.EventTypeWarning, ReasonFailed,
+				"Run scheduled at %s returned status %d after %s", scheduled.Format(time.RFC3339), status, duration)
+		default:
+			s.event(job, corev1.EventTypeNormal, ReasonInvoked,
+				"Run scheduled at %s returned status %d after %s", scheduled.Format(time.RFC3339), status, duration)
+		}
+	}()
+}
+
+func (s *Scheduler) invoke(ctx context.Context, job *Job, scheduled time.Time) (int, time.Duration, error) {
+	functionURL, err := s.resolver.Resolve(job.Function + "." + job.Namespace)
+	if err != nil {
+		return 0, 0, err
+	}
+	functionURL.Path = "/"
+
+	req, err := http.NewRequest(http.MethodPost, functionURL.String(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("X-Topic", CronTopic)
+	req.Header.Set("X-Scheduled-Time", scheduled.Format(time.RFC3339))
+
+	start := time.Now()
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+
+	if _, err := io.Copy(ioutil.Discard, res.Body); err != nil {
+		return 0, 0, err
+	}
+
+	return res.StatusCode, time.Since(start).Round(time.Millisecond), nil
+}
+
+func (s *Scheduler) event(job *Job, eventType, reason, messageFmt string, args ...interface{}) {
+	log.Printf("%s %s: %s\n", reason, job.key(), fmt.Sprintf(messageFmt, args...))
+
+	if s.recorder != nil && job.Object != nil {
+		s.recorder.Eventf(job.Object, eventType, reason, messageFmt, args...)
+	}
+}
+
+// lastSchedule returns the scheduled time of the last run of the job, or the zero
+// time when the job has not been recorded yet
+func (s *Scheduler) lastSchedule(ctx context.Context, job *Job) (time.Time, error) {
+	configMap, err := s.kube.CoreV1().ConfigMaps(job.Namespace).Get(ctx, StateConfigMapName(job.Function), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	value, ok := configMap.Data[lastScheduleKey]
+	if !ok {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// recordSchedule stores the scheduled time of the last run of the job
+func (s *Scheduler) recordSchedule(ctx context.Context, job *Job, scheduled time.Time) error {
+	configMaps := s.kube.CoreV1().ConfigMaps(job.Namespace)
+	name := StateConfigMapName(job.Function)
+
+	existing, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	value := scheduled.UTC().Format(time.RFC3339)
+
+	if err == nil {
+		configMap := existing.DeepCopy()
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[lastScheduleKey] = value
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"faas_function": job.Function,
+			},
+		},
+		Data: map[string]string{
+			lastScheduleKey: value,
+		},
+	}
+	if len(job.Owner.UID) > 0 {
+		configMap.OwnerReferences = []metav1.OwnerReference{job.Owner}
+	}
+
+	_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	return err
+}
+
+// Start creates a Scheduler for the jobs returned by list, which are synced every 10
+// seconds until stopCh is closed. Functions are invoked with the provider's proxy
+// client and Events are recorded as faas-netes.
+func Start(cfg config.BootstrapConfig, kube kubernetes.Interface, resolver proxy.BaseURLResolver, list func() ([]*Job, error), stopCh <-chan struct{}) *Scheduler {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kube.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "faas-netes"})
+
+	scheduler := NewScheduler(kube, resolver, proxy.NewProxyClientFromConfig(cfg.FaaSConfig), recorder)
+	go scheduler.Run(list, 10*time.Second, stopCh)
+
+	return scheduler
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package cron
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+func newTestScheduler(function http.HandlerFunc, objects ...runtime.Object) (*Scheduler, *fake.Clientset, *record.FakeRecorder, func()) {
+	srv := httptest.NewServer(function)
+	srvURL, _ := url.Parse(srv.URL)
+
+	kube := fake.NewSimpleClientset(objects...)
+	recorder := record.NewFakeRecorder(10)
+
+	return NewScheduler(kube, staticResolver{url: *srvURL}, http.DefaultClient, recorder), kube, recorder, srv.Close
+}
+
+func newTestJob(t *testing.T, annotations map[string]string) *Job {
+	job, err := NewJob("nodeinfo", "openfaas-fn", annotations)
+	if err != nil {
+		t.Fatalf("want job, got: %s", err)
+	}
+	job.Object = &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"}}
+	return job
+}
+
+func waitForEvent(t *testing.T, recorder *record.FakeRecorder) string {
+	select {
+	case event := <-recorder.Events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("want event, got none")
+	}
+	return ""
+}
+
+func lastScheduleOf(t *testing.T, s *Scheduler, job *Job) time.Time {
+	last, err := s.lastSchedule(context.TODO(), job)
+	if err != nil {
+		t.Fatalf("want last schedule, got: %s", err)
+	}
+	return last
+}
+
+func Test_Scheduler_InvokesOnSchedule(t *testing.T) {
+	invoked := make(chan *http.Request, 1)
+	s, _, recorder, stop := newTestScheduler(func(w http.ResponseWriter, r *http.Request) {
+		invoked <- r
+	})
+	defer stop()
+
+	// start 50ms before the next minute, so that the first run is due straight away
+	base := time.Now()
+	offset := base.Truncate(time.Minute).Add(time.Minute).Sub(base) - 50*time.Millisecond
+	s.now = func() time.Time { return time.Now().Add(offset) }
+
+	job := newTestJob(t, map[string]string{"topic": "cron-function", "schedule": "* * * * *"})
+	s.Sync([]*Job{job})
+	defer s.Sync(nil)
+
+	event := waitForEvent(t, recorder)
+	if !strings.HasPrefix(event, corev1.EventTypeNormal+" "+ReasonInvoked) {
+		t.Errorf("want %s event, got: %s", ReasonInvoked, event)
+	}
+
+	r := <-invoked
+	if r.Method != http.MethodPost || r.Header.Get("X-Topic") != CronTopic {
+		t.Errorf("want POST with X-Topic %s, got: %s %s", CronTopic, r.Method, r.Header.Get("X-Topic"))
+	}
+
+	s.Wait()
+	if last := lastScheduleOf(t, s, job); last.Second() != 0 || last.IsZero() {
+		t.Errorf("want the scheduled time of the run to be recorded, got: %s", last)
+	}
+}
+
+func Test_Scheduler_CatchesUpOnMissedRun(t *testing.T) {
+	now := time.Date(2020, 6, 15, 10, 30, 0, 0, time.UTC)
+	state := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: StateConfigMapName("nodeinfo"), Namespace: "openfaas-fn"},
+		Data:       map[string]string{lastScheduleKey: "2020-06-15T07:00:00Z"},
+	}
+
+	cases := []struct {
+		name        string
+		catchUp     string
+		wantInvoked bool
+	}{
+		{name: "catch up", catchUp: "true", wantInvoked: true},
+		{name: "catch up disabled", catchUp: "false", wantInvoked: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _, recorder, stop := newTestScheduler(func(w http.ResponseWriter, r *http.Request) {}, state.DeepCopy())
+			defer stop()
+			s.now = func() time.Time { return now }
+
+			job := newTestJob(t, map[string]string{
+				"topic":                     "cron-function",
+				"schedule":                  "0 * * * *",
+				"com.openfaas.cron.catchup": tc.catchUp,
+			})
+			s.Sync([]*Job{job})
+
+			if !tc.wantInvoked {
+				s.Sync(nil)
+				select {
+				case event := <-recorder.Events:
+					t.Errorf("want no run, got: %s", event)
+				case <-time.After(100 * time.Millisecond):
+				}
+				return
+			}
+
+			event := waitForEvent(t, recorder)
+			s.Sync(nil)
+			s.Wait()
+
+			// only the latest missed run is caught up on
+			if !strings.Contains(event, "2020-06-15T10:00:00Z") {
+				t.Errorf("want the run of 10:00 to be caught up on, got: %s", event)
+			}
+			if want, last := time.Date(2020, 6, 15, 10, 0, 0, 0, time.UTC), lastScheduleOf(t, s, job); !last.Equal(want) {
+				t.Errorf("want last schedule %s, got: %s", want, last)
+			}
+		})
+	}
+}
+
+func Test_Scheduler_OverlapPolicy(t *testing.T) {
+	cases := []struct {
+		overlap    OverlapPolicy
+		wantEvents []string
+	}{
+		{overlap: ForbidOverlap, wantEvents: []string{ReasonSkipped, ReasonInvoked}},
+		{overlap: ReplaceOverlap, wantEvents: []string{ReasonReplaced, ReasonInvoked}},
+		{overlap: AllowOverlap, wantEvents: []string{ReasonInvoked, ReasonInvoked}},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.overlap), func(t *testing.T) {
+			release := make(chan struct{})
+			started := make(chan struct{}, 2)
+			s, _, recorder, stop := newTestScheduler(func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+			})
+			defer stop()
+
+			job := newTestJob(t, map[string]string{
+				"topic":                     "cron-function",
+				"schedule":                  "@hourly",
+				"com.openfaas.cron.overlap": string(tc.overlap),
+			})
+			e := &entry{job: job, stop: make(chan struct{})}
+
+			scheduled := time.Date(2020, 6, 15, 10, 0, 0, 0, time.UTC)
+			s.trigger(e, scheduled)
+			<-started
+			s.trigger(e, scheduled.Add(time.Hour))
+			if tc.overlap != ForbidOverlap {
+				<-started
+			}
+			close(release)
+			s.Wait()
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, strings.Fields(<-recorder.Events)[1])
+			}
+			if strings.Join(events, ",") != strings.Join(tc.wantEvents, ",") {
+				t.Errorf("want events %v, got: %v", tc.wantEvents, events)
+			}
+		})
+	}
+}
+
+func Test_Scheduler_SyncStopsRemovedJobs(t *testing.T) {
+	s, _, _, stop := newTestScheduler(func(w http.ResponseWriter, r *http.Request) {})
+	defer stop()
+
+	job := newTestJob(t, map[string]string{"topic": "cron-function", "schedule": "@daily"})
+	s.Sync([]*Job{job})
+
+	first := s.entries[job.key()]
+	s.Sync([]*Job{newTestJob(t, map[string]string{"topic": "cron-function", "schedule": "@daily"})})
+	if s.entries[job.key()] != first {
+		t.Errorf("want an unchanged job to keep running")
+	}
+
+	s.Sync([]*Job{newTestJob(t, map[string]string{"topic": "cron-function", "schedule": "@hourly"})})
+	if s.entries[job.key()] == first {
+		t.Errorf("want a changed job to be rescheduled")
+	}
+	select {
+	case <-first.stop:
+	default:
+		t.Errorf("want the previous schedule to be stopped")
+	}
+
+	s.Sync(nil)
+	if len(s.entries) != 0 {
+		t.Errorf("want no scheduled jobs, got: %d", len(s.entries))
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package cron
+
+import (
+	"log"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// DeploymentJobs returns the jobs of the scheduled function Deployments in lister, for
+// when faas-netes runs as a controller. Canaries are not scheduled, only the function
+// that they are a canary of.
+func DeploymentJobs(lister appslisters.DeploymentLister) func() ([]*Job, error) {
+	return func() ([]*Job, error) {
+		deployments, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+
+		jobs := []*Job{}
+		for _, deployment := range deployments {
+			if _, ok := deployment.Labels["faas_function"]; !ok || k8s.IsCanary(deployment.Name) || !IsCronFunction(deployment.Annotations) {
+				continue
+			}
+
+			job, err := NewJob(deployment.Name, deployment.Namespace, deployment.Annotations)
+			if err != nil {
+				log.Printf("Unable to schedule %s.%s: %s\n", deployment.Name, deployment.Namespace, err.Error())
+				continue
+			}
+
+			job.Object = deployment
+			job.Owner = metav1.OwnerReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       deployment.Name,
+				UID:        deployment.UID,
+			}
+			jobs = append(jobs, job)
+		}
+		return jobs, nil
+	}
+}
+
+// FunctionJobs returns the jobs of the scheduled Functions in lister, for when
+// faas-netes runs as an operator
+func FunctionJobs(lister listers.FunctionLister) func() ([]*Job, error) {
+	return func() ([]*Job, error) {
+		functions, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+
+		jobs := []*Job{}
+		for _, function := range functions {
+			if function.Spec.Annotations == nil || k8s.IsCanary(function.Spec.Name) || !IsCronFunction(*function.Spec.Annotations) {
+				continue
+			}
+
+			job, err := NewJob(function.Spec.Name, function.Namespace, *function.Spec.Annotations)
+			if err != nil {
+				log.Printf("Unable to schedule %s.%s: %s\n", function.Spec.Name, function.Namespace, err.Error())
+				continue
+			}
+
+			job.Object = function
+			job.Owner = metav1.OwnerReference{
+				APIVersion: faasv1.SchemeGroupVersion.String(),
+				Kind:       "Function",
+				Name:       function.Name,
+				UID:        function.UID,
+			}
+			jobs = append(jobs, job)
+		}
+		return jobs, nil
+	}
+}
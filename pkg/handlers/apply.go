@@ -0,0 +1,162 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// applyDeployment creates the function's Deployment, or updates it when it was left
+// behind by an earlier deploy. The Deployment that was replaced is returned so that it
+// can be restored with rollbackDeployment, it is nil when the Deployment was created.
+func applyDeployment(ctx context.Context, client kubernetes.Interface, namespace string, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	deployments := client.AppsV1().Deployments(namespace)
+
+	_, err := deployments.Create(ctx, deployment, metav1.CreateOptions{})
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	existing, getErr := deployments.Get(ctx, deployment.Name, metav1.GetOptions{})
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	// never take over a Deployment that was not created for a function
+	if !isFunction(existing) {
+		return nil, err
+	}
+
+	updated := existing.DeepCopy()
+	updated.Labels = deployment.Labels
+	updated.Annotations = deployment.Annotations
+	updated.Spec.Template = deployment.Spec.Template
+	updated.Spec.Strategy = deployment.Spec.Strategy
+	updated.Spec.RevisionHistoryLimit = deployment.Spec.RevisionHistoryLimit
+
+	if _, err := deployments.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// applyService creates the function's Service or updates the existing one. The Service
+// that was replaced is returned so that it can be restored with rollbackService, it is
+// nil when the Service was created.
+func applyService(ctx context.Context, client kubernetes.Interface, namespace string, service *corev1.Service) (*corev1.Service, error) {
+	services := client.CoreV1().Services(namespace)
+
+	_, err := services.Create(ctx, service, metav1.CreateOptions{})
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	existing, err := services.Get(ctx, service.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	updated := existing.DeepCopy()
+	updated.Annotations = service.Annotations
+	updated.Spec.Selector = service.Spec.Selector
+	updated.Spec.Ports = service.Spec.Ports
+
+	if _, err := services.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// rollbackDeployment undoes applyDeployment or updateDeploymentSpec. When previous is
+// nil the Deployment was created by the failed request and is deleted, otherwise the
+// labels, annotations and spec of previous are restored.
+func rollbackDeployment(ctx context.Context, client kubernetes.Interface, namespace, name string, previous *appsv1.Deployment) error {
+	deployments := client.AppsV1().Deployments(namespace)
+
+	if previous == nil {
+		foregroundPolicy := metav1.DeletePropagationForeground
+		err := deployments.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &foregroundPolicy})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete Deployment: %s", err.Error())
+		}
+		return nil
+	}
+
+	current, err := deployments.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get Deployment: %s", err.Error())
+	}
+
+	current.Labels = previous.Labels
+	current.Annotations = previous.Annotations
+	current.Spec = previous.Spec
+
+	if _, err := deployments.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to restore Deployment: %s", err.Error())
+	}
+	return nil
+}
+
+// rollbackService undoes applyService or updateService. When previous is nil the
+// Service was created by the failed request and is deleted, otherwise the annotations,
+// selector and ports of previous are restored.
+func rollbackService(ctx context.Context, client kubernetes.Interface, namespace, name string, previous *corev1.Service) error {
+	services := client.CoreV1().Services(namespace)
+
+	if previous == nil {
+		err := services.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete Service: %s", err.Error())
+		}
+		return nil
+	}
+
+	current, err := services.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get Service: %s", err.Error())
+	}
+
+	current.Annotations = previous.Annotations
+	current.Spec.Selector = previous.Spec.Selector
+	current.Spec.Ports = previous.Spec.Ports
+
+	if _, err := services.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to restore Service: %s", err.Error())
+	}
+	return nil
+}
+
+// rollbackFunction undoes a deploy or update that failed after the Deployment and
+// Service were applied. The objects owned by the Deployment are brought back in line
+// with previousDeployment, or removed when the function was created by the request.
+func rollbackFunction(ctx context.Context, factory k8s.FunctionFactory, namespace, name string, previousDeployment *appsv1.Deployment, previousService *corev1.Service) error {
+	var failed []string
+
+	if err := rollbackOwnedResources(ctx, factory, namespace, name, previousDeployment); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if err := rollbackService(ctx, factory.Client, namespace, name, previousService); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if err := rollbackDeployment(ctx, factory.Client, namespace, name, previousDeployment); err != nil {
+		failed = append(failed, err.Error())
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "openfaas-fn"
+
+func functionRequest(t *testing.T, method, url string, request interface{}) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("unable to marshal request: %s", err)
+	}
+	return httptest.NewRequest(method, url, bytes.NewReader(body))
+}
+
+func failWith(err error) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	}
+}
+
+func Test_DeployHandler_RollsBackDeploymentWhenServiceFails(t *testing.T) {
+	factory := validationFactory()
+	kube := factory.Client.(*fake.Clientset)
+	kube.PrependReactor("create", "services", failWith(fmt.Errorf("quota exceeded")))
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo"}))
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("want status code '%d', got '%d'", http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "quota exceeded") {
+		t.Errorf("want error message to contain the cause, got: %s", string(body))
+	}
+
+	_, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("want Deployment to be rolled back, got: %v", err)
+	}
+}
+
+func Test_DeployHandler_RollsBackFunctionWhenResourcesFail(t *testing.T) {
+	factory := validationFactory(&autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace},
+	})
+	kube := factory.Client.(*fake.Clientset)
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{
+			Service: "nodeinfo",
+			Image:   "functions/nodeinfo",
+			Labels:  &map[string]string{k8s.MaxScaleLabel: "5"},
+		}))
+
+	if w.Code == http.StatusAccepted || !strings.Contains(w.Body.String(), "not managed by OpenFaaS") {
+		t.Fatalf("want an error status code and the cause, got '%d': %q", w.Code, w.Body.String())
+	}
+
+	if _, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want Deployment to be rolled back, got: %v", err)
+	}
+
+	if _, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want Service to be rolled back, got: %v", err)
+	}
+
+	if _, err := kube.AutoscalingV2beta2().HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want the unmanaged HorizontalPodAutoscaler to be kept, got: %s", err)
+	}
+}
+
+func Test_DeployHandler_CompletesPartialDeploy(t *testing.T) {
+	replicas := int32(3)
+	orphan := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nodeinfo",
+			Namespace: testNamespace,
+			Labels:    map[string]string{"faas_function": "nodeinfo"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "nodeinfo", Image: "functions/nodeinfo:old"}},
+				},
+			},
+		},
+	}
+
+	factory := validationFactory(orphan)
+	kube := factory.Client.(*fake.Clientset)
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:new"}))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	deployment, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want Deployment to exist, got: %s", err)
+	}
+
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "functions/nodeinfo:new" {
+		t.Errorf("want image to be updated to functions/nodeinfo:new, got: %s", image)
+	}
+
+	if *deployment.Spec.Replicas != replicas {
+		t.Errorf("want replicas to be kept at %d, got: %d", replicas, *deployment.Spec.Replicas)
+	}
+
+	if _, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want Service to be created, got: %s", err)
+	}
+}
+
+func Test_DeployHandler_DoesNotTakeOverOtherDeployments(t *testing.T) {
+	factory := validationFactory(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace},
+	})
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo"}))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("want status code '%d', got '%d'", http.StatusConflict, w.Code)
+	}
+}
+
+func Test_UpdateHandler_RestoresDeploymentWhenServiceFails(t *testing.T) {
+	factory := validationFactory()
+	kube := factory.Client.(*fake.Clientset)
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	kube.PrependReactor("update", "services", failWith(errors.NewServiceUnavailable("try again")))
+
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:2"}))
+
+	if w.Code == http.StatusAccepted || w.Body.Len() == 0 {
+		t.Fatalf("want an error status code and message, got '%d': %q", w.Code, w.Body.String())
+	}
+
+	deployment, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want Deployment to exist, got: %s", err)
+	}
+
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "functions/nodeinfo:1" {
+		t.Errorf("want image to be restored to functions/nodeinfo:1, got: %s", image)
+	}
+}
+
+func Test_UpdateHandler_RestoresFunctionWhenResourcesFail(t *testing.T) {
+	factory := validationFactory(&autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace},
+	})
+	kube := factory.Client.(*fake.Clientset)
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{
+			Service:     "nodeinfo",
+			Image:       "functions/nodeinfo:1",
+			Annotations: &map[string]string{"topic": "a"},
+		}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{
+			Service:     "nodeinfo",
+			Image:       "functions/nodeinfo:2",
+			Labels:      &map[string]string{k8s.MaxScaleLabel: "5"},
+			Annotations: &map[string]string{"topic": "b"},
+		}))
+
+	if w.Code == http.StatusAccepted || !strings.Contains(w.Body.String(), "not managed by OpenFaaS") {
+		t.Fatalf("want an error status code and the cause, got '%d': %q", w.Code, w.Body.String())
+	}
+
+	deployment, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want Deployment to exist, got: %s", err)
+	}
+
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "functions/nodeinfo:1" {
+		t.Errorf("want image to be restored to functions/nodeinfo:1, got: %s", image)
+	}
+
+	service, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want Service to exist, got: %s", err)
+	}
+
+	if topic := service.Annotations["topic"]; topic != "a" {
+		t.Errorf("want Service annotations to be restored, got topic: %q", topic)
+	}
+}
+
+func Test_UpdateHandler_KeepsScalingWhenResourcesFail(t *testing.T) {
+	factory := validationFactory(&networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace},
+	})
+	kube := factory.Client.(*fake.Clientset)
+
+	labels := map[string]string{k8s.MaxScaleLabel: "5", k8s.PDBMinAvailableLabel: "1"}
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1", Labels: &labels}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	// the Ingress of the same name is not managed by OpenFaaS, so claiming a domain
+	// fails after the scaling objects were updated
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{
+			Service:     "nodeinfo",
+			Image:       "functions/nodeinfo:2",
+			Labels:      &map[string]string{k8s.MaxScaleLabel: "10", k8s.PDBMinAvailableLabel: "2"},
+			Annotations: &map[string]string{k8s.DomainAnnotation: "api.example.com"},
+		}))
+
+	if w.Code == http.StatusAccepted || !strings.Contains(w.Body.String(), "not managed by OpenFaaS") {
+		t.Fatalf("want an error status code and the cause, got '%d': %q", w.Code, w.Body.String())
+	}
+
+	hpa, err := kube.AutoscalingV2beta2().HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want HorizontalPodAutoscaler to be kept, got: %s", err)
+	}
+	if hpa.Spec.MaxReplicas != 5 {
+		t.Errorf("want max replicas to be restored to 5, got: %d", hpa.Spec.MaxReplicas)
+	}
+
+	pdb, err := kube.PolicyV1().PodDisruptionBudgets(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want PodDisruptionBudget to be kept, got: %s", err)
+	}
+	if pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("want min available to be restored to 1, got: %v", pdb.Spec.MinAvailable)
+	}
+}
+
+func Test_UpdateHandler_WritesErrorWhenDeploymentUpdateFails(t *testing.T) {
+	factory := validationFactory()
+	kube := factory.Client.(*fake.Clientset)
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	conflict := errors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "nodeinfo", fmt.Errorf("object was modified"))
+	kube.PrependReactor("update", "deployments", failWith(conflict))
+
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:2"}))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("want status code '%d', got '%d'", http.StatusConflict, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "object was modified") {
+		t.Errorf("want error message to contain the cause, got: %q", w.Body.String())
+	}
+}
+
+func Test_UpdateHandler_CreatesMissingService(t *testing.T) {
+	factory := validationFactory(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nodeinfo",
+			Namespace: testNamespace,
+			Labels:    map[string]string{"faas_function": "nodeinfo"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "nodeinfo", Image: "functions/nodeinfo:1"}},
+				},
+			},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:2"}))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	if _, err := factory.Client.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want Service to be created, got: %s", err)
+	}
+}
+
+func Test_DeleteHandler_RemovesPartialFunctions(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects []runtime.Object
+		status  int
+	}{
+		{
+			name: "deployment without service",
+			objects: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace, Labels: map[string]string{"faas_function": "nodeinfo"}},
+			}},
+			status: http.StatusAccepted,
+		},
+		{
+			name: "service without deployment",
+			objects: []runtime.Object{&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: testNamespace},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"faas_function": "nodeinfo"}},
+			}},
+			status: http.StatusAccepted,
+		},
+		{
+			name:   "missing function",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kube := fake.NewSimpleClientset(tc.objects...)
+
+			w := httptest.NewRecorder()
+			MakeDeleteHandler(testNamespace, kube).ServeHTTP(w, functionRequest(t, http.MethodDelete, "http://system/functions",
+				map[string]string{"functionName": "nodeinfo"}))
+
+			if w.Code != tc.status {
+				t.Errorf("want status code '%d', got '%d': %s", tc.status, w.Code, w.Body.String())
+			}
+
+			if _, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("want Deployment to be deleted, got: %v", err)
+			}
+
+			if _, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("want Service to be deleted, got: %v", err)
+			}
+		})
+	}
+}
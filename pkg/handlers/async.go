@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/queue"
+	bootstrap "github.com/openfaas/faas-provider"
+)
+
+// RegisterAsyncRoutes serves handler for asynchronous invocations on the same paths
+// as synchronous invocations, with the /async-function/ prefix
+func RegisterAsyncRoutes(handler http.HandlerFunc) {
+	r := bootstrap.Router()
+
+	r.HandleFunc("/async-function/{name:["+bootstrap.NameExpression+"]+}", handler)
+	r.HandleFunc("/async-function/{name:["+bootstrap.NameExpression+"]+}/", handler)
+	r.HandleFunc("/async-function/{name:["+bootstrap.NameExpression+"]+}/{params:.*}", handler)
+}
+
+// MakeAsyncHandler queues an invocation of a function and returns 202 Accepted with
+// the X-Call-Id of the invocation. The result is posted to the X-Callback-Url header
+// of the request when it is set.
+func MakeAsyncHandler(q queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var body []byte
+		if r.Body != nil {
+			defer r.Body.Close()
+
+			var err error
+			if body, err = ioutil.ReadAll(r.Body); err != nil {
+				http.Error(w, fmt.Sprintf("unable to read request body: %s", err.Error()), http.StatusBadRequest)
+				return
+			}
+		}
+
+		callID := r.Header.Get(queue.CallIDHeader)
+		if len(callID) == 0 {
+			callID = newCallID()
+		}
+
+		req := &queue.Request{
+			CallID:      callID,
+			Function:    vars["name"],
+			Method:      r.Method,
+			Path:        vars["params"],
+			QueryString: r.URL.RawQuery,
+			Header:      r.Header.Clone(),
+			Body:        body,
+			CallbackURL: r.Header.Get(queue.CallbackHeader),
+			Enqueued:    time.Now(),
+		}
+
+		if err := q.Enqueue(req); err != nil {
+			log.Printf("Unable to queue invocation of %s: %s\n", req.Function, err.Error())
+
+			status := http.StatusInternalServerError
+			if err == queue.ErrQueueFull {
+				status = http.StatusTooManyRequests
+			}
+			http.Error(w, fmt.Sprintf("unable to queue invocation: %s", err.Error()), status)
+			return
+		}
+
+		w.Header().Set(queue.CallIDHeader, callID)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func newCallID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
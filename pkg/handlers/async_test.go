@@ -0,0 +1,90 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/auth"
+	"github.com/openfaas/faas-netes/pkg/queue"
+)
+
+func Test_AsyncHandler_QueuesInvocation(t *testing.T) {
+	q := queue.NewMemoryQueue(1)
+
+	r := httptest.NewRequest(http.MethodPost, "http://system/async-function/resizer/resize?width=10", strings.NewReader("image"))
+	r.Header.Set(queue.CallbackHeader, "http://callback/")
+	r = mux.SetURLVars(r, map[string]string{"name": "resizer", "params": "resize"})
+
+	w := httptest.NewRecorder()
+	MakeAsyncHandler(q).ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	callID := w.Header().Get(queue.CallIDHeader)
+	if len(callID) == 0 {
+		t.Fatalf("want %s header, got none", queue.CallIDHeader)
+	}
+
+	req, err := q.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("want queued request, got: %s", err)
+	}
+	if req.CallID != callID || req.Function != "resizer" || req.Path != "resize" ||
+		req.QueryString != "width=10" || req.CallbackURL != "http://callback/" || string(req.Body) != "image" {
+		t.Errorf("want queued request to match the invocation, got: %+v", req)
+	}
+}
+
+func Test_AsyncHandler_QueueFull(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+
+	r := httptest.NewRequest(http.MethodPost, "http://system/async-function/resizer", nil)
+	r = mux.SetURLVars(r, map[string]string{"name": "resizer"})
+
+	w := httptest.NewRecorder()
+	MakeAsyncHandler(q).ServeHTTP(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("want status code '%d', got '%d'", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func Test_AsyncHandler_RequiresAuth(t *testing.T) {
+	q := queue.NewMemoryQueue(1)
+	lister := functionLister(t, functionDeployment("private", map[string]string{auth.RequiredAnnotation: "true"}))
+	authenticator := tokenAuthenticator{
+		"Bearer admin": &auth.Identity{Subject: "admin", Method: auth.MethodJWT},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/async-function/{name}", MakeAuthHandler(MakeAsyncHandler(q), authenticator, lister, testNamespace))
+
+	r := httptest.NewRequest(http.MethodPost, "http://system/async-function/private", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusUnauthorized, w.Code)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("want no queued request, got %d", q.Len())
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "http://system/async-function/private", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+}
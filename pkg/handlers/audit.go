@@ -0,0 +1,145 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/audit"
+	"github.com/openfaas/faas-netes/pkg/auth"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// maxAuditError is how much of the body of a failed response is kept in its record
+const maxAuditError = 512
+
+// secretVerbs are the verbs of the records of the SecretHandler and of the namespace
+// handler for each method
+var secretVerbs = map[string]string{
+	http.MethodGet:    "list",
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodDelete: "delete",
+}
+
+// Audit wraps a handler of the REST API so that each call of it is recorded
+type Audit func(kind, verb string, source NamespaceSource, next http.HandlerFunc) http.HandlerFunc
+
+// NewAudit returns an Audit that wraps handlers with MakeAuditedHandler
+func NewAudit(auditor *audit.Auditor, authenticator auth.Authenticator, lister v1.DeploymentLister, defaultNamespace string) Audit {
+	return func(kind, verb string, source NamespaceSource, next http.HandlerFunc) http.HandlerFunc {
+		return MakeAuditedHandler(next, kind, verb, source, auditor, authenticator, lister, defaultNamespace)
+	}
+}
+
+// MakeAuditedHandler records the caller, target, changes and outcome of each call of
+// next with auditor. The verb of secrets and namespaces is taken from the method when
+// verb is empty. It wraps MakeAuthorizedHandler so that denied calls are recorded too.
+// Every call is passed to next unchanged when auditor is nil.
+func MakeAuditedHandler(next http.HandlerFunc, kind, verb string, source NamespaceSource, auditor *audit.Auditor, authenticator auth.Authenticator, lister v1.DeploymentLister, defaultNamespace string) http.HandlerFunc {
+	if auditor == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := requestNamespace(r, source, defaultNamespace)
+
+		var body []byte
+		if r.Body != nil {
+			body, _ = ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		}
+
+		record := audit.Record{
+			Source:    audit.SourceAPI,
+			Caller:    auth.SubjectAnonymous,
+			Namespace: namespace,
+			Kind:      kind,
+			Name:      requestName(r, body),
+			Verb:      verb,
+		}
+		if len(record.Verb) == 0 {
+			record.Verb = secretVerbs[r.Method]
+		}
+
+		// credentials that fail to verify are recorded as anonymous, the call is denied
+		if identity, err := authenticator.Authenticate(r, namespace); err == nil && identity != nil {
+			record.Caller = identity.String()
+		}
+
+		var previous interface{}
+		if kind == audit.KindFunction && len(record.Name) > 0 && lister != nil {
+			if function, err := getService(namespace, record.Name, lister); err == nil && function != nil {
+				previous = function
+			}
+		}
+
+		recorder := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		record.Status = recorder.status
+		record.Outcome = audit.OutcomeFor(recorder.status)
+		if record.Outcome != audit.OutcomeSuccess {
+			record.Error = strings.TrimSpace(recorder.body.String())
+		}
+		if len(body) > 0 && r.Method != http.MethodGet && record.Verb != auth.VerbDelete {
+			record.Diff = audit.Diff(previous, body)
+		}
+
+		auditor.Record(record)
+	}
+}
+
+// requestName returns the name of the function or secret that a request acts on,
+// from the path or from the JSON body
+func requestName(r *http.Request, body []byte) string {
+	if name := mux.Vars(r)["name"]; len(name) > 0 {
+		return name
+	}
+
+	req := struct {
+		Service      string `json:"service"`
+		ServiceName  string `json:"serviceName"`
+		FunctionName string `json:"functionName"`
+		Name         string `json:"name"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	for _, name := range []string{req.Service, req.ServiceName, req.FunctionName, req.Name} {
+		if len(name) > 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// auditResponseWriter keeps the status and the start of the body of a response
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if remaining := maxAuditError - w.body.Len(); remaining > 0 {
+		if len(data) < remaining {
+			remaining = len(data)
+		}
+		w.body.Write(data[:remaining])
+	}
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/audit"
+	"github.com/openfaas/faas-netes/pkg/auth"
+)
+
+type memorySink []audit.Record
+
+func (s *memorySink) Write(record audit.Record) error {
+	*s = append(*s, record)
+	return nil
+}
+
+func Test_AuditedHandler(t *testing.T) {
+	authenticator := tokenAuthenticator{
+		"Bearer alice": &auth.Identity{Subject: "alice", Method: auth.MethodJWT},
+	}
+	lister := functionLister(t, functionDeployment("nodeinfo", nil))
+
+	cases := []struct {
+		name    string
+		kind    string
+		verb    string
+		source  NamespaceSource
+		method  string
+		url     string
+		body    string
+		token   string
+		status  int
+		want    audit.Record
+		changes []string
+	}{
+		{
+			name: "update", kind: audit.KindFunction, verb: "update", source: NamespaceFromBody, method: http.MethodPut, url: "/system/functions",
+			body: `{"service": "nodeinfo", "image": "functions/nodeinfo:0.2"}`, token: "Bearer alice", status: http.StatusAccepted,
+			want:    audit.Record{Caller: "jwt:alice", Namespace: testNamespace, Name: "nodeinfo", Verb: "update", Outcome: audit.OutcomeSuccess},
+			changes: []string{"image"},
+		},
+		{
+			name: "denied delete", kind: audit.KindFunction, verb: auth.VerbDelete, source: NamespaceFromQuery, method: http.MethodDelete, url: "/system/functions?namespace=team-a",
+			body: `{"functionName": "nodeinfo"}`, status: http.StatusUnauthorized,
+			want: audit.Record{Caller: "anonymous", Namespace: "team-a", Name: "nodeinfo", Verb: auth.VerbDelete, Outcome: audit.OutcomeDenied, Error: "authentication required"},
+		},
+		{
+			name: "secret", kind: audit.KindSecret, source: NamespaceFromQueryOrBody, method: http.MethodPut, url: "/system/secrets",
+			body: `{"name": "db-password", "value": "s3cr3t"}`, token: "Bearer alice", status: http.StatusOK,
+			want:    audit.Record{Caller: "jwt:alice", Namespace: testNamespace, Name: "db-password", Verb: "update", Outcome: audit.OutcomeSuccess},
+			changes: []string{"value"},
+		},
+		{
+			name: "failed rollback", kind: audit.KindFunction, verb: "rollback", source: NamespaceFromQuery, method: http.MethodPost, url: "/system/function/nodeinfo/rollback",
+			token: "Bearer alice", status: http.StatusNotFound,
+			want: audit.Record{Caller: "jwt:alice", Namespace: testNamespace, Name: "nodeinfo", Verb: "rollback", Outcome: audit.OutcomeFailure, Error: "no previous revision"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &memorySink{}
+			var body string
+			handler := MakeAuditedHandler(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+				if tc.status >= http.StatusBadRequest {
+					http.Error(w, tc.want.Error, tc.status)
+					return
+				}
+				w.WriteHeader(tc.status)
+			}, tc.kind, tc.verb, tc.source, audit.New(sink), authenticator, lister, testNamespace)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/system/function/{name}/rollback", handler)
+			router.HandleFunc("/system/functions", handler)
+			router.HandleFunc("/system/secrets", handler)
+
+			r := httptest.NewRequest(tc.method, "http://gateway"+tc.url, strings.NewReader(tc.body))
+			if len(tc.token) > 0 {
+				r.Header.Set("Authorization", tc.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if body != tc.body {
+				t.Errorf("want the body to be passed on, got: %q", body)
+			}
+			if len(*sink) != 1 {
+				t.Fatalf("want 1 record, got: %d", len(*sink))
+			}
+
+			got := (*sink)[0]
+			if got.Source != audit.SourceAPI || got.Kind != tc.kind || got.Status != tc.status {
+				t.Errorf("want an api record of a %s with status %d, got: %+v", tc.kind, tc.status, got)
+			}
+			if got.Caller != tc.want.Caller || got.Namespace != tc.want.Namespace || got.Name != tc.want.Name ||
+				got.Verb != tc.want.Verb || got.Outcome != tc.want.Outcome || got.Error != tc.want.Error {
+				t.Errorf("want record %+v, got: %+v", tc.want, got)
+			}
+			if len(got.Diff) != len(tc.changes) {
+				t.Fatalf("want changes %v, got: %+v", tc.changes, got.Diff)
+			}
+			for i, field := range tc.changes {
+				if got.Diff[i].Field != field {
+					t.Errorf("want change of %s, got: %+v", field, got.Diff[i])
+				}
+			}
+			if tc.kind == audit.KindSecret && got.Diff[0].To != audit.Redacted {
+				t.Errorf("want the secret to be redacted, got: %v", got.Diff[0].To)
+			}
+		})
+	}
+}
+
+func Test_AuditedHandler_Disabled(t *testing.T) {
+	called := false
+	next := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}
+
+	handler := MakeAuditedHandler(next, audit.KindFunction, auth.VerbDeploy, NamespaceFromBody, nil, tokenAuthenticator{}, nil, testNamespace)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "http://gateway/system/functions", nil))
+
+	if !called {
+		t.Errorf("want the handler to be called")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/auth"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// MakeAuthHandler checks the caller of an invocation against the auth annotations of
+// the function before next is called. The identity of an authenticated caller is
+// forwarded to the function in headers and is available to the next handlers through
+// auth.IdentityFrom.
+func MakeAuthHandler(next http.HandlerFunc, authenticator auth.Authenticator, lister v1.DeploymentLister, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := k8s.GetFuncName(mux.Vars(r)["name"], defaultNamespace)
+
+		requirement := auth.Requirement{}
+		function, err := getService(namespace, functionName, lister)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to get function %s.%s", functionName, namespace), http.StatusInternalServerError)
+			return
+		}
+		if function != nil && function.Annotations != nil {
+			if requirement, err = auth.ParseRequirement(*function.Annotations); err != nil {
+				log.Printf("Invalid auth annotations on %s.%s: %s\n", functionName, namespace, err.Error())
+				http.Error(w, "invalid auth annotations", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		identity, err := authenticator.Authenticate(r, namespace)
+		if err != nil {
+			if !requirement.Required {
+				// the credentials may be meant for the function itself
+				identity = nil
+			} else if errors.Is(err, auth.ErrInvalidCredentials) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			} else {
+				log.Printf("Unable to authenticate invocation of %s.%s: %s\n", functionName, namespace, err.Error())
+				http.Error(w, "unable to authenticate", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if requirement.Required {
+			if identity == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !identity.HasScopes(requirement.Scopes) {
+				http.Error(w, fmt.Sprintf("%s is missing a required scope", identity.Subject), http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, auth.ForwardIdentity(r, identity))
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/auth"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// tokenAuthenticator accepts the bearer tokens of its map
+type tokenAuthenticator map[string]*auth.Identity
+
+func (a tokenAuthenticator) Authenticate(r *http.Request, namespace string) (*auth.Identity, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) == 0 {
+		return nil, nil
+	}
+	if identity, ok := a[header]; ok {
+		return identity, nil
+	}
+	return nil, fmt.Errorf("%w: unknown token", auth.ErrInvalidCredentials)
+}
+
+func functionLister(t *testing.T, deployments ...*appsv1.Deployment) appslisters.DeploymentLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, deployment := range deployments {
+		if err := indexer.Add(deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return appslisters.NewDeploymentLister(indexer)
+}
+
+func functionDeployment(name string, annotations map[string]string) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace}}
+	deployment.Spec.Template.Labels = map[string]string{"faas_function": name}
+	deployment.Spec.Template.Annotations = annotations
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: name, Image: "functions/" + name}}
+	return deployment
+}
+
+func Test_AuthHandler(t *testing.T) {
+	authenticator := tokenAuthenticator{
+		"Bearer reader": &auth.Identity{Subject: "reader", Method: auth.MethodJWT, Scopes: []string{"read"}},
+		"Bearer admin":  &auth.Identity{Subject: "admin", Method: auth.MethodJWT, Scopes: []string{"read", "write"}},
+	}
+	lister := functionLister(t,
+		functionDeployment("public", nil),
+		functionDeployment("private", map[string]string{auth.RequiredAnnotation: "true"}),
+		functionDeployment("writer", map[string]string{auth.ScopesAnnotation: "write"}),
+	)
+
+	cases := []struct {
+		function string
+		token    string
+		spoofed  string
+		status   int
+		subject  string
+	}{
+		{function: "public", status: http.StatusOK},
+		{function: "public", spoofed: "admin", status: http.StatusOK},
+		{function: "public", token: "Bearer reader", status: http.StatusOK, subject: "reader"},
+		{function: "public", token: "Bearer for-the-function", status: http.StatusOK},
+		{function: "private", status: http.StatusUnauthorized},
+		{function: "private", spoofed: "admin", status: http.StatusUnauthorized},
+		{function: "private", token: "Bearer unknown", status: http.StatusUnauthorized},
+		{function: "private", token: "Bearer reader", status: http.StatusOK, subject: "reader"},
+		{function: "writer", token: "Bearer reader", status: http.StatusForbidden},
+		{function: "writer", token: "Bearer admin", status: http.StatusOK, subject: "admin"},
+		{function: "missing", status: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s %s %s", tc.function, tc.token, tc.spoofed), func(t *testing.T) {
+			var subject string
+			var identity *auth.Identity
+			handler := MakeAuthHandler(func(w http.ResponseWriter, r *http.Request) {
+				subject = r.Header.Get(auth.SubjectHeader)
+				identity = auth.IdentityFrom(r.Context())
+			}, authenticator, lister, testNamespace)
+
+			r := httptest.NewRequest(http.MethodPost, "http://gateway/function/"+tc.function, nil)
+			if len(tc.token) > 0 {
+				r.Header.Set("Authorization", tc.token)
+			}
+			if len(tc.spoofed) > 0 {
+				r.Header.Set(auth.SubjectHeader, tc.spoofed)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, mux.SetURLVars(r, map[string]string{"name": tc.function}))
+
+			if w.Code != tc.status {
+				t.Fatalf("want status code %d, got: %d", tc.status, w.Code)
+			}
+			if subject != tc.subject {
+				t.Errorf("want subject header %q, got: %q", tc.subject, subject)
+			}
+			if len(tc.subject) > 0 && (identity == nil || identity.Subject != tc.subject) {
+				t.Errorf("want identity %s in the context, got: %+v", tc.subject, identity)
+			}
+		})
+	}
+}
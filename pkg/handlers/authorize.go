@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/openfaas/faas-netes/pkg/auth"
+)
+
+// NamespaceSource is where a handler reads the namespace of a request from
+type NamespaceSource int
+
+const (
+	// NamespaceFromQuery reads the namespace query parameter
+	NamespaceFromQuery NamespaceSource = iota
+	// NamespaceFromBody reads the namespace field of the JSON body
+	NamespaceFromBody
+	// NamespaceFromQueryOrBody reads the query of GET requests and the body of others,
+	// like NewNamespaceResolver
+	NamespaceFromQueryOrBody
+	// NamespaceFromName reads the name field of the JSON body, for the requests that act
+	// on a namespace itself
+	NamespaceFromName
+)
+
+// Authorize wraps a handler of the REST API so that it checks verb in the namespace
+// that the handler reads from source before it is called
+type Authorize func(verb string, source NamespaceSource, next http.HandlerFunc) http.HandlerFunc
+
+// NewAuthorize returns an Authorize that wraps handlers with MakeAuthorizedHandler
+func NewAuthorize(authenticator auth.Authenticator, policy *auth.Policy, defaultNamespace string) Authorize {
+	return func(verb string, source NamespaceSource, next http.HandlerFunc) http.HandlerFunc {
+		return MakeAuthorizedHandler(next, verb, source, authenticator, policy, defaultNamespace)
+	}
+}
+
+// MakeAuthorizedHandler only calls next when policy grants verb to the caller in the
+// namespace of the request. Every request is allowed when policy is nil.
+func MakeAuthorizedHandler(next http.HandlerFunc, verb string, source NamespaceSource, authenticator auth.Authenticator, policy *auth.Policy, defaultNamespace string) http.HandlerFunc {
+	if policy == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := requestNamespace(r, source, defaultNamespace)
+
+		// API keys are looked up in the namespace that the request acts on
+		identity, err := authenticator.Authenticate(r, namespace)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			log.Printf("Unable to authenticate %s request: %s\n", verb, err.Error())
+			http.Error(w, "unable to authenticate", http.StatusInternalServerError)
+			return
+		}
+
+		if !policy.Allows(identity, namespace, verb) {
+			if identity == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			log.Printf("Denied %s in %s to %s\n", verb, namespace, identity.String())
+			http.Error(w, fmt.Sprintf("%s may not %s in the %s namespace", identity.Subject, verb, namespace), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requestNamespace returns the namespace that a handler reads from source, the body is
+// restored so that the handler can read it again
+func requestNamespace(r *http.Request, source NamespaceSource, defaultNamespace string) string {
+	namespace := ""
+
+	if source == NamespaceFromQuery || (source == NamespaceFromQueryOrBody && r.Method == http.MethodGet) {
+		namespace = r.URL.Query().Get("namespace")
+	} else if r.Body != nil {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		req := struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		}{}
+		if err := json.Unmarshal(body, &req); err == nil {
+			namespace = req.Namespace
+			if source == NamespaceFromName {
+				namespace = req.Name
+			}
+		}
+	}
+
+	if len(namespace) == 0 {
+		return defaultNamespace
+	}
+	return namespace
+}
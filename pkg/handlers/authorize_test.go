@@ -0,0 +1,96 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/auth"
+)
+
+func Test_AuthorizedHandler(t *testing.T) {
+	authenticator := tokenAuthenticator{
+		"Bearer alice": &auth.Identity{Subject: "alice", Method: auth.MethodJWT},
+	}
+	policy, err := auth.ParsePolicy([]byte(`
+rules:
+- subjects: ["jwt:alice"]
+  namespaces: ["team-a"]
+  verbs: ["read", "deploy"]
+- subjects: ["anonymous"]
+  namespaces: ["*"]
+  verbs: ["scale"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		verb   string
+		source NamespaceSource
+		method string
+		url    string
+		body   string
+		token  string
+		status int
+	}{
+		{name: "body namespace", verb: auth.VerbDeploy, source: NamespaceFromBody, method: http.MethodPost, url: "/system/functions", body: `{"service": "nodeinfo", "namespace": "team-a"}`, token: "Bearer alice", status: http.StatusOK},
+		{name: "query namespace", verb: auth.VerbDeploy, source: NamespaceFromQuery, method: http.MethodPost, url: "/system/function/nodeinfo/rollback?namespace=team-a", token: "Bearer alice", status: http.StatusOK},
+		{name: "default namespace", verb: auth.VerbDeploy, source: NamespaceFromBody, method: http.MethodPost, url: "/system/functions", body: `{"service": "nodeinfo"}`, token: "Bearer alice", status: http.StatusForbidden},
+		{name: "body namespace ignored by the handler", verb: auth.VerbDeploy, source: NamespaceFromQuery, method: http.MethodDelete, url: "/system/functions", body: `{"functionName": "nodeinfo", "namespace": "team-a"}`, token: "Bearer alice", status: http.StatusForbidden},
+		{name: "verb not granted", verb: auth.VerbDelete, source: NamespaceFromQuery, method: http.MethodDelete, url: "/system/functions?namespace=team-a", body: `{"functionName": "nodeinfo"}`, token: "Bearer alice", status: http.StatusForbidden},
+		{name: "anonymous", verb: auth.VerbDeploy, source: NamespaceFromBody, method: http.MethodPost, url: "/system/functions", body: `{"service": "nodeinfo", "namespace": "team-a"}`, status: http.StatusUnauthorized},
+		{name: "invalid credentials", verb: auth.VerbDeploy, source: NamespaceFromBody, method: http.MethodPost, url: "/system/functions", body: `{"namespace": "team-a"}`, token: "Bearer unknown", status: http.StatusUnauthorized},
+		{name: "anonymous scale", verb: auth.VerbScale, source: NamespaceFromQuery, method: http.MethodPost, url: "/system/scale-function/nodeinfo", body: `{"serviceName": "nodeinfo", "replicas": 1}`, status: http.StatusOK},
+		{name: "namespace name", verb: auth.VerbDeploy, source: NamespaceFromName, method: http.MethodPost, url: "/system/namespaces", body: `{"name": "team-a", "namespace": "openfaas-fn"}`, token: "Bearer alice", status: http.StatusOK},
+		{name: "list functions", verb: auth.VerbRead, source: NamespaceFromQuery, method: http.MethodGet, url: "/system/functions?namespace=team-a", token: "Bearer alice", status: http.StatusOK},
+		{name: "list functions in another namespace", verb: auth.VerbRead, source: NamespaceFromQuery, method: http.MethodGet, url: "/system/functions?namespace=team-b", token: "Bearer alice", status: http.StatusForbidden},
+		{name: "list functions in the default namespace", verb: auth.VerbRead, source: NamespaceFromQuery, method: http.MethodGet, url: "/system/functions", token: "Bearer alice", status: http.StatusForbidden},
+		{name: "revisions in another namespace", verb: auth.VerbRead, source: NamespaceFromQuery, method: http.MethodGet, url: "/system/function/nodeinfo/revisions?namespace=team-b", token: "Bearer alice", status: http.StatusForbidden},
+		{name: "anonymous read", verb: auth.VerbRead, source: NamespaceFromQuery, method: http.MethodGet, url: "/system/function/nodeinfo?namespace=team-a", status: http.StatusUnauthorized},
+		{name: "secrets query", verb: auth.VerbSecrets, source: NamespaceFromQueryOrBody, method: http.MethodGet, url: "/system/secrets?namespace=team-a", token: "Bearer alice", status: http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body string
+			handler := MakeAuthorizedHandler(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+			}, tc.verb, tc.source, authenticator, policy, testNamespace)
+
+			r := httptest.NewRequest(tc.method, "http://gateway"+tc.url, strings.NewReader(tc.body))
+			if len(tc.token) > 0 {
+				r.Header.Set("Authorization", tc.token)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tc.status {
+				t.Fatalf("want status code %d, got: %d %s", tc.status, w.Code, w.Body.String())
+			}
+			if tc.status == http.StatusOK && body != tc.body {
+				t.Errorf("want the body to be passed on, got: %q", body)
+			}
+		})
+	}
+}
+
+func Test_AuthorizedHandler_NoPolicy(t *testing.T) {
+	called := false
+	handler := MakeAuthorizedHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, auth.VerbDelete, NamespaceFromQuery, tokenAuthenticator{}, nil, testNamespace)
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "http://gateway/system/functions", nil))
+	if !called {
+		t.Errorf("want every request to be allowed without a policy")
+	}
+}
@@ -0,0 +1,736 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/cron"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/proxy"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DeployStrategyAnnotation selects how an update is rolled out, either "rolling"
+	// which is the default or "bluegreen"
+	DeployStrategyAnnotation = "com.openfaas.deploy.strategy"
+
+	// DeployTimeoutAnnotation is the time that a blue/green update may take to become
+	// available and pass its smoke test, such as "90s"
+	DeployTimeoutAnnotation = "com.openfaas.deploy.timeout"
+
+	// DeploySmokeTestAnnotation is the path that is invoked on the new version of a
+	// blue/green update, it must return a 2xx status before the version receives traffic
+	DeploySmokeTestAnnotation = "com.openfaas.deploy.smoketest"
+
+	// RollingStrategy updates the function's Deployment in place
+	RollingStrategy = "rolling"
+
+	// BlueGreenStrategy starts the new version next to the current one and only
+	// switches traffic once it is available and healthy
+	BlueGreenStrategy = "bluegreen"
+
+	// BlueGreenSuffix is appended to the name of a function to name the new version
+	// during a blue/green update, the new version is recognised by BlueGreenLabel
+	BlueGreenSuffix = "-green"
+
+	// BlueGreenLabel is set on the Deployment of the new version of a blue/green update
+	// to the name of the function that is updated
+	BlueGreenLabel = "com.openfaas.deploy.bluegreen"
+
+	// BlueGreenStatusAnnotation holds the BlueGreenStatus of the last blue/green update
+	// of a function as JSON, it is set on the function's Deployment
+	BlueGreenStatusAnnotation = "com.openfaas.deploy.status"
+
+	defaultBlueGreenTimeout = 2 * time.Minute
+)
+
+// Phases of a blue/green update
+const (
+	// BlueGreenPending means that the new version is starting and has to pass its gate
+	BlueGreenPending = "Pending"
+
+	// BlueGreenPromoting means that the new version serves all traffic while the
+	// function's Deployment is replaced with it
+	BlueGreenPromoting = "Promoting"
+
+	// BlueGreenSucceeded means that the function runs the new version
+	BlueGreenSucceeded = "Succeeded"
+
+	// BlueGreenFailed means that the function was left at, or rolled back to, the
+	// version that it ran before the update
+	BlueGreenFailed = "Failed"
+)
+
+// BlueGreenStatus is the state of a blue/green update of a function
+type BlueGreenStatus struct {
+	Phase string `json:"phase"`
+
+	// Image is the image that was requested
+	Image string `json:"image"`
+
+	// ImageDigest is the digest of the image that passed the gate, the function is
+	// pinned to it when the new version is promoted
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Timeout is the time that the new version had to pass its gate
+	Timeout string `json:"timeout"`
+
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// Message explains why the update failed
+	Message string `json:"message,omitempty"`
+}
+
+// Active returns true while the update is in progress
+func (s BlueGreenStatus) Active() bool {
+	return s.Phase == BlueGreenPending || s.Phase == BlueGreenPromoting
+}
+
+// BlueGreenUpdater performs blue/green updates of functions. The new version is
+// deployed as a temporary function next to the current one and has to become available
+// and pass an optional smoke test through the resolver. The function's Service is then
+// cut over to the new version, which serves all traffic while the old version is
+// retired by replacing the function's Deployment with the new spec, pinned to the
+// image digest that passed the gate. The Service is pointed back at the function's
+// Deployment once it is available and the temporary function is removed, so that
+// Deployments can still be looked up by the name of the function.
+//
+// The state of an update is kept in BlueGreenStatusAnnotation on the function's
+// Deployment, Recover completes or rolls back the updates that were interrupted by a
+// restart.
+type BlueGreenUpdater struct {
+	factory  k8s.FunctionFactory
+	resolver proxy.BaseURLResolver
+	client   *http.Client
+	interval time.Duration
+
+	updates sync.WaitGroup
+}
+
+// NewBlueGreenUpdater creates a BlueGreenUpdater, the resolver is used to invoke the
+// smoke test of the new version
+func NewBlueGreenUpdater(factory k8s.FunctionFactory, resolver proxy.BaseURLResolver) *BlueGreenUpdater {
+	return &BlueGreenUpdater{
+		factory:  factory,
+		resolver: resolver,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: time.Second,
+	}
+}
+
+// IsBlueGreen returns true when the request asks for a blue/green update
+func IsBlueGreen(request types.FunctionDeployment) bool {
+	return request.Annotations != nil && (*request.Annotations)[DeployStrategyAnnotation] == BlueGreenStrategy
+}
+
+// ReadBlueGreenStatus returns the status of the last blue/green update of the function
+// that deployment runs, or nil when it was never updated with a blue/green update
+func ReadBlueGreenStatus(deployment *appsv1.Deployment) (*BlueGreenStatus, error) {
+	value, ok := deployment.Annotations[BlueGreenStatusAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	status := &BlueGreenStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", BlueGreenStatusAnnotation, err.Error())
+	}
+	return status, nil
+}
+
+// MakeBlueGreenStatusHandler returns the status of the last blue/green update of a
+// function, with a 404 status when it was never updated with a blue/green update
+func MakeBlueGreenStatusHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		deployment, err, status := getDeployment(r.Context(), lookupNamespace, factory, functionName)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		updateStatus, err := ReadBlueGreenStatus(deployment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if updateStatus == nil {
+			http.Error(w, fmt.Sprintf("function %s.%s has no blue/green update", functionName, lookupNamespace), http.StatusNotFound)
+			return
+		}
+
+		res, err := json.Marshal(updateStatus)
+		if err != nil {
+			http.Error(w, "failed to marshal status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
+
+// Start deploys the new version of the function and runs the rest of the update in
+// the background, since it can take longer than the write timeout of the API
+func (b *BlueGreenUpdater) Start(ctx context.Context, namespace string, request types.FunctionDeployment) (err error, httpStatus int) {
+	timeout := defaultBlueGreenTimeout
+	if value, ok := (*request.Annotations)[DeployTimeoutAnnotation]; ok {
+		if timeout, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid %s: %s", DeployTimeoutAnnotation, err.Error()), http.StatusBadRequest
+		}
+	}
+
+	current, err, status := getDeployment(ctx, namespace, b.factory, request.Service)
+	if err != nil {
+		return err, status
+	}
+
+	if err, status := checkNoBlueGreenUpdate(current); err != nil {
+		return err, status
+	}
+
+	green := request
+	green.Service = request.Service + BlueGreenSuffix
+
+	// the new version must not be invoked by connectors or the scheduler next to
+	// the function itself, nor claim the function's domain
+	greenAnnotations := map[string]string{}
+	for k, v := range *request.Annotations {
+		if k != cron.TopicAnnotation && k != k8s.DomainAnnotation {
+			greenAnnotations[k] = v
+		}
+	}
+	green.Annotations = &greenAnnotations
+
+	secrets := b.factory.SecretsClient()
+	existingSecrets, err := secrets.GetSecrets(namespace, k8s.RequiredSecrets(green.Secrets, greenAnnotations))
+	if err != nil {
+		return fmt.Errorf("unable to fetch secrets: %s", err.Error()), http.StatusBadRequest
+	}
+
+	deployment, err := makeDeploymentSpec(green, existingSecrets, b.factory)
+	if err != nil {
+		return fmt.Errorf("failed create Deployment spec: %s", err.Error()), http.StatusBadRequest
+	}
+
+	profileList, err := b.factory.GetProfiles(ctx, b.factory.Config.ProfilesNamespace, *green.Annotations)
+	if err != nil {
+		return fmt.Errorf("failed create Deployment spec: %s", err.Error()), http.StatusBadRequest
+	}
+	for _, profile := range profileList {
+		b.factory.ApplyProfile(profile, deployment)
+	}
+
+	// the new version has to be able to take all of the function's traffic
+	deployment.Spec.Replicas = current.Spec.Replicas
+	deployment.Labels[BlueGreenLabel] = request.Service
+
+	if _, err := b.factory.Client.AppsV1().Deployments(namespace).Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return b.greenConflict(ctx, namespace, request.Service, green.Service), http.StatusConflict
+		}
+		status, _ := ProcessErrorReasons(err)
+		return fmt.Errorf("unable create Deployment: %s", err.Error()), status
+	}
+
+	updateStatus := BlueGreenStatus{
+		Phase:   BlueGreenPending,
+		Image:   request.Image,
+		Timeout: timeout.String(),
+		Started: time.Now().UTC(),
+	}
+	if err := b.setStatus(ctx, namespace, request.Service, updateStatus); err != nil {
+		status, _ := ProcessErrorReasons(err)
+		b.removeGreen(namespace, green.Service)
+		return fmt.Errorf("unable to record the update: %s", err.Error()), status
+	}
+
+	if _, err := b.factory.Client.CoreV1().Services(namespace).Create(ctx, makeServiceSpec(green, b.factory), metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		status, _ := ProcessErrorReasons(err)
+		wrappedErr := fmt.Errorf("failed create Service: %s", err.Error())
+		b.fail(namespace, request.Service, green.Service, updateStatus, wrappedErr)
+		return wrappedErr, status
+	}
+
+	// the new version is isolated in the same way as the function
+	if err := applyOwnedResources(ctx, b.factory, namespace, green); err != nil {
+		status, _ := ProcessErrorReasons(err)
+		wrappedErr := fmt.Errorf("failed create function resources: %s", err.Error())
+		b.fail(namespace, request.Service, green.Service, updateStatus, wrappedErr)
+		return wrappedErr, status
+	}
+
+	log.Printf("Blue/green update of %s.%s started, waiting up to %s for %s\n", request.Service, namespace, timeout, green.Service)
+
+	b.updates.Add(1)
+	go func() {
+		defer b.updates.Done()
+		b.run(namespace, request, green.Service, timeout, updateStatus)
+	}()
+
+	return nil, http.StatusAccepted
+}
+
+// Wait blocks until the blue/green updates that were started have finished
+func (b *BlueGreenUpdater) Wait() {
+	b.updates.Wait()
+}
+
+// Recover finds the blue/green updates in namespace, or in all namespaces when it is
+// empty, that were interrupted by a restart. An update that had not passed its gate
+// is rolled back, an update that was being promoted is completed in the background.
+func (b *BlueGreenUpdater) Recover(ctx context.Context, namespace string) error {
+	greens, err := b.factory.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: BlueGreenLabel,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list blue/green updates: %s", err.Error())
+	}
+
+	for _, green := range greens.Items {
+		functionName := green.Labels[BlueGreenLabel]
+
+		current, err := b.factory.Client.AppsV1().Deployments(green.Namespace).Get(ctx, functionName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			log.Printf("Removing blue/green update %s.%s of a deleted function\n", green.Name, green.Namespace)
+			b.removeGreen(green.Namespace, green.Name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get Deployment %s.%s: %s", functionName, green.Namespace, err.Error())
+		}
+
+		updateStatus, err := ReadBlueGreenStatus(current)
+		if err != nil || updateStatus == nil {
+			updateStatus = &BlueGreenStatus{Phase: BlueGreenPending, Started: current.CreationTimestamp.UTC()}
+		}
+
+		if updateStatus.Phase != BlueGreenPromoting {
+			log.Printf("Rolling back blue/green update of %s.%s, it was interrupted before it passed its gate\n", functionName, green.Namespace)
+			b.fail(green.Namespace, functionName, green.Name, *updateStatus, fmt.Errorf("interrupted by a restart before the new version passed its gate"))
+			continue
+		}
+
+		timeout, err := time.ParseDuration(updateStatus.Timeout)
+		if err != nil {
+			timeout = defaultBlueGreenTimeout
+		}
+
+		log.Printf("Resuming the promotion of blue/green update of %s.%s\n", functionName, green.Namespace)
+
+		b.updates.Add(1)
+		go func(current *appsv1.Deployment, green string, updateStatus BlueGreenStatus) {
+			defer b.updates.Done()
+			b.resume(current, green, timeout, updateStatus)
+		}(current.DeepCopy(), green.Name, *updateStatus)
+	}
+
+	return nil
+}
+
+func (b *BlueGreenUpdater) run(namespace string, request types.FunctionDeployment, green string, timeout time.Duration, updateStatus BlueGreenStatus) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := b.gate(ctx, namespace, green, (*request.Annotations)[DeploySmokeTestAnnotation]); err != nil {
+		log.Printf("Blue/green update of %s.%s failed, rolling back: %s\n", request.Service, namespace, err.Error())
+		b.fail(namespace, request.Service, green, updateStatus, err)
+		return
+	}
+
+	promoted, err := b.promote(namespace, request, green, timeout, &updateStatus)
+	if err != nil {
+		log.Printf("Blue/green update of %s.%s failed, rolled back: %s\n", request.Service, namespace, err.Error())
+		b.finish(namespace, request.Service, updateStatus, err)
+		return
+	}
+
+	log.Printf("Blue/green update of %s.%s completed: %s\n", request.Service, namespace, promoted.Image)
+
+	b.finish(namespace, request.Service, updateStatus, nil)
+	recordRevision(context.Background(), namespace, b.factory, promoted)
+}
+
+// resume completes a promotion that was interrupted by a restart. When the function's
+// Deployment was already updated to the new version, the Service is pointed back at it
+// once it is available. When it does not become available the function is rolled back
+// to its newest stored revision, which is the version it ran before the update.
+func (b *BlueGreenUpdater) resume(current *appsv1.Deployment, green string, timeout time.Duration, updateStatus BlueGreenStatus) {
+	namespace, functionName := current.Namespace, current.Name
+
+	image := updateStatus.Image
+	if len(updateStatus.ImageDigest) > 0 {
+		image = k8s.FunctionRevision{Image: updateStatus.Image, ImageDigest: updateStatus.ImageDigest}.ImageReference()
+	}
+
+	// the restart happened before the function's Deployment was updated
+	if k8s.AsFunctionStatus(*current).Image != image {
+		b.fail(namespace, functionName, green, updateStatus, fmt.Errorf("interrupted by a restart before the new version was promoted"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	defer b.removeGreen(namespace, green)
+
+	err := b.waitForAvailable(ctx, namespace, functionName)
+	if err != nil {
+		err = fmt.Errorf("%s did not become available: %s", functionName, err.Error())
+		log.Printf("Blue/green update of %s.%s failed, rolling back: %s\n", functionName, namespace, err.Error())
+
+		if rollbackErr := b.rollbackToRevision(namespace, functionName, timeout); rollbackErr != nil {
+			log.Printf("Rollback of %s.%s failed: %s\n", functionName, namespace, rollbackErr.Error())
+		}
+	} else {
+		// the Service and the objects owned by the Deployment are built from the
+		// labels and annotations that the Deployment was updated to
+		request := deploymentRequest(current)
+		if _, err, _ := updateService(namespace, b.factory, request, buildAnnotations(request)); err != nil {
+			log.Printf("Unable to update Service %s.%s: %s\n", functionName, namespace, err.Error())
+		}
+		if err := applyOwnedResources(ctx, b.factory, namespace, request); err != nil {
+			log.Printf("Unable to update the resources of %s.%s: %s\n", functionName, namespace, err.Error())
+		}
+	}
+
+	if selectErr := b.selectPods(context.Background(), namespace, functionName, functionName); selectErr != nil {
+		log.Printf("Unable to switch traffic back to %s.%s: %s\n", functionName, namespace, selectErr.Error())
+		if err == nil {
+			err = selectErr
+		}
+	}
+
+	// the full spec of the update is not kept, so no revision is recorded for it
+	b.finish(namespace, functionName, updateStatus, err)
+	if err == nil {
+		log.Printf("Blue/green update of %s.%s completed: %s\n", functionName, namespace, image)
+	}
+}
+
+// rollbackToRevision re-applies the newest stored revision of a function
+func (b *BlueGreenUpdater) rollbackToRevision(namespace, functionName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	revisions, err := b.factory.ListRevisions(ctx, namespace, functionName)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return fmt.Errorf("no revision is stored")
+	}
+
+	latest := revisions[len(revisions)-1]
+	request := latest.Spec
+	request.Image = latest.ImageReference()
+
+	if err, _ := updateFunction(ctx, namespace, b.factory, request, buildAnnotations(request)); err != nil {
+		return err
+	}
+	return b.waitForAvailable(ctx, namespace, functionName)
+}
+
+// gate waits for the new version to become available and to pass its smoke test
+func (b *BlueGreenUpdater) gate(ctx context.Context, namespace, green, smokeTest string) error {
+	if err := b.waitForAvailable(ctx, namespace, green); err != nil {
+		return fmt.Errorf("%s did not become available: %s", green, err.Error())
+	}
+
+	if len(smokeTest) == 0 {
+		return nil
+	}
+
+	if err := b.smokeTest(ctx, namespace, green, smokeTest); err != nil {
+		return fmt.Errorf("smoke test of %s failed: %s", green, err.Error())
+	}
+	return nil
+}
+
+// promote cuts the function's traffic over to the new version and retires the old
+// version by replacing the function's Deployment with the new spec, pinned to the
+// digest that passed the gate. Traffic is moved back to the function's Deployment once
+// it is available and the new version is removed. The request that the function was
+// updated to is returned.
+func (b *BlueGreenUpdater) promote(namespace string, request types.FunctionDeployment, green string, timeout time.Duration, updateStatus *BlueGreenStatus) (types.FunctionDeployment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	defer b.removeGreen(namespace, green)
+
+	promoted := request
+	if digest, err := b.factory.RunningImageDigest(ctx, namespace, green, request.Image); err == nil && len(digest) > 0 {
+		updateStatus.ImageDigest = digest
+		promoted.Image = k8s.FunctionRevision{Image: request.Image, ImageDigest: digest}.ImageReference()
+	}
+
+	if err := b.selectPods(ctx, namespace, request.Service, green); err != nil {
+		b.selectPods(context.Background(), namespace, request.Service, request.Service)
+		return promoted, fmt.Errorf("unable to switch traffic to %s: %s", green, err.Error())
+	}
+
+	// the promotion is recorded before the function's Deployment is updated, so that
+	// Recover can complete it
+	updateStatus.Phase = BlueGreenPromoting
+	if err := b.setStatus(ctx, namespace, request.Service, *updateStatus); err != nil {
+		b.selectPods(context.Background(), namespace, request.Service, request.Service)
+		return promoted, fmt.Errorf("unable to record the promotion: %s", err.Error())
+	}
+
+	annotations := buildAnnotations(promoted)
+	previous, err, _ := updateDeploymentSpec(ctx, namespace, b.factory, promoted, annotations)
+	if err == nil {
+		err = b.waitForAvailable(ctx, namespace, request.Service)
+	}
+
+	if err != nil {
+		if previous != nil {
+			if rollbackErr := rollbackDeployment(context.Background(), b.factory.Client, namespace, request.Service, previous); rollbackErr != nil {
+				log.Printf("Rollback of Deployment %s.%s failed: %s\n", request.Service, namespace, rollbackErr.Error())
+			}
+
+			restoreCtx, restoreCancel := context.WithTimeout(context.Background(), timeout)
+			b.waitForAvailable(restoreCtx, namespace, request.Service)
+			restoreCancel()
+		}
+
+		if selectErr := b.selectPods(context.Background(), namespace, request.Service, request.Service); selectErr != nil {
+			log.Printf("Unable to switch traffic back to %s.%s: %s\n", request.Service, namespace, selectErr.Error())
+		}
+		return promoted, err
+	}
+
+	if _, err, _ := updateService(namespace, b.factory, promoted, annotations); err != nil {
+		log.Printf("Unable to update Service %s.%s: %s\n", request.Service, namespace, err.Error())
+	}
+	if err := applyOwnedResources(ctx, b.factory, namespace, promoted); err != nil {
+		log.Printf("Unable to update the resources of %s.%s: %s\n", request.Service, namespace, err.Error())
+	}
+
+	return promoted, b.selectPods(context.Background(), namespace, request.Service, request.Service)
+}
+
+// waitForAvailable waits until all replicas of the Deployment are updated and available
+func (b *BlueGreenUpdater) waitForAvailable(ctx context.Context, namespace, name string) error {
+	var lastErr error
+
+	err := wait.PollImmediateUntil(b.interval, func() (bool, error) {
+		deployment, err := b.factory.Client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return false, err
+			}
+			lastErr = err
+			return false, nil
+		}
+
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				return false, fmt.Errorf("%s", condition.Message)
+			}
+		}
+
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+
+		lastErr = fmt.Errorf("%d of %d replicas available", deployment.Status.AvailableReplicas, replicas)
+
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.UpdatedReplicas >= replicas &&
+			deployment.Status.AvailableReplicas >= replicas, nil
+	}, ctx.Done())
+
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// smokeTest invokes path on the function through the resolver until it returns a 2xx
+// status. The request is retried because the resolver only sees new endpoints once
+// its informer has synced.
+func (b *BlueGreenUpdater) smokeTest(ctx context.Context, namespace, name, path string) error {
+	var lastErr error
+
+	err := wait.PollImmediateUntil(b.interval, func() (bool, error) {
+		functionURL, err := b.resolver.Resolve(name + "." + namespace)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		functionURL.Path = path
+
+		req, err := http.NewRequest(http.MethodGet, functionURL.String(), nil)
+		if err != nil {
+			return false, err
+		}
+
+		res, err := b.client.Do(req.WithContext(ctx))
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			lastErr = fmt.Errorf("%s returned status %d", path, res.StatusCode)
+			return false, nil
+		}
+		return true, nil
+	}, ctx.Done())
+
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// selectPods points the function's Service at the pods of target
+func (b *BlueGreenUpdater) selectPods(ctx context.Context, namespace, functionName, target string) error {
+	services := b.factory.Client.CoreV1().Services(namespace)
+
+	service, err := services.Get(ctx, functionName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	service.Spec.Selector = map[string]string{"faas_function": target}
+
+	_, err = services.Update(ctx, service, metav1.UpdateOptions{})
+	return err
+}
+
+// removeGreen deletes the new version of a blue/green update
+func (b *BlueGreenUpdater) removeGreen(namespace, green string) {
+	foregroundPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{PropagationPolicy: &foregroundPolicy}
+
+	if err := b.factory.Client.AppsV1().Deployments(namespace).Delete(context.Background(), green, opts); err != nil && !errors.IsNotFound(err) {
+		log.Printf("Unable to delete Deployment %s.%s: %s\n", green, namespace, err.Error())
+	}
+
+	if err := b.factory.Client.CoreV1().Services(namespace).Delete(context.Background(), green, opts); err != nil && !errors.IsNotFound(err) {
+		log.Printf("Unable to delete Service %s.%s: %s\n", green, namespace, err.Error())
+	}
+}
+
+// fail points the function's Service back at its own Deployment, removes the new
+// version and records that the update failed
+func (b *BlueGreenUpdater) fail(namespace, functionName, green string, updateStatus BlueGreenStatus, cause error) {
+	if err := b.selectPods(context.Background(), namespace, functionName, functionName); err != nil && !errors.IsNotFound(err) {
+		log.Printf("Unable to switch traffic back to %s.%s: %s\n", functionName, namespace, err.Error())
+	}
+
+	b.removeGreen(namespace, green)
+	b.finish(namespace, functionName, updateStatus, cause)
+}
+
+// finish records the outcome of an update, cause is nil when it succeeded
+func (b *BlueGreenUpdater) finish(namespace, functionName string, updateStatus BlueGreenStatus, cause error) {
+	finished := time.Now().UTC()
+	updateStatus.Finished = &finished
+	updateStatus.Phase = BlueGreenSucceeded
+	updateStatus.Message = ""
+	if cause != nil {
+		updateStatus.Phase = BlueGreenFailed
+		updateStatus.Message = cause.Error()
+	}
+
+	if err := b.setStatus(context.Background(), namespace, functionName, updateStatus); err != nil {
+		log.Printf("Unable to record the blue/green update of %s.%s: %s\n", functionName, namespace, err.Error())
+	}
+}
+
+// setStatus writes the status of an update to the function's Deployment, without
+// changing its pod template. The write is retried when the Deployment was changed
+// since it was read.
+func (b *BlueGreenUpdater) setStatus(ctx context.Context, namespace, functionName string, updateStatus BlueGreenStatus) error {
+	value, err := json.Marshal(updateStatus)
+	if err != nil {
+		return err
+	}
+
+	deployments := b.factory.Client.AppsV1().Deployments(namespace)
+	for attempt := 0; ; attempt++ {
+		deployment, err := deployments.Get(ctx, functionName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		annotations := map[string]string{}
+		for k, v := range deployment.Annotations {
+			annotations[k] = v
+		}
+		annotations[BlueGreenStatusAnnotation] = string(value)
+		deployment.Annotations = annotations
+
+		_, err = deployments.Update(ctx, deployment, metav1.UpdateOptions{})
+		if err == nil || !errors.IsConflict(err) || attempt == 2 {
+			return err
+		}
+	}
+}
+
+// greenConflict explains why the Deployment of the new version could not be created
+func (b *BlueGreenUpdater) greenConflict(ctx context.Context, namespace, functionName, green string) error {
+	existing, err := b.factory.Client.AppsV1().Deployments(namespace).Get(ctx, green, metav1.GetOptions{})
+	if err == nil && existing.Labels[BlueGreenLabel] != functionName {
+		return fmt.Errorf("%s already exists and is not the new version of %s, it has to be removed before a blue/green update", green, functionName)
+	}
+	return fmt.Errorf("a blue/green update of %s.%s is already in progress", functionName, namespace)
+}
+
+// checkNoBlueGreenUpdate returns an error with a 409 status when a blue/green update of
+// the function that deployment runs is in progress, or when deployment is the new
+// version of a blue/green update
+func checkNoBlueGreenUpdate(deployment *appsv1.Deployment) (error, int) {
+	if functionName, ok := deployment.Labels[BlueGreenLabel]; ok {
+		return fmt.Errorf("%s.%s is the new version of a blue/green update of %s", deployment.Name, deployment.Namespace, functionName), http.StatusConflict
+	}
+
+	updateStatus, err := ReadBlueGreenStatus(deployment)
+	if err != nil || updateStatus == nil || !updateStatus.Active() {
+		return nil, http.StatusOK
+	}
+	return fmt.Errorf("a blue/green update of %s.%s is already in progress", deployment.Name, deployment.Namespace), http.StatusConflict
+}
+
+// deploymentRequest returns the labels and annotations of the deploy request that
+// deployment was updated with
+func deploymentRequest(deployment *appsv1.Deployment) types.FunctionDeployment {
+	labels := deployment.Spec.Template.Labels
+	annotations := deployment.Spec.Template.Annotations
+	return types.FunctionDeployment{
+		Service:     deployment.Name,
+		Labels:      &labels,
+		Annotations: &annotations,
+	}
+}
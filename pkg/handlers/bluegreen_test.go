@@ -0,0 +1,411 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+// availableDeployments reports every Deployment as fully rolled out, since the fake
+// clientset has no controller to update the status
+func availableDeployments(kube *fake.Clientset) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		obj, err := kube.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+
+		deployment := obj.(*appsv1.Deployment).DeepCopy()
+		deployment.Status.UpdatedReplicas = *deployment.Spec.Replicas
+		deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+		return true, deployment, nil
+	}
+}
+
+// greenPod is a Pod of the new version of a blue/green update of functionName that
+// resolved image to digest
+func greenPod(functionName, image, digest string) *corev1.Pod {
+	green := functionName + BlueGreenSuffix
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: green + "-1", Namespace: testNamespace, Labels: map[string]string{"faas_function": green}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: green, Image: image}}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:    green,
+			ImageID: "docker-pullable://functions/nodeinfo@" + digest,
+		}}},
+	}
+}
+
+func Test_UpdateHandler_BlueGreen(t *testing.T) {
+	cases := []struct {
+		name        string
+		smokeStatus int
+		wantImage   string
+		wantPhase   string
+	}{
+		{name: "smoke test passes", smokeStatus: http.StatusOK, wantImage: "functions/nodeinfo@sha256:9a1f", wantPhase: BlueGreenSucceeded},
+		{name: "smoke test fails", smokeStatus: http.StatusInternalServerError, wantImage: "functions/nodeinfo:1", wantPhase: BlueGreenFailed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			smokePath := ""
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				smokePath = r.URL.Path
+				w.WriteHeader(tc.smokeStatus)
+			}))
+			defer srv.Close()
+			srvURL, _ := url.Parse(srv.URL)
+
+			factory := validationFactory(greenPod("nodeinfo", "functions/nodeinfo:2", "sha256:9a1f"))
+			kube := factory.Client.(*fake.Clientset)
+			kube.PrependReactor("get", "deployments", availableDeployments(kube))
+
+			blueGreen := NewBlueGreenUpdater(factory, staticResolver{url: *srvURL})
+			blueGreen.interval = 10 * time.Millisecond
+
+			w := httptest.NewRecorder()
+			MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+				types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			MakeUpdateHandler(testNamespace, factory, blueGreen).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+				types.FunctionDeployment{
+					Service: "nodeinfo",
+					Image:   "functions/nodeinfo:2",
+					Annotations: &map[string]string{
+						DeployStrategyAnnotation:  BlueGreenStrategy,
+						DeploySmokeTestAnnotation: "/_/health",
+						DeployTimeoutAnnotation:   "500ms",
+					},
+				}))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("want update status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+
+			blueGreen.Wait()
+
+			if smokePath != "/_/health" {
+				t.Errorf("want smoke test of /_/health, got: %q", smokePath)
+			}
+
+			deployment, err := kube.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), testNamespace, "nodeinfo")
+			if err != nil {
+				t.Fatalf("want Deployment to exist, got: %s", err)
+			}
+			if image := deployment.(*appsv1.Deployment).Spec.Template.Spec.Containers[0].Image; image != tc.wantImage {
+				t.Errorf("want image %s, got: %s", tc.wantImage, image)
+			}
+
+			updateStatus, err := ReadBlueGreenStatus(deployment.(*appsv1.Deployment))
+			if err != nil || updateStatus == nil {
+				t.Fatalf("want the status of the update to be recorded, got: %v %v", updateStatus, err)
+			}
+			if updateStatus.Phase != tc.wantPhase || updateStatus.Finished == nil {
+				t.Errorf("want finished update in phase %s, got: %+v", tc.wantPhase, updateStatus)
+			}
+
+			service, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("want Service to exist, got: %s", err)
+			}
+			if selector := service.Spec.Selector["faas_function"]; selector != "nodeinfo" {
+				t.Errorf("want Service to select nodeinfo, got: %s", selector)
+			}
+
+			if _, err := kube.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), testNamespace, "nodeinfo-green"); !errors.IsNotFound(err) {
+				t.Errorf("want green Deployment to be removed, got: %v", err)
+			}
+			if _, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo-green", metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("want green Service to be removed, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_UpdateHandler_BlueGreenConflicts(t *testing.T) {
+	cases := []struct {
+		name     string
+		green    *appsv1.Deployment
+		phase    string
+		strategy string
+		want     string
+	}{
+		{
+			name:     "function named like the new version",
+			green:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo-green", Namespace: testNamespace}},
+			strategy: BlueGreenStrategy,
+			want:     "is not the new version of nodeinfo",
+		},
+		{
+			name:     "blue/green update in progress",
+			phase:    BlueGreenPending,
+			strategy: BlueGreenStrategy,
+			want:     "already in progress",
+		},
+		{
+			name:     "rolling update during a blue/green update",
+			phase:    BlueGreenPromoting,
+			strategy: RollingStrategy,
+			want:     "already in progress",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := validationFactory()
+			if tc.green != nil {
+				factory = validationFactory(tc.green)
+			}
+			blueGreen := NewBlueGreenUpdater(factory, staticResolver{})
+
+			w := httptest.NewRecorder()
+			MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+				types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+
+			if len(tc.phase) > 0 {
+				if err := blueGreen.setStatus(context.TODO(), testNamespace, "nodeinfo", BlueGreenStatus{Phase: tc.phase}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w = httptest.NewRecorder()
+			MakeUpdateHandler(testNamespace, factory, blueGreen).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+				types.FunctionDeployment{
+					Service:     "nodeinfo",
+					Image:       "functions/nodeinfo:2",
+					Annotations: &map[string]string{DeployStrategyAnnotation: tc.strategy},
+				}))
+			blueGreen.Wait()
+
+			if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("want status code '%d' and %q, got '%d': %s", http.StatusConflict, tc.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_UpdateHandler_FunctionNamedLikeNewVersion(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels map[string]string
+		status int
+	}{
+		{name: "function", status: http.StatusAccepted},
+		{name: "new version of a blue/green update", labels: map[string]string{BlueGreenLabel: "nodeinfo"}, status: http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := validationFactory()
+			kube := factory.Client.(*fake.Clientset)
+
+			w := httptest.NewRecorder()
+			MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+				types.FunctionDeployment{Service: "nodeinfo-green", Image: "functions/nodeinfo:1"}))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+
+			if len(tc.labels) > 0 {
+				deployment, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo-green", metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range tc.labels {
+					deployment.Labels[k] = v
+				}
+				if _, err := kube.AppsV1().Deployments(testNamespace).Update(context.TODO(), deployment, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w = httptest.NewRecorder()
+			MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+				types.FunctionDeployment{Service: "nodeinfo-green", Image: "functions/nodeinfo:2"}))
+
+			if w.Code != tc.status {
+				t.Errorf("want status code '%d', got '%d': %s", tc.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_BlueGreenUpdater_Recover(t *testing.T) {
+	cases := []struct {
+		name      string
+		phase     string
+		image     string
+		wantImage string
+		wantPhase string
+	}{
+		{name: "interrupted before the gate", phase: BlueGreenPending, image: "functions/nodeinfo:1", wantImage: "functions/nodeinfo:1", wantPhase: BlueGreenFailed},
+		{name: "interrupted before the promotion", phase: BlueGreenPromoting, image: "functions/nodeinfo:1", wantImage: "functions/nodeinfo:1", wantPhase: BlueGreenFailed},
+		{name: "interrupted during the promotion", phase: BlueGreenPromoting, image: "functions/nodeinfo:2", wantImage: "functions/nodeinfo:2", wantPhase: BlueGreenSucceeded},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := validationFactory()
+			kube := factory.Client.(*fake.Clientset)
+			kube.PrependReactor("get", "deployments", availableDeployments(kube))
+
+			blueGreen := NewBlueGreenUpdater(factory, staticResolver{})
+			blueGreen.interval = 10 * time.Millisecond
+
+			for _, request := range []types.FunctionDeployment{
+				{Service: "nodeinfo", Image: tc.image},
+				{Service: "nodeinfo-green", Image: "functions/nodeinfo:2"},
+			} {
+				secrets := map[string]*corev1.Secret{}
+				deployment, err := makeDeploymentSpec(request, secrets, factory)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if request.Service != "nodeinfo" {
+					deployment.Labels[BlueGreenLabel] = "nodeinfo"
+				}
+				if _, err := kube.AppsV1().Deployments(testNamespace).Create(context.TODO(), deployment, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := kube.CoreV1().Services(testNamespace).Create(context.TODO(), makeServiceSpec(request, factory), metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := blueGreen.setStatus(context.TODO(), testNamespace, "nodeinfo", BlueGreenStatus{Phase: tc.phase, Image: "functions/nodeinfo:2", Timeout: "500ms"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := blueGreen.selectPods(context.TODO(), testNamespace, "nodeinfo", "nodeinfo-green"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := blueGreen.Recover(context.TODO(), testNamespace); err != nil {
+				t.Fatalf("want updates to be recovered, got: %s", err)
+			}
+			blueGreen.Wait()
+
+			deployment, err := kube.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("want Deployment to exist, got: %s", err)
+			}
+			if image := deployment.Spec.Template.Spec.Containers[0].Image; image != tc.wantImage {
+				t.Errorf("want image %s, got: %s", tc.wantImage, image)
+			}
+
+			updateStatus, _ := ReadBlueGreenStatus(deployment)
+			if updateStatus == nil || updateStatus.Phase != tc.wantPhase {
+				t.Errorf("want phase %s, got: %+v", tc.wantPhase, updateStatus)
+			}
+
+			service, err := kube.CoreV1().Services(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("want Service to exist, got: %s", err)
+			}
+			if selector := service.Spec.Selector["faas_function"]; selector != "nodeinfo" {
+				t.Errorf("want Service to select nodeinfo, got: %s", selector)
+			}
+
+			if _, err := kube.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), testNamespace, "nodeinfo-green"); !errors.IsNotFound(err) {
+				t.Errorf("want green Deployment to be removed, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_BlueGreenStatusHandler(t *testing.T) {
+	factory := validationFactory()
+	blueGreen := NewBlueGreenUpdater(factory, staticResolver{})
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://system/function/nodeinfo/bluegreen", nil)
+		MakeBlueGreenStatusHandler(testNamespace, factory).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"name": "nodeinfo"}))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusNotFound {
+		t.Errorf("want status code '%d' without an update, got '%d': %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+
+	if err := blueGreen.setStatus(context.TODO(), testNamespace, "nodeinfo", BlueGreenStatus{Phase: BlueGreenPending, Image: "functions/nodeinfo:2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w = get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	updateStatus := BlueGreenStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &updateStatus); err != nil {
+		t.Fatal(err)
+	}
+	if updateStatus.Phase != BlueGreenPending || updateStatus.Image != "functions/nodeinfo:2" {
+		t.Errorf("want the pending update of functions/nodeinfo:2, got: %+v", updateStatus)
+	}
+}
+
+func Test_FunctionReaders_HideNewVersion(t *testing.T) {
+	function := functionDeployment("nodeinfo", nil)
+	green := functionDeployment("nodeinfo"+BlueGreenSuffix, nil)
+	green.Labels = map[string]string{"faas_function": green.Name, BlueGreenLabel: "nodeinfo"}
+	function.Labels = map[string]string{"faas_function": function.Name}
+	for _, deployment := range []*appsv1.Deployment{function, green} {
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: deployment.Name, Image: "functions/nodeinfo:1"}}
+	}
+	lister := functionLister(t, function, green)
+
+	functions, err := getServiceList(testNamespace, lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) != 1 || functions[0].Name != "nodeinfo" {
+		t.Errorf("want only nodeinfo to be listed, got: %v", functions)
+	}
+
+	status, err := getService(testNamespace, green.Name, lister)
+	if err != nil || status != nil {
+		t.Errorf("want the new version not to be found, got: %v %v", status, err)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeCanaryRoutingHandler sends invocations that set the X-Canary header to "always"
+// to the canary of the function, so that it can be tested before it receives traffic
+func MakeCanaryRoutingHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get(k8s.CanaryHeader), "always") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		vars := map[string]string{}
+		for k, v := range mux.Vars(r) {
+			vars[k] = v
+		}
+
+		// the name has the form <function_name>[.<namespace>]
+		functionName, suffix := vars["name"], ""
+		if i := strings.Index(functionName, "."); i > -1 {
+			functionName, suffix = functionName[:i], functionName[i:]
+		}
+
+		if !k8s.IsCanary(functionName) {
+			vars["name"] = k8s.CanaryName(functionName) + suffix
+		}
+
+		next.ServeHTTP(w, mux.SetURLVars(r, vars))
+	}
+}
+
+// MakeCanaryPromoteHandler replaces the spec of a function with the spec of its canary
+// and then removes the canary
+func MakeCanaryPromoteHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		request, err := ReadCanaryPromoteRequest(ctx, lookupNamespace, functionName, factory)
+		if err != nil {
+			status, _ := ProcessErrorReasons(err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if err := ValidateFunctionRequest(ctx, request, lookupNamespace, factory); err != nil {
+			log.Printf("Promotion of canary for %s.%s rejected: %s\n", functionName, lookupNamespace, err.Error())
+			WriteValidationError(w, err)
+			return
+		}
+
+		if err, status := updateFunction(ctx, lookupNamespace, factory, *request, buildAnnotations(*request)); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		recordRevision(ctx, lookupNamespace, factory, *request)
+
+		if _, err := removeCanary(ctx, factory.Client, lookupNamespace, functionName); err != nil {
+			status, _ := ProcessErrorReasons(err)
+			http.Error(w, fmt.Sprintf("canary promoted, but unable to remove it: %s", err.Error()), status)
+			return
+		}
+
+		log.Printf("Canary promoted: %s.%s to %s\n", functionName, lookupNamespace, request.Image)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// MakeCanaryAbortHandler removes the canary of a function, so that all traffic is
+// served by the function again
+func MakeCanaryAbortHandler(defaultNamespace string, clientset kubernetes.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		found, err := removeCanary(r.Context(), clientset, lookupNamespace, functionName)
+		if err != nil {
+			status, _ := ProcessErrorReasons(err)
+			http.Error(w, fmt.Sprintf("unable to remove canary: %s", err.Error()), status)
+			return
+		}
+
+		if !found {
+			http.Error(w, fmt.Sprintf("function %s.%s has no canary", functionName, lookupNamespace), http.StatusNotFound)
+			return
+		}
+
+		log.Printf("Canary aborted: %s.%s\n", functionName, lookupNamespace)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ReadCanaryPromoteRequest returns the deploy request of the function's canary, renamed
+// to the function and without its weight. The request is read from the canary's latest
+// revision, or from its Deployment when no revision was stored. The image is pinned to
+// the digest that the canary ran with when it is known.
+func ReadCanaryPromoteRequest(ctx context.Context, namespace, functionName string, factory k8s.FunctionFactory) (*types.FunctionDeployment, error) {
+	canaryName := k8s.CanaryName(functionName)
+
+	revisions, err := factory.ListRevisions(ctx, namespace, canaryName)
+	if err != nil {
+		return nil, err
+	}
+
+	var request types.FunctionDeployment
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		request = latest.Spec
+		request.Image = latest.ImageReference()
+	} else {
+		// revisions are recorded on a best-effort basis
+		deployment, err := factory.Client.AppsV1().Deployments(namespace).Get(ctx, canaryName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "canaries"}, canaryName)
+		} else if err != nil {
+			return nil, err
+		}
+
+		request = requestFromDeployment(deployment)
+		if digest, err := factory.RunningImageDigest(ctx, namespace, canaryName, request.Image); err == nil && len(digest) > 0 {
+			request.Image = k8s.FunctionRevision{Image: request.Image, ImageDigest: digest}.ImageReference()
+		}
+	}
+
+	request.Service = functionName
+	request.Namespace = namespace
+
+	if request.Annotations != nil {
+		annotations := map[string]string{}
+		for k, v := range *request.Annotations {
+			if k != k8s.CanaryWeightAnnotation {
+				annotations[k] = v
+			}
+		}
+		request.Annotations = &annotations
+	}
+
+	return &request, nil
+}
+
+// requestFromDeployment rebuilds the deploy request that a function's Deployment was
+// created from
+func requestFromDeployment(deployment *appsv1.Deployment) types.FunctionDeployment {
+	request := deploymentRequest(deployment)
+	container := deployment.Spec.Template.Spec.Containers[0]
+
+	// faas_function is set by makeDeploymentSpec and names the Deployment
+	labels := map[string]string{}
+	for k, v := range *request.Labels {
+		if k != "faas_function" {
+			labels[k] = v
+		}
+	}
+	request.Labels = &labels
+
+	request.Image = container.Image
+	request.Secrets = k8s.ReadFunctionSecretsSpec(*deployment)
+	if container.SecurityContext != nil && container.SecurityContext.ReadOnlyRootFilesystem != nil {
+		request.ReadOnlyRootFilesystem = *container.SecurityContext.ReadOnlyRootFilesystem
+	}
+
+	request.EnvVars = map[string]string{}
+	for _, env := range container.Env {
+		switch {
+		case env.ValueFrom != nil:
+			// secrets that are read as environment variables are part of Secrets
+		case env.Name == k8s.EnvProcessName:
+			request.EnvProcess = env.Value
+		default:
+			request.EnvVars[env.Name] = env.Value
+		}
+	}
+
+	for k, v := range deployment.Spec.Template.Spec.NodeSelector {
+		request.Constraints = append(request.Constraints, k+"="+v)
+	}
+	sort.Strings(request.Constraints)
+
+	request.Limits = functionResources(container.Resources.Limits)
+	request.Requests = functionResources(container.Resources.Requests)
+
+	return request
+}
+
+// functionResources returns the memory and CPU of resources, or nil when neither is set
+func functionResources(resources corev1.ResourceList) *types.FunctionResources {
+	memory, hasMemory := resources[corev1.ResourceMemory]
+	cpu, hasCPU := resources[corev1.ResourceCPU]
+	if !hasMemory && !hasCPU {
+		return nil
+	}
+
+	functionResources := &types.FunctionResources{}
+	if hasMemory {
+		functionResources.Memory = memory.String()
+	}
+	if hasCPU {
+		functionResources.CPU = cpu.String()
+	}
+	return functionResources
+}
+
+// removeCanary deletes the Deployment and Service of a function's canary, it returns
+// false when neither exists
+func removeCanary(ctx context.Context, clientset kubernetes.Interface, namespace, functionName string) (bool, error) {
+	canaryName := k8s.CanaryName(functionName)
+	foregroundPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{PropagationPolicy: &foregroundPolicy}
+
+	found := false
+
+	err := clientset.AppsV1().Deployments(namespace).Delete(ctx, canaryName, opts)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+	found = found || err == nil
+
+	err = clientset.CoreV1().Services(namespace).Delete(ctx, canaryName, opts)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return found, err
+	}
+	found = found || err == nil
+
+	return found, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_CanaryRoutingHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "nodeinfo", want: "nodeinfo"},
+		{name: "nodeinfo", header: "always", want: "nodeinfo-canary"},
+		{name: "nodeinfo.staging", header: "always", want: "nodeinfo-canary.staging"},
+		{name: "nodeinfo-canary", header: "always", want: "nodeinfo-canary"},
+		{name: "nodeinfo", header: "never", want: "nodeinfo"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name+" "+tc.header, func(t *testing.T) {
+			got := ""
+			handler := MakeCanaryRoutingHandler(func(w http.ResponseWriter, r *http.Request) {
+				got = mux.Vars(r)["name"]
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "http://gateway/function/"+tc.name, nil)
+			r.Header.Set(k8s.CanaryHeader, tc.header)
+			handler(httptest.NewRecorder(), mux.SetURLVars(r, map[string]string{"name": tc.name}))
+
+			if got != tc.want {
+				t.Errorf("want function %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_CanaryPromoteHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		revision bool
+	}{
+		{name: "from the canary's revision", revision: true},
+		{name: "from the canary's Deployment when no revision was stored"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := validationFactory()
+
+			deploy := func(request types.FunctionDeployment) {
+				w := httptest.NewRecorder()
+				MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions", request))
+				if w.Code != http.StatusAccepted {
+					t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+				}
+			}
+
+			deploy(types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"})
+			deploy(types.FunctionDeployment{
+				Service:     "nodeinfo-canary",
+				Image:       "functions/nodeinfo:2",
+				EnvVars:     map[string]string{"write_debug": "true"},
+				Labels:      &map[string]string{"team": "a"},
+				Limits:      &types.FunctionResources{Memory: "128Mi"},
+				Annotations: &map[string]string{k8s.CanaryWeightAnnotation: "10", "topic": "cron"},
+			})
+
+			if !tc.revision {
+				err := factory.Client.CoreV1().Secrets(testNamespace).Delete(context.TODO(), k8s.RevisionsSecretName("nodeinfo-canary"), metav1.DeleteOptions{})
+				if err != nil {
+					t.Fatalf("unable to delete revisions: %s", err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "http://system/function/nodeinfo/canary/promote", nil)
+			MakeCanaryPromoteHandler(testNamespace, factory).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"name": "nodeinfo"}))
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+
+			deployment, err := factory.Client.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("want Deployment to exist, got: %s", err)
+			}
+
+			container := deployment.Spec.Template.Spec.Containers[0]
+			if container.Image != "functions/nodeinfo:2" {
+				t.Errorf("want the canary image functions/nodeinfo:2, got: %s", container.Image)
+			}
+
+			if len(container.Env) != 1 || container.Env[0].Value != "true" {
+				t.Errorf("want the canary environment, got: %v", container.Env)
+			}
+
+			if memory := container.Resources.Limits.Memory().String(); memory != "128Mi" {
+				t.Errorf("want the canary memory limit 128Mi, got: %s", memory)
+			}
+
+			labels := deployment.Spec.Template.Labels
+			if labels["team"] != "a" || labels["faas_function"] != "nodeinfo" {
+				t.Errorf("want the canary labels for nodeinfo, got: %v", labels)
+			}
+
+			if _, ok := deployment.Annotations[k8s.CanaryWeightAnnotation]; ok || deployment.Annotations["topic"] != "cron" {
+				t.Errorf("want the canary annotations without the weight, got: %v", deployment.Annotations)
+			}
+
+			if _, err := factory.Client.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo-canary", metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("want canary Deployment to be removed, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_CanaryAbortHandler_WithoutCanary(t *testing.T) {
+	factory := validationFactory()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "http://system/function/nodeinfo/canary/abort", nil)
+	MakeCanaryAbortHandler(testNamespace, factory.Client).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"name": "nodeinfo"}))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status code '%d', got '%d': %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
@@ -19,7 +19,7 @@ import (
 )
 
 // MakeDeleteHandler delete a function
-func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset) http.HandlerFunc {
+func MakeDeleteHandler(defaultNamespace string, clientset kubernetes.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
@@ -42,12 +42,12 @@ func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset)
 		request := requests.DeleteFunctionRequest{}
 		err := json.Unmarshal(body, &request)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("unable to unmarshal request: %s", err.Error()), http.StatusBadRequest)
 			return
 		}
 
 		if len(request.FunctionName) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+			http.Error(w, "functionName is required", http.StatusBadRequest)
 			return
 		}
 
@@ -58,19 +58,26 @@ func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset)
 			Deployments(lookupNamespace).
 			Get(context.TODO(), request.FunctionName, getOpts)
 
-		if findDeployErr != nil {
-			if errors.IsNotFound(findDeployErr) {
-				w.WriteHeader(http.StatusNotFound)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
+		if errors.IsNotFound(findDeployErr) {
+			// a Service can be left behind without its Deployment by an interrupted delete
+			if deleted, err := deleteOrphanedService(lookupNamespace, clientset, request.FunctionName); err != nil {
+				status, _ := ProcessErrorReasons(err)
+				http.Error(w, fmt.Sprintf("unable to delete Service: %s", err.Error()), status)
+				return
+			} else if deleted {
+				w.WriteHeader(http.StatusAccepted)
+				return
 			}
+		}
 
-			w.Write([]byte(findDeployErr.Error()))
+		if findDeployErr != nil {
+			status, _ := ProcessErrorReasons(findDeployErr)
+			http.Error(w, findDeployErr.Error(), status)
 			return
 		}
 
 		if isFunction(deployment) {
-			err := deleteFunction(lookupNamespace, clientset, request, w)
+			err := deleteFunction(lookupNamespace, clientset, deployment, request, w)
 			if err != nil {
 				return
 			}
@@ -95,34 +102,58 @@ func isFunction(deployment *appsv1.Deployment) bool {
 	return false
 }
 
-func deleteFunction(functionNamespace string, clientset *kubernetes.Clientset, request requests.DeleteFunctionRequest, w http.ResponseWriter) error {
+// deleteFunction removes the Deployment and Service of a function and the objects they
+// own. Objects that are already gone are skipped so that a function left behind
+// by a partial deploy or an interrupted delete can always be removed.
+func deleteFunction(functionNamespace string, clientset kubernetes.Interface, deployment *appsv1.Deployment, request requests.DeleteFunctionRequest, w http.ResponseWriter) error {
 	foregroundPolicy := metav1.DeletePropagationForeground
 	opts := &metav1.DeleteOptions{PropagationPolicy: &foregroundPolicy}
 
+	if err := deleteOwnedResources(context.TODO(), clientset, functionNamespace, deployment); err != nil {
+		status, _ := ProcessErrorReasons(err)
+		http.Error(w, err.Error(), status)
+		return err
+	}
+
 	if deployErr := clientset.AppsV1().Deployments(functionNamespace).
-		Delete(context.TODO(), request.FunctionName, *opts); deployErr != nil {
+		Delete(context.TODO(), request.FunctionName, *opts); deployErr != nil && !errors.IsNotFound(deployErr) {
 
-		if errors.IsNotFound(deployErr) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		w.Write([]byte(deployErr.Error()))
+		status, _ := ProcessErrorReasons(deployErr)
+		http.Error(w, fmt.Sprintf("unable to delete Deployment: %s", deployErr.Error()), status)
 		return fmt.Errorf("error deleting function's deployment")
 	}
 
 	if svcErr := clientset.CoreV1().
 		Services(functionNamespace).
-		Delete(context.TODO(), request.FunctionName, *opts); svcErr != nil {
-
-		if errors.IsNotFound(svcErr) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		Delete(context.TODO(), request.FunctionName, *opts); svcErr != nil && !errors.IsNotFound(svcErr) {
 
-		w.Write([]byte(svcErr.Error()))
+		status, _ := ProcessErrorReasons(svcErr)
+		http.Error(w, fmt.Sprintf("Deployment deleted, but unable to delete Service: %s", svcErr.Error()), status)
 		return fmt.Errorf("error deleting function's service")
 	}
 	return nil
 }
+
+// deleteOrphanedService deletes the function's Service when its Deployment no longer
+// exists, it returns false when there is no such Service
+func deleteOrphanedService(functionNamespace string, clientset kubernetes.Interface, functionName string) (bool, error) {
+	services := clientset.CoreV1().Services(functionNamespace)
+
+	service, err := services.Get(context.TODO(), functionName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if service.Spec.Selector["faas_function"] != functionName {
+		return false, nil
+	}
+
+	if err := services.Delete(context.TODO(), functionName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	return true, nil
+}
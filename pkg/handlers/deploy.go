@@ -31,7 +31,7 @@ const initialReplicasCount = 1
 
 // MakeDeployHandler creates a handler to create new functions in the cluster
 func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
-	secrets := k8s.NewSecretsClient(factory.Client)
+	secrets := factory.SecretsClient()
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -50,18 +50,25 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) ht
 			return
 		}
 
-		if err := ValidateDeployRequest(&request); err != nil {
-			wrappedErr := fmt.Errorf("validation failed: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
-			return
-		}
-
 		namespace := functionNamespace
 		if len(request.Namespace) > 0 {
 			namespace = request.Namespace
 		}
 
-		existingSecrets, err := secrets.GetSecrets(namespace, request.Secrets)
+		if err := ValidateFunctionRequest(ctx, &request, namespace, factory); err != nil {
+			log.Printf("Deployment request for %s.%s rejected: %s\n", request.Service, namespace, err.Error())
+			WriteValidationError(w, err)
+			return
+		}
+
+		addNamespaceProfiles(ctx, factory, namespace, &request)
+
+		var annotations map[string]string
+		if request.Annotations != nil {
+			annotations = *request.Annotations
+		}
+
+		existingSecrets, err := secrets.GetSecrets(namespace, k8s.RequiredSecrets(request.Secrets, annotations))
 		if err != nil {
 			wrappedErr := fmt.Errorf("unable to fetch secrets: %s", err.Error())
 			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
@@ -92,31 +99,63 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) ht
 			return
 		}
 
-		deploy := factory.Client.AppsV1().Deployments(namespace)
+		serviceSpec := makeServiceSpec(request, factory)
 
-		_, err = deploy.Create(context.TODO(), deploymentSpec, metav1.CreateOptions{})
+		if IsDryRun(r) {
+			WriteDryRun(w, namespace, deploymentSpec, serviceSpec)
+			return
+		}
+
+		previous, err := applyDeployment(ctx, factory.Client, namespace, deploymentSpec)
 		if err != nil {
+			status, _ := ProcessErrorReasons(err)
 			wrappedErr := fmt.Errorf("unable create Deployment: %s", err.Error())
 			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusInternalServerError)
+			http.Error(w, wrappedErr.Error(), status)
 			return
 		}
 
-		log.Printf("Deployment created: %s.%s\n", request.Service, namespace)
-
-		service := factory.Client.CoreV1().Services(namespace)
-		serviceSpec := makeServiceSpec(request, factory)
-		_, err = service.Create(context.TODO(), serviceSpec, metav1.CreateOptions{})
+		if previous == nil {
+			log.Printf("Deployment created: %s.%s\n", request.Service, namespace)
+		} else {
+			log.Printf("Deployment updated: %s.%s\n", request.Service, namespace)
+		}
 
+		previousService, err := applyService(ctx, factory.Client, namespace, serviceSpec)
 		if err != nil {
+			status, _ := ProcessErrorReasons(err)
 			wrappedErr := fmt.Errorf("failed create Service: %s", err.Error())
 			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+
+			// the function is deployed as a unit, so undo the Deployment change rather
+			// than leaving it without a Service
+			if rollbackErr := rollbackDeployment(ctx, factory.Client, namespace, request.Service, previous); rollbackErr != nil {
+				log.Printf("Rollback of Deployment %s.%s failed: %s\n", request.Service, namespace, rollbackErr.Error())
+				wrappedErr = fmt.Errorf("%s, rollback of Deployment failed: %s", wrappedErr.Error(), rollbackErr.Error())
+			}
+
+			http.Error(w, wrappedErr.Error(), status)
 			return
 		}
 
 		log.Printf("Service created: %s.%s\n", request.Service, namespace)
 
+		if err := applyOwnedResources(ctx, factory, namespace, request); err != nil {
+			status, _ := ProcessErrorReasons(err)
+			wrappedErr := fmt.Errorf("failed create function resources: %s", err.Error())
+			log.Println(wrappedErr)
+
+			if rollbackErr := rollbackFunction(ctx, factory, namespace, request.Service, previous, previousService); rollbackErr != nil {
+				log.Printf("Rollback of function %s.%s failed: %s\n", request.Service, namespace, rollbackErr.Error())
+				wrappedErr = fmt.Errorf("%s, rollback of function failed: %s", wrappedErr.Error(), rollbackErr.Error())
+			}
+
+			http.Error(w, wrappedErr.Error(), status)
+			return
+		}
+
+		recordRevision(ctx, namespace, factory, request)
+
 		w.WriteHeader(http.StatusAccepted)
 	}
 }
@@ -288,6 +327,20 @@ func makeServiceSpec(request types.FunctionDeployment, factory k8s.FunctionFacto
 	return serviceSpec
 }
 
+// addNamespaceProfiles adds the default profiles of the namespace to the annotations of
+// the request
+func addNamespaceProfiles(ctx context.Context, factory k8s.FunctionFactory, namespace string, request *types.FunctionDeployment) {
+	profiles := k8s.NamespaceProfiles(ctx, factory.Client, namespace)
+	if len(profiles) == 0 {
+		return
+	}
+
+	if request.Annotations == nil {
+		request.Annotations = &map[string]string{}
+	}
+	k8s.AddProfiles(*request.Annotations, profiles)
+}
+
 func buildAnnotations(request types.FunctionDeployment) map[string]string {
 	var annotations map[string]string
 	if request.Annotations != nil {
@@ -0,0 +1,49 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DryRunResponse is returned instead of creating or updating a function when the
+// request has the dryRun query parameter set
+type DryRunResponse struct {
+	Deployment *appsv1.Deployment `json:"deployment"`
+	Service    *corev1.Service    `json:"service"`
+}
+
+// IsDryRun returns true when the request only asks for the rendered Deployment and
+// Service, i.e. ?dryRun=true
+func IsDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// WriteDryRun writes the Deployment and Service that would have been applied for the
+// function in the given namespace
+func WriteDryRun(w http.ResponseWriter, namespace string, deployment *appsv1.Deployment, service *corev1.Service) {
+	deployment.TypeMeta.Kind = "Deployment"
+	deployment.TypeMeta.APIVersion = appsv1.SchemeGroupVersion.String()
+	deployment.Namespace = namespace
+
+	service.TypeMeta.Kind = "Service"
+	service.TypeMeta.APIVersion = corev1.SchemeGroupVersion.String()
+	service.Namespace = namespace
+
+	body, err := json.Marshal(DryRunResponse{Deployment: deployment, Service: service})
+	if err != nil {
+		http.Error(w, "unable to marshal dry-run response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/logs"
+)
+
+// LogQuerier queries the logs of a function with the containers and filters of opts
+type LogQuerier interface {
+	QueryWithOptions(ctx context.Context, r logs.Request, opts k8s.LogOptions) (<-chan k8s.Message, error)
+}
+
+// MakeLogHandler streams the logs of a function as JSON lines. Along with the query of the
+// provider's log handler it accepts container, a comma separated list of containers or "*",
+// previous, filter for a substring, regex and structured to parse JSON messages into fields.
+func MakeLogHandler(requestor LogQuerier, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Println("LogHandler: response is not a Flusher, required for streaming response")
+			http.NotFound(w, r)
+			return
+		}
+
+		logRequest, opts, err := parseLogRequest(r)
+		if err != nil {
+			log.Printf("LogHandler: could not parse request %s", err)
+			http.Error(w, fmt.Sprintf("could not parse the log request: %s", err), http.StatusUnprocessableEntity)
+			return
+		}
+
+		ctx, cancelQuery := context.WithTimeout(r.Context(), timeout)
+		defer cancelQuery()
+
+		messages, err := requestor.QueryWithOptions(ctx, logRequest, opts)
+		if err != nil {
+			http.Error(w, "function log request failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Connection", "Keep-Alive")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// flush before and after the empty write so the closing chunk is sent on its own
+		defer flusher.Flush()
+		defer w.Write([]byte{})
+		defer flusher.Flush()
+
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("LogHandler: client stopped listening")
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					log.Println("LogHandler: end of log stream")
+					return
+				}
+
+				if err := encoder.Encode(msg); err != nil {
+					log.Printf("LogHandler: failed to serialize log message: '%s': %s\n", msg.String(), err)
+					encoder.Encode(logs.Message{Text: "failed to serialize log message"})
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// parseLogRequest reads the log request and its options from the query of r
+func parseLogRequest(r *http.Request) (logs.Request, k8s.LogOptions, error) {
+	query := r.URL.Query()
+	logRequest := logs.Request{
+		Name:      lastValue(query, "name"),
+		Namespace: lastValue(query, "namespace"),
+		Instance:  lastValue(query, "instance"),
+	}
+	opts := k8s.LogOptions{
+		Instance: logRequest.Instance,
+		Contains: lastValue(query, "filter"),
+	}
+
+	if len(logRequest.Name) == 0 {
+		return logRequest, opts, fmt.Errorf("name is required")
+	}
+
+	if tail := lastValue(query, "tail"); len(tail) > 0 {
+		n, err := strconv.Atoi(tail)
+		if err != nil {
+			return logRequest, opts, fmt.Errorf("invalid tail: %s", tail)
+		}
+		logRequest.Tail = n
+	}
+
+	if since := lastValue(query, "since"); len(since) > 0 {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return logRequest, opts, fmt.Errorf("invalid since: %s", since)
+		}
+		logRequest.Since = &t
+	}
+
+	var err error
+	if logRequest.Follow, err = parseBool(query, "follow"); err != nil {
+		return logRequest, opts, err
+	}
+	if opts.Previous, err = parseBool(query, "previous"); err != nil {
+		return logRequest, opts, err
+	}
+	if opts.Structured, err = parseBool(query, "structured"); err != nil {
+		return logRequest, opts, err
+	}
+
+	for _, value := range query["container"] {
+		for _, container := range strings.Split(value, ",") {
+			if container = strings.TrimSpace(container); len(container) > 0 {
+				opts.Containers = append(opts.Containers, container)
+			}
+		}
+	}
+
+	if expr := lastValue(query, "regex"); len(expr) > 0 {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return logRequest, opts, fmt.Errorf("invalid regex: %s", err)
+		}
+		opts.Regex = regex
+	}
+
+	return logRequest, opts, nil
+}
+
+// parseBool returns the boolean value of the query parameter, or false when it is not set
+func parseBool(query url.Values, name string) (bool, error) {
+	value := lastValue(query, name)
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return b, nil
+}
+
+// lastValue returns the last value of the query parameter, or "" when it is not set
+func lastValue(query url.Values, name string) string {
+	values := query[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
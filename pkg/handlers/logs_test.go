@@ -0,0 +1,109 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/logs"
+)
+
+type fakeLogQuerier struct {
+	request  logs.Request
+	opts     k8s.LogOptions
+	messages []k8s.Message
+}
+
+func (f *fakeLogQuerier) QueryWithOptions(ctx context.Context, r logs.Request, opts k8s.LogOptions) (<-chan k8s.Message, error) {
+	f.request = r
+	f.opts = opts
+
+	messages := make(chan k8s.Message, len(f.messages))
+	for _, msg := range f.messages {
+		messages <- msg
+	}
+	close(messages)
+	return messages, nil
+}
+
+func Test_LogHandler(t *testing.T) {
+	t.Run("parses the options and streams messages", func(t *testing.T) {
+		querier := &fakeLogQuerier{
+			messages: []k8s.Message{
+				{
+					Message:   logs.Message{Name: "figlet", Instance: "figlet-1", Text: `{"level":"error"}`},
+					Container: "proxy",
+					Fields:    map[string]interface{}{"level": "error"},
+				},
+			},
+		}
+
+		url := "/system/logs?name=figlet&namespace=dev&instance=figlet-1&tail=10&follow=true" +
+			"&container=proxy,migrate&container=figlet&previous=true&filter=error&regex=level.%2Berror&structured=true"
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+
+		MakeLogHandler(querier, time.Second)(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		if querier.request.Name != "figlet" || querier.request.Namespace != "dev" || querier.request.Tail != 10 || !querier.request.Follow {
+			t.Errorf("unexpected log request: %+v", querier.request)
+		}
+
+		opts := querier.opts
+		if want := []string{"proxy", "migrate", "figlet"}; !reflect.DeepEqual(opts.Containers, want) {
+			t.Errorf("want containers %v, got %v", want, opts.Containers)
+		}
+		if opts.Instance != "figlet-1" || !opts.Previous || !opts.Structured || opts.Contains != "error" {
+			t.Errorf("unexpected log options: %+v", opts)
+		}
+		if opts.Regex == nil || opts.Regex.String() != "level.+error" {
+			t.Errorf("want regex %q, got %v", "level.+error", opts.Regex)
+		}
+
+		var msg k8s.Message
+		if err := json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&msg); err != nil {
+			t.Fatalf("unexpected error decoding message: %s", err)
+		}
+		if msg.Container != "proxy" || msg.Fields["level"] != "error" || msg.Instance != "figlet-1" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing name", query: "tail=10"},
+		{name: "invalid tail", query: "name=figlet&tail=ten"},
+		{name: "invalid since", query: "name=figlet&since=yesterday"},
+		{name: "invalid previous", query: "name=figlet&previous=maybe"},
+		{name: "invalid regex", query: "name=figlet&regex=%28unclosed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := &fakeLogQuerier{}
+			req := httptest.NewRequest(http.MethodGet, "/system/logs?"+tc.query, nil)
+			w := httptest.NewRecorder()
+
+			MakeLogHandler(querier, time.Second)(w, req)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("want status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+			}
+		})
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	glog "k8s.io/klog"
@@ -47,6 +49,81 @@ func MakeNamespacesLister(defaultNamespace string, clusterRole bool, clientset k
 	}
 }
 
+// MakeNamespaceHandler creates, updates and deletes the namespaces of functions with the
+// JSON body of a k8s.FunctionNamespace. A namespace that has functions is only deleted
+// with ?force=true, which deletes its functions too.
+func MakeNamespaceHandler(namespaces *k8s.NamespacesClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		ctx := r.Context()
+		body, _ := ioutil.ReadAll(r.Body)
+
+		ns := k8s.FunctionNamespace{}
+		if err := json.Unmarshal(body, &ns); err != nil {
+			http.Error(w, fmt.Sprintf("unable to unmarshal request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			if err := namespaces.Validate(ctx, ns); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if r.Method == http.MethodPost {
+				err = namespaces.Create(ctx, ns)
+			} else {
+				err = namespaces.Update(ctx, ns)
+			}
+		case http.MethodDelete:
+			err = namespaces.Delete(ctx, ns.Name, r.URL.Query().Get("force") == "true")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Namespace %s %s failed: %s\n", r.Method, ns.Name, err)
+			http.Error(w, namespaceErrorMessage(err), namespaceErrorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// namespaceErrorStatus returns the status code of an error of the namespaces client
+func namespaceErrorStatus(err error) int {
+	if _, ok := err.(*k8s.NamespaceNotEmptyError); ok {
+		return http.StatusConflict
+	}
+
+	switch {
+	case err == k8s.ErrNamespaceExists:
+		return http.StatusConflict
+	case err == k8s.ErrNamespaceNotManaged, err == k8s.ErrDefaultNamespace:
+		return http.StatusForbidden
+	case k8serrors.IsNotFound(err):
+		return http.StatusNotFound
+	case k8serrors.IsInvalid(err), k8serrors.IsBadRequest(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// namespaceErrorMessage returns the message of an error of the namespaces client
+func namespaceErrorMessage(err error) string {
+	if _, ok := err.(*k8s.NamespaceNotEmptyError); ok {
+		return fmt.Sprintf("%s, delete them or delete the namespace with ?force=true", err)
+	}
+	return err.Error()
+}
+
 // NamespaceResolver is a method that determines the requested namespace corresponding to an
 // HTTP request. It then validates that OpenFaaS is permitted to operate in that the namespace.
 type NamespaceResolver func(r *http.Request) (namespace string, err error)
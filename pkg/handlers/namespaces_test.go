@@ -3,7 +3,17 @@
 
 package handlers
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
 
 func Test_findNamespace_Found(t *testing.T) {
 	got := findNamespace("fn", []string{"fn", "openfaas-fn"})
@@ -22,3 +32,49 @@ func Test_findNamespace_NotFound(t *testing.T) {
 		t.Errorf("findNamespace - want: %v, got %v", want, got)
 	}
 }
+
+func Test_NamespaceHandler(t *testing.T) {
+	nodeinfo := functionDeployment("nodeinfo", nil)
+	nodeinfo.Namespace = "team-a"
+
+	kube := testclient.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{k8s.NamespaceAnnotation: "1"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+	)
+	namespaces := k8s.NewNamespacesClient(k8s.FunctionFactory{Client: kube}, testNamespace, functionLister(t, nodeinfo))
+	handler := MakeNamespaceHandler(namespaces)
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "create", method: http.MethodPost, url: "/system/namespaces", body: `{"name": "team-b"}`, status: http.StatusAccepted},
+		{name: "create existing", method: http.MethodPost, url: "/system/namespaces", body: `{"name": "team-a"}`, status: http.StatusConflict},
+		{name: "create invalid name", method: http.MethodPost, url: "/system/namespaces", body: `{"name": "Team_B"}`, status: http.StatusBadRequest},
+		{name: "update", method: http.MethodPut, url: "/system/namespaces", body: `{"name": "team-a", "labels": {"team": "a"}}`, status: http.StatusAccepted},
+		{name: "update unmanaged", method: http.MethodPut, url: "/system/namespaces", body: `{"name": "kube-system"}`, status: http.StatusForbidden},
+		{name: "update missing", method: http.MethodPut, url: "/system/namespaces", body: `{"name": "team-c"}`, status: http.StatusNotFound},
+		{name: "delete with functions", method: http.MethodDelete, url: "/system/namespaces", body: `{"name": "team-a"}`, status: http.StatusConflict, want: "nodeinfo"},
+		{name: "delete default", method: http.MethodDelete, url: "/system/namespaces?force=true", body: `{"name": "openfaas-fn"}`, status: http.StatusForbidden},
+		{name: "delete forced", method: http.MethodDelete, url: "/system/namespaces?force=true", body: `{"name": "team-a"}`, status: http.StatusAccepted},
+		{name: "invalid body", method: http.MethodPost, url: "/system/namespaces", body: `{`, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(tc.method, "http://example.com"+tc.url, strings.NewReader(tc.body)))
+
+			if w.Code != tc.status {
+				t.Fatalf("want status code '%d', got '%d': %s", tc.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("want %q in the body, got: %s", tc.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// applyOwnedResources brings the HorizontalPodAutoscaler, PodDisruptionBudget,
+// NetworkPolicy and Ingress of the function in line with the request. They are owned by
+// the function's Deployment so that they are garbage collected with it.
+func applyOwnedResources(ctx context.Context, factory k8s.FunctionFactory, namespace string, request types.FunctionDeployment) error {
+	deployment, err := factory.Client.AppsV1().Deployments(namespace).Get(ctx, request.Service, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	owner := deploymentOwner(deployment)
+
+	if err := k8s.ApplyScaling(ctx, factory.Client, namespace, request, owner); err != nil {
+		return err
+	}
+	if err := k8s.ApplyNetworkPolicy(ctx, factory.Client, factory.Config.NetworkPolicy, namespace, request, owner); err != nil {
+		return err
+	}
+	return k8s.ApplyIngress(ctx, factory.Client, factory.Config.DomainNamespace, namespace, request, factory.Config.RuntimeHTTPPort, owner)
+}
+
+// deleteOwnedResources removes the objects created by applyOwnedResources, so that the
+// HorizontalPodAutoscaler stops acting on a Deployment that is being deleted and the
+// domain of the function is released straight away
+func deleteOwnedResources(ctx context.Context, client kubernetes.Interface, namespace string, deployment *appsv1.Deployment) error {
+	owner := deploymentOwner(deployment)
+
+	if err := k8s.DeleteScaling(ctx, client, namespace, deployment.Name, owner); err != nil {
+		return err
+	}
+	if err := k8s.DeleteNetworkPolicy(ctx, client, namespace, deployment.Name, owner); err != nil {
+		return err
+	}
+	return k8s.DeleteIngress(ctx, client, namespace, deployment.Name, owner)
+}
+
+// rollbackOwnedResources undoes applyOwnedResources for a function whose Deployment is
+// about to be restored to previous, or deleted when previous is nil
+func rollbackOwnedResources(ctx context.Context, factory k8s.FunctionFactory, namespace, name string, previous *appsv1.Deployment) error {
+	deployment, err := factory.Client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get Deployment: %s", err.Error())
+	}
+
+	if previous == nil {
+		return deleteOwnedResources(ctx, factory.Client, namespace, deployment)
+	}
+
+	// the owned objects are built from the labels and annotations of the pod template,
+	// which are the ones of the request that the Deployment was made from
+	request := deploymentRequest(previous)
+	request.Service = name
+	return applyOwnedResources(ctx, factory, namespace, request)
+}
+
+// deploymentOwner returns a controller reference to deployment
+func deploymentOwner(deployment *appsv1.Deployment) metav1.OwnerReference {
+	return *metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+}
+
+// hasAutoscaling returns true when the replicas of the function are managed by a
+// HorizontalPodAutoscaler
+func hasAutoscaling(labels map[string]string) bool {
+	_, ok := labels[k8s.MaxScaleLabel]
+	return ok
+}
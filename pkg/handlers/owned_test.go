@@ -0,0 +1,76 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_Handlers_ManageOwnedResources(t *testing.T) {
+	factory := validationFactory()
+	ctx := context.TODO()
+	hpas := factory.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(testNamespace)
+	pdbs := factory.Client.PolicyV1().PodDisruptionBudgets(testNamespace)
+	ingresses := factory.Client.NetworkingV1().Ingresses(testNamespace)
+
+	labels := map[string]string{k8s.MinScaleLabel: "2", k8s.MaxScaleLabel: "5", k8s.ScaleTypeLabel: k8s.ScaleTypeRPS}
+	annotations := map[string]string{k8s.PDBMinAvailableLabel: "50%", k8s.DomainAnnotation: "nodeinfo.example.com"}
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1", Labels: &labels, Annotations: &annotations}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	hpa, err := hpas.Get(ctx, "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want HorizontalPodAutoscaler to be created, got: %s", err)
+	}
+	if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 5 {
+		t.Errorf("want 2 to 5 replicas, got %d to %d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if owner := metav1.GetControllerOf(hpa); owner == nil || owner.Kind != "Deployment" || owner.Name != "nodeinfo" {
+		t.Errorf("want HorizontalPodAutoscaler to be owned by the Deployment, got: %v", owner)
+	}
+	if _, err := pdbs.Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want PodDisruptionBudget to be created, got: %s", err)
+	}
+	if _, err := ingresses.Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want Ingress to be created, got: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:2", Annotations: &annotations}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want update status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	if _, err := hpas.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want HorizontalPodAutoscaler to be deleted, got: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	MakeDeleteHandler(testNamespace, factory.Client).ServeHTTP(w, functionRequest(t, http.MethodDelete, "http://system/functions",
+		map[string]string{"functionName": "nodeinfo"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want delete status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	if _, err := pdbs.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want PodDisruptionBudget to be deleted, got: %v", err)
+	}
+	if _, err := ingresses.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want Ingress to be deleted, got: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/auth"
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	"golang.org/x/time/rate"
 	v1 "k8s.io/client-go/listers/apps/v1"
@@ -16,8 +17,14 @@ import (
 
 const RateQPSLabel = "com.openfaas.rate.qps"
 
+// RatePerCallerLabel set to true gives each authenticated caller its own bucket of
+// RateQPSLabel, anonymous callers share the bucket of the function
+const RatePerCallerLabel = "com.openfaas.rate.per-caller"
+
 type BucketService interface {
-	GetBucket(functionName string, lookupNamespace string) (*rate.Limiter, error)
+	// GetBucket returns the bucket of a function, caller is the identity of an
+	// authenticated caller or empty
+	GetBucket(functionName string, lookupNamespace string, caller string) (*rate.Limiter, error)
 }
 
 // MakeRateLimitedHandler make a layer of rate limited handler for function invoke api
@@ -30,7 +37,12 @@ func MakeRateLimitedHandler(next http.HandlerFunc, service BucketService, defaul
 		var namespace string
 		functionName, namespace = k8s.GetFuncName(functionName, defaultNamespace)
 
-		bucket, err := service.GetBucket(functionName, namespace)
+		var caller string
+		if identity := auth.IdentityFrom(r.Context()); identity != nil {
+			caller = identity.String()
+		}
+
+		bucket, err := service.GetBucket(functionName, namespace, caller)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(fmt.Sprintf("Unable to get rate limiter for %s.%s", functionName, namespace)))
@@ -49,42 +61,55 @@ func MakeRateLimitedHandler(next http.HandlerFunc, service BucketService, defaul
 }
 
 type FunctionBucketServiceImpl struct {
-	cache  map[string]*rate.Limiter
-	mu     sync.Mutex
-	lister v1.DeploymentLister
+	cache     map[string]*rate.Limiter
+	perCaller map[string]bool
+	mu        sync.Mutex
+	lister    v1.DeploymentLister
 }
 
 func NewFunctionBucketService(lister v1.DeploymentLister) BucketService {
 	s := FunctionBucketServiceImpl{
-		cache:  make(map[string]*rate.Limiter),
-		mu:     sync.Mutex{},
-		lister: lister,
+		cache:     make(map[string]*rate.Limiter),
+		perCaller: make(map[string]bool),
+		mu:        sync.Mutex{},
+		lister:    lister,
 	}
 	return &s
 }
 
-func (s *FunctionBucketServiceImpl) GetBucket(functionName string, namespace string) (*rate.Limiter, error) {
+func (s *FunctionBucketServiceImpl) GetBucket(functionName string, namespace string, caller string) (*rate.Limiter, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// function name must not contain '#' as a legal dns entry
 	key := namespace + "#" + functionName
 	val, hit := s.cache[key]
-	if hit {
-		return val, nil
+	if !hit {
+		var perCaller bool
+		var err error
+		val, perCaller, err = computeFunctionBucket(functionName, namespace, s.lister)
+		if err != nil {
+			return nil, err
+		}
+
+		s.cache[key] = val
+		s.perCaller[key] = perCaller
 	}
 
-	var err error
-	val, err = computeFunctionBucket(functionName, namespace, s.lister)
-	if err != nil {
-		return nil, err
+	if len(caller) == 0 || !s.perCaller[key] {
+		return val, nil
 	}
 
-	s.cache[key] = val
-	return val, nil
+	callerKey := key + "#" + caller
+	callerVal, hit := s.cache[callerKey]
+	if !hit {
+		callerVal = rate.NewLimiter(val.Limit(), val.Burst())
+		s.cache[callerKey] = callerVal
+	}
+	return callerVal, nil
 }
 
-func computeFunctionBucket(functionName string, namespace string, lister v1.DeploymentLister) (*rate.Limiter, error) {
+func computeFunctionBucket(functionName string, namespace string, lister v1.DeploymentLister) (*rate.Limiter, bool, error) {
 	// no rate limit for default config
 	defaultQPSRate := rate.Inf
 	// if rate is Inf, burst (or bucket capacity) is ignored
@@ -97,28 +122,30 @@ func computeFunctionBucket(functionName string, namespace string, lister v1.Depl
 	if err != nil {
 		log.Printf("Unable to fetch service: %s %s\n", functionName, namespace)
 		log.Printf(err.Error())
-		return nil, err
+		return nil, false, err
 	}
 
 	if function == nil {
 		log.Printf("function not found")
-		return nil, fmt.Errorf("function not found")
+		return nil, false, fmt.Errorf("function not found")
 	}
 
 	delay := time.Since(start)
 	log.Printf("Ratelimiter query for %s.%s, %dms\n", functionName, namespace, delay.Milliseconds())
 
 	labels := *function.Labels
+	perCaller, _ := strconv.ParseBool(labels[RatePerCallerLabel])
+
 	qps, exists := labels[RateQPSLabel]
 	if !exists {
-		return fallback, nil
+		return fallback, false, nil
 	}
 
 	val, e := strconv.ParseFloat(qps, 64)
 	if e != nil {
-		return fallback, nil
+		return fallback, false, nil
 	}
 
 	// default burst/bucket capacity is set accordingly
-	return rate.NewLimiter(rate.Limit(val), int(math.Ceil(val))), nil
+	return rate.NewLimiter(rate.Limit(val), int(math.Ceil(val))), perCaller, nil
 }
@@ -0,0 +1,46 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func Test_FunctionBucketService_PerCaller(t *testing.T) {
+	rateLimited := func(name string, labels map[string]string) *appsv1.Deployment {
+		deployment := functionDeployment(name, nil)
+		for k, v := range labels {
+			deployment.Spec.Template.Labels[k] = v
+		}
+		return deployment
+	}
+
+	service := NewFunctionBucketService(functionLister(t,
+		rateLimited("shared", map[string]string{RateQPSLabel: "1"}),
+		rateLimited("per-caller", map[string]string{RateQPSLabel: "1", RatePerCallerLabel: "true"}),
+	))
+
+	bucket := func(function, caller string) interface{} {
+		b, err := service.GetBucket(function, testNamespace, caller)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return b
+	}
+
+	if bucket("shared", "jwt:alice") != bucket("shared", "jwt:bob") {
+		t.Errorf("want callers to share the bucket of the function")
+	}
+	if bucket("per-caller", "jwt:alice") == bucket("per-caller", "jwt:bob") {
+		t.Errorf("want a bucket per caller")
+	}
+	if bucket("per-caller", "jwt:alice") != bucket("per-caller", "jwt:alice") {
+		t.Errorf("want the bucket of a caller to be reused")
+	}
+	if bucket("per-caller", "") == bucket("per-caller", "jwt:alice") {
+		t.Errorf("want anonymous callers to use the bucket of the function")
+	}
+}
@@ -66,7 +66,12 @@ func getServiceList(functionNamespace string, deploymentLister v1.DeploymentList
 	if err != nil {
 		return functions, err
 	}
-	onlyFunctions := sel.Add(*req)
+	// the new version of a blue/green update is not a function of its own
+	notBlueGreen, err := labels.NewRequirement(BlueGreenLabel, selection.DoesNotExist, []string{})
+	if err != nil {
+		return functions, err
+	}
+	onlyFunctions := sel.Add(*req, *notBlueGreen)
 
 	res, err := deploymentLister.Deployments(functionNamespace).List(onlyFunctions)
 
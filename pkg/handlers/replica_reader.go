@@ -81,6 +81,11 @@ func getService(functionNamespace string, functionName string, lister v1.Deploym
 	}
 
 	if item != nil {
+		// the new version of a blue/green update is not a function of its own
+		if _, ok := item.Labels[BlueGreenLabel]; ok {
+			return nil, nil
+		}
+
 		function := k8s.AsFunctionStatus(*item)
 		if function != nil {
 			return function, nil
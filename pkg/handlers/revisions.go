@@ -0,0 +1,188 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	bootstrap "github.com/openfaas/faas-provider"
+	"github.com/openfaas/faas-provider/auth"
+	types "github.com/openfaas/faas-provider/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RollbackRequest is the body of a request to roll a function back to an earlier revision
+type RollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+// RegisterSystemRoute adds a handler to the provider's router for a path that is not
+// part of faas-provider. The handler is protected with basic auth in the same way as
+// the other system routes. It must be called before the provider is started.
+func RegisterSystemRoute(path string, handler http.HandlerFunc, config types.FaaSConfig, methods ...string) {
+	if config.EnableBasicAuth {
+		reader := auth.ReadBasicAuthFromDisk{
+			SecretMountPath: config.SecretMountPath,
+		}
+
+		credentials, err := reader.Read()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		handler = auth.DecorateWithBasicAuth(handler, credentials)
+	}
+
+	bootstrap.Router().HandleFunc(path, handler).Methods(methods...)
+}
+
+// MakeRevisionsHandler lists the stored revisions of a function
+func MakeRevisionsHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		revisions, err := factory.ListRevisions(r.Context(), lookupNamespace, functionName)
+		if err != nil {
+			status, _ := ProcessErrorReasons(err)
+			log.Printf("Unable to list revisions for %s.%s: %s\n", functionName, lookupNamespace, err.Error())
+			http.Error(w, fmt.Sprintf("unable to list revisions: %s", err.Error()), status)
+			return
+		}
+
+		res, err := json.Marshal(revisions)
+		if err != nil {
+			http.Error(w, "failed to marshal revisions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
+
+// MakeRollbackHandler re-applies a stored revision of a function. The image is pinned
+// to the digest that the revision ran with when it is known. The rollback is recorded
+// as a new revision.
+func MakeRollbackHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		request, err := ReadRollbackRequest(ctx, r, lookupNamespace, functionName, factory)
+		if err != nil {
+			status, _ := ProcessErrorReasons(err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if err := ValidateFunctionRequest(ctx, request, lookupNamespace, factory); err != nil {
+			log.Printf("Rollback request for %s.%s rejected: %s\n", functionName, lookupNamespace, err.Error())
+			WriteValidationError(w, err)
+			return
+		}
+
+		if current, err, _ := getDeployment(ctx, lookupNamespace, factory, functionName); err == nil {
+			if err, status := checkNoBlueGreenUpdate(current); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+
+		if err, status := updateFunction(ctx, lookupNamespace, factory, *request, buildAnnotations(*request)); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		log.Printf("Function rolled back: %s.%s to %s\n", functionName, lookupNamespace, request.Image)
+
+		recordRevision(ctx, lookupNamespace, factory, *request)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ReadRollbackRequest reads the body of a rollback request and returns the deploy
+// request of the revision that it refers to, with the image pinned to its digest
+func ReadRollbackRequest(ctx context.Context, r *http.Request, namespace, functionName string, factory k8s.FunctionFactory) (*types.FunctionDeployment, error) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rollback := RollbackRequest{}
+	if err := json.Unmarshal(body, &rollback); err != nil {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("unable to unmarshal request: %s", err.Error()))
+	}
+
+	if rollback.Revision < 1 {
+		return nil, k8serrors.NewBadRequest("revision must be greater than zero")
+	}
+
+	revision, err := factory.GetRevision(ctx, namespace, functionName, rollback.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	request := revision.Spec
+	request.Service = functionName
+	request.Namespace = namespace
+	request.Image = revision.ImageReference()
+
+	return &request, nil
+}
+
+// recordRevision stores the request in the function's revision history. A failure is
+// logged rather than returned, since the function itself was deployed.
+func recordRevision(ctx context.Context, namespace string, factory k8s.FunctionFactory, request types.FunctionDeployment) {
+	deployment, err := factory.Client.AppsV1().Deployments(namespace).Get(ctx, request.Service, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Unable to record revision of %s.%s: %s\n", request.Service, namespace, err.Error())
+		return
+	}
+
+	owner := metav1.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       deployment.Name,
+		UID:        deployment.UID,
+	}
+
+	revision, err := factory.RecordRevision(ctx, namespace, request, owner)
+	if err != nil {
+		log.Printf("Unable to record revision of %s.%s: %s\n", request.Service, namespace, err.Error())
+		return
+	}
+
+	log.Printf("Function %s.%s is at revision %d\n", request.Service, namespace, revision.Revision)
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RollbackHandler_RestoresRevision(t *testing.T) {
+	factory := validationFactory()
+
+	w := httptest.NewRecorder()
+	MakeDeployHandler(testNamespace, factory).ServeHTTP(w, functionRequest(t, http.MethodPost, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want deploy status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	MakeUpdateHandler(testNamespace, factory, nil).ServeHTTP(w, functionRequest(t, http.MethodPut, "http://system/functions",
+		types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:2"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want update status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r := functionRequest(t, http.MethodPost, "http://system/function/nodeinfo/rollback", RollbackRequest{Revision: 1})
+	r = mux.SetURLVars(r, map[string]string{"name": "nodeinfo"})
+	MakeRollbackHandler(testNamespace, factory).ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	deployment, err := factory.Client.AppsV1().Deployments(testNamespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want Deployment to exist, got: %s", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "functions/nodeinfo:1" {
+		t.Errorf("want image to be rolled back to functions/nodeinfo:1, got: %s", image)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "http://system/function/nodeinfo/revisions", nil)
+	r = mux.SetURLVars(r, map[string]string{"name": "nodeinfo"})
+	MakeRevisionsHandler(testNamespace, factory).ServeHTTP(w, r)
+
+	revisions := []k8s.FunctionRevision{}
+	if err := json.NewDecoder(w.Body).Decode(&revisions); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+
+	if len(revisions) != 3 || revisions[2].Image != "functions/nodeinfo:1" {
+		t.Errorf("want the rollback to be recorded as revision 3, got: %v", revisions)
+	}
+}
+
+func Test_RollbackHandler_UnknownRevision(t *testing.T) {
+	factory := validationFactory()
+
+	w := httptest.NewRecorder()
+	r := functionRequest(t, http.MethodPost, "http://system/function/nodeinfo/rollback", RollbackRequest{Revision: 4})
+	r = mux.SetURLVars(r, map[string]string{"name": "nodeinfo"})
+	MakeRollbackHandler(testNamespace, factory).ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status code '%d', got '%d': %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
@@ -5,20 +5,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
 )
 
 // MakeSecretHandler makes a handler for Create/List/Delete/Update of
-// secrets in the Kubernetes API
-func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface) http.HandlerFunc {
+// secrets with the secrets client, in the Kubernetes API or in a secret store.
+// The functions that use each secret are found with the deployment lister.
+func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface, secrets k8s.SecretsClient, deployments appslisters.DeploymentLister) http.HandlerFunc {
 	handler := SecretsHandler{
 		LookupNamespace: NewNamespaceResolver(defaultNamespace, kube),
-		Secrets:         k8s.NewSecretsClient(kube),
+		Secrets:         secrets,
+		Deployments:     deployments,
 	}
 	return handler.ServeHTTP
 }
@@ -27,6 +32,10 @@ func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface) http.
 type SecretsHandler struct {
 	Secrets         k8s.SecretsClient
 	LookupNamespace NamespaceResolver
+
+	// Deployments finds the functions that use a secret, secrets that are in use can
+	// be deleted when it is nil
+	Deployments appslisters.DeploymentLister
 }
 
 func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -62,8 +71,16 @@ func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// listSecrets returns the names of the secrets, or with ?metadata=true also their type,
+// keys, labels and the functions that use them. The values of secrets are never returned.
 func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *http.Request) {
-	res, err := h.Secrets.List(namespace)
+	var secrets interface{}
+	var err error
+	if r.URL.Query().Get("metadata") == "true" {
+		secrets, err = h.listSecretMetadata(namespace)
+	} else {
+		secrets, err = h.listSecretNames(namespace)
+	}
 	if err != nil {
 		status, reason := ProcessErrorReasons(err)
 		log.Printf("Secret list error reason: %s, %v\n", reason, err)
@@ -71,13 +88,6 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 		return
 	}
 
-	secrets := make([]types.Secret, len(res))
-	for idx, name := range res {
-		secrets[idx] = types.Secret{
-			Name:      name,
-			Namespace: namespace,
-		}
-	}
 	secretsBytes, err := json.Marshal(secrets)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -89,8 +99,43 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 	w.Write(secretsBytes)
 }
 
+func (h SecretsHandler) listSecretMetadata(namespace string) ([]k8s.SecretMetadata, error) {
+	secrets, err := h.Secrets.ListMetadata(namespace)
+	if err != nil || h.Deployments == nil {
+		return secrets, err
+	}
+
+	usage, err := k8s.SecretUsage(h.Deployments, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range secrets {
+		secrets[i].UsedBy = usage[secrets[i].Name]
+		if secrets[i].UsedBy == nil {
+			secrets[i].UsedBy = []string{}
+		}
+	}
+	return secrets, nil
+}
+
+func (h SecretsHandler) listSecretNames(namespace string) ([]types.Secret, error) {
+	res, err := h.Secrets.List(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]types.Secret, len(res))
+	for idx, name := range res {
+		secrets[idx] = types.Secret{
+			Name:      name,
+			Namespace: namespace,
+		}
+	}
+	return secrets, nil
+}
+
 func (h SecretsHandler) createSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
+	secret := k8s.Secret{}
 	err := json.NewDecoder(r.Body).Decode(&secret)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -111,7 +156,7 @@ func (h SecretsHandler) createSecret(namespace string, w http.ResponseWriter, r
 }
 
 func (h SecretsHandler) replaceSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
+	secret := k8s.Secret{}
 	err := json.NewDecoder(r.Body).Decode(&secret)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -140,6 +185,23 @@ func (h SecretsHandler) deleteSecret(namespace string, w http.ResponseWriter, r
 		return
 	}
 
+	// the Pods of functions that use the secret would not start again without it
+	if h.Deployments != nil && r.URL.Query().Get("force") != "true" {
+		usage, err := k8s.SecretUsage(h.Deployments, namespace)
+		if err != nil {
+			log.Printf("Secret delete error: unable to find the functions that use %s: %v\n", secret.Name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if functions := usage[secret.Name]; len(functions) > 0 {
+			msg := fmt.Sprintf("secret %s is used by the functions: %s, remove it from them or delete it with ?force=true",
+				secret.Name, strings.Join(functions, ", "))
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+
 	err = h.Secrets.Delete(namespace, secret.Name)
 	if err != nil {
 		status, reason := ProcessErrorReasons(err)
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,7 +26,7 @@ const secretLabelValue = "openfaas"
 func Test_SecretsHandler(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), nil).ServeHTTP
 	secretName := "testsecret"
 
 	t.Run("create managed secrets", func(t *testing.T) {
@@ -185,7 +186,7 @@ func Test_SecretsHandler(t *testing.T) {
 func Test_SecretsHandler_ListEmpty(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), nil).ServeHTTP
 
 	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
 	w := httptest.NewRecorder()
@@ -284,3 +285,203 @@ func Test_NamespaceResolver(t *testing.T) {
 		}
 	})
 }
+
+func Test_SecretsHandler_MultipleKeys(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), nil).ServeHTTP
+
+	t.Run("create a TLS secret", func(t *testing.T) {
+		// the certificate is sent base64 encoded, the key as text
+		payload := `{"name": "tls", "type": "kubernetes.io/tls", "data": {"tls.crt": "Y2VydA=="}, "stringData": {"tls.key": "key"}}`
+		req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("want status code '%d', got '%d'", http.StatusAccepted, w.Code)
+		}
+
+		actualSecret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "tls", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error validating secret: %s", err)
+		}
+		if actualSecret.Type != v1.SecretTypeTLS {
+			t.Errorf("want secret type: '%s', got: '%s'", v1.SecretTypeTLS, actualSecret.Type)
+		}
+		if string(actualSecret.Data["tls.crt"]) != "cert" || actualSecret.StringData["tls.key"] != "key" {
+			t.Errorf("want both keys to be stored, got data: %v, string data: %v", actualSecret.Data, actualSecret.StringData)
+		}
+		if _, ok := actualSecret.StringData["tls"]; ok {
+			t.Errorf("want no key named after the secret, got: %v", actualSecret.StringData)
+		}
+	})
+
+	t.Run("create a binary secret", func(t *testing.T) {
+		payload := `{"name": "keystore", "rawValue": "AAECAw=="}`
+		req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("want status code '%d', got '%d'", http.StatusAccepted, w.Code)
+		}
+
+		actualSecret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "keystore", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error validating secret: %s", err)
+		}
+		if string(actualSecret.Data["keystore"]) != "\x00\x01\x02\x03" {
+			t.Errorf("want the raw value under the name of the secret, got: %v", actualSecret.Data)
+		}
+	})
+
+	t.Run("list metadata without values", func(t *testing.T) {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: namespace, Labels: map[string]string{secretLabel: secretLabelValue}},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("s3cr3t")},
+		}
+		kube.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+
+		req := httptest.NewRequest("GET", "http://example.com/foo?metadata=true", nil)
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("want status code '%d', got '%d'", http.StatusOK, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "s3cr3t") || strings.Contains(w.Body.String(), "czNjcjN0") {
+			t.Fatalf("want no values in the list, got: %s", w.Body.String())
+		}
+
+		list := []map[string]interface{}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range list {
+			if item["name"] != "db" {
+				continue
+			}
+			if item["type"] != "Opaque" || fmt.Sprint(item["keys"]) != "[password username]" {
+				t.Errorf("want the type and keys of the secret, got: %v", item)
+			}
+			return
+		}
+		t.Errorf("want the db secret to be listed, got: %s", w.Body.String())
+	})
+
+	t.Run("replace removes keys that are not sent", func(t *testing.T) {
+		payload := `{"name": "db", "stringData": {"password": "n3w"}}`
+		req := httptest.NewRequest("PUT", "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("want status code '%d', got '%d'", http.StatusAccepted, w.Code)
+		}
+
+		actualSecret, _ := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "db", metav1.GetOptions{})
+		if len(actualSecret.Data) != 0 || actualSecret.StringData["password"] != "n3w" {
+			t.Errorf("want only the new password, got data: %v, string data: %v", actualSecret.Data, actualSecret.StringData)
+		}
+	})
+
+	cases := []struct {
+		name    string
+		method  string
+		payload string
+	}{
+		{name: "change the type", method: "PUT", payload: `{"name": "db", "type": "kubernetes.io/tls", "stringData": {"tls.key": "key"}}`},
+		{name: "value and raw value", method: "POST", payload: `{"name": "both", "value": "text", "rawValue": "AAECAw=="}`},
+		{name: "key set twice", method: "POST", payload: `{"name": "twice", "stringData": {"key": "a"}, "data": {"key": "Yg=="}}`},
+		{name: "invalid key", method: "POST", payload: `{"name": "invalid", "stringData": {"a/b": "c"}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name+" is rejected", func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://example.com/foo", strings.NewReader(tc.payload))
+			w := httptest.NewRecorder()
+
+			secretsHandler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("want status code '%d', got '%d'", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func Test_SecretsHandler_Usage(t *testing.T) {
+	labels := map[string]string{secretLabel: secretLabelValue}
+	kube := testclient.NewSimpleClientset(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db-creds", Namespace: testNamespace, Labels: labels}, Data: map[string][]byte{"password": []byte("s3cr3t")}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: testNamespace, Labels: labels}, Data: map[string][]byte{"api-key": []byte("k3y")}},
+	)
+
+	wordpress := functionDeployment("wordpress", nil)
+	wordpress.Spec.Template.Spec.Containers[0].Env = []v1.EnvVar{{
+		Name: "WORDPRESS_DB_PASSWORD",
+		ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "db-creds"},
+			Key:                  "password",
+		}},
+	}}
+	lister := functionLister(t, wordpress, functionDeployment("nodeinfo", nil))
+
+	secretsHandler := MakeSecretHandler(testNamespace, kube, k8s.NewSecretsClient(kube), lister).ServeHTTP
+
+	t.Run("metadata lists the functions that use each secret", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		secretsHandler(w, httptest.NewRequest(http.MethodGet, "http://example.com/system/secrets?metadata=true", nil))
+
+		secrets := []k8s.SecretMetadata{}
+		if err := json.Unmarshal(w.Body.Bytes(), &secrets); err != nil {
+			t.Fatal(err)
+		}
+
+		usedBy := map[string][]string{}
+		for _, secret := range secrets {
+			usedBy[secret.Name] = secret.UsedBy
+		}
+		if fmt.Sprint(usedBy["db-creds"]) != "[wordpress]" || usedBy["api-key"] == nil || len(usedBy["api-key"]) != 0 {
+			t.Errorf("want db-creds to be used by wordpress only, got: %v", usedBy)
+		}
+	})
+
+	cases := []struct {
+		name   string
+		secret string
+		url    string
+		status int
+		body   string
+	}{
+		{name: "secret in use", secret: "db-creds", url: "/system/secrets", status: http.StatusConflict, body: "wordpress"},
+		{name: "unused secret", secret: "api-key", url: "/system/secrets", status: http.StatusAccepted},
+		{name: "forced", secret: "db-creds", url: "/system/secrets?force=true", status: http.StatusAccepted},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := fmt.Sprintf(`{"name": %q}`, tc.secret)
+			w := httptest.NewRecorder()
+			secretsHandler(w, httptest.NewRequest(http.MethodDelete, "http://example.com"+tc.url, strings.NewReader(payload)))
+
+			if w.Code != tc.status {
+				t.Fatalf("want status code '%d', got '%d': %s", tc.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("want %q in the body, got: %s", tc.body, w.Body.String())
+			}
+
+			_, err := kube.CoreV1().Secrets(testNamespace).Get(context.TODO(), tc.secret, metav1.GetOptions{})
+			if deleted := err != nil; deleted != (tc.status == http.StatusAccepted) {
+				t.Errorf("want deleted %v, got error: %v", tc.status == http.StatusAccepted, err)
+			}
+		})
+	}
+}
@@ -15,11 +15,14 @@ import (
 	"github.com/openfaas/faas-netes/pkg/k8s"
 
 	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// MakeUpdateHandler update specified function
-func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+// MakeUpdateHandler update specified function, requests for a blue/green update are
+// passed to blueGreen and fall back to a rolling update when it is nil
+func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory, blueGreen *BlueGreenUpdater) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		if r.Body != nil {
@@ -46,50 +49,178 @@ func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) htt
 			return
 		}
 
+		if err := ValidateFunctionRequest(ctx, &request, lookupNamespace, factory); err != nil {
+			log.Printf("Update request for %s.%s rejected: %s\n", request.Service, lookupNamespace, err.Error())
+			WriteValidationError(w, err)
+			return
+		}
+
+		addNamespaceProfiles(ctx, factory, lookupNamespace, &request)
+
 		annotations := buildAnnotations(request)
-		if err, status := updateDeploymentSpec(ctx, lookupNamespace, factory, request, annotations); err != nil {
-			if !k8s.IsNotFound(err) {
-				log.Printf("error updating deployment: %s.%s, error: %s\n", request.Service, lookupNamespace, err)
 
+		if IsDryRun(r) {
+			deployment, err, status := getDeployment(ctx, lookupNamespace, factory, request.Service)
+			if err == nil {
+				err, status = makeUpdatedDeploymentSpec(ctx, lookupNamespace, deployment, factory, request, annotations)
+			}
+			if err != nil {
+				wrappedErr := fmt.Errorf("unable to render Deployment: %s.%s, error: %s", request.Service, lookupNamespace, err.Error())
+				http.Error(w, wrappedErr.Error(), status)
+				return
+			}
+
+			service, err, status := makeUpdatedServiceSpec(lookupNamespace, factory, request, annotations)
+			if k8s.IsNotFound(err) {
+				service, err = makeServiceSpec(request, factory), nil
+			}
+			if err != nil {
+				wrappedErr := fmt.Errorf("unable to render Service: %s.%s, error: %s", request.Service, lookupNamespace, err.Error())
+				http.Error(w, wrappedErr.Error(), status)
+				return
+			}
+
+			WriteDryRun(w, lookupNamespace, deployment, service)
+			return
+		}
+
+		if IsBlueGreen(request) && blueGreen != nil {
+			if err, status := blueGreen.Start(ctx, lookupNamespace, request); err != nil {
+				log.Printf("error starting blue/green update: %s.%s, error: %s\n", request.Service, lookupNamespace, err)
+				http.Error(w, err.Error(), status)
 				return
 			}
 
-			wrappedErr := fmt.Errorf("unable update Deployment: %s.%s, error: %s", request.Service, lookupNamespace, err.Error())
-			http.Error(w, wrappedErr.Error(), status)
+			// the revision is recorded once the new version has passed its health gate
+			w.WriteHeader(http.StatusAccepted)
 			return
 		}
 
-		if err, status := updateService(lookupNamespace, factory, request, annotations); err != nil {
-			if !k8s.IsNotFound(err) {
-				log.Printf("error updating service: %s.%s, error: %s\n", request.Service, lookupNamespace, err)
+		if current, err, _ := getDeployment(ctx, lookupNamespace, factory, request.Service); err == nil {
+			if err, status := checkNoBlueGreenUpdate(current); err != nil {
+				http.Error(w, err.Error(), status)
+				return
 			}
+		}
 
-			wrappedErr := fmt.Errorf("unable update Service: %s.%s, error: %s", request.Service, request.Namespace, err.Error())
-			http.Error(w, wrappedErr.Error(), status)
+		if err, status := updateFunction(ctx, lookupNamespace, factory, request, annotations); err != nil {
+			http.Error(w, err.Error(), status)
 			return
 		}
 
+		recordRevision(ctx, lookupNamespace, factory, request)
+
 		w.WriteHeader(http.StatusAccepted)
 	}
 }
 
-func updateDeploymentSpec(
+// updateFunction applies the request to the function's Deployment, Service and the
+// objects they own, the Deployment is restored when the Service cannot be updated
+func updateFunction(
 	ctx context.Context,
 	functionNamespace string,
 	factory k8s.FunctionFactory,
 	request types.FunctionDeployment,
 	annotations map[string]string) (err error, httpStatus int) {
 
+	previous, err, status := updateDeploymentSpec(ctx, functionNamespace, factory, request, annotations)
+	if err != nil {
+		log.Printf("error updating deployment: %s.%s, error: %s\n", request.Service, functionNamespace, err)
+
+		return fmt.Errorf("unable update Deployment: %s.%s, error: %s", request.Service, functionNamespace, err.Error()), status
+	}
+
+	previousService, err, status := updateService(functionNamespace, factory, request, annotations)
+	if err != nil {
+		log.Printf("error updating service: %s.%s, error: %s\n", request.Service, functionNamespace, err)
+
+		wrappedErr := fmt.Errorf("unable update Service: %s.%s, error: %s", request.Service, functionNamespace, err.Error())
+		if rollbackErr := rollbackDeployment(ctx, factory.Client, functionNamespace, request.Service, previous); rollbackErr != nil {
+			log.Printf("error rolling back deployment: %s.%s, error: %s\n", request.Service, functionNamespace, rollbackErr)
+			wrappedErr = fmt.Errorf("%s, rollback of Deployment failed: %s", wrappedErr.Error(), rollbackErr.Error())
+		}
+
+		return wrappedErr, status
+	}
+
+	if err := applyOwnedResources(ctx, factory, functionNamespace, request); err != nil {
+		log.Printf("error updating function resources: %s.%s, error: %s\n", request.Service, functionNamespace, err)
+
+		status, _ := ProcessErrorReasons(err)
+		wrappedErr := fmt.Errorf("unable update function resources: %s.%s, error: %s", request.Service, functionNamespace, err.Error())
+		if rollbackErr := rollbackFunction(ctx, factory, functionNamespace, request.Service, previous, previousService); rollbackErr != nil {
+			log.Printf("error rolling back function: %s.%s, error: %s\n", request.Service, functionNamespace, rollbackErr)
+			wrappedErr = fmt.Errorf("%s, rollback of function failed: %s", wrappedErr.Error(), rollbackErr.Error())
+		}
+
+		return wrappedErr, status
+	}
+
+	return nil, http.StatusAccepted
+}
+
+// updateDeploymentSpec applies the request to the function's Deployment and returns the
+// Deployment as it was before the update, so that it can be restored if a later step fails
+func updateDeploymentSpec(
+	ctx context.Context,
+	functionNamespace string,
+	factory k8s.FunctionFactory,
+	request types.FunctionDeployment,
+	annotations map[string]string) (previous *appsv1.Deployment, err error, httpStatus int) {
+
+	deployment, err, status := getDeployment(ctx, functionNamespace, factory, request.Service)
+	if err != nil {
+		return nil, err, status
+	}
+
+	previous = deployment.DeepCopy()
+
+	if err, status := makeUpdatedDeploymentSpec(ctx, functionNamespace, deployment, factory, request, annotations); err != nil {
+		return nil, err, status
+	}
+
+	if _, updateErr := factory.Client.AppsV1().
+		Deployments(functionNamespace).
+		Update(context.TODO(), deployment, metav1.UpdateOptions{}); updateErr != nil {
+
+		status, _ := ProcessErrorReasons(updateErr)
+		return nil, updateErr, status
+	}
+
+	return previous, nil, http.StatusAccepted
+}
+
+// getDeployment fetches the function's Deployment
+func getDeployment(
+	ctx context.Context,
+	functionNamespace string,
+	factory k8s.FunctionFactory,
+	functionName string) (deployment *appsv1.Deployment, err error, httpStatus int) {
+
 	getOpts := metav1.GetOptions{}
 
 	deployment, findDeployErr := factory.Client.AppsV1().
 		Deployments(functionNamespace).
-		Get(context.TODO(), request.Service, getOpts)
+		Get(ctx, functionName, getOpts)
 
 	if findDeployErr != nil {
-		return findDeployErr, http.StatusNotFound
+		status, _ := ProcessErrorReasons(findDeployErr)
+		return nil, findDeployErr, status
 	}
 
+	return deployment, nil, http.StatusOK
+}
+
+// makeUpdatedDeploymentSpec applies the request to the existing Deployment without
+// persisting it
+func makeUpdatedDeploymentSpec(
+	ctx context.Context,
+	functionNamespace string,
+	deployment *appsv1.Deployment,
+	factory k8s.FunctionFactory,
+	request types.FunctionDeployment,
+	annotations map[string]string) (err error, httpStatus int) {
+
 	if len(deployment.Spec.Template.Spec.Containers) > 0 {
 		deployment.Spec.Template.Spec.Containers[0].Image = request.Image
 
@@ -111,7 +242,8 @@ func updateDeploymentSpec(
 		}
 
 		if request.Labels != nil {
-			if min := getMinReplicaCount(*request.Labels); min != nil {
+			// the replicas of an autoscaled function are left to its HorizontalPodAutoscaler
+			if min := getMinReplicaCount(*request.Labels); min != nil && !hasAutoscaling(*request.Labels) {
 				deployment.Spec.Replicas = min
 			}
 
@@ -127,6 +259,14 @@ func updateDeploymentSpec(
 		// and determine which profiles need to be removed
 		currentAnnotations := deployment.Annotations
 		deployment.Annotations = annotations
+
+		// the status of the last blue/green update is not part of the request
+		if value, ok := currentAnnotations[BlueGreenStatusAnnotation]; ok {
+			deployment.Annotations = map[string]string{BlueGreenStatusAnnotation: value}
+			for k, v := range annotations {
+				deployment.Annotations[k] = v
+			}
+		}
 		deployment.Spec.Template.Annotations = annotations
 		deployment.Spec.Template.ObjectMeta.Annotations = annotations
 
@@ -148,8 +288,8 @@ func updateDeploymentSpec(
 
 		deployment.Spec.Template.Spec.ServiceAccountName = serviceAccount
 
-		secrets := k8s.NewSecretsClient(factory.Client)
-		existingSecrets, err := secrets.GetSecrets(functionNamespace, request.Secrets)
+		secrets := factory.SecretsClient()
+		existingSecrets, err := secrets.GetSecrets(functionNamespace, k8s.RequiredSecrets(request.Secrets, annotations))
 		if err != nil {
 			return err, http.StatusBadRequest
 		}
@@ -189,13 +329,6 @@ func updateDeploymentSpec(
 		}
 	}
 
-	if _, updateErr := factory.Client.AppsV1().
-		Deployments(functionNamespace).
-		Update(context.TODO(), deployment, metav1.UpdateOptions{}); updateErr != nil {
-
-		return updateErr, http.StatusInternalServerError
-	}
-
 	return nil, http.StatusAccepted
 }
 
@@ -203,26 +336,64 @@ func updateService(
 	functionNamespace string,
 	factory k8s.FunctionFactory,
 	request types.FunctionDeployment,
-	annotations map[string]string) (err error, httpStatus int) {
+	annotations map[string]string) (previous *corev1.Service, err error, httpStatus int) {
 
-	getOpts := metav1.GetOptions{}
-
-	service, findServiceErr := factory.Client.CoreV1().
+	service, err := factory.Client.CoreV1().
 		Services(functionNamespace).
-		Get(context.TODO(), request.Service, getOpts)
+		Get(context.TODO(), request.Service, metav1.GetOptions{})
+	if k8s.IsNotFound(err) {
+		// the Service is missing when an earlier deploy only partially completed, create
+		// it so that the function becomes reachable again
+		if _, createErr := factory.Client.CoreV1().
+			Services(functionNamespace).
+			Create(context.TODO(), makeServiceSpec(request, factory), metav1.CreateOptions{}); createErr != nil {
+
+			status, _ := ProcessErrorReasons(createErr)
+			return nil, createErr, status
+		}
 
-	if findServiceErr != nil {
-		return findServiceErr, http.StatusNotFound
+		log.Printf("Service created: %s.%s\n", request.Service, functionNamespace)
+		return nil, nil, http.StatusAccepted
+	}
+	if err != nil {
+		status, _ := ProcessErrorReasons(err)
+		return nil, err, status
 	}
 
+	previous = service.DeepCopy()
 	service.Annotations = annotations
 
 	if _, updateErr := factory.Client.CoreV1().
 		Services(functionNamespace).
 		Update(context.TODO(), service, metav1.UpdateOptions{}); updateErr != nil {
 
-		return updateErr, http.StatusInternalServerError
+		status, _ := ProcessErrorReasons(updateErr)
+		return nil, updateErr, status
 	}
 
-	return nil, http.StatusAccepted
+	return previous, nil, http.StatusAccepted
+}
+
+// makeUpdatedServiceSpec applies the request to a copy of the existing Service without
+// persisting it
+func makeUpdatedServiceSpec(
+	functionNamespace string,
+	factory k8s.FunctionFactory,
+	request types.FunctionDeployment,
+	annotations map[string]string) (service *corev1.Service, err error, httpStatus int) {
+
+	getOpts := metav1.GetOptions{}
+
+	service, findServiceErr := factory.Client.CoreV1().
+		Services(functionNamespace).
+		Get(context.TODO(), request.Service, getOpts)
+
+	if findServiceErr != nil {
+		status, _ := ProcessErrorReasons(findServiceErr)
+		return nil, findServiceErr, status
+	}
+
+	service.Annotations = annotations
+
+	return service, nil, http.StatusAccepted
 }
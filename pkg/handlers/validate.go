@@ -5,10 +5,27 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/openfaas/faas-netes/pkg/auth"
+	"github.com/openfaas/faas-netes/pkg/cron"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/trigger"
 	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 // Regex for RFC-1123 validation:
@@ -24,3 +41,317 @@ func ValidateDeployRequest(request *types.FunctionDeployment) error {
 
 	return fmt.Errorf("(%s) must be a valid DNS entry for service name", request.Service)
 }
+
+// FieldError describes a single invalid field of a FunctionDeployment request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a FunctionDeployment request is rejected, it is
+// written to the client as a JSON list of field errors with a 400 status code
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// ValidateFunctionRequest checks a FunctionDeployment request against the rules that the
+// Kubernetes API server applies to the Deployment built from it, and checks that the
+// secrets and profiles it references exist. A *ValidationError is returned when the
+// request is invalid, any other error means that the references could not be looked up.
+func ValidateFunctionRequest(ctx context.Context, request *types.FunctionDeployment, namespace string, factory k8s.FunctionFactory) error {
+	errs := validateFunctionSpec(request, factory)
+
+	refErrs, err := validateFunctionReferences(ctx, request, namespace, factory)
+	if err != nil {
+		return err
+	}
+	errs = append(errs, refErrs...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	validationErr := &ValidationError{}
+	for _, fieldErr := range errs {
+		validationErr.Errors = append(validationErr.Errors, FieldError{
+			Field:   fieldErr.Field,
+			Message: fieldErr.ErrorBody(),
+		})
+	}
+	return validationErr
+}
+
+// validateFunctionSpec checks the fields of the request that do not depend on other
+// objects in the cluster
+func validateFunctionSpec(request *types.FunctionDeployment, factory k8s.FunctionFactory) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if err := ValidateDeployRequest(request); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("service"), request.Service, "must be a valid DNS entry for service name"))
+	}
+
+	if len(strings.TrimSpace(request.Image)) == 0 {
+		errs = append(errs, field.Required(field.NewPath("image"), ""))
+	}
+
+	envPath := field.NewPath("envVars")
+	for name := range request.EnvVars {
+		for _, msg := range validation.IsEnvVarName(name) {
+			errs = append(errs, field.Invalid(envPath.Key(name), name, msg))
+		}
+	}
+
+	constraintsPath := field.NewPath("constraints")
+	for i, constraint := range request.Constraints {
+		parts := strings.Split(constraint, "=")
+		if len(parts) != 2 {
+			errs = append(errs, field.Invalid(constraintsPath.Index(i), constraint, "must be in the form key=value"))
+			continue
+		}
+
+		for _, msg := range validation.IsQualifiedName(parts[0]) {
+			errs = append(errs, field.Invalid(constraintsPath.Index(i), constraint, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(parts[1]) {
+			errs = append(errs, field.Invalid(constraintsPath.Index(i), constraint, msg))
+		}
+	}
+
+	if request.Labels != nil {
+		errs = append(errs, metav1validation.ValidateLabels(*request.Labels, field.NewPath("labels"))...)
+	}
+
+	if request.Annotations != nil {
+		errs = append(errs, apivalidation.ValidateAnnotations(*request.Annotations, field.NewPath("annotations"))...)
+
+		if _, err := factory.MakeProbes(*request); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations"), "", err.Error()))
+		}
+
+		if weight, ok := (*request.Annotations)[k8s.CanaryWeightAnnotation]; ok {
+			weightPath := field.NewPath("annotations").Key(k8s.CanaryWeightAnnotation)
+			if !k8s.IsCanary(request.Service) {
+				errs = append(errs, field.Forbidden(weightPath, fmt.Sprintf("may only be set on a function named with the suffix %s", k8s.CanarySuffix)))
+			} else if _, err := k8s.ParseCanaryWeight(weight); err != nil {
+				errs = append(errs, field.Invalid(weightPath, weight, err.Error()))
+			}
+		}
+
+		errs = append(errs, validateDeployStrategy(*request.Annotations, field.NewPath("annotations"))...)
+
+		if err := cron.ValidateAnnotations(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(cron.ScheduleAnnotation), (*request.Annotations)[cron.ScheduleAnnotation], err.Error()))
+		}
+
+		if err := trigger.ValidateAnnotations(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(trigger.TriggerAnnotation), (*request.Annotations)[trigger.TriggerAnnotation], err.Error()))
+		}
+
+		if err := k8s.ValidateEgress(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(k8s.EgressAnnotation), (*request.Annotations)[k8s.EgressAnnotation], err.Error()))
+		}
+
+		for _, key := range []string{auth.RequiredAnnotation, auth.ScopesAnnotation} {
+			if value, ok := (*request.Annotations)[key]; ok {
+				if err := auth.ValidateAnnotations(map[string]string{key: value}); err != nil {
+					errs = append(errs, field.Invalid(field.NewPath("annotations").Key(key), value, err.Error()))
+				}
+			}
+		}
+
+		if _, err := k8s.ParseDomain(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(k8s.DomainAnnotation), (*request.Annotations)[k8s.DomainAnnotation], err.Error()))
+		}
+
+		if err := k8s.ValidateSecretsRollout(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(k8s.SecretsRolloutAnnotation), (*request.Annotations)[k8s.SecretsRolloutAnnotation], err.Error()))
+		}
+
+		if err := k8s.ValidateSecretsEnv(*request.Annotations); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("annotations").Key(k8s.SecretsEnvAnnotation), (*request.Annotations)[k8s.SecretsEnvAnnotation], err.Error()))
+		}
+	}
+
+	var labels, annotations map[string]string
+	if request.Labels != nil {
+		labels = *request.Labels
+	}
+	if request.Annotations != nil {
+		annotations = *request.Annotations
+	}
+	if err := k8s.ValidateScaling(labels, annotations); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("labels"), "", err.Error()))
+	}
+
+	errs = append(errs, validateResources(request)...)
+
+	return errs
+}
+
+// validateDeployStrategy checks the annotations that configure how updates are rolled out
+func validateDeployStrategy(annotations map[string]string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if strategy, ok := annotations[DeployStrategyAnnotation]; ok && strategy != RollingStrategy && strategy != BlueGreenStrategy {
+		errs = append(errs, field.NotSupported(path.Key(DeployStrategyAnnotation), strategy, []string{RollingStrategy, BlueGreenStrategy}))
+	}
+
+	if timeout, ok := annotations[DeployTimeoutAnnotation]; ok {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			errs = append(errs, field.Invalid(path.Key(DeployTimeoutAnnotation), timeout, "must be a positive duration such as 90s"))
+		}
+	}
+
+	if smokeTest, ok := annotations[DeploySmokeTestAnnotation]; ok && !strings.HasPrefix(smokeTest, "/") {
+		errs = append(errs, field.Invalid(path.Key(DeploySmokeTestAnnotation), smokeTest, "must be a path starting with /"))
+	}
+
+	return errs
+}
+
+// validateResources checks that the limits and requests are valid quantities and that
+// requests do not exceed limits
+func validateResources(request *types.FunctionDeployment) field.ErrorList {
+	errs := field.ErrorList{}
+
+	parse := func(path *field.Path, value string) *resource.Quantity {
+		if len(value) == 0 {
+			return nil
+		}
+
+		qty, err := resource.ParseQuantity(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(path, value, err.Error()))
+			return nil
+		}
+		return &qty
+	}
+
+	var limitMemory, limitCPU, requestMemory, requestCPU *resource.Quantity
+	if request.Limits != nil {
+		limitMemory = parse(field.NewPath("limits", "memory"), request.Limits.Memory)
+		limitCPU = parse(field.NewPath("limits", "cpu"), request.Limits.CPU)
+	}
+	if request.Requests != nil {
+		requestMemory = parse(field.NewPath("requests", "memory"), request.Requests.Memory)
+		requestCPU = parse(field.NewPath("requests", "cpu"), request.Requests.CPU)
+	}
+
+	if limitMemory != nil && requestMemory != nil && requestMemory.Cmp(*limitMemory) > 0 {
+		errs = append(errs, field.Invalid(field.NewPath("requests", "memory"), request.Requests.Memory,
+			fmt.Sprintf("must be less than or equal to the memory limit of %s", request.Limits.Memory)))
+	}
+
+	if limitCPU != nil && requestCPU != nil && requestCPU.Cmp(*limitCPU) > 0 {
+		errs = append(errs, field.Invalid(field.NewPath("requests", "cpu"), request.Requests.CPU,
+			fmt.Sprintf("must be less than or equal to the cpu limit of %s", request.Limits.CPU)))
+	}
+
+	return errs
+}
+
+// findSecret returns a NotFound error when the secret is neither in the cluster nor in
+// the secret store of factory
+func findSecret(ctx context.Context, factory k8s.FunctionFactory, namespace, name string) error {
+	_, err := factory.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if !errors.IsNotFound(err) || factory.Secrets == nil {
+		return err
+	}
+
+	// secrets of a secret store are only materialised when the function is deployed
+	names, err := factory.Secrets.List(namespace)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n == name {
+			return nil
+		}
+	}
+	return errors.NewNotFound(corev1.Resource("secrets"), name)
+}
+
+// validateFunctionReferences checks that the secrets and profiles used by the request
+// exist, an error is only returned when they could not be looked up
+func validateFunctionReferences(ctx context.Context, request *types.FunctionDeployment, namespace string, factory k8s.FunctionFactory) (field.ErrorList, error) {
+	errs := field.ErrorList{}
+
+	secretsPath := field.NewPath("secrets")
+	for i, name := range request.Secrets {
+		err := findSecret(ctx, factory, namespace, name)
+		if errors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(secretsPath.Index(i), name))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch secret %s.%s: %s", name, namespace, err.Error())
+		}
+	}
+
+	if request.Annotations == nil {
+		return errs, nil
+	}
+
+	envPath := field.NewPath("annotations").Key(k8s.SecretsEnvAnnotation)
+	for _, name := range k8s.RequiredSecrets(request.Secrets, *request.Annotations)[len(request.Secrets):] {
+		err := findSecret(ctx, factory, namespace, name)
+		if errors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(envPath, name))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch secret %s.%s: %s", name, namespace, err.Error())
+		}
+	}
+
+	profileNamespace := factory.Config.ProfilesNamespace
+	profiles := factory.NewProfileClient()
+	profilePath := field.NewPath("annotations").Key(k8s.ProfileAnnotationKey)
+	for _, name := range k8s.ParseProfileNames(*request.Annotations) {
+		_, err := profiles.Get(ctx, profileNamespace, name)
+		if errors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(profilePath, name))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch profile %s.%s: %s", name, profileNamespace, err.Error())
+		}
+	}
+
+	// an invalid domain is reported by validateFunctionSpec
+	if domain, err := k8s.ParseDomain(*request.Annotations); err == nil && domain != nil && !k8s.IsCanary(request.Service) {
+		conflict, err := k8s.FindDomainConflict(ctx, factory.Client, factory.Config.DomainNamespace, namespace, request.Service, *domain)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list ingresses: %s", err.Error())
+		}
+		if len(conflict) > 0 {
+			domainPath := field.NewPath("annotations").Key(k8s.DomainAnnotation)
+			errs = append(errs, field.Invalid(domainPath, domain.Host, fmt.Sprintf("the path %s is already served by %s", domain.Path, conflict)))
+		}
+	}
+
+	return errs, nil
+}
+
+// WriteValidationError writes a *ValidationError as JSON with a 400 status code, any
+// other error is written as text with a 500 status code
+func WriteValidationError(w http.ResponseWriter, err error) {
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := json.Marshal(validationErr)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+}
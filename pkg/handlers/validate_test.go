@@ -0,0 +1,366 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func validationFactory(objects ...runtime.Object) k8s.FunctionFactory {
+	return k8s.NewFunctionFactory(fake.NewSimpleClientset(objects...), k8s.DeploymentConfig{
+		RuntimeHTTPPort: 8080,
+		LivenessProbe:   &k8s.ProbeConfig{},
+		ReadinessProbe:  &k8s.ProbeConfig{},
+	}, nil)
+}
+
+func Test_ValidateFunctionRequest(t *testing.T) {
+	namespace := "openfaas-fn"
+	factory := validationFactory(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: namespace},
+	}, k8s.MakeIngress("figlet", namespace, k8s.Domain{Host: "api.example.com", Path: "/"}, 8080, metav1.OwnerReference{}))
+
+	cases := []struct {
+		name    string
+		request types.FunctionDeployment
+		fields  []string
+	}{
+		{
+			name: "valid request",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				EnvVars:     map[string]string{"write_debug": "true"},
+				Constraints: []string{"kubernetes.io/os=linux"},
+				Labels:      &map[string]string{"com.openfaas.scale.min": "2"},
+				Secrets:     []string{"api-key"},
+				Limits:      &types.FunctionResources{Memory: "128Mi", CPU: "500m"},
+				Requests:    &types.FunctionResources{Memory: "64Mi", CPU: "100m"},
+			},
+		},
+		{
+			name:    "invalid name and missing image",
+			request: types.FunctionDeployment{Service: "Node_Info"},
+			fields:  []string{"service", "image"},
+		},
+		{
+			name:    "named like the new version of a blue/green update",
+			request: types.FunctionDeployment{Service: "nodeinfo" + BlueGreenSuffix, Image: "functions/nodeinfo"},
+		},
+		{
+			name: "invalid env var name",
+			request: types.FunctionDeployment{
+				Service: "nodeinfo",
+				Image:   "functions/nodeinfo",
+				EnvVars: map[string]string{"1=bad": "value"},
+			},
+			fields: []string{"envVars[1=bad]"},
+		},
+		{
+			name: "malformed constraint",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Constraints: []string{"node.platform.os == linux"},
+			},
+			fields: []string{"constraints[0]"},
+		},
+		{
+			name: "invalid label key",
+			request: types.FunctionDeployment{
+				Service: "nodeinfo",
+				Image:   "functions/nodeinfo",
+				Labels:  &map[string]string{"not a key": "value"},
+			},
+			fields: []string{"labels"},
+		},
+		{
+			name: "invalid egress allow-list",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.egress": "10.0.0.0/8,example.com"},
+			},
+			fields: []string{"annotations[com.openfaas.egress]"},
+		},
+		{
+			name: "invalid auth annotations",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.auth": "yes", "com.openfaas.auth.scopes": " , "},
+			},
+			fields: []string{"annotations[com.openfaas.auth]", "annotations[com.openfaas.auth.scopes]"},
+		},
+		{
+			name: "invalid domain",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.domain": "api_example"},
+			},
+			fields: []string{"annotations[com.openfaas.domain]"},
+		},
+		{
+			name: "invalid secrets rollout",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.secrets.rollout": "never"},
+			},
+			fields: []string{"annotations[com.openfaas.secrets.rollout]"},
+		},
+		{
+			name: "domain served by another function",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.domain": "api.example.com"},
+			},
+			fields: []string{"annotations[com.openfaas.domain]"},
+		},
+		{
+			name: "domain on another path",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.domain": "api.example.com", "com.openfaas.domain.path": "/nodeinfo"},
+			},
+		},
+		{
+			name: "annotations too large",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"large": strings.Repeat("a", 256*(1<<10)+1)},
+			},
+			fields: []string{"annotations"},
+		},
+		{
+			name: "canary weight on a function that is not a canary",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{k8s.CanaryWeightAnnotation: "10"},
+			},
+			fields: []string{"annotations[com.openfaas.canary.weight]"},
+		},
+		{
+			name: "canary weight out of range",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo-canary",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{k8s.CanaryWeightAnnotation: "150"},
+			},
+			fields: []string{"annotations[com.openfaas.canary.weight]"},
+		},
+		{
+			name: "invalid cron schedule",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"topic": "cron-function", "schedule": "*/5 * * *"},
+			},
+			fields: []string{"annotations[schedule]"},
+		},
+		{
+			name: "min replicas above max replicas",
+			request: types.FunctionDeployment{
+				Service: "nodeinfo",
+				Image:   "functions/nodeinfo",
+				Labels:  &map[string]string{"com.openfaas.scale.min": "5", "com.openfaas.scale.max": "2"},
+			},
+			fields: []string{"labels"},
+		},
+		{
+			name: "invalid quantity and request above limit",
+			request: types.FunctionDeployment{
+				Service:  "nodeinfo",
+				Image:    "functions/nodeinfo",
+				Limits:   &types.FunctionResources{Memory: "128 megs", CPU: "100m"},
+				Requests: &types.FunctionResources{CPU: "1"},
+			},
+			fields: []string{"limits.memory", "requests.cpu"},
+		},
+		{
+			name: "missing secret",
+			request: types.FunctionDeployment{
+				Service: "nodeinfo",
+				Image:   "functions/nodeinfo",
+				Secrets: []string{"api-key", "db-password"},
+			},
+			fields: []string{"secrets[1]"},
+		},
+		{
+			name: "invalid secrets env",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.secrets.env": "DB_PASSWORD"},
+			},
+			fields: []string{"annotations[com.openfaas.secrets.env]"},
+		},
+		{
+			name: "missing secret of env",
+			request: types.FunctionDeployment{
+				Service:     "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Secrets:     []string{"api-key"},
+				Annotations: &map[string]string{"com.openfaas.secrets.env": "API_KEY=api-key,DB_PASSWORD=db-creds:password"},
+			},
+			fields: []string{"annotations[com.openfaas.secrets.env]"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFunctionRequest(context.TODO(), &tc.request, namespace, factory)
+			if len(tc.fields) == 0 {
+				if err != nil {
+					t.Fatalf("want no error, got: %s", err)
+				}
+				return
+			}
+
+			validationErr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("want *ValidationError, got: %v", err)
+			}
+
+			got := []string{}
+			for _, fieldErr := range validationErr.Errors {
+				got = append(got, fieldErr.Field)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tc.fields, ",") {
+				t.Errorf("want field errors for %v, got: %v", tc.fields, validationErr.Errors)
+			}
+		})
+	}
+}
+
+func Test_DeployHandler_RejectsInvalidRequest(t *testing.T) {
+	factory := validationFactory()
+	deployHandler := MakeDeployHandler("openfaas-fn", factory).ServeHTTP
+
+	payload, _ := json.Marshal(types.FunctionDeployment{
+		Service: "nodeinfo",
+		Image:   "functions/nodeinfo",
+		Limits:  &types.FunctionResources{Memory: "lots"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://system/functions", bytes.NewReader(payload))
+	w := httptest.NewRecorder()
+
+	deployHandler(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("want Content-Type application/json, got: %s", contentType)
+	}
+
+	validationErr := ValidationError{}
+	if err := json.NewDecoder(resp.Body).Decode(&validationErr); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "limits.memory" {
+		t.Errorf("want a single limits.memory field error, got: %v", validationErr.Errors)
+	}
+
+	_, err := factory.Client.AppsV1().Deployments("openfaas-fn").Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want invalid function not to be deployed")
+	}
+}
+
+func Test_DeployHandler_DryRun(t *testing.T) {
+	factory := validationFactory()
+	deployHandler := MakeDeployHandler("openfaas-fn", factory).ServeHTTP
+
+	payload, _ := json.Marshal(types.FunctionDeployment{
+		Service: "nodeinfo",
+		Image:   "functions/nodeinfo",
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://system/functions?dryRun=true", bytes.NewReader(payload))
+	w := httptest.NewRecorder()
+
+	deployHandler(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusOK, resp.StatusCode)
+	}
+
+	rendered := struct {
+		Deployment appsv1.Deployment `json:"deployment"`
+		Service    corev1.Service    `json:"service"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&rendered); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+
+	if rendered.Deployment.Namespace != "openfaas-fn" || rendered.Deployment.Kind != "Deployment" {
+		t.Errorf("want Deployment in openfaas-fn, got: %s %s", rendered.Deployment.Kind, rendered.Deployment.Namespace)
+	}
+
+	if image := rendered.Deployment.Spec.Template.Spec.Containers[0].Image; image != "functions/nodeinfo" {
+		t.Errorf("want image functions/nodeinfo, got: %s", image)
+	}
+
+	if rendered.Service.Spec.Selector["faas_function"] != "nodeinfo" {
+		t.Errorf("want Service selecting nodeinfo, got: %v", rendered.Service.Spec.Selector)
+	}
+
+	_, err := factory.Client.AppsV1().Deployments("openfaas-fn").Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want dry-run not to create a Deployment")
+	}
+}
+
+// storeSecrets is a SecretsClient of a secret store that holds names
+type storeSecrets struct {
+	k8s.SecretsClient
+	names []string
+}
+
+func (s storeSecrets) List(namespace string) ([]string, error) {
+	return s.names, nil
+}
+
+func Test_ValidateFunctionRequest_SecretStore(t *testing.T) {
+	factory := validationFactory()
+	factory.Secrets = storeSecrets{names: []string{"db-password"}}
+
+	request := types.FunctionDeployment{
+		Service: "nodeinfo",
+		Image:   "functions/nodeinfo",
+		Secrets: []string{"db-password"},
+	}
+	if err := ValidateFunctionRequest(context.TODO(), &request, "openfaas-fn", factory); err != nil {
+		t.Errorf("want secrets of the store to be found before they are materialised, got: %s", err)
+	}
+
+	request.Secrets = []string{"api-key"}
+	if _, ok := ValidateFunctionRequest(context.TODO(), &request, "openfaas-fn", factory).(*ValidationError); !ok {
+		t.Errorf("want a validation error for a secret that is not in the store")
+	}
+}
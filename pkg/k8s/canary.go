@@ -0,0 +1,78 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+const (
+	// CanarySuffix is appended to the name of a function to name its canary
+	CanarySuffix = "-canary"
+
+	// CanaryWeightAnnotation is set on a canary to the percentage of the function's
+	// traffic, from 0 to 100, that is sent to the canary
+	CanaryWeightAnnotation = "com.openfaas.canary.weight"
+
+	// CanaryHeader can be set to "always" on an invocation to route it to the canary
+	// of the function regardless of the weight
+	CanaryHeader = "X-Canary"
+)
+
+// CanaryName returns the name of the canary of a function
+func CanaryName(functionName string) string {
+	return functionName + CanarySuffix
+}
+
+// IsCanary returns true when functionName is the name of a canary
+func IsCanary(functionName string) bool {
+	return strings.HasSuffix(functionName, CanarySuffix) && len(functionName) > len(CanarySuffix)
+}
+
+// ParseCanaryWeight parses the value of the CanaryWeightAnnotation
+func ParseCanaryWeight(value string) (int, error) {
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 0 || weight > 100 {
+		return 0, fmt.Errorf("must be a whole number from 0 to 100")
+	}
+	return weight, nil
+}
+
+// canaryWeight returns the share of traffic for a canary Deployment, a canary without
+// available replicas receives no traffic
+func canaryWeight(deployment *appsv1.Deployment) int {
+	if deployment.Status.AvailableReplicas == 0 {
+		return 0
+	}
+
+	weight, err := ParseCanaryWeight(deployment.Annotations[CanaryWeightAnnotation])
+	if err != nil {
+		return 0
+	}
+	return weight
+}
+
+// SelectVersion picks either the function or its canary to serve an invocation, in
+// proportion to the weight of the canary
+func SelectVersion(namespace, functionName string, lister v1.DeploymentLister) string {
+	if lister == nil || IsCanary(functionName) {
+		return functionName
+	}
+
+	canary, err := lister.Deployments(namespace).Get(CanaryName(functionName))
+	if err != nil {
+		return functionName
+	}
+
+	if weight := canaryWeight(canary); weight > 0 && rand.Intn(100) < weight {
+		return canary.Name
+	}
+	return functionName
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func canaryLister(t *testing.T, deployments ...*appsv1.Deployment) appslisters.DeploymentLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, deployment := range deployments {
+		if err := indexer.Add(deployment); err != nil {
+			t.Fatalf("unable to add Deployment: %s", err)
+		}
+	}
+	return appslisters.NewDeploymentLister(indexer)
+}
+
+func canaryDeployment(weight string, available int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "nodeinfo-canary",
+			Namespace:   "openfaas-fn",
+			Annotations: map[string]string{CanaryWeightAnnotation: weight},
+		},
+		Status: appsv1.DeploymentStatus{AvailableReplicas: available},
+	}
+}
+
+func Test_SelectVersion(t *testing.T) {
+	cases := []struct {
+		name         string
+		functionName string
+		deployments  []*appsv1.Deployment
+		want         string
+	}{
+		{
+			name:         "no canary",
+			functionName: "nodeinfo",
+			want:         "nodeinfo",
+		},
+		{
+			name:         "all traffic to canary",
+			functionName: "nodeinfo",
+			deployments:  []*appsv1.Deployment{canaryDeployment("100", 1)},
+			want:         "nodeinfo-canary",
+		},
+		{
+			name:         "no traffic to canary",
+			functionName: "nodeinfo",
+			deployments:  []*appsv1.Deployment{canaryDeployment("0", 1)},
+			want:         "nodeinfo",
+		},
+		{
+			name:         "canary without available replicas",
+			functionName: "nodeinfo",
+			deployments:  []*appsv1.Deployment{canaryDeployment("100", 0)},
+			want:         "nodeinfo",
+		},
+		{
+			name:         "invalid weight",
+			functionName: "nodeinfo",
+			deployments:  []*appsv1.Deployment{canaryDeployment("all", 1)},
+			want:         "nodeinfo",
+		},
+		{
+			name:         "canary invoked directly",
+			functionName: "nodeinfo-canary",
+			deployments:  []*appsv1.Deployment{canaryDeployment("0", 1)},
+			want:         "nodeinfo-canary",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lister := canaryLister(t, tc.deployments...)
+
+			for i := 0; i < 10; i++ {
+				if got := SelectVersion("openfaas-fn", tc.functionName, lister); got != tc.want {
+					t.Fatalf("want %s, got: %s", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_SelectVersion_SplitsTraffic(t *testing.T) {
+	lister := canaryLister(t, canaryDeployment("20", 1))
+
+	canary := 0
+	for i := 0; i < 10000; i++ {
+		if SelectVersion("openfaas-fn", "nodeinfo", lister) == "nodeinfo-canary" {
+			canary++
+		}
+	}
+
+	if canary < 1500 || canary > 2500 {
+		t.Errorf("want about 20%% of invocations on the canary, got: %d of 10000", canary)
+	}
+}
+
+func Test_ParseCanaryWeight(t *testing.T) {
+	for _, value := range []string{"0", "10", "100"} {
+		if _, err := ParseCanaryWeight(value); err != nil {
+			t.Errorf("want %q to be valid, got: %s", value, err)
+		}
+	}
+
+	for _, value := range []string{"", "-1", "101", "10%", "0.5"} {
+		if _, err := ParseCanaryWeight(value); err == nil {
+			t.Errorf("want %q to be invalid", value)
+		}
+	}
+}
@@ -22,4 +22,9 @@ type DeploymentConfig struct {
 	SetNonRootUser bool
 	// ProfilesNamespace defines which namespace is used to look up available Profiles.
 	ProfilesNamespace string
+	// NetworkPolicy configures the NetworkPolicies that isolate functions.
+	NetworkPolicy NetworkPolicyConfig
+	// DomainNamespace is the namespace that is searched for Ingresses that already serve
+	// the domain of a function, every namespace when it is empty.
+	DomainNamespace string
 }
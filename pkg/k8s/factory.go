@@ -19,6 +19,10 @@ type FunctionFactory struct {
 	Client   kubernetes.Interface
 	Config   DeploymentConfig
 	Profiler NamespacedProfiler
+
+	// Secrets reads the secrets of functions, Kubernetes Secrets are read directly
+	// when it is nil
+	Secrets SecretsClient
 }
 
 func NewFunctionFactory(clientset kubernetes.Interface, config DeploymentConfig, profiler NamespacedProfiler) FunctionFactory {
@@ -28,3 +32,11 @@ func NewFunctionFactory(clientset kubernetes.Interface, config DeploymentConfig,
 		Profiler: profiler,
 	}
 }
+
+// SecretsClient returns the client that reads the secrets of functions
+func (f FunctionFactory) SecretsClient() SecretsClient {
+	if f.Secrets != nil {
+		return f.Secrets
+	}
+	return NewSecretsClient(f.Client)
+}
@@ -42,3 +42,14 @@ func AsFunctionStatus(item appsv1.Deployment) *types.FunctionStatus {
 
 	return &function
 }
+
+// IsFunctionDeployment returns true when the Deployment runs a function. The operator
+// only sets the faas_function label on the pod template of a function, the controller
+// also sets it on the Deployment.
+func IsFunctionDeployment(deployment *appsv1.Deployment) bool {
+	if _, ok := deployment.Spec.Template.Labels["faas_function"]; ok {
+		return true
+	}
+	_, ok := deployment.Labels["faas_function"]
+	return ok
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	types "github.com/openfaas/faas-provider/types"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DomainAnnotation is the host name that the function is served on through an
+	// Ingress, for example api.example.com
+	DomainAnnotation = "com.openfaas.domain"
+
+	// DomainPathAnnotation is the path prefix that the function is served on, it
+	// defaults to /
+	DomainPathAnnotation = "com.openfaas.domain.path"
+
+	// DomainTLSSecretAnnotation is the Secret with the TLS certificate of the domain,
+	// the Ingress only serves plain HTTP when it is not set
+	DomainTLSSecretAnnotation = "com.openfaas.domain.tls-secret"
+
+	// DomainIngressClassAnnotation is the IngressClass of the Ingress, the cluster's
+	// default class is used when it is not set
+	DomainIngressClassAnnotation = "com.openfaas.domain.ingress-class"
+
+	// functionIngressLabel marks the Ingresses that faas-netes manages
+	functionIngressLabel = "openfaas.com/function-ingress"
+)
+
+// Domain is the host and path that a function is served on
+type Domain struct {
+	Host         string
+	Path         string
+	TLSSecret    string
+	IngressClass string
+}
+
+// ParseDomain reads the domain annotations of a function, it returns nil when
+// DomainAnnotation is not set
+func ParseDomain(annotations map[string]string) (*Domain, error) {
+	host, ok := annotations[DomainAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	domain := &Domain{
+		Host:         strings.ToLower(host),
+		Path:         "/",
+		TLSSecret:    annotations[DomainTLSSecretAnnotation],
+		IngressClass: annotations[DomainIngressClassAnnotation],
+	}
+
+	if msgs := validateHost(domain.Host); len(msgs) > 0 {
+		return nil, fmt.Errorf("%s: %s", DomainAnnotation, strings.Join(msgs, ", "))
+	}
+
+	if path, ok := annotations[DomainPathAnnotation]; ok {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%s: must be a path starting with /", DomainPathAnnotation)
+		}
+		domain.Path = path
+	}
+
+	if len(domain.TLSSecret) > 0 {
+		if msgs := validation.IsDNS1123Subdomain(domain.TLSSecret); len(msgs) > 0 {
+			return nil, fmt.Errorf("%s: %s", DomainTLSSecretAnnotation, strings.Join(msgs, ", "))
+		}
+	}
+
+	if len(domain.IngressClass) > 0 {
+		if msgs := validation.IsDNS1123Subdomain(domain.IngressClass); len(msgs) > 0 {
+			return nil, fmt.Errorf("%s: %s", DomainIngressClassAnnotation, strings.Join(msgs, ", "))
+		}
+	}
+
+	return domain, nil
+}
+
+// validateHost accepts the host names that an Ingress rule accepts, including a single
+// leading wildcard label
+func validateHost(host string) []string {
+	if strings.HasPrefix(host, "*.") {
+		return validation.IsWildcardDNS1123Subdomain(host)
+	}
+	if msgs := validation.IsDNS1123Subdomain(host); len(msgs) > 0 {
+		return msgs
+	}
+	if !strings.Contains(host, ".") {
+		return []string{"must be a fully qualified domain name"}
+	}
+	return nil
+}
+
+// MakeIngress returns the Ingress that routes the domain to the function's Service
+func MakeIngress(functionName, namespace string, domain Domain, port int32, owner metav1.OwnerReference) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"faas_function":      functionName,
+				functionIngressLabel: "true",
+			},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: domain.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     domain.Path,
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: functionName,
+									Port: networkingv1.ServiceBackendPort{Number: port},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+
+	if len(domain.IngressClass) > 0 {
+		ingressClass := domain.IngressClass
+		ingress.Spec.IngressClassName = &ingressClass
+	}
+
+	if len(domain.TLSSecret) > 0 {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      []string{domain.Host},
+			SecretName: domain.TLSSecret,
+		}}
+	}
+
+	return ingress
+}
+
+// FindDomainConflict returns the Ingress in domainNamespace that is already serving the
+// host and path of domain, or an empty string when there is none. Ingresses that were not
+// created by faas-netes are included, the function's own Ingress is not.
+func FindDomainConflict(ctx context.Context, client kubernetes.Interface, domainNamespace, namespace, functionName string, domain Domain) (string, error) {
+	ingresses, err := client.NetworkingV1().Ingresses(domainNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	for _, ingress := range ingresses.Items {
+		if ingress.Name == functionName && ingress.Namespace == namespace {
+			continue
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != domain.Host || rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Path == domain.Path {
+					return describeIngress(ingress), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// describeIngress names the function of an Ingress that faas-netes manages, or the
+// Ingress itself
+func describeIngress(ingress networkingv1.Ingress) string {
+	if ingress.Labels[functionIngressLabel] == "true" {
+		return fmt.Sprintf("function %s.%s", ingress.Name, ingress.Namespace)
+	}
+	return fmt.Sprintf("Ingress %s.%s", ingress.Name, ingress.Namespace)
+}
+
+// ApplyIngress creates, updates or deletes the Ingress of a function so that it matches
+// the domain annotations of request. The Ingress is owned by owner and is not created
+// when another function is already served on the same host and path. Canaries share
+// the Ingress of their function and never get one of their own. Other Ingresses are
+// looked up in domainNamespace.
+func ApplyIngress(ctx context.Context, client kubernetes.Interface, domainNamespace, namespace string, request types.FunctionDeployment, port int32, owner metav1.OwnerReference) error {
+	var domain *Domain
+	if request.Annotations != nil && !IsCanary(request.Service) {
+		var err error
+		if domain, err = ParseDomain(*request.Annotations); err != nil {
+			return err
+		}
+	}
+
+	if domain != nil {
+		conflict, err := FindDomainConflict(ctx, client, domainNamespace, namespace, request.Service, *domain)
+		if err != nil {
+			return fmt.Errorf("unable to list Ingresses: %s", err.Error())
+		}
+		if len(conflict) > 0 {
+			return fmt.Errorf("%s%s is already served by %s", domain.Host, domain.Path, conflict)
+		}
+	}
+
+	if err := applyIngress(ctx, client, namespace, request.Service, domain, port, owner); err != nil {
+		return fmt.Errorf("unable to apply Ingress: %s", err.Error())
+	}
+	return nil
+}
+
+// DeleteIngress removes the Ingress of a function when it is owned by owner
+func DeleteIngress(ctx context.Context, client kubernetes.Interface, namespace, functionName string, owner metav1.OwnerReference) error {
+	if err := applyIngress(ctx, client, namespace, functionName, nil, 0, owner); err != nil {
+		return fmt.Errorf("unable to delete Ingress: %s", err.Error())
+	}
+	return nil
+}
+
+func applyIngress(ctx context.Context, client kubernetes.Interface, namespace, functionName string, domain *Domain, port int32, owner metav1.OwnerReference) error {
+	ingresses := client.NetworkingV1().Ingresses(namespace)
+
+	existing, err := ingresses.Get(ctx, functionName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if domain == nil {
+		if !found || !ownedBy(existing.ObjectMeta, owner) {
+			return nil
+		}
+		if err := ingresses.Delete(ctx, functionName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	ingress := MakeIngress(functionName, namespace, *domain, port, owner)
+	if !found {
+		_, err := ingresses.Create(ctx, ingress, metav1.CreateOptions{})
+		return err
+	}
+
+	if !ownedBy(existing.ObjectMeta, owner) {
+		return fmt.Errorf("%s already exists and is not managed by OpenFaaS", functionName)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, ingress.Spec) {
+		return nil
+	}
+
+	existing.Spec = ingress.Spec
+	_, err = ingresses.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_ParseDomain(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        *Domain
+		err         bool
+	}{
+		{name: "unset"},
+		{
+			name:        "host only",
+			annotations: map[string]string{DomainAnnotation: "API.example.com"},
+			want:        &Domain{Host: "api.example.com", Path: "/"},
+		},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				DomainAnnotation:             "*.example.com",
+				DomainPathAnnotation:         "/v1",
+				DomainTLSSecretAnnotation:    "example-com-tls",
+				DomainIngressClassAnnotation: "nginx",
+			},
+			want: &Domain{Host: "*.example.com", Path: "/v1", TLSSecret: "example-com-tls", IngressClass: "nginx"},
+		},
+		{name: "not fully qualified", annotations: map[string]string{DomainAnnotation: "localhost"}, err: true},
+		{name: "invalid host", annotations: map[string]string{DomainAnnotation: "api_example.com"}, err: true},
+		{name: "relative path", annotations: map[string]string{DomainAnnotation: "api.example.com", DomainPathAnnotation: "v1"}, err: true},
+		{name: "invalid secret", annotations: map[string]string{DomainAnnotation: "api.example.com", DomainTLSSecretAnnotation: "Example TLS"}, err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseDomain(tc.annotations)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("want error, got: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_MakeIngress(t *testing.T) {
+	ingress := MakeIngress("nodeinfo", "openfaas-fn", Domain{Host: "api.example.com", Path: "/", TLSSecret: "tls", IngressClass: "nginx"}, 8080, scalingOwner)
+
+	backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	if backend.Name != "nodeinfo" || backend.Port.Number != 8080 {
+		t.Errorf("want the function's Service on port 8080, got: %+v", backend)
+	}
+	if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != "tls" {
+		t.Errorf("want TLS with the secret tls, got: %+v", ingress.Spec.TLS)
+	}
+	if ingress.Spec.IngressClassName == nil || *ingress.Spec.IngressClassName != "nginx" {
+		t.Errorf("want the IngressClass nginx, got: %v", ingress.Spec.IngressClassName)
+	}
+}
+
+func Test_ApplyIngress(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.TODO()
+	ingresses := client.NetworkingV1().Ingresses("openfaas-fn")
+
+	annotations := map[string]string{DomainAnnotation: "api.example.com"}
+	if err := ApplyIngress(ctx, client, "", "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo", Annotations: &annotations}, 8080, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ingresses.Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want Ingress, got: %s", err)
+	}
+
+	other := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "figlet", UID: "figlet", Controller: boolp(true)}
+	if err := ApplyIngress(ctx, client, "", "openfaas-fn", types.FunctionDeployment{Service: "figlet", Annotations: &annotations}, 8080, other); err == nil {
+		t.Errorf("want error for a domain that is already served")
+	}
+
+	if err := ApplyIngress(ctx, client, "", "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo-canary", Annotations: &annotations}, 8080, other); err != nil {
+		t.Errorf("want canaries to be skipped, got: %s", err)
+	}
+
+	if err := ApplyIngress(ctx, client, "", "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo"}, 8080, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ingresses.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want Ingress to be deleted, got: %v", err)
+	}
+}
+
+func Test_FindDomainConflict(t *testing.T) {
+	domain := Domain{Host: "api.example.com", Path: "/"}
+	owned := MakeIngress("nodeinfo", "team-a", domain, 8080, scalingOwner)
+	unmanaged := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "www.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{Path: "/"}},
+			}},
+		}}},
+	}
+
+	cases := []struct {
+		name            string
+		domainNamespace string
+		namespace       string
+		functionName    string
+		domain          Domain
+		want            string
+	}{
+		{name: "function in another namespace", namespace: "team-b", functionName: "nodeinfo", domain: domain, want: "function nodeinfo.team-a"},
+		{name: "own Ingress", namespace: "team-a", functionName: "nodeinfo", domain: domain},
+		{name: "other namespaces are not managed", domainNamespace: "team-b", namespace: "team-b", functionName: "nodeinfo", domain: domain},
+		{name: "other path", namespace: "team-b", functionName: "figlet", domain: Domain{Host: "api.example.com", Path: "/v1"}},
+		{name: "Ingress not created by OpenFaaS", namespace: "team-b", functionName: "figlet", domain: Domain{Host: "www.example.com", Path: "/"}, want: "Ingress web.default"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(owned, unmanaged)
+
+			got, err := FindDomainConflict(context.TODO(), client, tc.domainNamespace, tc.namespace, tc.functionName, tc.domain)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want conflict %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/openfaas/faas-provider/logs"
 	"k8s.io/client-go/kubernetes"
@@ -16,47 +17,134 @@ import (
 type LogRequestor struct {
 	client            kubernetes.Interface
 	functionNamespace string
+	store             *LogStore
 }
 
-// NewLogRequestor returns a new logs.Requestor that uses kail to select and follow pod logs
-func NewLogRequestor(client kubernetes.Interface, functionNamespace string) *LogRequestor {
+// NewLogRequestor returns a new logs.Requestor that uses kail to select and follow pod logs.
+// The history of functions is read from store when it is not nil.
+func NewLogRequestor(client kubernetes.Interface, functionNamespace string, store *LogStore) *LogRequestor {
 	return &LogRequestor{
 		client:            client,
 		functionNamespace: functionNamespace,
+		store:             store,
 	}
 }
 
+// Message is a log message with the container that wrote it and, for structured logs,
+// its fields
+type Message struct {
+	logs.Message
+
+	Container string                 `json:"container,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
 // Query implements the actual Swarm logs request logic for the Requestor interface
 // This implementation ignores the r.Limit value because the OF-Provider already handles server side
 // line limits.
 func (l LogRequestor) Query(ctx context.Context, r logs.Request) (<-chan logs.Message, error) {
+	messages, err := l.QueryWithOptions(ctx, r, LogOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	msgStream := make(chan logs.Message, LogBufferSize)
+	go func() {
+		defer close(msgStream)
+		for msg := range messages {
+			msgStream <- msg.Message
+		}
+	}()
+
+	return msgStream, nil
+}
+
+// QueryWithOptions returns the logs of the request, with the containers and filters of
+// opts. The instance of the request is used when opts does not set one.
+//
+// When there is a LogStore, the messages that it holds are returned first, so that the
+// logs of Pods that are gone can be read. A request that follows the logs then switches
+// to the live logs of the running Pods, from the last message of the history.
+func (l LogRequestor) QueryWithOptions(ctx context.Context, r logs.Request, opts LogOptions) (<-chan Message, error) {
 	ns := l.functionNamespace
 
 	if len(r.Namespace) > 0 && strings.ToLower(r.Namespace) != "kube-system" {
 		ns = r.Namespace
 	}
 
-	logStream, err := GetLogs(ctx, l.client, r.Name, ns, int64(r.Tail), r.Since, r.Follow)
-	if err != nil {
-		log.Printf("LogRequestor: get logs failed: %s\n", err)
-		return nil, err
+	if len(opts.Instance) == 0 {
+		opts.Instance = r.Instance
 	}
 
-	msgStream := make(chan logs.Message, LogBufferSize)
+	var history []Log
+	if l.store != nil {
+		history = l.store.Query(ns, r.Name, r.Since, r.Tail, opts)
+	}
+
+	if len(history) == 0 {
+		logStream, err := GetLogs(ctx, l.client, r.Name, ns, int64(r.Tail), r.Since, r.Follow, opts)
+		if err != nil {
+			log.Printf("LogRequestor: get logs failed: %s\n", err)
+			return nil, err
+		}
+		return toMessages(ctx, nil, logStream, time.Time{}), nil
+	}
+
+	var logStream <-chan Log
+	last := history[len(history)-1].Timestamp
+	if r.Follow {
+		live, err := GetLogs(ctx, l.client, r.Name, ns, 0, &last, true, opts)
+		if err != nil && err != errNoInstances {
+			log.Printf("LogRequestor: get logs failed: %s\n", err)
+			return nil, err
+		}
+		logStream = live
+	}
+
+	return toMessages(ctx, history, logStream, last), nil
+}
+
+// toMessages sends the history and then the messages of logStream that are newer than
+// after, until logStream is closed or ctx is done
+func toMessages(ctx context.Context, history []Log, logStream <-chan Log, after time.Time) <-chan Message {
+	msgStream := make(chan Message, LogBufferSize)
 	go func() {
 		defer close(msgStream)
+
+		for _, msg := range history {
+			select {
+			case <-ctx.Done():
+				return
+			case msgStream <- toMessage(msg):
+			}
+		}
+
+		if logStream == nil {
+			return
+		}
+
 		// here we depend on the fact that logStream will close when the context is cancelled,
 		// this ensures that the go routine will resolve
 		for msg := range logStream {
-			msgStream <- logs.Message{
-				Timestamp: msg.Timestamp,
-				Text:      msg.Text,
-				Name:      msg.FunctionName,
-				Instance:  msg.PodName,
-				Namespace: msg.Namespace,
+			if msg.Timestamp.After(after) {
+				msgStream <- toMessage(msg)
 			}
 		}
 	}()
 
-	return msgStream, nil
+	return msgStream
+}
+
+func toMessage(msg Log) Message {
+	return Message{
+		Message: logs.Message{
+			Timestamp: msg.Timestamp,
+			Text:      msg.Text,
+			Name:      msg.FunctionName,
+			Instance:  msg.PodName,
+			Namespace: msg.Namespace,
+		},
+		Container: msg.Container,
+		Fields:    msg.Fields,
+	}
 }
@@ -0,0 +1,45 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// logStorePruneInterval is the period between the removals of expired messages
+const logStorePruneInterval = time.Minute
+
+// StartLogCollector tails the logs of every container of the function Pods in namespace,
+// which may be all namespaces, into store until stopCh is closed. The logs of each
+// container are read from the start of its Pod, and again from the last line when it
+// restarts.
+func StartLogCollector(client kubernetes.Interface, namespace string, store *LogStore, stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	messages := make(chan Log, LogBufferSize)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-messages:
+				store.Add(entry)
+			}
+		}
+	}()
+
+	streamer := newLogStreamer(client, 0, nil, true, LogOptions{Containers: []string{AllContainers}}, messages)
+	streamer.fromStart = true
+	go streamer.run(ctx, startPodInformer(ctx, client, namespace, "faas_function", LogBufferSize))
+
+	go wait.Until(store.Prune, logStorePruneInterval, stopCh)
+}
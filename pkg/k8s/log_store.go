@@ -0,0 +1,142 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LogStore keeps the recent log messages of functions in memory, so that they can be read
+// after the Pods that wrote them are gone. The messages of each function are bounded by
+// size and by age, the oldest are dropped first.
+type LogStore struct {
+	maxBytes  int
+	retention time.Duration
+	now       func() time.Time
+
+	lock      sync.Mutex
+	functions map[string]*functionLogs
+}
+
+// functionLogs are the messages of a function in the order they were added, with the
+// timestamp of the last message of each container, so that a stream that is resumed
+// does not add the same messages twice
+type functionLogs struct {
+	entries []Log
+	size    int
+	last    map[string]time.Time
+}
+
+// NewLogStore returns a store that keeps up to maxBytes of messages of each function
+// for the retention period
+func NewLogStore(maxBytes int, retention time.Duration) *LogStore {
+	return &LogStore{
+		maxBytes:  maxBytes,
+		retention: retention,
+		now:       time.Now,
+		functions: map[string]*functionLogs{},
+	}
+}
+
+// Add keeps a message, it is ignored when it is not newer than the last message of its
+// container
+func (s *LogStore) Add(entry Log) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := entry.Namespace + "/" + entry.FunctionName
+	logs, ok := s.functions[key]
+	if !ok {
+		logs = &functionLogs{last: map[string]time.Time{}}
+		s.functions[key] = logs
+	}
+
+	container := entry.PodName + "/" + entry.Container
+	if last, ok := logs.last[container]; ok && !entry.Timestamp.After(last) {
+		return
+	}
+	logs.last[container] = entry.Timestamp
+
+	logs.entries = append(logs.entries, entry)
+	logs.size += len(entry.Text)
+	for logs.size > s.maxBytes && len(logs.entries) > 0 {
+		logs.size -= len(logs.entries[0].Text)
+		logs.entries = logs.entries[1:]
+	}
+}
+
+// Query returns the messages of a function that were written after since, if it is set,
+// and that match the containers, instance and filters of opts, oldest first. Only the
+// last tail messages are returned when tail is greater than zero.
+func (s *LogStore) Query(namespace, functionName string, since *time.Time, tail int, opts LogOptions) []Log {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	logs, ok := s.functions[namespace+"/"+functionName]
+	if !ok {
+		return nil
+	}
+
+	expired := s.now().Add(-s.retention)
+	matched := []Log{}
+	for _, entry := range logs.entries {
+		if !entry.Timestamp.After(expired) || (since != nil && entry.Timestamp.Before(*since)) {
+			continue
+		}
+		if len(opts.Instance) > 0 && entry.PodName != opts.Instance {
+			continue
+		}
+		if !opts.selects(entry.Container, functionName) || !opts.Match(entry.Text) {
+			continue
+		}
+
+		if opts.Structured {
+			entry.Fields = parseStructuredLog(entry.Text)
+		}
+		matched = append(matched, entry)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.Before(matched[j].Timestamp)
+	})
+
+	if tail > 0 && len(matched) > tail {
+		matched = matched[len(matched)-tail:]
+	}
+	return matched
+}
+
+// Prune drops the messages that are older than the retention period, and forgets the
+// functions that have none left
+func (s *LogStore) Prune() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	expired := s.now().Add(-s.retention)
+	for key, logs := range s.functions {
+		entries := []Log{}
+		size := 0
+		for _, entry := range logs.entries {
+			if entry.Timestamp.After(expired) {
+				entries = append(entries, entry)
+				size += len(entry.Text)
+			}
+		}
+
+		for container, last := range logs.last {
+			if !last.After(expired) {
+				delete(logs.last, container)
+			}
+		}
+
+		if len(entries) == 0 && len(logs.last) == 0 {
+			delete(s.functions, key)
+			continue
+		}
+		logs.entries = entries
+		logs.size = size
+	}
+}
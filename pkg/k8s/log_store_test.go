@@ -0,0 +1,148 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/logs"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLogStore(maxBytes int, now time.Time) *LogStore {
+	store := NewLogStore(maxBytes, time.Hour)
+	store.now = func() time.Time { return now }
+	return store
+}
+
+func testLog(pod, container, text string, ts time.Time) Log {
+	return Log{Namespace: "openfaas-fn", FunctionName: "figlet", PodName: pod, Container: container, Text: text, Timestamp: ts}
+}
+
+func texts(entries []Log) []string {
+	out := []string{}
+	for _, entry := range entries {
+		out = append(out, entry.Text)
+	}
+	return out
+}
+
+func Test_LogStore_Add(t *testing.T) {
+	now := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+
+	t.Run("drops the oldest messages over the size limit", func(t *testing.T) {
+		store := newTestLogStore(10, now)
+		store.Add(testLog("figlet-1", "figlet", "aaaa", now.Add(-3*time.Second)))
+		store.Add(testLog("figlet-1", "figlet", "bbbb", now.Add(-2*time.Second)))
+		store.Add(testLog("figlet-1", "figlet", "cccc", now.Add(-time.Second)))
+
+		got := texts(store.Query("openfaas-fn", "figlet", nil, 0, LogOptions{}))
+		if len(got) != 2 || got[0] != "bbbb" || got[1] != "cccc" {
+			t.Errorf("want the last two messages, got %v", got)
+		}
+	})
+
+	t.Run("ignores messages that are not newer than the last of the container", func(t *testing.T) {
+		store := newTestLogStore(1024, now)
+		store.Add(testLog("figlet-1", "figlet", "first", now.Add(-2*time.Second)))
+		store.Add(testLog("figlet-1", "figlet", "second", now.Add(-time.Second)))
+		store.Add(testLog("figlet-1", "figlet", "second", now.Add(-time.Second)))
+		store.Add(testLog("figlet-2", "figlet", "other pod", now.Add(-2*time.Second)))
+
+		got := texts(store.Query("openfaas-fn", "figlet", nil, 0, LogOptions{}))
+		if len(got) != 3 {
+			t.Errorf("want 3 messages, got %v", got)
+		}
+	})
+}
+
+func Test_LogStore_Query(t *testing.T) {
+	now := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+	store := newTestLogStore(1024, now)
+	store.Add(testLog("figlet-1", "figlet", "expired", now.Add(-2*time.Hour)))
+	store.Add(testLog("figlet-1", "figlet", `{"level":"info"}`, now.Add(-3*time.Minute)))
+	store.Add(testLog("figlet-2", "figlet", "error from figlet-2", now.Add(-4*time.Minute)))
+	store.Add(testLog("figlet-1", "proxy", "error from proxy", now.Add(-2*time.Minute)))
+	store.Add(testLog("figlet-1", "figlet", "error from figlet-1", now.Add(-time.Minute)))
+
+	since := now.Add(-150 * time.Second)
+	cases := []struct {
+		name  string
+		since *time.Time
+		tail  int
+		opts  LogOptions
+		want  []string
+	}{
+		{name: "function container, oldest first", want: []string{"error from figlet-2", `{"level":"info"}`, "error from figlet-1"}},
+		{name: "tail", tail: 1, want: []string{"error from figlet-1"}},
+		{name: "since", since: &since, opts: LogOptions{Containers: []string{AllContainers}}, want: []string{"error from proxy", "error from figlet-1"}},
+		{name: "instance", opts: LogOptions{Instance: "figlet-2"}, want: []string{"error from figlet-2"}},
+		{name: "sidecar", opts: LogOptions{Containers: []string{"proxy"}}, want: []string{"error from proxy"}},
+		{name: "filter", opts: LogOptions{Containers: []string{AllContainers}, Contains: "error"}, want: []string{"error from figlet-2", "error from proxy", "error from figlet-1"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := texts(store.Query("openfaas-fn", "figlet", tc.since, tc.tail, tc.opts))
+			if len(got) != len(tc.want) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("want %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("structured", func(t *testing.T) {
+		got := store.Query("openfaas-fn", "figlet", nil, 0, LogOptions{Instance: "figlet-1", Contains: "level", Structured: true})
+		if len(got) != 1 || got[0].Fields["level"] != "info" {
+			t.Errorf("want the fields of the message, got %+v", got)
+		}
+	})
+}
+
+func Test_LogStore_Prune(t *testing.T) {
+	now := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+	store := newTestLogStore(1024, now)
+	store.Add(testLog("figlet-1", "figlet", "old", now.Add(-2*time.Hour)))
+	store.Add(Log{Namespace: "openfaas-fn", FunctionName: "env", PodName: "env-1", Container: "env", Text: "recent", Timestamp: now.Add(-time.Minute)})
+
+	store.Prune()
+
+	if _, ok := store.functions["openfaas-fn/figlet"]; ok {
+		t.Errorf("want a function without messages to be forgotten")
+	}
+	if got := texts(store.Query("openfaas-fn", "env", nil, 0, LogOptions{})); len(got) != 1 {
+		t.Errorf("want the recent message to be kept, got %v", got)
+	}
+}
+
+func Test_LogRequestor_History(t *testing.T) {
+	now := time.Now().UTC()
+	store := NewLogStore(1024, time.Hour)
+	store.Add(testLog("figlet-1", "figlet", "from a deleted pod", now.Add(-time.Minute)))
+
+	requestor := NewLogRequestor(fake.NewSimpleClientset(), "openfaas-fn", store)
+
+	messages, err := requestor.Query(context.Background(), logs.Request{Name: "figlet"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := []logs.Message{}
+	for msg := range messages {
+		got = append(got, msg)
+	}
+	if len(got) != 1 || got[0].Text != "from a deleted pod" || got[0].Instance != "figlet-1" {
+		t.Errorf("want the message from the store, got %+v", got)
+	}
+
+	if _, err := requestor.Query(context.Background(), logs.Request{Name: "env"}); err != errNoInstances {
+		t.Errorf("want %s without history or Pods, got %v", errNoInstances, err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// logStreamRetry is the delay before the logs of a container that is still running are
+// read again, after its stream ended
+const logStreamRetry = 5 * time.Second
+
+// containerRun identifies a run of a container, a new run starts when the container is
+// started, restarted or stops
+type containerRun struct {
+	id       string
+	restarts int32
+	running  bool
+}
+
+// containerRuns returns the current run of each container of pod that has a status
+func containerRuns(pod *corev1.Pod) map[string]containerRun {
+	runs := map[string]containerRun{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		runs[status.Name] = containerRun{
+			id:       status.ContainerID,
+			restarts: status.RestartCount,
+			running:  status.State.Running != nil,
+		}
+	}
+	return runs
+}
+
+// containerStream is the state of the logs of a container of a Pod
+type containerStream struct {
+	run    containerRun
+	active bool
+	retry  bool
+	last   time.Time
+}
+
+// streamResult is sent when the stream of a container ends
+type streamResult struct {
+	uid       types.UID
+	container string
+	last      time.Time
+	err       error
+}
+
+// logStreamer reads the logs of the containers of Pods. A container is read again from its
+// last line when it starts a new run, so that the logs of a container that restarts are
+// followed without duplicate lines. When it does not follow the logs, it stops once the
+// streams of the Pods it was given have ended.
+type logStreamer struct {
+	client     kubernetes.Interface
+	tail       int64
+	since      *time.Time
+	follow     bool
+	opts       LogOptions
+	dst        chan<- Log
+	retryDelay time.Duration
+
+	// fromStart reads the first stream of each container from the start of its Pod,
+	// rather than with tail and since
+	fromStart bool
+
+	pods     map[types.UID]*corev1.Pod
+	streams  map[string]*containerStream
+	active   int
+	finished chan streamResult
+	retry    chan streamResult
+	wg       sync.WaitGroup
+}
+
+func newLogStreamer(client kubernetes.Interface, tail int64, since *time.Time, follow bool, opts LogOptions, dst chan<- Log) *logStreamer {
+	return &logStreamer{
+		client:     client,
+		tail:       tail,
+		since:      since,
+		follow:     follow,
+		opts:       opts,
+		dst:        dst,
+		retryDelay: logStreamRetry,
+		pods:       map[types.UID]*corev1.Pod{},
+		streams:    map[string]*containerStream{},
+		finished:   make(chan streamResult),
+		retry:      make(chan streamResult),
+	}
+}
+
+// run handles the Pod events and the streams that end until ctx is done, or until no
+// stream is active when it does not follow the logs. It returns once all of the streams
+// have stopped, so that dst can be closed.
+func (s *logStreamer) run(ctx context.Context, events <-chan podEvent) {
+	defer s.wg.Wait()
+
+	for s.follow || s.active > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			s.update(ctx, event)
+		case result := <-s.finished:
+			s.finish(ctx, result)
+		case result := <-s.retry:
+			stream, ok := s.streams[streamKey(result.uid, result.container)]
+			if pod, known := s.pods[result.uid]; ok && known && !stream.active {
+				stream.retry = true
+				s.start(ctx, pod, result.container)
+			}
+		}
+	}
+}
+
+// update starts the streams of the containers of a Pod that was added or that changed
+func (s *logStreamer) update(ctx context.Context, event podEvent) {
+	pod := event.pod
+	if event.deleted {
+		delete(s.pods, pod.UID)
+		return
+	}
+	if len(s.opts.Instance) > 0 && pod.Name != s.opts.Instance {
+		return
+	}
+
+	s.pods[pod.UID] = pod
+	for _, container := range s.opts.containers(pod, pod.Labels["faas_function"]) {
+		s.start(ctx, pod, container)
+	}
+}
+
+// finish records the last line of a stream that ended, and reads the container again when
+// it has started a new run, or later when it is still running
+func (s *logStreamer) finish(ctx context.Context, result streamResult) {
+	s.active--
+
+	key := streamKey(result.uid, result.container)
+	stream := s.streams[key]
+	stream.active = false
+	if result.last.After(stream.last) {
+		stream.last = result.last
+	}
+
+	pod, ok := s.pods[result.uid]
+	if !ok {
+		delete(s.streams, key)
+		return
+	}
+	if result.err != nil && ctx.Err() == nil {
+		log.Printf("Logger: log stream for %s/%s failed: %s\n", pod.Name, result.container, result.err)
+	}
+
+	if !s.follow || s.opts.Previous {
+		return
+	}
+
+	s.start(ctx, pod, result.container)
+	if !stream.active && containerRuns(pod)[result.container].running {
+		time.AfterFunc(s.retryDelay, func() {
+			select {
+			case s.retry <- result:
+			case <-ctx.Done():
+			}
+		})
+	}
+}
+
+// start reads the logs of a container of a Pod, unless they are being read or have been
+// read for its current run. A container that has a status but has not started has no logs.
+func (s *logStreamer) start(ctx context.Context, pod *corev1.Pod, container string) {
+	run, known := containerRuns(pod)[container]
+	if known && len(run.id) == 0 && !s.opts.Previous {
+		return
+	}
+
+	key := streamKey(pod.UID, container)
+	stream, ok := s.streams[key]
+	if ok && (stream.active || s.opts.Previous || (stream.run == run && !stream.retry)) {
+		return
+	}
+	if !ok {
+		stream = &containerStream{}
+		s.streams[key] = stream
+	}
+
+	stream.run = run
+	stream.active = true
+	stream.retry = false
+	s.active++
+
+	since, after := s.since, stream.last
+	if s.fromStart && after.IsZero() {
+		since = &pod.CreationTimestamp.Time
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		last, err := podLogs(ctx, s.client, pod, pod.Labels["faas_function"], container, s.tail, since, after, s.follow, s.opts, s.dst)
+		select {
+		case s.finished <- streamResult{uid: pod.UID, container: container, last: last, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+func streamKey(uid types.UID, container string) string {
+	return string(uid) + "/" + container
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testFunctionPod(name string, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openfaas-fn",
+			UID:       types.UID(name + "-uid"),
+			Labels:    map[string]string{"faas_function": "figlet"},
+		},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+	}
+	return pod
+}
+
+func withContainerStatus(pod *corev1.Pod, container, id string, restarts int32) *corev1.Pod {
+	status := corev1.ContainerStatus{Name: container, ContainerID: id, RestartCount: restarts}
+	if len(id) > 0 {
+		status.State.Running = &corev1.ContainerStateRunning{}
+	} else {
+		status.State.Waiting = &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}
+	}
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, status)
+	return pod
+}
+
+func receiveLog(t *testing.T, logs <-chan Log) Log {
+	t.Helper()
+	select {
+	case msg, ok := <-logs:
+		if !ok {
+			t.Fatal("want a log message, the stream was closed")
+		}
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for a log message")
+	}
+	return Log{}
+}
+
+func drainLogs(t *testing.T, logs <-chan Log) []Log {
+	t.Helper()
+	received := []Log{}
+	for {
+		select {
+		case msg, ok := <-logs:
+			if !ok {
+				return received
+			}
+			received = append(received, msg)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for the log stream to close, received: %v", received)
+		}
+	}
+}
+
+func Test_GetLogs_DrainsExistingPods(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testFunctionPod("figlet-1", "figlet", "proxy"),
+		testFunctionPod("figlet-2", "figlet"),
+	)
+
+	logs, err := GetLogs(context.Background(), client, "figlet", "openfaas-fn", 0, nil, false, LogOptions{Containers: []string{AllContainers}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := []string{}
+	for _, msg := range drainLogs(t, logs) {
+		if msg.Text != "fake logs" || msg.FunctionName != "figlet" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+		got = append(got, msg.PodName+"/"+msg.Container)
+	}
+	sort.Strings(got)
+
+	want := []string{"figlet-1/figlet", "figlet-1/proxy", "figlet-2/figlet"}
+	if len(got) != len(want) {
+		t.Fatalf("want messages from %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want messages from %v, got %v", want, got)
+		}
+	}
+}
+
+func Test_GetLogs_SkipsContainersThatHaveNotStarted(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		withContainerStatus(testFunctionPod("figlet-1", "figlet"), "figlet", "", 0),
+	)
+
+	logs, err := GetLogs(context.Background(), client, "figlet", "openfaas-fn", 0, nil, false, LogOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if received := drainLogs(t, logs); len(received) != 0 {
+		t.Errorf("want no messages from a container that has not started, got %v", received)
+	}
+}
+
+func Test_GetLogs_NoInstances(t *testing.T) {
+	client := fake.NewSimpleClientset(testFunctionPod("figlet-1", "figlet"))
+
+	if _, err := GetLogs(context.Background(), client, "figlet", "openfaas-fn", 0, nil, false, LogOptions{Instance: "figlet-2"}); err != errNoInstances {
+		t.Errorf("want %s, got %v", errNoInstances, err)
+	}
+}
+
+func Test_GetLogs_FollowsNewPodsAndRestarts(t *testing.T) {
+	pod := withContainerStatus(testFunctionPod("figlet-1", "figlet"), "figlet", "containerd://1", 0)
+	client := fake.NewSimpleClientset(pod)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logs, err := GetLogs(ctx, client, "figlet", "openfaas-fn", 0, nil, true, LogOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if msg := receiveLog(t, logs); msg.PodName != "figlet-1" {
+		t.Fatalf("want a message from figlet-1, got %+v", msg)
+	}
+
+	added := withContainerStatus(testFunctionPod("figlet-2", "figlet"), "figlet", "containerd://2", 0)
+	if _, err := client.CoreV1().Pods("openfaas-fn").Create(ctx, added, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if msg := receiveLog(t, logs); msg.PodName != "figlet-2" {
+		t.Fatalf("want a message from the new Pod figlet-2, got %+v", msg)
+	}
+
+	restarted := withContainerStatus(testFunctionPod("figlet-1", "figlet"), "figlet", "containerd://3", 1)
+	if _, err := client.CoreV1().Pods("openfaas-fn").Update(ctx, restarted, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if msg := receiveLog(t, logs); msg.PodName != "figlet-1" {
+		t.Fatalf("want a message from the restarted container of figlet-1, got %+v", msg)
+	}
+
+	cancel()
+	drainLogs(t, logs)
+}
+
+func Test_logStreamer_start(t *testing.T) {
+	pod := withContainerStatus(testFunctionPod("figlet-1", "figlet"), "figlet", "containerd://1", 0)
+	streamer := newLogStreamer(fake.NewSimpleClientset(pod), 0, nil, true, LogOptions{}, make(chan Log, LogBufferSize))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	streamer.update(ctx, podEvent{pod: pod})
+	if streamer.active != 1 {
+		t.Fatalf("want 1 active stream, got %d", streamer.active)
+	}
+
+	streamer.finish(ctx, <-streamer.finished)
+	streamer.update(ctx, podEvent{pod: pod})
+	if streamer.active != 0 {
+		t.Errorf("want the same run of a container not to be read again, got %d active streams", streamer.active)
+	}
+
+	restarted := withContainerStatus(testFunctionPod("figlet-1", "figlet"), "figlet", "containerd://2", 1)
+	streamer.update(ctx, podEvent{pod: restarted})
+	if streamer.active != 1 {
+		t.Errorf("want a restarted container to be read again, got %d active streams", streamer.active)
+	}
+
+	cancel()
+	streamer.wg.Wait()
+}
+
+func Test_parseSince(t *testing.T) {
+	if since := parseSince(nil); *since != int64(defaultLogSince.Seconds()) {
+		t.Errorf("want the default of %s, got %ds", defaultLogSince, *since)
+	}
+
+	recent := time.Now().Add(-100 * time.Millisecond)
+	if since := parseSince(&recent); *since != 1 {
+		t.Errorf("want at least one second, got %ds", *since)
+	}
+
+	earlier := time.Now().Add(-90*time.Second - 100*time.Millisecond)
+	if since := parseSince(&earlier); *since != 91 {
+		t.Errorf("want the seconds rounded up to 91, got %ds", *since)
+	}
+}
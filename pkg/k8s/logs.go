@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log"
+	"math"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
@@ -19,7 +23,6 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 const (
@@ -33,6 +36,9 @@ const (
 	LogBufferSize = 500 * 2
 )
 
+// errNoInstances is returned when a function has no Pods to read logs from
+var errNoInstances = errors.New("no matching instances found")
+
 // Log is the object which will be used together with the template to generate
 // the output.
 type Log struct {
@@ -50,101 +56,192 @@ type Log struct {
 
 	// Timestamp of the message
 	Timestamp time.Time `json:"timestamp"`
+
+	// Container that wrote the message
+	Container string `json:"container,omitempty"`
+
+	// Fields of a message that is a JSON object, when LogOptions.Structured is set
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// AllContainers selects every container and init container of a function's Pods
+const AllContainers = "*"
+
+// LogOptions selects the containers and messages of a log stream
+type LogOptions struct {
+	// Containers to read, the function's container when it is empty. Sidecars and init
+	// containers are selected by name, or all of them with AllContainers.
+	Containers []string
+
+	// Previous reads the logs of the previous run of the containers, such as after a crash
+	Previous bool
+
+	// Instance is the name of the only Pod to read
+	Instance string
+
+	// Contains keeps the messages that contain the text
+	Contains string
+
+	// Regex keeps the messages that match the expression
+	Regex *regexp.Regexp
+
+	// Structured parses messages that are JSON objects into Fields
+	Structured bool
 }
 
-// GetLogs returns a channel of logs for the given function
-func GetLogs(ctx context.Context, client kubernetes.Interface, functionName, namespace string, tail int64, since *time.Time, follow bool) (<-chan Log, error) {
-	added, err := startFunctionPodInformer(ctx, client, functionName, namespace)
+// Match returns true when text passes the filters of the options
+func (o LogOptions) Match(text string) bool {
+	if len(o.Contains) > 0 && !strings.Contains(text, o.Contains) {
+		return false
+	}
+	if o.Regex != nil && !o.Regex.MatchString(text) {
+		return false
+	}
+	return true
+}
+
+// containers returns the names of the containers of pod to read
+func (o LogOptions) containers(pod *corev1.Pod, functionName string) []string {
+	names := []string{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if o.selects(container.Name, functionName) {
+			names = append(names, container.Name)
+		}
+	}
+	return names
+}
+
+// selects returns true when the container of a function's Pod is one to read
+func (o LogOptions) selects(container, functionName string) bool {
+	if len(o.Containers) == 0 {
+		return container == functionName
+	}
+
+	for _, selected := range o.Containers {
+		if selected == AllContainers || selected == container {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLogs returns a channel of logs for the given function. When follow is false the
+// channel is closed once the logs of the Pods that exist at the time of the call have been
+// read, otherwise it follows the Pods that are added and the containers that restart until
+// ctx is done.
+func GetLogs(ctx context.Context, client kubernetes.Interface, functionName, namespace string, tail int64, since *time.Time, follow bool, opts LogOptions) (<-chan Log, error) {
+	pods, selector, err := functionPods(ctx, client, functionName, namespace, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	logs := make(chan Log, LogBufferSize)
+	streamer := newLogStreamer(client, tail, since, follow, opts, logs)
+
+	var events <-chan podEvent
+	if follow {
+		events = startPodInformer(ctx, client, namespace, selector, len(pods))
+	}
 
 	go func() {
-		var watching uint
 		defer close(logs)
 
-		finished := make(chan error)
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-finished:
-				watching--
-				if watching == 0 && !follow {
-					return
-				}
-			case p := <-added:
-				watching++
-				go func() {
-					finished <- podLogs(ctx, client.CoreV1().Pods(namespace), p, functionName, namespace, tail, since, follow, logs)
-				}()
-			}
+		for i := range pods {
+			streamer.update(ctx, podEvent{pod: &pods[i]})
 		}
+		streamer.run(ctx, events)
 	}()
 
 	return logs, nil
 }
 
-// podLogs returns a stream of logs lines from the specified pod
-func podLogs(ctx context.Context, i v1.PodInterface, pod, container, namespace string, tail int64, since *time.Time, follow bool, dst chan<- Log) error {
-	log.Printf("Logger: starting log stream for %s\n", pod)
-	defer log.Printf("Logger: stopping log stream for %s\n", pod)
+// podLogs sends the logs lines of a container of the pod to dst, it returns the timestamp
+// of the last line that it read. Lines that are not newer than after are skipped, so that
+// a stream can be resumed from the last line of a previous one.
+func podLogs(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod, functionName, container string, tail int64, since *time.Time, after time.Time, follow bool, options LogOptions, dst chan<- Log) (time.Time, error) {
+	log.Printf("Logger: starting log stream for %s/%s\n", pod.Name, container)
+	defer log.Printf("Logger: stopping log stream for %s/%s\n", pod.Name, container)
 
 	opts := &corev1.PodLogOptions{
 		Follow:     follow,
 		Timestamps: true,
 		Container:  container,
+		Previous:   options.Previous,
 	}
 
-	if tail > 0 {
-		opts.TailLines = &tail
-	}
+	if !after.IsZero() {
+		opts.SinceTime = &metav1.Time{Time: after}
+	} else {
+		if tail > 0 {
+			opts.TailLines = &tail
+		}
 
-	if opts.TailLines == nil || since != nil {
-		opts.SinceSeconds = parseSince(since)
+		if opts.TailLines == nil || since != nil {
+			opts.SinceSeconds = parseSince(since)
+		}
 	}
 
-	stream, err := i.GetLogs(pod, opts).Stream(context.TODO())
+	stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
 	if err != nil {
-		return err
+		return after, err
 	}
 	defer stream.Close()
 
-	done := make(chan error)
+	last := after
+	done := make(chan error, 1)
 	go func() {
 		reader := bufio.NewReader(stream)
 		for {
 			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				msg, ts := extractTimestampAndMsg(string(bytes.Trim(line, "\x00")))
+				if ts.After(last) {
+					last = ts
+					if options.Match(msg) {
+						entry := Log{Timestamp: ts, Text: msg, PodName: pod.Name, FunctionName: functionName, Namespace: pod.Namespace, Container: container}
+						if options.Structured {
+							entry.Fields = parseStructuredLog(msg)
+						}
+
+						select {
+						case dst <- entry:
+						case <-ctx.Done():
+							done <- ctx.Err()
+							return
+						}
+					}
+				}
+			}
+
 			if err != nil {
 				done <- err
 				return
 			}
-			msg, ts := extractTimestampAndMsg(string(bytes.Trim(line, "\x00")))
-			dst <- Log{Timestamp: ts, Text: msg, PodName: pod, FunctionName: container}
 		}
 	}()
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		// closing the stream stops the reader, which must not send after we return
+		stream.Close()
+		<-done
+		return last, ctx.Err()
 	case err := <-done:
 		if err != io.EOF {
-			return err
+			return last, err
 		}
-		return nil
+		return last, nil
 	}
 }
 
+// extractTimestampAndMsg splits the timestamp that Kubernetes adds from a line of logs.
+// A line without a valid timestamp is kept whole, with the time it was read.
 func extractTimestampAndMsg(logText string) (string, time.Time) {
 	// first 32 characters is the k8s timestamp
 	parts := strings.SplitN(logText, " ", 2)
 	ts, err := time.Parse(time.RFC3339Nano, parts[0])
 	if err != nil {
-		log.Printf("error: invalid timestamp '%s'\n", parts[0])
-		return "", time.Time{}
+		return logText, time.Now().UTC()
 	}
 
 	if len(parts) == 2 {
@@ -154,20 +251,38 @@ func extractTimestampAndMsg(logText string) (string, time.Time) {
 	return "", ts
 }
 
-// parseSince returns the time.Duration of the requested Since value _or_ 5 minutes
+// parseStructuredLog returns the fields of a message that is a JSON object, or nil
+func parseStructuredLog(msg string) map[string]interface{} {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, "{") {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(msg), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// parseSince returns the time.Duration of the requested Since value _or_ 5 minutes, it is
+// rounded up to a whole second, of which there must be at least one
 func parseSince(r *time.Time) *int64 {
 	var since int64
 	if r == nil || r.IsZero() {
 		since = int64(defaultLogSince.Seconds())
 		return &since
 	}
-	since = int64(time.Since(*r).Seconds())
+	since = int64(math.Ceil(time.Since(*r).Seconds()))
+	if since < 1 {
+		since = 1
+	}
 	return &since
 }
 
-// startFunctionPodInformer will gather the list of existing Pods for the function, it will then watch
-// and watch for newly added or deleted function instances.
-func startFunctionPodInformer(ctx context.Context, client kubernetes.Interface, functionName, namespace string) (<-chan string, error) {
+// functionPods returns the Pods of the function with the instance and containers of opts,
+// and the selector of all of the Pods of the function
+func functionPods(ctx context.Context, client kubernetes.Interface, functionName, namespace string, opts LogOptions) ([]corev1.Pod, string, error) {
 	functionSelector := &metav1.LabelSelector{
 		MatchLabels: map[string]string{"faas_function": functionName},
 	}
@@ -175,45 +290,56 @@ func startFunctionPodInformer(ctx context.Context, client kubernetes.Interface,
 	if err != nil {
 		err = errors.Wrap(err, "unable to build function selector")
 		log.Printf("PodInformer: %s", err)
-		return nil, err
+		return nil, "", err
 	}
 
-	log.Printf("PodInformer: starting informer for %s in: %s\n", selector.String(), namespace)
-	factory := informers.NewFilteredSharedInformerFactory(
-		client,
-		podInformerResync,
-		namespace,
-		withLabels(selector.String()),
-	)
-
-	podInformer := factory.Core().V1().Pods()
-	podsResp, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	podsResp, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
 	if err != nil {
 		log.Printf("PodInformer: %s", err)
-		return nil, err
+		return nil, "", err
 	}
 
-	pods := podsResp.Items
+	pods := []corev1.Pod{}
+	for i, pod := range podsResp.Items {
+		if len(opts.Instance) > 0 && pod.Name != opts.Instance {
+			continue
+		}
+		if len(opts.containers(&podsResp.Items[i], functionName)) > 0 {
+			pods = append(pods, pod)
+		}
+	}
 	if len(pods) == 0 {
-		err = errors.New("no matching instances found")
-		log.Printf("PodInformer: %s", err)
-		return nil, err
+		log.Printf("PodInformer: %s", errNoInstances)
+		return nil, "", errNoInstances
 	}
 
+	return pods, selector.String(), nil
+}
+
+// startPodInformer sends the existing Pods that match the selector to the returned channel,
+// and then the Pods that are added, that are deleted or whose containers start or restart,
+// until ctx is done
+func startPodInformer(ctx context.Context, client kubernetes.Interface, namespace, selector string, size int) <-chan podEvent {
+	log.Printf("PodInformer: starting informer for %s in: %s\n", selector, namespace)
+	factory := informers.NewFilteredSharedInformerFactory(
+		client,
+		podInformerResync,
+		namespace,
+		withLabels(selector),
+	)
+
 	// prepare channel with enough space for the current instance set
-	added := make(chan string, len(pods))
+	events := make(chan podEvent, size)
+	podInformer := factory.Core().V1().Pods()
 	podInformer.Informer().AddEventHandler(&podLoggerEventHandler{
-		added: added,
+		ctx:    ctx,
+		events: events,
 	})
 
-	// will add existing pods to the chan and then listen for any new pods
+	// will add existing pods to the chan and then listen for any changes
 	go podInformer.Informer().Run(ctx.Done())
-	go func() {
-		<-ctx.Done()
-		close(added)
-	}()
 
-	return added, nil
+	return events
 }
 
 func withLabels(selector string) internalinterfaces.TweakListOptionsFunc {
@@ -222,25 +348,45 @@ func withLabels(selector string) internalinterfaces.TweakListOptionsFunc {
 	}
 }
 
+// podEvent is a Pod that was added, whose containers changed, or that was deleted
+type podEvent struct {
+	pod     *corev1.Pod
+	deleted bool
+}
+
+// podLoggerEventHandler sends the changes of Pods that matter to their logs as podEvents.
+// The channel is never closed, as the informer may still call the handler after ctx is done.
 type podLoggerEventHandler struct {
-	cache.ResourceEventHandler
-	added   chan<- string
-	deleted chan<- string
+	ctx    context.Context
+	events chan<- podEvent
+}
+
+func (h *podLoggerEventHandler) send(event podEvent) {
+	select {
+	case h.events <- event:
+	case <-h.ctx.Done():
+	}
 }
 
 func (h *podLoggerEventHandler) OnAdd(obj interface{}) {
 	pod := obj.(*corev1.Pod)
 	log.Printf("PodInformer: adding instance: %s", pod.Name)
-	h.added <- pod.Name
+	h.send(podEvent{pod: pod})
 }
 
 func (h *podLoggerEventHandler) OnUpdate(oldObj, newObj interface{}) {
-	// purposefully empty, we don't need to do anything for logs on update
+	oldPod, newPod := oldObj.(*corev1.Pod), newObj.(*corev1.Pod)
+	if oldPod.UID != newPod.UID || !reflect.DeepEqual(containerRuns(oldPod), containerRuns(newPod)) {
+		h.send(podEvent{pod: newPod})
+	}
 }
 
 func (h *podLoggerEventHandler) OnDelete(obj interface{}) {
-	// this may not be needed, the log stream Reader _should_ close on its own without
-	// us needing to watch and close it
-	// pod := obj.(*corev1.Pod)
-	// h.deleted <- pod.Name
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		log.Printf("PodInformer: removing instance: %s", pod.Name)
+		h.send(podEvent{pod: pod, deleted: true})
+	}
 }
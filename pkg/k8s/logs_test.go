@@ -0,0 +1,105 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_extractTimestampAndMsg(t *testing.T) {
+	t.Run("splits the timestamp from the message", func(t *testing.T) {
+		msg, ts := extractTimestampAndMsg("2020-06-01T10:00:00.000000001Z hello world")
+		if msg != "hello world" {
+			t.Errorf("want message %q, got %q", "hello world", msg)
+		}
+		want := time.Date(2020, 6, 1, 10, 0, 0, 1, time.UTC)
+		if !ts.Equal(want) {
+			t.Errorf("want timestamp %s, got %s", want, ts)
+		}
+	})
+
+	t.Run("keeps a malformed line", func(t *testing.T) {
+		before := time.Now().UTC()
+		msg, ts := extractTimestampAndMsg("panic: something broke")
+		if msg != "panic: something broke" {
+			t.Errorf("want the whole line, got %q", msg)
+		}
+		if ts.Before(before) {
+			t.Errorf("want the time the line was read, got %s", ts)
+		}
+	})
+}
+
+func Test_LogOptions_Match(t *testing.T) {
+	cases := []struct {
+		name string
+		opts LogOptions
+		text string
+		want bool
+	}{
+		{name: "no filters", opts: LogOptions{}, text: "anything", want: true},
+		{name: "contains", opts: LogOptions{Contains: "error"}, text: "an error occurred", want: true},
+		{name: "does not contain", opts: LogOptions{Contains: "error"}, text: "all good", want: false},
+		{name: "regex", opts: LogOptions{Regex: regexp.MustCompile(`status=5\d\d`)}, text: "status=503", want: true},
+		{name: "regex does not match", opts: LogOptions{Regex: regexp.MustCompile(`status=5\d\d`)}, text: "status=200", want: false},
+		{name: "both must match", opts: LogOptions{Contains: "GET", Regex: regexp.MustCompile(`status=5\d\d`)}, text: "POST status=503", want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.opts.Match(tc.text); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_LogOptions_containers(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate"}},
+			Containers:     []corev1.Container{{Name: "figlet"}, {Name: "proxy"}},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		containers []string
+		want       []string
+	}{
+		{name: "function container by default", containers: nil, want: []string{"figlet"}},
+		{name: "sidecar", containers: []string{"proxy"}, want: []string{"proxy"}},
+		{name: "init container", containers: []string{"migrate", "figlet"}, want: []string{"migrate", "figlet"}},
+		{name: "all containers", containers: []string{AllContainers}, want: []string{"migrate", "figlet", "proxy"}},
+		{name: "unknown container", containers: []string{"sidecar"}, want: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := LogOptions{Containers: tc.containers}.containers(pod, "figlet")
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseStructuredLog(t *testing.T) {
+	fields := parseStructuredLog(`{"level":"info","msg":"started","port":8080}`)
+	want := map[string]interface{}{"level": "info", "msg": "started", "port": float64(8080)}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("want %v, got %v", want, fields)
+	}
+
+	for _, msg := range []string{"plain text", `{"truncated": `, `["not", "an", "object"]`} {
+		if fields := parseStructuredLog(msg); fields != nil {
+			t.Errorf("want no fields for %q, got %v", msg, fields)
+		}
+	}
+}
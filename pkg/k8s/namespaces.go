@@ -0,0 +1,430 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+const (
+	// NamespaceAnnotation marks the namespaces that functions may be deployed to
+	NamespaceAnnotation = "openfaas"
+
+	// NamespaceProfilesAnnotation lists the Profiles that are applied to every function
+	// of a namespace, before the function's own profiles
+	NamespaceProfilesAnnotation = "com.openfaas.namespace.profiles"
+
+	// NamespacePullSecretLabel marks the image pull secrets that were copied into a
+	// namespace, so that they are removed when they are no longer requested
+	NamespacePullSecretLabel = "com.openfaas.namespace.pull-secret"
+
+	// namespaceObjectName is the name of the ResourceQuota and the LimitRange of a namespace
+	namespaceObjectName = "openfaas"
+
+	// namespaceServiceAccount is the service account of functions that do not set one
+	namespaceServiceAccount = "default"
+)
+
+var (
+	// ErrNamespaceExists is returned when the namespace to create already exists
+	ErrNamespaceExists = errors.New("namespace already exists")
+
+	// ErrNamespaceNotManaged is returned for a namespace without the NamespaceAnnotation
+	ErrNamespaceNotManaged = errors.New("namespace is not an openfaas namespace")
+
+	// ErrDefaultNamespace is returned when deleting the default function namespace
+	ErrDefaultNamespace = errors.New("the default function namespace can not be deleted")
+)
+
+// NamespaceNotEmptyError is returned when deleting a namespace that has functions
+type NamespaceNotEmptyError struct {
+	Namespace string
+	Functions []string
+}
+
+func (e *NamespaceNotEmptyError) Error() string {
+	return fmt.Sprintf("namespace %s has the functions: %s", e.Namespace, strings.Join(e.Functions, ", "))
+}
+
+// FunctionNamespace is a namespace of functions with the objects that faas-netes
+// manages in it
+type FunctionNamespace struct {
+	// Name of the namespace
+	Name string `json:"name"`
+
+	// Labels are added to the namespace
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the namespace
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ResourceQuota of the namespace, it is removed when it is not set
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+
+	// LimitRange of the namespace, it is removed when it is not set
+	LimitRange *corev1.LimitRangeSpec `json:"limitRange,omitempty"`
+
+	// Profiles that are applied to every function of the namespace
+	Profiles []string `json:"profiles,omitempty"`
+
+	// ImagePullSecrets are copied from the default function namespace and added to the
+	// default service account of the namespace
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+}
+
+// NamespacesClient creates, updates and deletes the namespaces of functions
+type NamespacesClient struct {
+	factory          FunctionFactory
+	defaultNamespace string
+	deployments      appslisters.DeploymentLister
+}
+
+// NewNamespacesClient returns a client that copies image pull secrets from the default
+// namespace and finds the functions of a namespace with the deployments lister
+func NewNamespacesClient(factory FunctionFactory, defaultNamespace string, deployments appslisters.DeploymentLister) *NamespacesClient {
+	return &NamespacesClient{
+		factory:          factory,
+		defaultNamespace: defaultNamespace,
+		deployments:      deployments,
+	}
+}
+
+// Validate returns an error when the name of ns is invalid, or when one of its profiles
+// or image pull secrets does not exist
+func (c *NamespacesClient) Validate(ctx context.Context, ns FunctionNamespace) error {
+	if errs := validation.IsDNS1123Label(ns.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid namespace name %q: %s", ns.Name, strings.Join(errs, ", "))
+	}
+
+	for _, name := range ns.Profiles {
+		if _, err := c.factory.NewProfileClient().Get(ctx, c.factory.Config.ProfilesNamespace, name); err != nil {
+			return fmt.Errorf("unable to find profile %s.%s: %s", name, c.factory.Config.ProfilesNamespace, err)
+		}
+	}
+
+	for _, name := range ns.ImagePullSecrets {
+		secret, err := c.factory.Client.CoreV1().Secrets(c.defaultNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to find image pull secret %s.%s: %s", name, c.defaultNamespace, err)
+		}
+		if secret.Type != corev1.SecretTypeDockerConfigJson && secret.Type != corev1.SecretTypeDockercfg {
+			return fmt.Errorf("secret %s.%s is not an image pull secret", name, c.defaultNamespace)
+		}
+	}
+
+	return nil
+}
+
+// Create creates the namespace of ns with the NamespaceAnnotation, and its quota, limit
+// range and image pull secrets
+func (c *NamespacesClient) Create(ctx context.Context, ns FunctionNamespace) error {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ns.Name,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+	setNamespaceMetadata(namespace, ns)
+
+	_, err := c.factory.Client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return ErrNamespaceExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.apply(ctx, ns)
+}
+
+// Update sets the labels, annotations, profiles, quota, limit range and image pull
+// secrets of a namespace of functions to those of ns
+func (c *NamespacesClient) Update(ctx context.Context, ns FunctionNamespace) error {
+	namespace, err := c.managedNamespace(ctx, ns.Name)
+	if err != nil {
+		return err
+	}
+
+	if namespace.Labels == nil {
+		namespace.Labels = map[string]string{}
+	}
+	setNamespaceMetadata(namespace, ns)
+
+	if _, err := c.factory.Client.CoreV1().Namespaces().Update(ctx, namespace, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	return c.apply(ctx, ns)
+}
+
+// Delete deletes a namespace of functions and everything in it. A namespace that has
+// functions is only deleted when force is set.
+func (c *NamespacesClient) Delete(ctx context.Context, name string, force bool) error {
+	if name == c.defaultNamespace {
+		return ErrDefaultNamespace
+	}
+
+	if _, err := c.managedNamespace(ctx, name); err != nil {
+		return err
+	}
+
+	if !force {
+		deployments, err := listFunctionDeployments(c.deployments, name)
+		if err != nil {
+			return err
+		}
+		if len(deployments) > 0 {
+			functions := make([]string, 0, len(deployments))
+			for _, deployment := range deployments {
+				functions = append(functions, deployment.Name)
+			}
+			sort.Strings(functions)
+			return &NamespaceNotEmptyError{Namespace: name, Functions: functions}
+		}
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	return c.factory.Client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+}
+
+// managedNamespace returns the namespace when it has the NamespaceAnnotation
+func (c *NamespacesClient) managedNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	namespace, err := c.factory.Client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := namespace.Annotations[NamespaceAnnotation]; !ok {
+		return nil, ErrNamespaceNotManaged
+	}
+	return namespace, nil
+}
+
+// apply creates, updates or removes the quota, limit range and image pull secrets of ns
+func (c *NamespacesClient) apply(ctx context.Context, ns FunctionNamespace) error {
+	if err := c.applyResourceQuota(ctx, ns); err != nil {
+		return fmt.Errorf("unable to apply the resource quota of %s: %s", ns.Name, err)
+	}
+	if err := c.applyLimitRange(ctx, ns); err != nil {
+		return fmt.Errorf("unable to apply the limit range of %s: %s", ns.Name, err)
+	}
+	if err := c.applyPullSecrets(ctx, ns); err != nil {
+		return fmt.Errorf("unable to apply the image pull secrets of %s: %s", ns.Name, err)
+	}
+	return nil
+}
+
+func (c *NamespacesClient) applyResourceQuota(ctx context.Context, ns FunctionNamespace) error {
+	quotas := c.factory.Client.CoreV1().ResourceQuotas(ns.Name)
+	if ns.ResourceQuota == nil {
+		return ignoreNotFound(quotas.Delete(ctx, namespaceObjectName, metav1.DeleteOptions{}))
+	}
+
+	quota, err := quotas.Get(ctx, namespaceObjectName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		quota = &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: namespaceObjectName, Namespace: ns.Name},
+			Spec:       *ns.ResourceQuota,
+		}
+		_, err = quotas.Create(ctx, quota, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	quota.Spec = *ns.ResourceQuota
+	_, err = quotas.Update(ctx, quota, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *NamespacesClient) applyLimitRange(ctx context.Context, ns FunctionNamespace) error {
+	limitRanges := c.factory.Client.CoreV1().LimitRanges(ns.Name)
+	if ns.LimitRange == nil {
+		return ignoreNotFound(limitRanges.Delete(ctx, namespaceObjectName, metav1.DeleteOptions{}))
+	}
+
+	limitRange, err := limitRanges.Get(ctx, namespaceObjectName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		limitRange = &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: namespaceObjectName, Namespace: ns.Name},
+			Spec:       *ns.LimitRange,
+		}
+		_, err = limitRanges.Create(ctx, limitRange, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	limitRange.Spec = *ns.LimitRange
+	_, err = limitRanges.Update(ctx, limitRange, metav1.UpdateOptions{})
+	return err
+}
+
+// applyPullSecrets copies the image pull secrets of ns from the default namespace, removes
+// the ones that were copied before and are no longer requested, and sets them on the
+// default service account
+func (c *NamespacesClient) applyPullSecrets(ctx context.Context, ns FunctionNamespace) error {
+	secrets := c.factory.Client.CoreV1().Secrets(ns.Name)
+
+	copied, err := secrets.List(ctx, metav1.ListOptions{LabelSelector: NamespacePullSecretLabel})
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, secret := range copied.Items {
+		if containsString(ns.ImagePullSecrets, secret.Name) {
+			continue
+		}
+		if err := ignoreNotFound(secrets.Delete(ctx, secret.Name, metav1.DeleteOptions{})); err != nil {
+			return err
+		}
+		removed[secret.Name] = true
+	}
+
+	for _, name := range ns.ImagePullSecrets {
+		source, err := c.factory.Client.CoreV1().Secrets(c.defaultNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ns.Name,
+					Labels:    map[string]string{NamespacePullSecretLabel: "true"},
+				},
+				Type: source.Type,
+				Data: source.Data,
+			}
+			if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := secret.Labels[NamespacePullSecretLabel]; !ok {
+			return fmt.Errorf("secret %s.%s already exists", name, ns.Name)
+		}
+
+		secret.Data = source.Data
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return c.applyServiceAccount(ctx, ns.Name, ns.ImagePullSecrets, removed)
+}
+
+// applyServiceAccount adds the image pull secrets to the default service account of the
+// namespace, and removes the ones that were removed. The service account is created when
+// Kubernetes has not created it yet.
+func (c *NamespacesClient) applyServiceAccount(ctx context.Context, namespace string, pullSecrets []string, removed map[string]bool) error {
+	if len(pullSecrets) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	accounts := c.factory.Client.CoreV1().ServiceAccounts(namespace)
+	account, err := accounts.Get(ctx, namespaceServiceAccount, metav1.GetOptions{})
+	create := k8serrors.IsNotFound(err)
+	if create {
+		account = &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: namespaceServiceAccount, Namespace: namespace},
+		}
+	} else if err != nil {
+		return err
+	}
+
+	refs := []corev1.LocalObjectReference{}
+	for _, ref := range account.ImagePullSecrets {
+		if !removed[ref.Name] && !containsString(pullSecrets, ref.Name) {
+			refs = append(refs, ref)
+		}
+	}
+	for _, name := range pullSecrets {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	account.ImagePullSecrets = refs
+
+	if create {
+		_, err = accounts.Create(ctx, account, metav1.CreateOptions{})
+		return err
+	}
+	_, err = accounts.Update(ctx, account, metav1.UpdateOptions{})
+	return err
+}
+
+// setNamespaceMetadata adds the labels and annotations of ns to the namespace, with the
+// NamespaceAnnotation and the NamespaceProfilesAnnotation
+func setNamespaceMetadata(namespace *corev1.Namespace, ns FunctionNamespace) {
+	if namespace.Annotations == nil {
+		namespace.Annotations = map[string]string{}
+	}
+
+	for key, value := range ns.Labels {
+		namespace.Labels[key] = value
+	}
+	for key, value := range ns.Annotations {
+		namespace.Annotations[key] = value
+	}
+
+	namespace.Annotations[NamespaceAnnotation] = "1"
+	if len(ns.Profiles) > 0 {
+		namespace.Annotations[NamespaceProfilesAnnotation] = strings.Join(ns.Profiles, ",")
+	} else {
+		delete(namespace.Annotations, NamespaceProfilesAnnotation)
+	}
+}
+
+// NamespaceProfiles returns the names of the Profiles that are applied to every function
+// of the namespace, or nil when the namespace can not be read
+func NamespaceProfiles(ctx context.Context, client kubernetes.Interface, namespace string) []string {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+
+	return ParseProfileNames(map[string]string{ProfileAnnotationKey: ns.Annotations[NamespaceProfilesAnnotation]})
+}
+
+// AddProfiles adds profiles to the profile annotation of a function, before the profiles
+// that the function sets, so that its own profiles are applied last
+func AddProfiles(annotations map[string]string, profiles []string) {
+	if len(profiles) == 0 {
+		return
+	}
+
+	own := ParseProfileNames(annotations)
+	names := []string{}
+	for _, name := range profiles {
+		if !containsString(own, name) && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	annotations[ProfileAnnotationKey] = strings.Join(append(names, own...), ",")
+}
+
+func ignoreNotFound(err error) error {
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
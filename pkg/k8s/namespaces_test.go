@@ -0,0 +1,181 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func namespacesClient(t *testing.T, deployments []*appsv1.Deployment, objects ...runtime.Object) *NamespacesClient {
+	t.Helper()
+
+	objects = append(objects, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "openfaas-fn"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "openfaas-fn"},
+		Type:       corev1.SecretTypeOpaque,
+	})
+
+	factory := FunctionFactory{Client: fake.NewSimpleClientset(objects...)}
+	return NewNamespacesClient(factory, "openfaas-fn", canaryLister(t, deployments...))
+}
+
+func managedNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{NamespaceAnnotation: "1"}},
+	}
+}
+
+func Test_NamespacesClient_Validate(t *testing.T) {
+	client := namespacesClient(t, nil)
+
+	cases := []struct {
+		name    string
+		ns      FunctionNamespace
+		wantErr bool
+	}{
+		{name: "valid", ns: FunctionNamespace{Name: "team-a", ImagePullSecrets: []string{"registry"}}},
+		{name: "invalid name", ns: FunctionNamespace{Name: "Team_A"}, wantErr: true},
+		{name: "missing pull secret", ns: FunctionNamespace{Name: "team-a", ImagePullSecrets: []string{"unknown"}}, wantErr: true},
+		{name: "not a pull secret", ns: FunctionNamespace{Name: "team-a", ImagePullSecrets: []string{"api-key"}}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := client.Validate(context.Background(), tc.ns)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("want error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_NamespacesClient_CreateAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := namespacesClient(t, nil, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team-a"},
+	})
+	kube := client.factory.Client
+
+	err := client.Create(ctx, FunctionNamespace{
+		Name:             "team-a",
+		Labels:           map[string]string{"team": "a"},
+		Profiles:         []string{"gvisor"},
+		ResourceQuota:    &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}},
+		LimitRange:       &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypeContainer}}},
+		ImagePullSecrets: []string{"registry"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	namespace, err := kube.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if namespace.Annotations[NamespaceAnnotation] != "1" || namespace.Labels["team"] != "a" {
+		t.Errorf("want the openfaas annotation and the labels, got %+v", namespace.ObjectMeta)
+	}
+	if got := NamespaceProfiles(ctx, kube, "team-a"); len(got) != 1 || got[0] != "gvisor" {
+		t.Errorf("want the profiles of the namespace, got %v", got)
+	}
+	if _, err := kube.CoreV1().ResourceQuotas("team-a").Get(ctx, namespaceObjectName, metav1.GetOptions{}); err != nil {
+		t.Errorf("want a resource quota, got %s", err)
+	}
+	if _, err := kube.CoreV1().LimitRanges("team-a").Get(ctx, namespaceObjectName, metav1.GetOptions{}); err != nil {
+		t.Errorf("want a limit range, got %s", err)
+	}
+	secret, err := kube.CoreV1().Secrets("team-a").Get(ctx, "registry", metav1.GetOptions{})
+	if err != nil || string(secret.Data[corev1.DockerConfigJsonKey]) != `{"auths":{}}` {
+		t.Errorf("want the image pull secret to be copied, got %v, %v", secret, err)
+	}
+	account, _ := kube.CoreV1().ServiceAccounts("team-a").Get(ctx, "default", metav1.GetOptions{})
+	if len(account.ImagePullSecrets) != 1 || account.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("want the image pull secret on the service account, got %v", account.ImagePullSecrets)
+	}
+
+	if err := client.Create(ctx, FunctionNamespace{Name: "team-a"}); err != ErrNamespaceExists {
+		t.Errorf("want %s, got %v", ErrNamespaceExists, err)
+	}
+
+	if err := client.Update(ctx, FunctionNamespace{Name: "team-a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := NamespaceProfiles(ctx, kube, "team-a"); len(got) != 0 {
+		t.Errorf("want the profiles to be removed, got %v", got)
+	}
+	if _, err := kube.CoreV1().ResourceQuotas("team-a").Get(ctx, namespaceObjectName, metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("want the resource quota to be removed, got %v", err)
+	}
+	if _, err := kube.CoreV1().Secrets("team-a").Get(ctx, "registry", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("want the image pull secret to be removed, got %v", err)
+	}
+	account, _ = kube.CoreV1().ServiceAccounts("team-a").Get(ctx, "default", metav1.GetOptions{})
+	if len(account.ImagePullSecrets) != 0 {
+		t.Errorf("want the image pull secret to be removed from the service account, got %v", account.ImagePullSecrets)
+	}
+}
+
+func Test_NamespacesClient_Update_NotManaged(t *testing.T) {
+	client := namespacesClient(t, nil, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}})
+
+	if err := client.Update(context.Background(), FunctionNamespace{Name: "kube-system"}); err != ErrNamespaceNotManaged {
+		t.Errorf("want %s, got %v", ErrNamespaceNotManaged, err)
+	}
+}
+
+func Test_NamespacesClient_Delete(t *testing.T) {
+	ctx := context.Background()
+	function := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "team-a", Labels: map[string]string{"faas_function": "figlet"}},
+	}
+	client := namespacesClient(t, []*appsv1.Deployment{function},
+		managedNamespace("team-a"), managedNamespace("team-b"), managedNamespace("openfaas-fn"))
+
+	if err := client.Delete(ctx, "openfaas-fn", true); err != ErrDefaultNamespace {
+		t.Errorf("want %s, got %v", ErrDefaultNamespace, err)
+	}
+
+	err := client.Delete(ctx, "team-a", false)
+	if notEmpty, ok := err.(*NamespaceNotEmptyError); !ok || len(notEmpty.Functions) != 1 || notEmpty.Functions[0] != "figlet" {
+		t.Fatalf("want the namespace not to be deleted with its functions, got %v", err)
+	}
+
+	if err := client.Delete(ctx, "team-a", true); err != nil {
+		t.Errorf("want the namespace to be deleted with force, got %s", err)
+	}
+	if err := client.Delete(ctx, "team-b", false); err != nil {
+		t.Errorf("want an empty namespace to be deleted, got %s", err)
+	}
+	if err := client.Delete(ctx, "team-c", false); !k8serrors.IsNotFound(err) {
+		t.Errorf("want not found, got %v", err)
+	}
+}
+
+func Test_AddProfiles(t *testing.T) {
+	annotations := map[string]string{ProfileAnnotationKey: "gpu,gvisor"}
+	AddProfiles(annotations, []string{"gvisor", "spot"})
+
+	if got := annotations[ProfileAnnotationKey]; got != "spot,gpu,gvisor" {
+		t.Errorf("want the profiles of the namespace before those of the function, got %q", got)
+	}
+
+	empty := map[string]string{}
+	AddProfiles(empty, nil)
+	if _, ok := empty[ProfileAnnotationKey]; ok {
+		t.Errorf("want no profile annotation without profiles")
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// NetworkPolicyFunction creates a NetworkPolicy for each function
+	NetworkPolicyFunction = "function"
+
+	// NetworkPolicyNamespace creates one NetworkPolicy for the functions of a namespace,
+	// functions with an EgressAnnotation still get their own NetworkPolicy for egress
+	NetworkPolicyNamespace = "namespace"
+
+	// NamespaceNetworkPolicyName is the name of the NetworkPolicy in NetworkPolicyNamespace
+	// mode
+	NamespaceNetworkPolicyName = "openfaas-functions"
+
+	// EgressAnnotation is a comma separated allow-list of the destinations that a function
+	// may connect to, each one a CIDR or namespace/<name>, optionally followed by :<port>.
+	// DNS is always allowed, an empty value blocks all other egress.
+	EgressAnnotation = "com.openfaas.egress"
+
+	// networkPolicyManagedLabel marks the NetworkPolicies that faas-netes manages
+	networkPolicyManagedLabel = "openfaas.com/network-policy"
+
+	// namespaceNameLabel is set on every namespace by Kubernetes 1.21 and later
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// NetworkPolicyConfig holds the options of the generated NetworkPolicies
+type NetworkPolicyConfig struct {
+	// Mode is NetworkPolicyFunction, NetworkPolicyNamespace or empty when no policies
+	// are generated
+	Mode string
+
+	// IngressNamespaceSelector and IngressPodSelector select the Pods that may invoke
+	// functions, which are the gateway and faas-netes
+	IngressNamespaceSelector string
+	IngressPodSelector       string
+}
+
+// ParseEgress parses the value of EgressAnnotation into egress rules, the rule that
+// allows DNS is always included
+func ParseEgress(value string) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+	dns := intstr.FromInt(53)
+	rules := []networkingv1.NetworkPolicyEgressRule{{
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &udp, Port: &dns},
+			{Protocol: &tcp, Port: &dns},
+		},
+	}}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		target, port, err := splitEgressPort(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		rule := networkingv1.NetworkPolicyEgressRule{}
+		if strings.HasPrefix(target, "namespace/") {
+			name := strings.TrimPrefix(target, "namespace/")
+			if len(name) == 0 {
+				return nil, fmt.Errorf("invalid egress %q, namespace must not be empty", entry)
+			}
+			rule.To = []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: name}},
+			}}
+		} else {
+			if _, _, err := net.ParseCIDR(target); err != nil {
+				return nil, fmt.Errorf("invalid egress %q, expected a CIDR or namespace/<name>", entry)
+			}
+			rule.To = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: target}}}
+		}
+
+		if port != nil {
+			rule.Ports = []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: port}}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// splitEgressPort splits an optional :<port> suffix from an egress entry, taking care
+// of the colons in IPv6 CIDRs
+func splitEgressPort(entry string) (string, *intstr.IntOrString, error) {
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return entry, nil, nil
+	}
+
+	i := strings.LastIndex(entry, ":")
+	if i < 0 {
+		return entry, nil, nil
+	}
+
+	n, err := strconv.Atoi(entry[i+1:])
+	if err != nil || n < 1 || n > 65535 {
+		return "", nil, fmt.Errorf("invalid egress %q, port must be from 1 to 65535", entry)
+	}
+	port := intstr.FromInt(n)
+	return entry[:i], &port, nil
+}
+
+// ValidateEgress returns an error when the EgressAnnotation of a function is invalid
+func ValidateEgress(annotations map[string]string) error {
+	value, ok := annotations[EgressAnnotation]
+	if !ok {
+		return nil
+	}
+	if _, err := ParseEgress(value); err != nil {
+		return fmt.Errorf("%s: %s", EgressAnnotation, err.Error())
+	}
+	return nil
+}
+
+// MakeFunctionNetworkPolicy returns the NetworkPolicy of a function, or nil when the
+// function does not need one
+func MakeFunctionNetworkPolicy(config NetworkPolicyConfig, functionName, namespace string, annotations map[string]string, owner metav1.OwnerReference) (*networkingv1.NetworkPolicy, error) {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"faas_function":           functionName,
+				networkPolicyManagedLabel: "true",
+			},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"faas_function": functionName},
+			},
+		},
+	}
+
+	if config.Mode == NetworkPolicyFunction {
+		namespaceSelector, podSelector, err := ingressPeer(config)
+		if err != nil {
+			return nil, err
+		}
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		policy.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+			From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: namespaceSelector, PodSelector: podSelector}},
+		}}
+	}
+
+	if value, ok := annotations[EgressAnnotation]; ok {
+		egress, err := ParseEgress(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", EgressAnnotation, err.Error())
+		}
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		policy.Spec.Egress = egress
+	}
+
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// MakeNamespaceNetworkPolicy returns the NetworkPolicy that only allows ingress to the
+// functions of a namespace from the gateway and faas-netes
+func MakeNamespaceNetworkPolicy(config NetworkPolicyConfig, namespace string) (*networkingv1.NetworkPolicy, error) {
+	namespaceSelector, podSelector, err := ingressPeer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NamespaceNetworkPolicyName,
+			Namespace: namespace,
+			Labels:    map[string]string{networkPolicyManagedLabel: "true"},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "faas_function", Operator: metav1.LabelSelectorOpExists},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: namespaceSelector, PodSelector: podSelector}},
+			}},
+		},
+	}, nil
+}
+
+// ApplyNetworkPolicy creates, updates or deletes the NetworkPolicies of a function so
+// that they match config and the EgressAnnotation of request. The policy of the
+// function is owned by owner, in NetworkPolicyNamespace mode the policy of the
+// namespace is created when it is missing.
+func ApplyNetworkPolicy(ctx context.Context, client kubernetes.Interface, config NetworkPolicyConfig, namespace string, request types.FunctionDeployment, owner metav1.OwnerReference) error {
+	var annotations map[string]string
+	if request.Annotations != nil {
+		annotations = *request.Annotations
+	}
+
+	var policy *networkingv1.NetworkPolicy
+	if len(config.Mode) > 0 {
+		var err error
+		if policy, err = MakeFunctionNetworkPolicy(config, request.Service, namespace, annotations, owner); err != nil {
+			return err
+		}
+	}
+
+	if config.Mode == NetworkPolicyNamespace {
+		namespacePolicy, err := MakeNamespaceNetworkPolicy(config, namespace)
+		if err != nil {
+			return err
+		}
+		if err := applyNetworkPolicy(ctx, client, namespace, NamespaceNetworkPolicyName, namespacePolicy, nil); err != nil {
+			return fmt.Errorf("unable to apply NetworkPolicy %s: %s", NamespaceNetworkPolicyName, err.Error())
+		}
+	}
+
+	if err := applyNetworkPolicy(ctx, client, namespace, request.Service, policy, &owner); err != nil {
+		return fmt.Errorf("unable to apply NetworkPolicy: %s", err.Error())
+	}
+	return nil
+}
+
+// DeleteNetworkPolicy removes the NetworkPolicy of a function when it is owned by owner,
+// the policy of the namespace is left in place for the other functions
+func DeleteNetworkPolicy(ctx context.Context, client kubernetes.Interface, namespace, functionName string, owner metav1.OwnerReference) error {
+	if err := applyNetworkPolicy(ctx, client, namespace, functionName, nil, &owner); err != nil {
+		return fmt.Errorf("unable to delete NetworkPolicy: %s", err.Error())
+	}
+	return nil
+}
+
+// applyNetworkPolicy creates or updates policy, or deletes the existing policy when it
+// is nil. Policies owned by something other than owner, or without the managed label
+// when owner is nil, are never changed.
+func applyNetworkPolicy(ctx context.Context, client kubernetes.Interface, namespace, name string, policy *networkingv1.NetworkPolicy, owner *metav1.OwnerReference) error {
+	policies := client.NetworkingV1().NetworkPolicies(namespace)
+
+	existing, err := policies.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	managed := found && existing.Labels[networkPolicyManagedLabel] == "true"
+	if found && owner != nil {
+		managed = managed && ownedBy(existing.ObjectMeta, *owner)
+	}
+
+	if policy == nil {
+		if !managed {
+			return nil
+		}
+		if err := policies.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	if !found {
+		_, err := policies.Create(ctx, policy, metav1.CreateOptions{})
+		return err
+	}
+
+	if !managed {
+		return fmt.Errorf("%s already exists and is not managed by OpenFaaS", name)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, policy.Spec) {
+		return nil
+	}
+
+	existing.Spec = policy.Spec
+	_, err = policies.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// ingressPeer parses the selectors of the Pods that may invoke functions
+func ingressPeer(config NetworkPolicyConfig) (*metav1.LabelSelector, *metav1.LabelSelector, error) {
+	namespaceSelector, err := metav1.ParseToLabelSelector(config.IngressNamespaceSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ingress namespace selector: %s", err.Error())
+	}
+	podSelector, err := metav1.ParseToLabelSelector(config.IngressPodSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ingress pod selector: %s", err.Error())
+	}
+	return namespaceSelector, podSelector, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testNetworkPolicyConfig = NetworkPolicyConfig{
+	Mode:                     NetworkPolicyFunction,
+	IngressNamespaceSelector: "role=openfaas-system",
+	IngressPodSelector:       "app=gateway",
+}
+
+func Test_ParseEgress(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		rules int
+		port  int
+		err   bool
+	}{
+		{name: "empty allows only DNS", value: "", rules: 1},
+		{name: "CIDR", value: "10.0.0.0/8", rules: 2},
+		{name: "CIDR with port", value: "10.0.0.0/8:5432", rules: 2, port: 5432},
+		{name: "IPv6 CIDR", value: "fd00::/8", rules: 2},
+		{name: "namespace with port", value: "namespace/db:5432", rules: 2, port: 5432},
+		{name: "list", value: "10.0.0.0/8, namespace/db", rules: 3},
+		{name: "invalid CIDR", value: "example.com", err: true},
+		{name: "invalid port", value: "10.0.0.0/8:https", err: true},
+		{name: "empty namespace", value: "namespace/", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseEgress(tc.value)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("want error, got: %v", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(rules) != tc.rules {
+				t.Fatalf("want %d rules, got: %d", tc.rules, len(rules))
+			}
+			if tc.port > 0 {
+				if ports := rules[1].Ports; len(ports) != 1 || ports[0].Port.IntValue() != tc.port {
+					t.Errorf("want port %d, got: %v", tc.port, ports)
+				}
+			}
+		})
+	}
+}
+
+func Test_MakeFunctionNetworkPolicy(t *testing.T) {
+	egress := map[string]string{EgressAnnotation: "10.0.0.0/8"}
+
+	policy, err := MakeFunctionNetworkPolicy(testNetworkPolicyConfig, "nodeinfo", "openfaas-fn", nil, scalingOwner)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(policy.Spec.PolicyTypes) != 1 || policy.Spec.PolicyTypes[0] != networkingv1.PolicyTypeIngress {
+		t.Errorf("want an ingress policy, got: %v", policy.Spec.PolicyTypes)
+	}
+	if policy.Spec.PodSelector.MatchLabels["faas_function"] != "nodeinfo" {
+		t.Errorf("want the function's Pods to be selected, got: %v", policy.Spec.PodSelector)
+	}
+
+	namespaceMode := testNetworkPolicyConfig
+	namespaceMode.Mode = NetworkPolicyNamespace
+
+	policy, err = MakeFunctionNetworkPolicy(namespaceMode, "nodeinfo", "openfaas-fn", nil, scalingOwner)
+	if err != nil || policy != nil {
+		t.Errorf("want no policy without egress in namespace mode, got: %v, %v", policy, err)
+	}
+
+	policy, err = MakeFunctionNetworkPolicy(namespaceMode, "nodeinfo", "openfaas-fn", egress, scalingOwner)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(policy.Spec.PolicyTypes) != 1 || policy.Spec.PolicyTypes[0] != networkingv1.PolicyTypeEgress {
+		t.Errorf("want an egress policy, got: %v", policy.Spec.PolicyTypes)
+	}
+}
+
+func Test_ApplyNetworkPolicy(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.TODO()
+	policies := client.NetworkingV1().NetworkPolicies("openfaas-fn")
+	request := types.FunctionDeployment{Service: "nodeinfo"}
+
+	config := testNetworkPolicyConfig
+	config.Mode = NetworkPolicyNamespace
+
+	if err := ApplyNetworkPolicy(ctx, client, config, "openfaas-fn", request, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := policies.Get(ctx, NamespaceNetworkPolicyName, metav1.GetOptions{}); err != nil {
+		t.Errorf("want namespace NetworkPolicy, got: %s", err)
+	}
+	if _, err := policies.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want no function NetworkPolicy, got: %v", err)
+	}
+
+	request.Annotations = &map[string]string{EgressAnnotation: ""}
+	if err := ApplyNetworkPolicy(ctx, client, config, "openfaas-fn", request, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := policies.Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want function NetworkPolicy for egress, got: %s", err)
+	}
+
+	if err := DeleteNetworkPolicy(ctx, client, "openfaas-fn", "nodeinfo", scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := policies.Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want function NetworkPolicy to be deleted, got: %v", err)
+	}
+	if _, err := policies.Get(ctx, NamespaceNetworkPolicyName, metav1.GetOptions{}); err != nil {
+		t.Errorf("want namespace NetworkPolicy to be kept, got: %s", err)
+	}
+}
+
+func Test_ApplyNetworkPolicy_LeavesUnmanagedPolicies(t *testing.T) {
+	client := fake.NewSimpleClientset(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+	})
+
+	err := ApplyNetworkPolicy(context.TODO(), client, testNetworkPolicyConfig, "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo"}, scalingOwner)
+	if err == nil {
+		t.Errorf("want error for an unmanaged NetworkPolicy")
+	}
+
+	if err := ApplyNetworkPolicy(context.TODO(), client, NetworkPolicyConfig{}, "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo"}, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.NetworkingV1().NetworkPolicies("openfaas-fn").Get(context.TODO(), "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want unmanaged NetworkPolicy to be kept, got: %s", err)
+	}
+}
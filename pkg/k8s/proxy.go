@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 
+	appslister "k8s.io/client-go/listers/apps/v1"
 	corelister "k8s.io/client-go/listers/core/v1"
 )
 
@@ -31,6 +32,10 @@ type FunctionLookup struct {
 	EndpointLister   corelister.EndpointsLister
 	Listers          map[string]corelister.EndpointsNamespaceLister
 
+	// DeploymentLister is used to find the canary of a function, traffic is not split
+	// when it is nil
+	DeploymentLister appslister.DeploymentLister
+
 	lock sync.RWMutex
 }
 
@@ -65,6 +70,8 @@ func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
 		functionName = strings.TrimSuffix(name, "."+namespace)
 	}
 
+	functionName = SelectVersion(namespace, functionName, l.DeploymentLister)
+
 	nsEndpointLister := l.GetLister(namespace)
 
 	if nsEndpointLister == nil {
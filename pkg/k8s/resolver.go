@@ -51,6 +51,9 @@ func (r *FunctionResolver) Resolve(name string) (url.URL, error) {
 	var namespace string
 	functionName, namespace = GetFuncName(functionName, r.DefaultNamespace)
 
+	// split traffic between the function and its canary
+	functionName = SelectVersion(namespace, functionName, r.DeploymentLister)
+
 	var lb LoadBalancer
 	// cache load balancer
 	lb = r.GetLoadBalancer(namespace, functionName)
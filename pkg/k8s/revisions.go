@@ -0,0 +1,313 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MaxFunctionRevisions is the number of revisions that are kept for each function
+	MaxFunctionRevisions = 10
+
+	// RevisionsLabel is set on the Secret that holds the revisions of a function
+	RevisionsLabel = "com.openfaas.revisions"
+
+	// revisionsSecretType is the type of the Secret that holds the revisions of a function,
+	// they are kept in a Secret as the spec of a revision includes its environment
+	revisionsSecretType = "openfaas.com/function-revisions"
+
+	revisionsSecretTmpl = "%s-revisions"
+)
+
+// FunctionRevision is a snapshot of the request that was used to deploy a function
+type FunctionRevision struct {
+	// Revision increases by one each time the function spec changes
+	Revision int `json:"revision"`
+
+	// Created is the time that the revision was deployed
+	Created time.Time `json:"created"`
+
+	// Image is the image that was requested
+	Image string `json:"image"`
+
+	// ImageDigest is the digest of the image that the function's Pods were started with,
+	// it is empty until a Pod of the revision has pulled the image
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Spec is the deploy request of the revision
+	Spec types.FunctionDeployment `json:"spec"`
+}
+
+// ImageReference returns the image of the revision pinned to its digest when it is
+// known, so that a rollback deploys the same image even if the tag was pushed again
+func (r FunctionRevision) ImageReference() string {
+	if len(r.ImageDigest) == 0 {
+		return r.Image
+	}
+
+	repository := r.Image
+	if i := strings.Index(repository, "@"); i > -1 {
+		repository = repository[:i]
+	}
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+
+	return repository + "@" + r.ImageDigest
+}
+
+// RevisionsSecretName returns the name of the Secret used to store the revisions of a
+// function
+func RevisionsSecretName(functionName string) string {
+	return fmt.Sprintf(revisionsSecretTmpl, functionName)
+}
+
+// RecordRevision stores request as the newest revision of the function. No revision is
+// added when the spec is identical to the newest revision, so it is safe to call after
+// every successful apply. The Secret holding the revisions is owned by owner so that it
+// is removed together with the function, a Secret of the same name that is not owned by
+// owner is left alone and an error is returned.
+//
+// The digest of the newest stored revision is filled in from the function's Pods, which
+// still run it when the next revision is recorded.
+func (f FunctionFactory) RecordRevision(ctx context.Context, namespace string, request types.FunctionDeployment, owner metav1.OwnerReference) (*FunctionRevision, error) {
+	name := RevisionsSecretName(request.Service)
+
+	existing, err := f.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var revisions []FunctionRevision
+	if existing != nil {
+		if !isRevisionsSecret(existing, owner) {
+			return nil, fmt.Errorf("%s already exists and is not managed by OpenFaaS", name)
+		}
+		if revisions, err = parseRevisions(existing); err != nil {
+			return nil, err
+		}
+	}
+
+	request.Namespace = namespace
+	next := 1
+	if len(revisions) > 0 {
+		latest := &revisions[len(revisions)-1]
+		resolved := f.resolveImageDigest(ctx, namespace, request.Service, latest)
+
+		if reflect.DeepEqual(latest.Spec, request) {
+			revision := *latest
+			if resolved {
+				if err := saveRevisions(ctx, f.Client, namespace, request.Service, existing, revisions, owner); err != nil {
+					return nil, err
+				}
+			}
+			return &revision, nil
+		}
+		next = latest.Revision + 1
+	}
+
+	revision := FunctionRevision{
+		Revision: next,
+		Created:  time.Now().UTC(),
+		Image:    request.Image,
+		Spec:     request,
+	}
+	revisions = append(revisions, revision)
+	if len(revisions) > MaxFunctionRevisions {
+		revisions = revisions[len(revisions)-MaxFunctionRevisions:]
+	}
+
+	if err := saveRevisions(ctx, f.Client, namespace, request.Service, existing, revisions, owner); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// saveRevisions writes revisions to the Secret of the function, existing is nil when the
+// Secret does not exist yet
+func saveRevisions(ctx context.Context, client kubernetes.Interface, namespace, functionName string, existing *apiv1.Secret, revisions []FunctionRevision, owner metav1.OwnerReference) error {
+	secret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RevisionsSecretName(functionName),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"faas_function": functionName,
+				RevisionsLabel:  "true",
+			},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Type: revisionsSecretType,
+	}
+	if err := writeRevisions(secret, revisions); err != nil {
+		return err
+	}
+
+	secrets := client.CoreV1().Secrets(namespace)
+	if existing == nil {
+		_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	}
+
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err := secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// ListRevisions returns the stored revisions of a function, oldest first. When the
+// digest of the newest revision has not been stored yet, it is filled in from the
+// function's Pods in the result.
+func (f FunctionFactory) ListRevisions(ctx context.Context, namespace, functionName string) ([]FunctionRevision, error) {
+	secret, err := f.Client.CoreV1().Secrets(namespace).Get(ctx, RevisionsSecretName(functionName), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return []FunctionRevision{}, nil
+		}
+		return nil, err
+	}
+
+	if _, ok := secret.Labels[RevisionsLabel]; !ok {
+		return []FunctionRevision{}, nil
+	}
+
+	revisions, err := parseRevisions(secret)
+	if err != nil || len(revisions) == 0 {
+		return revisions, err
+	}
+
+	f.resolveImageDigest(ctx, namespace, functionName, &revisions[len(revisions)-1])
+
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of a function, a NotFound error is returned
+// when the revision is not stored
+func (f FunctionFactory) GetRevision(ctx context.Context, namespace, functionName string, revision int) (*FunctionRevision, error) {
+	revisions, err := f.ListRevisions(ctx, namespace, functionName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range revisions {
+		if r.Revision == revision {
+			return &r, nil
+		}
+	}
+
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "revisions"}, fmt.Sprintf("%s/%d", functionName, revision))
+}
+
+// resolveImageDigest sets the digest of revision from the function's Pods when it is not
+// known yet, and returns true when it was set. The digest is optional, so a failure to
+// look it up is ignored.
+func (f FunctionFactory) resolveImageDigest(ctx context.Context, namespace, functionName string, revision *FunctionRevision) bool {
+	if len(revision.ImageDigest) > 0 {
+		return false
+	}
+
+	digest, err := f.RunningImageDigest(ctx, namespace, functionName, revision.Image)
+	if err != nil || len(digest) == 0 {
+		return false
+	}
+
+	revision.ImageDigest = digest
+	return true
+}
+
+// isRevisionsSecret returns true when secret holds the revisions of the function that
+// owner refers to
+func isRevisionsSecret(secret *apiv1.Secret, owner metav1.OwnerReference) bool {
+	if _, ok := secret.Labels[RevisionsLabel]; !ok {
+		return false
+	}
+
+	for _, ref := range secret.OwnerReferences {
+		if ref.UID == owner.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// RunningImageDigest finds the digest that the Pods of a function resolved image to, it
+// returns an empty string when no Pod has pulled the image yet
+func (f FunctionFactory) RunningImageDigest(ctx context.Context, namespace, functionName, image string) (string, error) {
+	pods, err := f.Client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "faas_function=" + functionName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			if container.Name != functionName || container.Image != image {
+				continue
+			}
+
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.Name != container.Name {
+					continue
+				}
+
+				// the ImageID has the form [docker-pullable://]repository@sha256:...
+				if i := strings.LastIndex(status.ImageID, "@"); i > -1 {
+					return status.ImageID[i+1:], nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func parseRevisions(secret *apiv1.Secret) ([]FunctionRevision, error) {
+	revisions := make([]FunctionRevision, 0, len(secret.Data))
+	for key, value := range secret.Data {
+		if _, err := strconv.Atoi(key); err != nil {
+			continue
+		}
+
+		revision := FunctionRevision{}
+		if err := json.Unmarshal(value, &revision); err != nil {
+			return nil, fmt.Errorf("unable to parse revision %s of %s: %s", key, secret.Name, err.Error())
+		}
+		revisions = append(revisions, revision)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+func writeRevisions(secret *apiv1.Secret, revisions []FunctionRevision) error {
+	secret.Data = make(map[string][]byte, len(revisions))
+	for _, revision := range revisions {
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return err
+		}
+		secret.Data[strconv.Itoa(revision.Revision)] = data
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var revisionOwner = metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nodeinfo", UID: "uid"}
+
+func Test_RecordRevision_SkipsUnchangedSpec(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+	request := types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	request.Image = "functions/nodeinfo:2"
+	revision, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if revision.Revision != 2 {
+		t.Errorf("want revision 2, got: %d", revision.Revision)
+	}
+
+	revisions, err := f.ListRevisions(ctx, "openfaas-fn", "nodeinfo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(revisions) != 2 || revisions[0].Image != "functions/nodeinfo:1" || revisions[1].Image != "functions/nodeinfo:2" {
+		t.Errorf("want two revisions in order, got: %v", revisions)
+	}
+
+	secret, err := f.Client.CoreV1().Secrets("openfaas-fn").Get(ctx, "nodeinfo-revisions", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want revisions Secret, got: %s", err)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != revisionOwner.UID {
+		t.Errorf("want Secret to be owned by the function, got: %v", secret.OwnerReferences)
+	}
+}
+
+func Test_RecordRevision_KeepsLatestRevisions(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+
+	for i := 1; i <= MaxFunctionRevisions+3; i++ {
+		request := types.FunctionDeployment{Service: "nodeinfo", Image: fmt.Sprintf("functions/nodeinfo:%d", i)}
+		if _, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	revisions, err := f.ListRevisions(ctx, "openfaas-fn", "nodeinfo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(revisions) != MaxFunctionRevisions {
+		t.Fatalf("want %d revisions, got: %d", MaxFunctionRevisions, len(revisions))
+	}
+	if revisions[0].Revision != 4 || revisions[len(revisions)-1].Revision != MaxFunctionRevisions+3 {
+		t.Errorf("want revisions 4 to %d, got: %d to %d", MaxFunctionRevisions+3, revisions[0].Revision, revisions[len(revisions)-1].Revision)
+	}
+
+	if _, err := f.GetRevision(ctx, "openfaas-fn", "nodeinfo", 1); !IsNotFound(err) {
+		t.Errorf("want NotFound for a pruned revision, got: %v", err)
+	}
+}
+
+func Test_RecordRevision_RefusesUnmanagedSecret(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+
+	for _, existing := range []*apiv1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo-revisions", Namespace: "openfaas-fn"}, Data: map[string][]byte{"1": []byte("user data")}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:            "nodeinfo-revisions",
+			Namespace:       "openfaas-fn",
+			Labels:          map[string]string{RevisionsLabel: "true"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "nodeinfo", UID: "other"}},
+		}},
+	} {
+		f.Client.CoreV1().Secrets("openfaas-fn").Delete(ctx, existing.Name, metav1.DeleteOptions{})
+		if _, err := f.Client.CoreV1().Secrets("openfaas-fn").Create(ctx, existing, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		request := types.FunctionDeployment{Service: "nodeinfo", Image: "functions/nodeinfo:1"}
+		if _, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner); err == nil {
+			t.Errorf("want an error for a Secret that is not managed by OpenFaaS")
+		}
+
+		secret, err := f.Client.CoreV1().Secrets("openfaas-fn").Get(ctx, existing.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(secret, existing) {
+			t.Errorf("want the Secret to be left alone, got: %v", secret)
+		}
+	}
+}
+
+func Test_RecordRevision_StoresImageDigest(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+
+	request := types.FunctionDeployment{Service: "nodeinfo", Image: "registry:5000/functions/nodeinfo:latest"}
+	if _, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f.Client.CoreV1().Pods("openfaas-fn").Create(ctx, &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nodeinfo-abc",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "nodeinfo"},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "nodeinfo", Image: request.Image}},
+		},
+		Status: apiv1.PodStatus{
+			ContainerStatuses: []apiv1.ContainerStatus{{
+				Name:    "nodeinfo",
+				ImageID: "docker-pullable://registry:5000/functions/nodeinfo@sha256:abc",
+			}},
+		},
+	}, metav1.CreateOptions{})
+
+	// listing the revisions resolves the digest without storing it
+	revision, err := f.GetRevision(ctx, "openfaas-fn", "nodeinfo", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if revision.ImageDigest != "sha256:abc" {
+		t.Errorf("want digest sha256:abc, got: %q", revision.ImageDigest)
+	}
+	if stored := storedRevisions(t, f); stored[0].ImageDigest != "" {
+		t.Errorf("want listing the revisions not to write the digest, got: %q", stored[0].ImageDigest)
+	}
+
+	want := "registry:5000/functions/nodeinfo@sha256:abc"
+	if got := revision.ImageReference(); got != want {
+		t.Errorf("want image reference %s, got: %s", want, got)
+	}
+
+	// the digest of the running revision is stored when the next one is recorded
+	request.Image = "registry:5000/functions/nodeinfo:next"
+	if _, err := f.RecordRevision(ctx, "openfaas-fn", request, revisionOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stored := storedRevisions(t, f)
+	if len(stored) != 2 || stored[0].ImageDigest != "sha256:abc" || stored[1].ImageDigest != "" {
+		t.Errorf("want the digest of revision 1 to be stored, got: %v", stored)
+	}
+}
+
+func storedRevisions(t *testing.T, f FunctionFactory) []FunctionRevision {
+	t.Helper()
+
+	secret, err := f.Client.CoreV1().Secrets("openfaas-fn").Get(context.TODO(), "nodeinfo-revisions", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want revisions Secret, got: %s", err)
+	}
+	revisions, err := parseRevisions(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return revisions
+}
@@ -0,0 +1,360 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	types "github.com/openfaas/faas-provider/types"
+	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MinScaleLabel is the minimum number of replicas of a function
+	MinScaleLabel = "com.openfaas.scale.min"
+
+	// MaxScaleLabel is the maximum number of replicas of a function, setting it creates
+	// a HorizontalPodAutoscaler for the function
+	MaxScaleLabel = "com.openfaas.scale.max"
+
+	// TargetScaleLabel is the target of the HorizontalPodAutoscaler per replica, a
+	// percentage of the requests for cpu and memory or a number of requests per second
+	// for rps
+	TargetScaleLabel = "com.openfaas.scale.target"
+
+	// ScaleTypeLabel is the metric that the HorizontalPodAutoscaler scales on
+	ScaleTypeLabel = "com.openfaas.scale.type"
+
+	// PDBMinAvailableLabel is the number or percentage of replicas that have to stay
+	// available during voluntary disruptions, setting it creates a PodDisruptionBudget
+	// for the function. A percentage is not a valid label value, so it may also be set
+	// as an annotation.
+	PDBMinAvailableLabel = "com.openfaas.pdb.minAvailable"
+)
+
+const (
+	// ScaleTypeCPU scales on the cpu utilisation of the replicas
+	ScaleTypeCPU = "cpu"
+	// ScaleTypeMemory scales on the memory utilisation of the replicas
+	ScaleTypeMemory = "memory"
+	// ScaleTypeRPS scales on the requests per second of the replicas, which needs an
+	// adapter for the custom metrics API that serves RPSMetricName for the Pods
+	ScaleTypeRPS = "rps"
+
+	// RPSMetricName is the Pods metric that ScaleTypeRPS scales on
+	RPSMetricName = "http_requests_per_second"
+
+	// DefaultScaleTarget is used when TargetScaleLabel is not set
+	DefaultScaleTarget = 80
+)
+
+// Autoscaling is the HorizontalPodAutoscaler configuration of a function
+type Autoscaling struct {
+	Min    int32
+	Max    int32
+	Target int32
+	Type   string
+}
+
+// ParseAutoscaling reads the autoscaling labels of a function, it returns nil when
+// MaxScaleLabel is not set
+func ParseAutoscaling(labels map[string]string) (*Autoscaling, error) {
+	value, ok := labels[MaxScaleLabel]
+	if !ok {
+		return nil, nil
+	}
+
+	scaling := &Autoscaling{Min: 1, Target: DefaultScaleTarget, Type: ScaleTypeCPU}
+
+	max, err := parsePositive(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", MaxScaleLabel, err.Error())
+	}
+	scaling.Max = max
+
+	if value, ok := labels[MinScaleLabel]; ok {
+		min, err := parsePositive(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", MinScaleLabel, err.Error())
+		}
+		scaling.Min = min
+	}
+
+	if scaling.Min > scaling.Max {
+		return nil, fmt.Errorf("%s: must not be less than %s", MaxScaleLabel, MinScaleLabel)
+	}
+
+	if value, ok := labels[TargetScaleLabel]; ok {
+		target, err := parsePositive(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", TargetScaleLabel, err.Error())
+		}
+		scaling.Target = target
+	}
+
+	if value, ok := labels[ScaleTypeLabel]; ok {
+		switch scaleType := strings.ToLower(value); scaleType {
+		case ScaleTypeCPU, ScaleTypeMemory, ScaleTypeRPS:
+			scaling.Type = scaleType
+		default:
+			return nil, fmt.Errorf("%s: must be one of %s, %s or %s", ScaleTypeLabel, ScaleTypeCPU, ScaleTypeMemory, ScaleTypeRPS)
+		}
+	}
+
+	return scaling, nil
+}
+
+// ParsePDBMinAvailable reads PDBMinAvailableLabel from the labels of a function or, when
+// it is not a label, from its annotations. It returns nil when neither is set.
+func ParsePDBMinAvailable(labels, annotations map[string]string) (*intstr.IntOrString, error) {
+	value, ok := labels[PDBMinAvailableLabel]
+	if !ok {
+		if value, ok = annotations[PDBMinAvailableLabel]; !ok {
+			return nil, nil
+		}
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("%s: must be a whole number or a percentage from 0%% to 100%%", PDBMinAvailableLabel)
+		}
+		minAvailable := intstr.FromString(value)
+		return &minAvailable, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("%s: must be a whole number or a percentage from 0%% to 100%%", PDBMinAvailableLabel)
+	}
+	minAvailable := intstr.FromInt(count)
+	return &minAvailable, nil
+}
+
+// ValidateScaling returns an error when the autoscaling or disruption budget settings
+// of a function are invalid
+func ValidateScaling(labels, annotations map[string]string) error {
+	if _, err := ParseAutoscaling(labels); err != nil {
+		return err
+	}
+	_, err := ParsePDBMinAvailable(labels, annotations)
+	return err
+}
+
+// MakeHorizontalPodAutoscaler returns the HorizontalPodAutoscaler of the function's
+// Deployment. autoscaling/v2 is not served by the client-go release that faas-netes
+// builds with, so the equivalent autoscaling/v2beta2 API is used.
+func MakeHorizontalPodAutoscaler(functionName, namespace string, scaling Autoscaling, owner metav1.OwnerReference) *autoscalingv2.HorizontalPodAutoscaler {
+	target := scaling.Target
+
+	var metric autoscalingv2.MetricSpec
+	switch scaling.Type {
+	case ScaleTypeRPS:
+		metric = autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: RPSMetricName},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: resource.NewQuantity(int64(target), resource.DecimalSI),
+				},
+			},
+		}
+	default:
+		name := corev1.ResourceCPU
+		if scaling.Type == ScaleTypeMemory {
+			name = corev1.ResourceMemory
+		}
+		metric = autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &target,
+				},
+			},
+		}
+	}
+
+	min := scaling.Min
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            functionName,
+			Namespace:       namespace,
+			Labels:          map[string]string{"faas_function": functionName},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       functionName,
+			},
+			MinReplicas: &min,
+			MaxReplicas: scaling.Max,
+			Metrics:     []autoscalingv2.MetricSpec{metric},
+		},
+	}
+}
+
+// MakePodDisruptionBudget returns the PodDisruptionBudget of the function's replicas
+func MakePodDisruptionBudget(functionName, namespace string, minAvailable intstr.IntOrString, owner metav1.OwnerReference) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            functionName,
+			Namespace:       namespace,
+			Labels:          map[string]string{"faas_function": functionName},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"faas_function": functionName},
+			},
+		},
+	}
+}
+
+// ApplyScaling creates, updates or deletes the HorizontalPodAutoscaler and
+// PodDisruptionBudget of a function so that they match the labels and annotations of
+// request. Both are owned by owner, objects of the same name that are owned by
+// something else are never changed or deleted.
+func ApplyScaling(ctx context.Context, client kubernetes.Interface, namespace string, request types.FunctionDeployment, owner metav1.OwnerReference) error {
+	var labels, annotations map[string]string
+	if request.Labels != nil {
+		labels = *request.Labels
+	}
+	if request.Annotations != nil {
+		annotations = *request.Annotations
+	}
+
+	scaling, err := ParseAutoscaling(labels)
+	if err != nil {
+		return err
+	}
+	minAvailable, err := ParsePDBMinAvailable(labels, annotations)
+	if err != nil {
+		return err
+	}
+
+	if err := applyHorizontalPodAutoscaler(ctx, client, namespace, request.Service, scaling, owner); err != nil {
+		return fmt.Errorf("unable to apply HorizontalPodAutoscaler: %s", err.Error())
+	}
+	if err := applyPodDisruptionBudget(ctx, client, namespace, request.Service, minAvailable, owner); err != nil {
+		return fmt.Errorf("unable to apply PodDisruptionBudget: %s", err.Error())
+	}
+	return nil
+}
+
+// DeleteScaling removes the HorizontalPodAutoscaler and PodDisruptionBudget of a
+// function when they are owned by owner
+func DeleteScaling(ctx context.Context, client kubernetes.Interface, namespace, functionName string, owner metav1.OwnerReference) error {
+	if err := applyHorizontalPodAutoscaler(ctx, client, namespace, functionName, nil, owner); err != nil {
+		return fmt.Errorf("unable to delete HorizontalPodAutoscaler: %s", err.Error())
+	}
+	if err := applyPodDisruptionBudget(ctx, client, namespace, functionName, nil, owner); err != nil {
+		return fmt.Errorf("unable to delete PodDisruptionBudget: %s", err.Error())
+	}
+	return nil
+}
+
+func applyHorizontalPodAutoscaler(ctx context.Context, client kubernetes.Interface, namespace, functionName string, scaling *Autoscaling, owner metav1.OwnerReference) error {
+	hpas := client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace)
+
+	existing, err := hpas.Get(ctx, functionName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if scaling == nil {
+		if !found || !ownedBy(existing.ObjectMeta, owner) {
+			return nil
+		}
+		if err := hpas.Delete(ctx, functionName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	hpa := MakeHorizontalPodAutoscaler(functionName, namespace, *scaling, owner)
+	if !found {
+		_, err := hpas.Create(ctx, hpa, metav1.CreateOptions{})
+		return err
+	}
+
+	if !ownedBy(existing.ObjectMeta, owner) {
+		return fmt.Errorf("%s already exists and is not managed by OpenFaaS", functionName)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, hpa.Spec) {
+		return nil
+	}
+
+	existing.Spec = hpa.Spec
+	_, err = hpas.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+func applyPodDisruptionBudget(ctx context.Context, client kubernetes.Interface, namespace, functionName string, minAvailable *intstr.IntOrString, owner metav1.OwnerReference) error {
+	pdbs := client.PolicyV1().PodDisruptionBudgets(namespace)
+
+	existing, err := pdbs.Get(ctx, functionName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if minAvailable == nil {
+		if !found || !ownedBy(existing.ObjectMeta, owner) {
+			return nil
+		}
+		if err := pdbs.Delete(ctx, functionName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	pdb := MakePodDisruptionBudget(functionName, namespace, *minAvailable, owner)
+	if !found {
+		_, err := pdbs.Create(ctx, pdb, metav1.CreateOptions{})
+		return err
+	}
+
+	if !ownedBy(existing.ObjectMeta, owner) {
+		return fmt.Errorf("%s already exists and is not managed by OpenFaaS", functionName)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, pdb.Spec) {
+		return nil
+	}
+
+	existing.Spec = pdb.Spec
+	_, err = pdbs.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// ownedBy returns true when owner is the controller of an object
+func ownedBy(object metav1.ObjectMeta, owner metav1.OwnerReference) bool {
+	ref := metav1.GetControllerOfNoCopy(&object)
+	return ref != nil && ref.UID == owner.UID
+}
+
+func parsePositive(value string) (int32, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("must be a whole number greater than 0")
+	}
+	return int32(n), nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var scalingOwner = metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nodeinfo", UID: "uid", Controller: boolp(true)}
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func Test_ParseAutoscaling(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   *Autoscaling
+		err    bool
+	}{
+		{
+			name:   "no max",
+			labels: map[string]string{MinScaleLabel: "2"},
+		},
+		{
+			name:   "defaults",
+			labels: map[string]string{MaxScaleLabel: "5"},
+			want:   &Autoscaling{Min: 1, Max: 5, Target: DefaultScaleTarget, Type: ScaleTypeCPU},
+		},
+		{
+			name:   "all labels",
+			labels: map[string]string{MinScaleLabel: "2", MaxScaleLabel: "10", TargetScaleLabel: "50", ScaleTypeLabel: "RPS"},
+			want:   &Autoscaling{Min: 2, Max: 10, Target: 50, Type: ScaleTypeRPS},
+		},
+		{
+			name:   "min above max",
+			labels: map[string]string{MinScaleLabel: "5", MaxScaleLabel: "2"},
+			err:    true,
+		},
+		{
+			name:   "invalid max",
+			labels: map[string]string{MaxScaleLabel: "0"},
+			err:    true,
+		},
+		{
+			name:   "invalid type",
+			labels: map[string]string{MaxScaleLabel: "5", ScaleTypeLabel: "queue"},
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseAutoscaling(tc.labels)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("want error, got: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParsePDBMinAvailable(t *testing.T) {
+	cases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        *intstr.IntOrString
+		err         bool
+	}{
+		{name: "unset"},
+		{name: "count label", labels: map[string]string{PDBMinAvailableLabel: "1"}, want: intOrStringp(intstr.FromInt(1))},
+		{name: "percentage annotation", annotations: map[string]string{PDBMinAvailableLabel: "50%"}, want: intOrStringp(intstr.FromString("50%"))},
+		{name: "negative", labels: map[string]string{PDBMinAvailableLabel: "-1"}, err: true},
+		{name: "percentage above 100", annotations: map[string]string{PDBMinAvailableLabel: "150%"}, err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParsePDBMinAvailable(tc.labels, tc.annotations)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("want error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_MakeHorizontalPodAutoscaler_Metrics(t *testing.T) {
+	hpa := MakeHorizontalPodAutoscaler("nodeinfo", "openfaas-fn", Autoscaling{Min: 1, Max: 5, Target: 70, Type: ScaleTypeMemory}, scalingOwner)
+
+	if hpa.Spec.ScaleTargetRef.Kind != "Deployment" || hpa.Spec.ScaleTargetRef.Name != "nodeinfo" {
+		t.Errorf("want Deployment nodeinfo as target, got: %+v", hpa.Spec.ScaleTargetRef)
+	}
+	metric := hpa.Spec.Metrics[0]
+	if metric.Resource == nil || metric.Resource.Name != corev1.ResourceMemory || *metric.Resource.Target.AverageUtilization != 70 {
+		t.Errorf("want memory utilisation of 70%%, got: %+v", metric)
+	}
+
+	hpa = MakeHorizontalPodAutoscaler("nodeinfo", "openfaas-fn", Autoscaling{Min: 1, Max: 5, Target: 20, Type: ScaleTypeRPS}, scalingOwner)
+	metric = hpa.Spec.Metrics[0]
+	if metric.Pods == nil || metric.Pods.Metric.Name != RPSMetricName || metric.Pods.Target.AverageValue.Value() != 20 {
+		t.Errorf("want %s of 20, got: %+v", RPSMetricName, metric)
+	}
+}
+
+func Test_ApplyScaling_CreatesUpdatesAndDeletes(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.TODO()
+	labels := map[string]string{MaxScaleLabel: "5", PDBMinAvailableLabel: "1"}
+	request := types.FunctionDeployment{Service: "nodeinfo", Labels: &labels}
+
+	if err := ApplyScaling(ctx, client, "openfaas-fn", request, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hpa, err := client.AutoscalingV2beta2().HorizontalPodAutoscalers("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want HorizontalPodAutoscaler, got: %s", err)
+	}
+	if hpa.Spec.MaxReplicas != 5 {
+		t.Errorf("want max replicas 5, got: %d", hpa.Spec.MaxReplicas)
+	}
+	if _, err := client.PolicyV1().PodDisruptionBudgets("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want PodDisruptionBudget, got: %s", err)
+	}
+
+	labels[MaxScaleLabel] = "8"
+	delete(labels, PDBMinAvailableLabel)
+	if err := ApplyScaling(ctx, client, "openfaas-fn", request, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hpa, _ = client.AutoscalingV2beta2().HorizontalPodAutoscalers("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{})
+	if hpa.Spec.MaxReplicas != 8 {
+		t.Errorf("want max replicas 8, got: %d", hpa.Spec.MaxReplicas)
+	}
+	if _, err := client.PolicyV1().PodDisruptionBudgets("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want PodDisruptionBudget to be deleted, got: %v", err)
+	}
+
+	if err := DeleteScaling(ctx, client, "openfaas-fn", "nodeinfo", scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.AutoscalingV2beta2().HorizontalPodAutoscalers("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want HorizontalPodAutoscaler to be deleted, got: %v", err)
+	}
+}
+
+func Test_ApplyScaling_LeavesUnmanagedObjects(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"}},
+		&policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"}},
+	)
+	ctx := context.TODO()
+
+	if err := ApplyScaling(ctx, client, "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo"}, scalingOwner); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.AutoscalingV2beta2().HorizontalPodAutoscalers("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want unmanaged HorizontalPodAutoscaler to be kept, got: %s", err)
+	}
+	if _, err := client.PolicyV1().PodDisruptionBudgets("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); err != nil {
+		t.Errorf("want unmanaged PodDisruptionBudget to be kept, got: %s", err)
+	}
+
+	labels := map[string]string{MaxScaleLabel: "5"}
+	if err := ApplyScaling(ctx, client, "openfaas-fn", types.FunctionDeployment{Service: "nodeinfo", Labels: &labels}, scalingOwner); err == nil {
+		t.Errorf("want error for an unmanaged HorizontalPodAutoscaler")
+	}
+}
+
+func intOrStringp(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
@@ -0,0 +1,325 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// SecretsChecksumAnnotation is set on the pod template of a function to the checksum
+	// of the data of the secrets that it references, so that a change of a secret rolls
+	// out new Pods
+	SecretsChecksumAnnotation = "com.openfaas.secrets.checksum"
+
+	// SecretsRolloutAnnotation set to false on a function keeps its Pods running when
+	// the secrets that it references change
+	SecretsRolloutAnnotation = "com.openfaas.secrets.rollout"
+)
+
+// SecretsRolloutEnabled returns false when a function opted out of rollouts on
+// secret changes with its annotations
+func SecretsRolloutEnabled(annotations map[string]string) bool {
+	enabled, err := strconv.ParseBool(annotations[SecretsRolloutAnnotation])
+	return err != nil || enabled
+}
+
+// ValidateSecretsRollout returns an error when the SecretsRolloutAnnotation of a
+// function is not a bool
+func ValidateSecretsRollout(annotations map[string]string) error {
+	value, ok := annotations[SecretsRolloutAnnotation]
+	if !ok {
+		return nil
+	}
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("%s: must be true or false", SecretsRolloutAnnotation)
+	}
+	return nil
+}
+
+// SecretsChecksum returns a checksum of the data of the named secrets, names that are
+// missing from secrets are skipped
+func SecretsChecksum(names []string, secrets map[string]*apiv1.Secret) string {
+	digests := map[string]*apiv1.Secret{}
+	for name, secret := range secrets {
+		digests[name] = digestSecret(secret)
+	}
+	return digestsChecksum(names, digests)
+}
+
+// digestsChecksum returns the checksum of the named secrets from their digests, see
+// digestSecret
+func digestsChecksum(names []string, digests map[string]*apiv1.Secret) string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+
+	hash := sha256.New()
+	for _, name := range sorted {
+		secret, ok := digests[name]
+		if !ok {
+			continue
+		}
+
+		keys := []string{}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+		for _, key := range keys {
+			hash.Write([]byte(key))
+			hash.Write([]byte{0})
+			hash.Write(secret.Data[key])
+			hash.Write([]byte{0})
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// digestSecret returns a copy of secret that only holds its name and a SHA-256 digest of
+// each of its values, so that the values are not kept in memory. Annotations are left
+// out too, since kubectl copies the values into its last-applied-configuration.
+func digestSecret(secret *apiv1.Secret) *apiv1.Secret {
+	digest := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            secret.Name,
+			Namespace:       secret.Namespace,
+			UID:             secret.UID,
+			ResourceVersion: secret.ResourceVersion,
+		},
+		Type: secret.Type,
+		Data: map[string][]byte{},
+	}
+
+	for key, value := range secret.Data {
+		sum := sha256.Sum256(value)
+		digest.Data[key] = sum[:]
+	}
+	return digest
+}
+
+// SetSecretsChecksum sets the SecretsChecksumAnnotation on the pod template of
+// deployment, it is removed when the function references no secrets or opted out
+// with its annotations
+func SetSecretsChecksum(deployment *appsv1.Deployment, names []string, secrets map[string]*apiv1.Secret, annotations map[string]string) {
+	checksum := ""
+	if len(names) > 0 && SecretsRolloutEnabled(annotations) {
+		checksum = SecretsChecksum(names, secrets)
+	}
+	setSecretsChecksum(deployment, checksum)
+}
+
+// setSecretsChecksum sets the SecretsChecksumAnnotation on the pod template of
+// deployment to checksum, or removes it when checksum is empty
+func setSecretsChecksum(deployment *appsv1.Deployment, checksum string) {
+	current, exists := deployment.Spec.Template.Annotations[SecretsChecksumAnnotation]
+	if current == checksum && (exists || len(checksum) == 0) {
+		return
+	}
+
+	// the annotations of the pod template are often shared with the Deployment and the
+	// request, so they are copied before the checksum is set
+	template := map[string]string{}
+	for key, value := range deployment.Spec.Template.Annotations {
+		template[key] = value
+	}
+	delete(template, SecretsChecksumAnnotation)
+	if len(checksum) > 0 {
+		template[SecretsChecksumAnnotation] = checksum
+	}
+	deployment.Spec.Template.Annotations = template
+}
+
+// SecretRollout restarts the functions that reference a secret when its data changes,
+// by updating the SecretsChecksumAnnotation of their Deployments. This works for
+// secrets replaced through the REST API and for secrets changed in the cluster.
+type SecretRollout struct {
+	kube        kubernetes.Interface
+	deployments appslisters.DeploymentLister
+	secrets     corelisters.SecretLister
+}
+
+// NewSecretRollout returns a SecretRollout that finds functions with deployments and
+// reads the digests of their secrets from secrets, see digestSecret
+func NewSecretRollout(kube kubernetes.Interface, deployments appslisters.DeploymentLister, secrets corelisters.SecretLister) *SecretRollout {
+	return &SecretRollout{
+		kube:        kube,
+		deployments: deployments,
+		secrets:     secrets,
+	}
+}
+
+// rolloutFieldSelector leaves out the secrets that functions do not reference, which
+// are often the largest and most numerous in a namespace
+const rolloutFieldSelector = "type!=" + string(apiv1.SecretTypeServiceAccountToken) + ",type!=helm.sh/release.v1"
+
+// StartSecretRollout watches the secrets of namespace, or of all namespaces when it is
+// empty, until stopCh is closed. Only the digests of the secrets are cached.
+func StartSecretRollout(kube kubernetes.Interface, namespace string, deployments appslisters.DeploymentLister, stopCh <-chan struct{}) *SecretRollout {
+	secrets := kube.CoreV1().Secrets(namespace)
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = rolloutFieldSelector
+			list, err := secrets.List(context.TODO(), options)
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				list.Items[i] = *digestSecret(&list.Items[i])
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = rolloutFieldSelector
+			w, err := secrets.Watch(context.TODO(), options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				if secret, ok := event.Object.(*apiv1.Secret); ok {
+					event.Object = digestSecret(secret)
+				}
+				return event, true
+			}), nil
+		},
+	}
+	informer := cache.NewSharedIndexInformer(listWatch, &apiv1.Secret{}, 5*time.Minute, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	rollout := NewSecretRollout(kube, deployments, corelisters.NewSecretLister(informer.GetIndexer()))
+	rollout.Watch(informer)
+
+	go informer.Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:secrets", stopCh, informer.HasSynced); !ok {
+		log.Fatalf("failed to wait for cache to sync")
+	}
+
+	return rollout
+}
+
+// Watch rolls out the functions of each secret of informer whose data changes. The
+// secrets listed when the informer starts only roll out the functions whose checksum
+// is out of date, so that functions deployed before the checksum existed are not all
+// restarted at once.
+func (s *SecretRollout) Watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if secret, ok := obj.(*apiv1.Secret); ok {
+				s.Rollout(secret.Namespace, secret.Name, false)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldSecret, ok := old.(*apiv1.Secret)
+			if !ok {
+				return
+			}
+			newSecret, ok := new.(*apiv1.Secret)
+			if !ok || reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+				return
+			}
+			s.Rollout(newSecret.Namespace, newSecret.Name, true)
+		},
+	})
+}
+
+// Rollout updates the checksum of each function in namespace that references the
+// secret and has not opted out. Functions without a checksum are only updated when
+// changed is set.
+func (s *SecretRollout) Rollout(namespace, secretName string, changed bool) {
+	deployments, err := listFunctionDeployments(s.deployments, namespace)
+	if err != nil {
+		log.Printf("Unable to list functions in %s: %s\n", namespace, err.Error())
+		return
+	}
+
+	for _, deployment := range deployments {
+		names := ReadFunctionSecretsSpec(*deployment)
+		if !containsString(names, secretName) || !SecretsRolloutEnabled(deployment.Spec.Template.Annotations) {
+			continue
+		}
+
+		current, exists := deployment.Spec.Template.Annotations[SecretsChecksumAnnotation]
+		if !exists && !changed {
+			continue
+		}
+
+		// new Pods would not start without all of their secrets, so the running Pods
+		// are kept until the missing secrets are created again
+		secrets := map[string]*apiv1.Secret{}
+		for _, name := range names {
+			secret, err := s.secrets.Secrets(namespace).Get(name)
+			if err != nil {
+				if !errors.IsNotFound(err) {
+					log.Printf("Unable to get secret %s.%s: %s\n", name, namespace, err.Error())
+				}
+				break
+			}
+			secrets[name] = secret
+		}
+		if len(secrets) != len(names) {
+			continue
+		}
+
+		checksum := digestsChecksum(names, secrets)
+		if checksum == current {
+			continue
+		}
+
+		updated := deployment.DeepCopy()
+		setSecretsChecksum(updated, checksum)
+		if _, err := s.kube.AppsV1().Deployments(namespace).Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+			log.Printf("Unable to roll out %s.%s for secret %s: %s\n", deployment.Name, namespace, secretName, err.Error())
+			continue
+		}
+
+		log.Printf("Rolling out %s.%s as secret %s changed\n", deployment.Name, namespace, secretName)
+	}
+}
+
+// listFunctionDeployments returns the Deployments of the functions of namespace
+func listFunctionDeployments(deployments appslisters.DeploymentLister, namespace string) ([]*appsv1.Deployment, error) {
+	res, err := deployments.Deployments(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	functions := []*appsv1.Deployment{}
+	for _, deployment := range res {
+		if IsFunctionDeployment(deployment) {
+			functions = append(functions, deployment)
+		}
+	}
+	return functions, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func makeSecret(name, value string) *apiv1.Secret {
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn"},
+		Data:       map[string][]byte{name: []byte(value)},
+	}
+}
+
+func Test_SecretsChecksum(t *testing.T) {
+	secrets := map[string]*apiv1.Secret{
+		"db-password": makeSecret("db-password", "s3cr3t"),
+		"api-token":   makeSecret("api-token", "t0k3n"),
+	}
+
+	checksum := SecretsChecksum([]string{"db-password", "api-token"}, secrets)
+	if reordered := SecretsChecksum([]string{"api-token", "db-password"}, secrets); reordered != checksum {
+		t.Errorf("want the checksum not to depend on the order of the secrets")
+	}
+
+	secrets["api-token"] = makeSecret("api-token", "n3w-t0k3n")
+	if changed := SecretsChecksum([]string{"db-password", "api-token"}, secrets); changed == checksum {
+		t.Errorf("want the checksum to change with the data of a secret")
+	}
+}
+
+func Test_SetSecretsChecksum(t *testing.T) {
+	secrets := map[string]*apiv1.Secret{"db-password": makeSecret("db-password", "s3cr3t")}
+
+	t.Run("does not change shared annotations", func(t *testing.T) {
+		annotations := map[string]string{"prometheus.io.scrape": "false"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		deployment.Spec.Template.Annotations = annotations
+
+		SetSecretsChecksum(deployment, []string{"db-password"}, secrets, annotations)
+
+		if deployment.Spec.Template.Annotations[SecretsChecksumAnnotation] != SecretsChecksum([]string{"db-password"}, secrets) {
+			t.Errorf("want the checksum on the pod template, got: %v", deployment.Spec.Template.Annotations)
+		}
+		if _, ok := deployment.Annotations[SecretsChecksumAnnotation]; ok {
+			t.Errorf("want no checksum on the Deployment, got: %v", deployment.Annotations)
+		}
+	})
+
+	t.Run("opt out removes the checksum", func(t *testing.T) {
+		deployment := &appsv1.Deployment{}
+		deployment.Spec.Template.Annotations = map[string]string{SecretsChecksumAnnotation: "abc"}
+
+		SetSecretsChecksum(deployment, []string{"db-password"}, secrets, map[string]string{SecretsRolloutAnnotation: "false"})
+
+		if _, ok := deployment.Spec.Template.Annotations[SecretsChecksumAnnotation]; ok {
+			t.Errorf("want no checksum, got: %v", deployment.Spec.Template.Annotations)
+		}
+	})
+
+	t.Run("no secrets", func(t *testing.T) {
+		deployment := &appsv1.Deployment{}
+
+		SetSecretsChecksum(deployment, nil, nil, nil)
+
+		if deployment.Spec.Template.Annotations != nil {
+			t.Errorf("want the annotations to be left alone, got: %v", deployment.Spec.Template.Annotations)
+		}
+	})
+}
+
+func Test_ValidateSecretsRollout(t *testing.T) {
+	if err := ValidateSecretsRollout(map[string]string{SecretsRolloutAnnotation: "false"}); err != nil {
+		t.Errorf("want false to be valid, got: %s", err.Error())
+	}
+	if err := ValidateSecretsRollout(map[string]string{SecretsRolloutAnnotation: "never"}); err == nil {
+		t.Errorf("want an error for a value that is not a bool")
+	}
+}
+
+func Test_SecretRollout_Rollout(t *testing.T) {
+	secret := makeSecret("db-password", "s3cr3t")
+	previous := SecretsChecksum([]string{"db-password"}, map[string]*apiv1.Secret{"db-password": makeSecret("db-password", "old")})
+
+	function := func(name string, annotations map[string]string) *appsv1.Deployment {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openfaas-fn",
+		}}
+		deployment.Spec.Template.Labels = map[string]string{"faas_function": name}
+		deployment.Spec.Template.Annotations = annotations
+		deployment.Spec.Template.Spec.Volumes = []apiv1.Volume{{
+			Name: fmt.Sprintf(secretsProjectVolumeNameTmpl, name),
+			VolumeSource: apiv1.VolumeSource{Projected: &apiv1.ProjectedVolumeSource{
+				Sources: []apiv1.VolumeProjection{{Secret: &apiv1.SecretProjection{LocalObjectReference: apiv1.LocalObjectReference{Name: "db-password"}}}},
+			}},
+		}}
+		return deployment
+	}
+
+	// the handlers also set the faas_function label on the Deployment, the operator
+	// only sets it on the pod template
+	outdated := function("outdated", map[string]string{SecretsChecksumAnnotation: previous})
+	outdated.Labels = map[string]string{"faas_function": "outdated"}
+
+	deployments := []*appsv1.Deployment{
+		outdated,
+		function("legacy", nil),
+		function("opted-out", map[string]string{SecretsChecksumAnnotation: previous, SecretsRolloutAnnotation: "false"}),
+	}
+
+	cases := []struct {
+		name    string
+		changed bool
+		want    map[string]bool
+	}{
+		{name: "secret listed on start", changed: false, want: map[string]bool{"outdated": true}},
+		{name: "secret changed", changed: true, want: map[string]bool{"outdated": true, "legacy": true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, deployment := range deployments {
+				deploymentIndexer.Add(deployment)
+				client.AppsV1().Deployments("openfaas-fn").Create(context.TODO(), deployment, metav1.CreateOptions{})
+			}
+			secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			secretIndexer.Add(digestSecret(secret))
+
+			rollout := NewSecretRollout(client, appslisters.NewDeploymentLister(deploymentIndexer), corelisters.NewSecretLister(secretIndexer))
+			rollout.Rollout("openfaas-fn", "db-password", tc.changed)
+
+			want := SecretsChecksum([]string{"db-password"}, map[string]*apiv1.Secret{"db-password": secret})
+			for _, deployment := range deployments {
+				got, err := client.AppsV1().Deployments("openfaas-fn").Get(context.TODO(), deployment.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rolled := got.Spec.Template.Annotations[SecretsChecksumAnnotation] == want
+				if rolled != tc.want[deployment.Name] {
+					t.Errorf("%s: want rolled out %v, got annotations: %v", deployment.Name, tc.want[deployment.Name], got.Spec.Template.Annotations)
+				}
+			}
+		})
+	}
+}
+
+func Test_StartSecretRollout_CachesDigests(t *testing.T) {
+	secret := makeSecret("db-password", "s3cr3t")
+	secret.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"db-password":"czNjcjN0"}}`}
+
+	client := fake.NewSimpleClientset(secret)
+	deployments := appslisters.NewDeploymentLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	rollout := StartSecretRollout(client, "openfaas-fn", deployments, stopCh)
+
+	cached, err := rollout.secrets.Secrets("openfaas-fn").Get("db-password")
+	if err != nil {
+		t.Fatalf("want the secret to be cached, got: %s", err)
+	}
+
+	if string(cached.Data["db-password"]) == "s3cr3t" || len(cached.Annotations) > 0 {
+		t.Errorf("want only a digest of the secret to be cached, got: %v", cached)
+	}
+
+	names := []string{"db-password"}
+	if got, want := digestsChecksum(names, map[string]*apiv1.Secret{"db-password": cached}), SecretsChecksum(names, map[string]*apiv1.Secret{"db-password": secret}); got != want {
+		t.Errorf("want the checksum of the cached digest to match the secret, got: %s, want: %s", got, want)
+	}
+}
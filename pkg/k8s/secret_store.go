@@ -0,0 +1,345 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/secretstore"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SecretStoreLabel is set on the Kubernetes Secrets that are materialised from a
+	// secret store, to the name of its backend
+	SecretStoreLabel = "com.openfaas.secrets.store"
+
+	// SecretSyncedAnnotation is the time at which a materialised Secret was last read
+	// from the secret store
+	SecretSyncedAnnotation = "com.openfaas.secrets.synced"
+)
+
+var secretsResource = schema.GroupResource{Resource: "secrets"}
+
+// StoreSecretsClient is a SecretsClient that keeps the values of function secrets in a
+// secretstore.Store. The Kubernetes Secrets that functions mount are materialised from
+// the store when a function that references them is deployed, and are refreshed when
+// they are older than the TTL. Secrets that are not in the store, such as registry
+// credentials created with kubectl, are read from Kubernetes as they are.
+type StoreSecretsClient struct {
+	kube  SecretInterfacer
+	store secretstore.Store
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewStoreSecretsClient returns a SecretsClient for store, which materialises Secrets
+// with kube and refreshes them after ttl
+func NewStoreSecretsClient(kube kubernetes.Interface, store secretstore.Store, ttl time.Duration) *StoreSecretsClient {
+	return &StoreSecretsClient{
+		kube:  kube.CoreV1(),
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+func (c *StoreSecretsClient) List(namespace string) ([]string, error) {
+	names, err := c.store.List(namespace)
+	if err != nil {
+		log.Printf("failed to list secrets in %s: %v\n", namespace, err)
+		return nil, err
+	}
+	return names, nil
+}
+
+func (c *StoreSecretsClient) ListMetadata(namespace string) ([]SecretMetadata, error) {
+	names, err := c.List(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := []SecretMetadata{}
+	for _, name := range names {
+		secret, err := c.store.Get(namespace, name)
+		if err == secretstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []string{}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		secrets = append(secrets, SecretMetadata{
+			Name:      name,
+			Namespace: namespace,
+			Type:      storeSecretType(secret),
+			Keys:      keys,
+			Labels:    map[string]string{SecretStoreLabel: c.store.Backend()},
+		})
+	}
+	return secrets, nil
+}
+
+func (c *StoreSecretsClient) Create(secret Secret) error {
+	if err := (secretClient{}).validateSecret(secret); err != nil {
+		return err
+	}
+
+	_, err := c.store.Get(secret.Namespace, secret.Name)
+	if err == nil {
+		return k8serrors.NewAlreadyExists(secretsResource, secret.Name)
+	}
+	if err != secretstore.ErrNotFound {
+		return err
+	}
+
+	if err := c.store.Put(secret.Namespace, toStoreSecret(secret, "")); err != nil {
+		log.Printf("failed to create secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		return err
+	}
+
+	log.Printf("created secret %s.%s in the %s secret store\n", secret.Name, secret.Namespace, c.store.Backend())
+	return nil
+}
+
+func (c *StoreSecretsClient) Replace(secret Secret) error {
+	if err := (secretClient{}).validateSecret(secret); err != nil {
+		return err
+	}
+
+	found, err := c.store.Get(secret.Namespace, secret.Name)
+	if err == secretstore.ErrNotFound {
+		return k8serrors.NewNotFound(secretsResource, secret.Name)
+	}
+	if err != nil {
+		log.Printf("can not retrieve secret for update %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		return err
+	}
+
+	// the type of a Kubernetes secret can not be changed
+	if len(secret.Type) > 0 && secret.Type != storeSecretType(found) {
+		return k8serrors.NewBadRequest(fmt.Sprintf("type of secret %s is %s and can not be changed", secret.Name, storeSecretType(found)))
+	}
+
+	if err := c.store.Put(secret.Namespace, toStoreSecret(secret, found.Type)); err != nil {
+		log.Printf("can not update secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		return err
+	}
+
+	// functions see the new values without waiting for the TTL
+	if _, err := c.kube.Secrets(secret.Namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{}); err == nil {
+		if _, err := c.materialise(secret.Namespace, secret.Name); err != nil {
+			log.Printf("can not refresh secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		}
+	}
+	return nil
+}
+
+func (c *StoreSecretsClient) Delete(namespace string, name string) error {
+	err := c.store.Delete(namespace, name)
+	if err == secretstore.ErrNotFound {
+		return k8serrors.NewNotFound(secretsResource, name)
+	}
+	if err != nil {
+		log.Printf("can not delete %s.%s: %v\n", name, namespace, err)
+		return err
+	}
+
+	c.deleteMaterialised(namespace, name)
+	return nil
+}
+
+// GetSecrets returns the named secrets, materialising those of the store that are
+// missing from Kubernetes or are older than the TTL
+func (c *StoreSecretsClient) GetSecrets(namespace string, secretNames []string) (map[string]*apiv1.Secret, error) {
+	secrets := map[string]*apiv1.Secret{}
+	for _, secretName := range secretNames {
+		secret, err := c.kube.Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		if err != nil || c.stale(secret) {
+			secret, err = c.materialise(namespace, secretName)
+			if err != nil {
+				return nil, err
+			}
+		}
+		secrets[secretName] = secret
+	}
+
+	return secrets, nil
+}
+
+// Start refreshes the materialised Secrets of namespace, or of all namespaces when it is
+// empty, every TTL until stopCh is closed
+func (c *StoreSecretsClient) Start(namespace string, stopCh <-chan struct{}) {
+	go wait.Until(func() {
+		c.Sync(namespace)
+	}, c.ttl, stopCh)
+}
+
+// Sync refreshes the materialised Secrets of namespace that are older than the TTL, and
+// deletes those that were removed from the store
+func (c *StoreSecretsClient) Sync(namespace string) {
+	list, err := c.kube.Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", SecretStoreLabel, c.store.Backend()),
+	})
+	if err != nil {
+		log.Printf("Unable to list the secrets of the %s secret store: %s\n", c.store.Backend(), err.Error())
+		return
+	}
+
+	for i := range list.Items {
+		secret := &list.Items[i]
+		if !c.stale(secret) {
+			continue
+		}
+		if _, err := c.materialise(secret.Namespace, secret.Name); err != nil {
+			log.Printf("Unable to refresh secret %s.%s: %s\n", secret.Name, secret.Namespace, err.Error())
+		}
+	}
+}
+
+// stale is true for a Secret of the store that was read from it more than the TTL
+// ago. Secrets that were not materialised from the store are never stale.
+func (c *StoreSecretsClient) stale(secret *apiv1.Secret) bool {
+	if secret.Labels[SecretStoreLabel] != c.store.Backend() {
+		return false
+	}
+
+	synced, err := time.Parse(time.RFC3339, secret.Annotations[SecretSyncedAnnotation])
+	return err != nil || c.now().Sub(synced) >= c.ttl
+}
+
+// materialise creates or updates the Kubernetes Secret of a secret of the store. When
+// the store does not have the secret, a Secret that was created in the cluster is
+// returned as it is, and one that was materialised before is deleted.
+func (c *StoreSecretsClient) materialise(namespace, name string) (*apiv1.Secret, error) {
+	kube := c.kube.Secrets(namespace)
+
+	existing, err := kube.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil {
+		existing = nil
+	}
+
+	stored, err := c.store.Get(namespace, name)
+	if err == secretstore.ErrNotFound {
+		if existing == nil {
+			return nil, k8serrors.NewNotFound(secretsResource, name)
+		}
+		if existing.Labels[SecretStoreLabel] != c.store.Backend() {
+			return existing, nil
+		}
+
+		c.deleteMaterialised(namespace, name)
+		return nil, k8serrors.NewNotFound(secretsResource, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil && existing.Labels[SecretStoreLabel] != c.store.Backend() {
+		log.Printf("Secret %s.%s was not created from the %s secret store and is used as it is\n", name, namespace, c.store.Backend())
+		return existing, nil
+	}
+
+	synced := c.now().UTC().Format(time.RFC3339)
+	secretType := apiv1.SecretType(storeSecretType(stored))
+
+	// the type of a Kubernetes secret can not be changed, so the Secret is created again
+	if existing != nil && existing.Type != secretType {
+		if err := kube.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
+			return nil, err
+		}
+		existing = nil
+	}
+
+	if existing == nil {
+		secret := &apiv1.Secret{
+			Type: secretType,
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					secretLabel:      secretLabelValue,
+					SecretStoreLabel: c.store.Backend(),
+				},
+				Annotations: map[string]string{SecretSyncedAnnotation: synced},
+			},
+			Data: stored.Data,
+		}
+
+		created, err := kube.Create(context.TODO(), secret, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Materialised secret %s.%s from the %s secret store\n", name, namespace, c.store.Backend())
+		return created, nil
+	}
+
+	updated := existing.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[SecretSyncedAnnotation] = synced
+	if !reflect.DeepEqual(updated.Data, stored.Data) {
+		updated.Data = stored.Data
+		log.Printf("Refreshed secret %s.%s from the %s secret store\n", name, namespace, c.store.Backend())
+	}
+
+	return kube.Update(context.TODO(), updated, metav1.UpdateOptions{})
+}
+
+func (c *StoreSecretsClient) deleteMaterialised(namespace, name string) {
+	err := c.kube.Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		log.Printf("can not delete %s.%s: %v\n", name, namespace, err)
+	}
+}
+
+// toStoreSecret returns the values of secret as they are kept in a store, with
+// secretType when the secret does not set one
+func toStoreSecret(secret Secret, secretType string) secretstore.Secret {
+	if len(secret.Type) > 0 {
+		secretType = secret.Type
+	}
+
+	stringData, data := secretValues(secret)
+	values := map[string][]byte{}
+	for key, value := range data {
+		values[key] = value
+	}
+	for key, value := range stringData {
+		values[key] = []byte(value)
+	}
+
+	return secretstore.Secret{Name: secret.Name, Type: secretType, Data: values}
+}
+
+func storeSecretType(secret *secretstore.Secret) string {
+	if len(secret.Type) == 0 {
+		return string(apiv1.SecretTypeOpaque)
+	}
+	return secret.Type
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/secretstore"
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type memoryStore map[string]secretstore.Secret
+
+func (s memoryStore) Backend() string {
+	return "memory"
+}
+
+func (s memoryStore) Get(namespace, name string) (*secretstore.Secret, error) {
+	secret, ok := s[namespace+"/"+name]
+	if !ok {
+		return nil, secretstore.ErrNotFound
+	}
+	return &secret, nil
+}
+
+func (s memoryStore) Put(namespace string, secret secretstore.Secret) error {
+	s[namespace+"/"+secret.Name] = secret
+	return nil
+}
+
+func (s memoryStore) Delete(namespace, name string) error {
+	if _, ok := s[namespace+"/"+name]; !ok {
+		return secretstore.ErrNotFound
+	}
+	delete(s, namespace+"/"+name)
+	return nil
+}
+
+func (s memoryStore) List(namespace string) ([]string, error) {
+	names := []string{}
+	for key, secret := range s {
+		if strings.HasPrefix(key, namespace+"/") {
+			names = append(names, secret.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func Test_StoreSecretsClient(t *testing.T) {
+	kube := fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "openfaas-fn"},
+		Type:       apiv1.SecretTypeDockerConfigJson,
+	})
+	store := memoryStore{}
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client := NewStoreSecretsClient(kube, store, 5*time.Minute)
+	client.now = func() time.Time { return now }
+
+	secretOf := func(name string) *apiv1.Secret {
+		secret, err := kube.CoreV1().Secrets("openfaas-fn").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		return secret
+	}
+
+	err := client.Create(Secret{Secret: types.Secret{Name: "db-password", Namespace: "openfaas-fn", Value: "s3cr3t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secretOf("db-password") != nil {
+		t.Fatalf("want the secret to be kept in the store until a function uses it")
+	}
+	if err := client.Create(Secret{Secret: types.Secret{Name: "db-password", Namespace: "openfaas-fn", Value: "s3cr3t"}}); !k8serrors.IsAlreadyExists(err) {
+		t.Errorf("want AlreadyExists, got: %v", err)
+	}
+
+	t.Run("deploying a function materialises its secrets", func(t *testing.T) {
+		secrets, err := client.GetSecrets("openfaas-fn", []string{"db-password", "registry"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret := secretOf("db-password")
+		if secret == nil || string(secret.Data["db-password"]) != "s3cr3t" || secret.Type != apiv1.SecretTypeOpaque {
+			t.Fatalf("want the secret to be created from the store, got: %+v", secret)
+		}
+		if secret.Labels[SecretStoreLabel] != "memory" || secret.Annotations[SecretSyncedAnnotation] != "2020-06-01T12:00:00Z" {
+			t.Errorf("want the secret to be labelled with the store, got: %v %v", secret.Labels, secret.Annotations)
+		}
+		if secrets["registry"] == nil || secrets["registry"].Type != apiv1.SecretTypeDockerConfigJson {
+			t.Errorf("want secrets outside of the store to be used as they are, got: %+v", secrets["registry"])
+		}
+
+		if _, err := client.GetSecrets("openfaas-fn", []string{"missing"}); !k8serrors.IsNotFound(err) {
+			t.Errorf("want NotFound for a missing secret, got: %v", err)
+		}
+	})
+
+	t.Run("replace refreshes the materialised secret", func(t *testing.T) {
+		err := client.Replace(Secret{Secret: types.Secret{Name: "db-password", Namespace: "openfaas-fn"}, StringData: map[string]string{"user": "admin", "password": "n3w"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret := secretOf("db-password")
+		if len(secret.Data) != 2 || string(secret.Data["password"]) != "n3w" {
+			t.Errorf("want the new keys, got: %v", secret.Data)
+		}
+
+		err = client.Replace(Secret{Secret: types.Secret{Name: "db-password", Namespace: "openfaas-fn", Value: "x"}, Type: string(apiv1.SecretTypeTLS)})
+		if !k8serrors.IsBadRequest(err) {
+			t.Errorf("want a BadRequest to change the type, got: %v", err)
+		}
+	})
+
+	t.Run("sync refreshes secrets after the TTL", func(t *testing.T) {
+		store.Put("openfaas-fn", secretstore.Secret{Name: "db-password", Data: map[string][]byte{"password": []byte("rotated")}})
+
+		client.Sync("openfaas-fn")
+		if got := string(secretOf("db-password").Data["password"]); got != "n3w" {
+			t.Errorf("want the secret to be kept within the TTL, got: %s", got)
+		}
+
+		now = now.Add(5 * time.Minute)
+		client.Sync("openfaas-fn")
+		if got := string(secretOf("db-password").Data["password"]); got != "rotated" {
+			t.Errorf("want the secret to be refreshed after the TTL, got: %s", got)
+		}
+	})
+
+	t.Run("list and metadata read the store", func(t *testing.T) {
+		store.Put("openfaas-fn", secretstore.Secret{Name: "tls", Type: string(apiv1.SecretTypeTLS), Data: map[string][]byte{"tls.crt": []byte("a"), "tls.key": []byte("b")}})
+
+		names, err := client.List("openfaas-fn")
+		if err != nil || len(names) != 2 || names[0] != "db-password" || names[1] != "tls" {
+			t.Errorf("want the secrets of the store, got: %v, %v", names, err)
+		}
+
+		metadata, err := client.ListMetadata("openfaas-fn")
+		if err != nil || len(metadata) != 2 || metadata[1].Type != string(apiv1.SecretTypeTLS) || len(metadata[1].Keys) != 2 {
+			t.Errorf("want the metadata of the secrets, got: %+v, %v", metadata, err)
+		}
+	})
+
+	t.Run("delete removes the materialised secret", func(t *testing.T) {
+		if err := client.Delete("openfaas-fn", "db-password"); err != nil {
+			t.Fatal(err)
+		}
+		if secretOf("db-password") != nil {
+			t.Errorf("want the materialised secret to be deleted")
+		}
+		if err := client.Delete("openfaas-fn", "db-password"); !k8serrors.IsNotFound(err) {
+			t.Errorf("want NotFound, got: %v", err)
+		}
+	})
+
+	t.Run("sync deletes secrets that were removed from the store", func(t *testing.T) {
+		client.GetSecrets("openfaas-fn", []string{"tls"})
+		delete(store, "openfaas-fn/tls")
+
+		now = now.Add(5 * time.Minute)
+		client.Sync("openfaas-fn")
+		if secretOf("tls") != nil {
+			t.Errorf("want the secret to be deleted")
+		}
+		if secretOf("registry") == nil {
+			t.Errorf("want secrets outside of the store to be kept")
+		}
+	})
+}
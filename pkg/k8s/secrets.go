@@ -9,14 +9,17 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	types "github.com/openfaas/faas-provider/types"
-	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	typedV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
 )
 
 const (
@@ -26,6 +29,39 @@ const (
 	secretsProjectVolumeNameTmpl = "%s-projected-secrets"
 )
 
+// Secret is a function secret as it is created or replaced through the REST API. It
+// extends types.Secret with text and base64 values for multiple keys, and with the
+// type of the Kubernetes secret, such as kubernetes.io/tls. Value and RawValue are
+// stored under a key named after the secret.
+type Secret struct {
+	types.Secret
+
+	// RawValue is a base64 value, for binary data
+	RawValue []byte `json:"rawValue,omitempty"`
+
+	// StringData holds text values by key
+	StringData map[string]string `json:"stringData,omitempty"`
+
+	// Data holds base64 values by key
+	Data map[string][]byte `json:"data,omitempty"`
+
+	// Type is the type of the Kubernetes secret, Opaque when it is empty
+	Type string `json:"type,omitempty"`
+}
+
+// SecretMetadata describes a function secret without any of its values
+type SecretMetadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Keys      []string          `json:"keys"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+
+	// UsedBy are the functions that reference the secret
+	UsedBy []string `json:"usedBy"`
+}
+
 // SecretsClient exposes the standardized CRUD behaviors for Kubernetes secrets.  These methods
 // will ensure that the secrets are structured and labelled correctly for use by the OpenFaaS system.
 type SecretsClient interface {
@@ -33,11 +69,15 @@ type SecretsClient interface {
 	// to ensure we do not accidentally read or print the sensitive values during
 	// read operations.
 	List(namespace string) (names []string, err error)
+	// ListMetadata returns the type, key names and labels of the function secrets, but
+	// never their values.
+	ListMetadata(namespace string) ([]SecretMetadata, error)
 	// Create adds a new secret, with the appropriate labels and structure to be
 	// used as a function secret.
-	Create(secret types.Secret) error
-	// Replace updates the value of a function secret
-	Replace(secret types.Secret) error
+	Create(secret Secret) error
+	// Replace updates the values of a function secret, keys that are not in secret
+	// are removed
+	Replace(secret Secret) error
 	// Delete removes a function secret
 	Delete(name string, namespace string) error
 	// GetSecrets queries Kubernetes for a list of secrets by name in the given k8s namespace.
@@ -82,14 +122,47 @@ func (c secretClient) List(namespace string) (names []string, err error) {
 	return names, nil
 }
 
-func (c secretClient) Create(secret types.Secret) error {
+func (c secretClient) ListMetadata(namespace string) ([]SecretMetadata, error) {
+	res, err := c.kube.Secrets(namespace).List(context.TODO(), c.selector())
+	if err != nil {
+		log.Printf("failed to list secrets in %s: %v\n", namespace, err)
+		return nil, err
+	}
+
+	secrets := make([]SecretMetadata, len(res.Items))
+	for idx, item := range res.Items {
+		keys := []string{}
+		for key := range item.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		secrets[idx] = SecretMetadata{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+			Type:      string(item.Type),
+			Keys:      keys,
+			Labels:    item.Labels,
+			CreatedAt: item.CreationTimestamp.Time,
+		}
+	}
+	return secrets, nil
+}
+
+func (c secretClient) Create(secret Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
 	}
 
+	secretType := apiv1.SecretTypeOpaque
+	if len(secret.Type) > 0 {
+		secretType = apiv1.SecretType(secret.Type)
+	}
+
+	stringData, data := secretValues(secret)
 	req := &apiv1.Secret{
-		Type: apiv1.SecretTypeOpaque,
+		Type: secretType,
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secret.Name,
 			Namespace: secret.Namespace,
@@ -97,9 +170,8 @@ func (c secretClient) Create(secret types.Secret) error {
 				secretLabel: secretLabelValue,
 			},
 		},
-		StringData: map[string]string{
-			secret.Name: secret.Value,
-		},
+		StringData: stringData,
+		Data:       data,
 	}
 
 	_, err = c.kube.Secrets(secret.Namespace).Create(context.TODO(), req, metav1.CreateOptions{})
@@ -113,7 +185,7 @@ func (c secretClient) Create(secret types.Secret) error {
 	return nil
 }
 
-func (c secretClient) Replace(secret types.Secret) error {
+func (c secretClient) Replace(secret Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
@@ -126,9 +198,12 @@ func (c secretClient) Replace(secret types.Secret) error {
 		return err
 	}
 
-	found.StringData = map[string]string{
-		secret.Name: secret.Value,
+	// the type of a Kubernetes secret can not be changed
+	if len(secret.Type) > 0 && apiv1.SecretType(secret.Type) != found.Type {
+		return k8serrors.NewBadRequest(fmt.Sprintf("type of secret %s is %s and can not be changed", secret.Name, found.Type))
 	}
+
+	found.StringData, found.Data = secretValues(secret)
 	_, err = kube.Update(context.TODO(), found, metav1.UpdateOptions{})
 	if err != nil {
 		log.Printf("can not update secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
@@ -168,22 +243,83 @@ func (c secretClient) selector() metav1.ListOptions {
 	}
 }
 
-func (c secretClient) validateSecret(secret types.Secret) error {
+func (c secretClient) validateSecret(secret Secret) error {
 	if strings.TrimSpace(secret.Namespace) == "" {
-		return errors.New("namespace may not be empty")
+		return k8serrors.NewBadRequest("namespace may not be empty")
 	}
 
 	if strings.TrimSpace(secret.Name) == "" {
-		return errors.New("name may not be empty")
+		return k8serrors.NewBadRequest("name may not be empty")
+	}
+
+	if len(secret.Value) > 0 && len(secret.RawValue) > 0 {
+		return k8serrors.NewBadRequest("only one of value and rawValue may be set")
+	}
+
+	keys := []string{}
+	if len(secret.Value) > 0 || len(secret.RawValue) > 0 {
+		keys = append(keys, secret.Name)
+	}
+	for key := range secret.StringData {
+		keys = append(keys, key)
+	}
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			return k8serrors.NewBadRequest(fmt.Sprintf("key %s is set more than once", key))
+		}
+		seen[key] = true
+
+		if msgs := validation.IsConfigMapKey(key); len(msgs) > 0 {
+			return k8serrors.NewBadRequest(fmt.Sprintf("invalid key %s: %s", key, strings.Join(msgs, ", ")))
+		}
 	}
 
 	return nil
 }
 
+// secretValues returns the text and binary values of secret by key. A secret with
+// only a Value keeps it under the name of the secret, as before keys existed.
+func secretValues(secret Secret) (map[string]string, map[string][]byte) {
+	var stringData map[string]string
+	var data map[string][]byte
+
+	if len(secret.StringData) > 0 {
+		stringData = map[string]string{}
+		for key, value := range secret.StringData {
+			stringData[key] = value
+		}
+	}
+	if len(secret.Data) > 0 || len(secret.RawValue) > 0 {
+		data = map[string][]byte{}
+		for key, value := range secret.Data {
+			data[key] = value
+		}
+	}
+
+	switch {
+	case len(secret.RawValue) > 0:
+		data[secret.Name] = secret.RawValue
+	case len(secret.Value) > 0 || (stringData == nil && data == nil):
+		if stringData == nil {
+			stringData = map[string]string{}
+		}
+		stringData[secret.Name] = secret.Value
+	}
+
+	return stringData, data
+}
+
 // ConfigureSecrets will update the Deployment spec to include secrets that have been deployed
 // in the kubernetes cluster.  For each requested secret, we inspect the type and add it to the
 // deployment spec as appropriate: secrets with type `SecretTypeDockercfg/SecretTypeDockerjson`
 // are added as ImagePullSecrets all other secrets are mounted as files in the deployments containers.
+// The keys of secrets are set as environment variables, see ConfigureSecretsEnv.
+// The checksum of the secrets is set on the pod template, see SetSecretsChecksum.
 func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, deployment *appsv1.Deployment, existingSecrets map[string]*apiv1.Secret) error {
 	// Add / reference pre-existing secrets within Kubernetes
 	secretVolumeProjections := []apiv1.VolumeProjection{}
@@ -259,6 +395,15 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, dep
 
 	deployment.Spec.Template.Spec.Containers = updatedContainers
 
+	annotations := map[string]string{}
+	if request.Annotations != nil {
+		annotations = *request.Annotations
+	}
+	if err := ConfigureSecretsEnv(deployment, annotations, existingSecrets); err != nil {
+		return err
+	}
+	SetSecretsChecksum(deployment, RequiredSecrets(request.Secrets, annotations), existingSecrets, annotations)
+
 	return nil
 }
 
@@ -286,6 +431,36 @@ func ReadFunctionSecretsSpec(item appsv1.Deployment) []string {
 		secrets = append(secrets, s.Secret.Name)
 	}
 
+	// secrets that are only read as environment variables
+	for _, container := range item.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil || containsString(secrets, env.ValueFrom.SecretKeyRef.Name) {
+				continue
+			}
+			secrets = append(secrets, env.ValueFrom.SecretKeyRef.Name)
+		}
+	}
+
 	sort.Strings(secrets)
 	return secrets
 }
+
+// SecretUsage returns the names of the functions of namespace that reference each
+// secret, by name of the secret, see ReadFunctionSecretsSpec
+func SecretUsage(deployments appslisters.DeploymentLister, namespace string) (map[string][]string, error) {
+	res, err := listFunctionDeployments(deployments, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string][]string{}
+	for _, item := range res {
+		for _, name := range ReadFunctionSecretsSpec(*item) {
+			usage[name] = append(usage[name], item.Name)
+		}
+	}
+	for _, functions := range usage {
+		sort.Strings(functions)
+	}
+	return usage, nil
+}
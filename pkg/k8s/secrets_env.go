@@ -0,0 +1,151 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SecretsEnvAnnotation maps environment variables of a function to keys of secrets, as
+// a comma separated list of NAME=secret:key. The key defaults to the name of the
+// secret, such as DB_PASSWORD=db-password. The secrets do not need to be listed in
+// the secrets of the function, they are not mounted as files unless they are.
+const SecretsEnvAnnotation = "com.openfaas.secrets.env"
+
+// SecretEnv is an environment variable whose value is read from the key of a secret
+type SecretEnv struct {
+	Name   string
+	Secret string
+	Key    string
+}
+
+// ParseSecretsEnv returns the environment variables of the SecretsEnvAnnotation
+func ParseSecretsEnv(annotations map[string]string) ([]SecretEnv, error) {
+	value, ok := annotations[SecretsEnvAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	envs := []SecretEnv{}
+	seen := map[string]bool{}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: %q must be NAME=secret:key", SecretsEnvAnnotation, entry)
+		}
+
+		env := SecretEnv{Name: strings.TrimSpace(parts[0])}
+		ref := strings.SplitN(strings.TrimSpace(parts[1]), ":", 2)
+		env.Secret, env.Key = ref[0], ref[0]
+		if len(ref) == 2 {
+			env.Key = ref[1]
+		}
+
+		if msgs := validation.IsEnvVarName(env.Name); len(msgs) > 0 {
+			return nil, fmt.Errorf("%s: invalid name %q: %s", SecretsEnvAnnotation, env.Name, strings.Join(msgs, ", "))
+		}
+		if msgs := validation.IsDNS1123Subdomain(env.Secret); len(msgs) > 0 {
+			return nil, fmt.Errorf("%s: invalid secret %q: %s", SecretsEnvAnnotation, env.Secret, strings.Join(msgs, ", "))
+		}
+		if msgs := validation.IsConfigMapKey(env.Key); len(msgs) > 0 {
+			return nil, fmt.Errorf("%s: invalid key %q: %s", SecretsEnvAnnotation, env.Key, strings.Join(msgs, ", "))
+		}
+		if seen[env.Name] {
+			return nil, fmt.Errorf("%s: %s is set more than once", SecretsEnvAnnotation, env.Name)
+		}
+		seen[env.Name] = true
+
+		envs = append(envs, env)
+	}
+
+	return envs, nil
+}
+
+// ValidateSecretsEnv returns an error when the SecretsEnvAnnotation of a function can
+// not be parsed
+func ValidateSecretsEnv(annotations map[string]string) error {
+	_, err := ParseSecretsEnv(annotations)
+	return err
+}
+
+// RequiredSecrets returns secrets followed by the other secrets that the
+// SecretsEnvAnnotation references, which all have to exist to deploy a function
+func RequiredSecrets(secrets []string, annotations map[string]string) []string {
+	envs, _ := ParseSecretsEnv(annotations)
+	if len(envs) == 0 {
+		return secrets
+	}
+
+	names := append([]string{}, secrets...)
+	for _, env := range envs {
+		if !containsString(names, env.Secret) {
+			names = append(names, env.Secret)
+		}
+	}
+	return names
+}
+
+// ConfigureSecretsEnv sets the environment variables of the SecretsEnvAnnotation on the
+// containers of deployment, as references to the keys of the secrets. They replace
+// the environment variables with the same name and those of a previous mapping.
+func ConfigureSecretsEnv(deployment *appsv1.Deployment, annotations map[string]string, existingSecrets map[string]*apiv1.Secret) error {
+	envs, err := ParseSecretsEnv(annotations)
+	if err != nil {
+		return err
+	}
+
+	mapped := map[string]bool{}
+	for _, env := range envs {
+		secret, ok := existingSecrets[env.Secret]
+		if !ok {
+			return fmt.Errorf("required secret '%s' was not found in the cluster", env.Secret)
+		}
+		if _, ok := secret.Data[env.Key]; !ok {
+			return fmt.Errorf("secret '%s' has no key '%s' for %s", env.Secret, env.Key, env.Name)
+		}
+		mapped[env.Name] = true
+	}
+
+	for i := range deployment.Spec.Template.Spec.Containers {
+		container := &deployment.Spec.Template.Spec.Containers[i]
+
+		updated := []apiv1.EnvVar{}
+		for _, env := range container.Env {
+			if mapped[env.Name] || (env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil) {
+				continue
+			}
+			updated = append(updated, env)
+		}
+
+		if len(envs) == 0 && len(updated) == len(container.Env) {
+			continue
+		}
+
+		for _, env := range envs {
+			updated = append(updated, apiv1.EnvVar{
+				Name: env.Name,
+				ValueFrom: &apiv1.EnvVarSource{
+					SecretKeyRef: &apiv1.SecretKeySelector{
+						LocalObjectReference: apiv1.LocalObjectReference{Name: env.Secret},
+						Key:                  env.Key,
+					},
+				},
+			})
+		}
+
+		container.Env = updated
+	}
+
+	return nil
+}
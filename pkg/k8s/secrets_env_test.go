@@ -0,0 +1,122 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseSecretsEnv(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  []SecretEnv
+		err   bool
+	}{
+		{
+			name:  "key of a secret",
+			value: "DB_PASSWORD=db-creds:password",
+			want:  []SecretEnv{{Name: "DB_PASSWORD", Secret: "db-creds", Key: "password"}},
+		},
+		{
+			name:  "key defaults to the name of the secret",
+			value: "API_TOKEN=api-token, DB_USER=db-creds:user\n",
+			want: []SecretEnv{
+				{Name: "API_TOKEN", Secret: "api-token", Key: "api-token"},
+				{Name: "DB_USER", Secret: "db-creds", Key: "user"},
+			},
+		},
+		{name: "missing secret", value: "DB_PASSWORD", err: true},
+		{name: "invalid name", value: "1DB=db-creds:password", err: true},
+		{name: "invalid secret", value: "DB_PASSWORD=DB_Creds:password", err: true},
+		{name: "invalid key", value: "DB_PASSWORD=db-creds:pass/word", err: true},
+		{name: "duplicate name", value: "DB_PASSWORD=db-creds:password,DB_PASSWORD=db-creds:user", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSecretsEnv(map[string]string{SecretsEnvAnnotation: tc.value})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("want an error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_RequiredSecrets(t *testing.T) {
+	annotations := map[string]string{SecretsEnvAnnotation: "DB_USER=db-creds:user,DB_PASSWORD=db-creds:password,TOKEN=api-token"}
+
+	got := RequiredSecrets([]string{"api-token"}, annotations)
+	if want := []string{"api-token", "db-creds"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got: %v", want, got)
+	}
+}
+
+func Test_ConfigureSecrets_Env(t *testing.T) {
+	f := mockFactory()
+	existingSecrets := map[string]*apiv1.Secret{
+		"db-creds": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"user": []byte("admin"), "password": []byte("s3cr3t")}},
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wordpress"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{
+						Name: "wordpress",
+						Env: []apiv1.EnvVar{
+							{Name: "DB_HOST", Value: "mysql"},
+							{Name: "DB_PASSWORD", Value: "plain"},
+							{Name: "OLD", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{Key: "old"}}},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	request := types.FunctionDeployment{
+		Service:     "wordpress",
+		Annotations: &map[string]string{SecretsEnvAnnotation: "DB_PASSWORD=db-creds:password"},
+	}
+	if err := f.ConfigureSecrets(request, deployment, existingSecrets); err != nil {
+		t.Fatal(err)
+	}
+
+	env := deployment.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 2 || env[0].Name != "DB_HOST" || env[1].Name != "DB_PASSWORD" {
+		t.Fatalf("want DB_HOST and the secret DB_PASSWORD, got: %v", env)
+	}
+	ref := env[1].ValueFrom.SecretKeyRef
+	if ref.Name != "db-creds" || ref.Key != "password" || len(env[1].Value) > 0 {
+		t.Errorf("want a reference to db-creds:password, got: %+v", env[1])
+	}
+	if len(deployment.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("want secrets of environment variables not to be mounted, got: %v", deployment.Spec.Template.Spec.Volumes)
+	}
+	if len(deployment.Spec.Template.Annotations[SecretsChecksumAnnotation]) == 0 {
+		t.Errorf("want the checksum to cover secrets of environment variables")
+	}
+
+	request.Annotations = &map[string]string{SecretsEnvAnnotation: "DB_PASSWORD=db-creds:pass"}
+	if err := f.ConfigureSecrets(request, deployment, existingSecrets); err == nil {
+		t.Errorf("want an error for a missing key")
+	}
+}
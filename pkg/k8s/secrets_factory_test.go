@@ -75,6 +75,16 @@ func Test_ReadFunctionSecretsSpec(t *testing.T) {
 			deployment: functionDep,
 			expected:   []string{"pullsecret", "testsecret"},
 		},
+		{
+			name: "detects and extracts secrets of environment variables",
+			req: types.FunctionDeployment{
+				Service:     "testfunc",
+				Secrets:     []string{"pullsecret"},
+				Annotations: &map[string]string{SecretsEnvAnnotation: "FILENAME=testsecret:filename"},
+			},
+			deployment: functionDep,
+			expected:   []string{"pullsecret", "testsecret"},
+		},
 	}
 
 	for _, tc := range cases {
@@ -270,3 +280,30 @@ func validateNewSecretVolumesAndMounts(t *testing.T, deployment *appsv1.Deployme
 		t.Errorf("Incorrect volume mount path: expected \"%s\", got \"%s\"", secretsMountPath, mount.MountPath)
 	}
 }
+
+func Test_FunctionFactory_ConfigureSecrets_ProjectsEveryKey(t *testing.T) {
+	f := mockFactory()
+	existingSecrets := map[string]*apiv1.Secret{
+		"tls": {Type: apiv1.SecretTypeTLS, Data: map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")}},
+	}
+
+	deployment := appsv1.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "testfunc", Image: "alpine:latest"}}
+
+	req := types.FunctionDeployment{Service: "testfunc", Secrets: []string{"tls"}}
+	if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployment.Spec.Template.Spec.Volumes) != 1 {
+		t.Fatalf("want one secrets volume, got: %+v", deployment.Spec.Template.Spec.Volumes)
+	}
+	items := deployment.Spec.Template.Spec.Volumes[0].Projected.Sources[0].Secret.Items
+	paths := map[string]bool{}
+	for _, item := range items {
+		paths[item.Path] = true
+	}
+	if len(paths) != 2 || !paths["tls.crt"] || !paths["tls.key"] {
+		t.Errorf("want tls.crt and tls.key to be projected, got: %+v", items)
+	}
+}
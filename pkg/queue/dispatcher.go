@@ -0,0 +1,355 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+	"github.com/openfaas/faas-provider/proxy"
+)
+
+const (
+	// CallbackHeader is set on an asynchronous invocation to the URL that receives
+	// the result of the invocation
+	CallbackHeader = "X-Callback-Url"
+
+	// CallIDHeader identifies an asynchronous invocation
+	CallIDHeader = "X-Call-Id"
+)
+
+// DispatcherConfig configures how queued invocations are dispatched
+type DispatcherConfig struct {
+	// MaxWorkers is the number of invocations that are dispatched at the same time
+	// across all functions, requests are left in the queue until a worker is free
+	MaxWorkers int
+
+	// MaxInflight is the number of invocations of a single function that are
+	// dispatched at the same time
+	MaxInflight int
+
+	// MaxParked is the number of dequeued requests that wait for a free slot of their
+	// function without holding a worker, requests stay in the queue once it is reached
+	MaxParked int
+
+	// MaxRetries is the number of times an invocation is retried when the function is
+	// unavailable, before the failure is sent to the callback
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, it doubles for each retry
+	RetryBackoff time.Duration
+}
+
+// Start creates a MemoryQueue from the provider's configuration and dispatches its
+// requests until stopCh is closed. Functions are invoked with the provider's proxy
+// client, so an invocation can take up to the configured read timeout.
+func Start(cfg config.BootstrapConfig, resolver proxy.BaseURLResolver, stopCh <-chan struct{}) Queue {
+	queue := NewMemoryQueue(cfg.AsyncQueueSize)
+
+	dispatcher := NewDispatcher(queue, resolver, proxy.NewProxyClientFromConfig(cfg.FaaSConfig), DispatcherConfig{
+		MaxWorkers:   cfg.AsyncMaxWorkers,
+		MaxInflight:  cfg.AsyncMaxInflight,
+		MaxParked:    cfg.AsyncQueueSize,
+		MaxRetries:   cfg.AsyncMaxRetries,
+		RetryBackoff: cfg.AsyncRetryBackoff,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go dispatcher.Run(ctx)
+
+	return queue
+}
+
+// Dispatcher invokes the functions of queued requests through the resolver and posts
+// the results to the callback URL of each request
+type Dispatcher struct {
+	queue    Queue
+	resolver proxy.BaseURLResolver
+	client   *http.Client
+	config   DispatcherConfig
+
+	workers chan struct{}
+	parking chan struct{}
+
+	lock     sync.Mutex
+	inflight map[string]int
+	parked   map[string][]*Request
+}
+
+// result is the outcome of an invocation
+type result struct {
+	status   int
+	header   http.Header
+	body     []byte
+	duration time.Duration
+}
+
+// NewDispatcher creates a Dispatcher, client is used both to invoke functions and to
+// post to callbacks
+func NewDispatcher(queue Queue, resolver proxy.BaseURLResolver, client *http.Client, config DispatcherConfig) *Dispatcher {
+	if config.MaxWorkers < 1 {
+		config.MaxWorkers = 1
+	}
+	if config.MaxInflight < 1 {
+		config.MaxInflight = 1
+	}
+	if config.MaxParked < 1 {
+		config.MaxParked = config.MaxWorkers
+	}
+
+	return &Dispatcher{
+		queue:    queue,
+		resolver: resolver,
+		client:   client,
+		config:   config,
+		workers:  make(chan struct{}, config.MaxWorkers),
+		parking:  make(chan struct{}, config.MaxParked),
+		inflight: map[string]int{},
+		parked:   map[string][]*Request{},
+	}
+}
+
+// Run dispatches queued requests until ctx is done. A worker, and room to park the
+// request, are taken before a request is dequeued, so that requests stay in the queue,
+// and new ones are rejected once it is full, while all of the workers are busy.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case d.parking <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case d.workers <- struct{}{}:
+		case <-ctx.Done():
+			<-d.parking
+			return
+		}
+
+		req, err := d.queue.Dequeue(ctx)
+		if err != nil {
+			<-d.workers
+			<-d.parking
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Unable to dequeue invocation: %s\n", err.Error())
+			continue
+		}
+
+		// a request of a function that has no free slot is parked without holding a
+		// worker, so that the other functions are still dispatched
+		if !d.acquire(req) {
+			<-d.workers
+			continue
+		}
+		<-d.parking
+
+		go d.work(ctx, req)
+	}
+}
+
+// work dispatches req, and then the parked requests of the same function that it is
+// handed the slot for, before the worker is released
+func (d *Dispatcher) work(ctx context.Context, req *Request) {
+	defer func() { <-d.workers }()
+
+	for req != nil {
+		d.dispatch(ctx, req)
+		req = d.release(req.Function)
+	}
+}
+
+// acquire takes a slot of the request's function, or parks the request when all of
+// them are taken
+func (d *Dispatcher) acquire(req *Request) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.inflight[req.Function] >= d.config.MaxInflight {
+		d.parked[req.Function] = append(d.parked[req.Function], req)
+		return false
+	}
+	d.inflight[req.Function]++
+	return true
+}
+
+// release hands the slot of a function to its oldest parked request, which is returned,
+// or frees the slot when none is parked
+func (d *Dispatcher) release(function string) *Request {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if parked := d.parked[function]; len(parked) > 0 {
+		next := parked[0]
+		parked[0] = nil
+		if len(parked) == 1 {
+			delete(d.parked, function)
+		} else {
+			d.parked[function] = parked[1:]
+		}
+		<-d.parking
+		return next
+	}
+
+	d.inflight[function]--
+	if d.inflight[function] < 1 {
+		delete(d.inflight, function)
+	}
+	return nil
+}
+
+// dispatch invokes the function of a request that holds one of its slots. Requests that
+// fail because the function is unavailable are queued again after a backoff.
+func (d *Dispatcher) dispatch(ctx context.Context, req *Request) {
+	res, err := d.invoke(ctx, req)
+
+	if retryable(res, err) && req.Attempts < d.config.MaxRetries {
+		delay := d.config.RetryBackoff * time.Duration(1<<uint(req.Attempts))
+		req.Attempts++
+
+		log.Printf("Invocation %s of %s will be retried in %s: %s\n", req.CallID, req.Function, delay, describe(res, err))
+
+		time.AfterFunc(delay, func() {
+			// the retry is dropped when the queue has filled up in the meantime, the
+			// last failure is sent back so that the caller is not left waiting
+			if enqueueErr := d.queue.Enqueue(req); enqueueErr != nil {
+				log.Printf("Dropped retry of invocation %s of %s: %s\n", req.CallID, req.Function, enqueueErr.Error())
+				d.complete(ctx, req, res, err)
+			}
+		})
+		return
+	}
+
+	log.Printf("Invocation %s of %s completed: %s\n", req.CallID, req.Function, describe(res, err))
+
+	d.complete(ctx, req, res, err)
+}
+
+// complete posts the outcome of an invocation to its callback URL, when it has one
+func (d *Dispatcher) complete(ctx context.Context, req *Request, res *result, invokeErr error) {
+	if len(req.CallbackURL) == 0 {
+		return
+	}
+
+	if err := d.callback(ctx, req, res, invokeErr); err != nil {
+		log.Printf("Callback of invocation %s of %s failed: %s\n", req.CallID, req.Function, err.Error())
+	}
+}
+
+func (d *Dispatcher) invoke(ctx context.Context, req *Request) (*result, error) {
+	functionURL, err := d.resolver.Resolve(req.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	functionURL.Path = "/" + strings.TrimPrefix(req.Path, "/")
+	functionURL.RawQuery = req.QueryString
+
+	invocation, err := http.NewRequest(req.Method, functionURL.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range req.Header {
+		invocation.Header[k] = v
+	}
+	invocation.Header.Del(CallbackHeader)
+	invocation.Header.Set(CallIDHeader, req.CallID)
+
+	start := time.Now()
+	res, err := d.client.Do(invocation.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result{
+		status:   res.StatusCode,
+		header:   res.Header,
+		body:     body,
+		duration: time.Since(start),
+	}, nil
+}
+
+// callback posts the result of an invocation to its callback URL
+func (d *Dispatcher) callback(ctx context.Context, req *Request, res *result, invokeErr error) error {
+	status := http.StatusServiceUnavailable
+	contentType := "text/plain"
+	var body []byte
+	var duration time.Duration
+
+	if invokeErr != nil {
+		body = []byte(invokeErr.Error())
+	} else {
+		status = res.status
+		body = res.body
+		duration = res.duration
+		if value := res.header.Get("Content-Type"); len(value) > 0 {
+			contentType = value
+		}
+	}
+
+	callback, err := http.NewRequest(http.MethodPost, req.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	callback.Header.Set("Content-Type", contentType)
+	callback.Header.Set(CallIDHeader, req.CallID)
+	callback.Header.Set("X-Function-Name", req.Function)
+	callback.Header.Set("X-Function-Status", strconv.Itoa(status))
+	callback.Header.Set("X-Duration-Seconds", fmt.Sprintf("%f", duration.Seconds()))
+
+	callbackRes, err := d.client.Do(callback.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	callbackRes.Body.Close()
+
+	if callbackRes.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", callbackRes.StatusCode)
+	}
+	return nil
+}
+
+// retryable returns true when the function could not be reached or was overloaded,
+// errors returned by the function itself are not retried
+func retryable(res *result, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch res.status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func describe(res *result, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d in %s", res.status, res.duration)
+}
@@ -0,0 +1,302 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+type callback struct {
+	header http.Header
+	body   string
+}
+
+// startDispatcher dispatches a new queue to function and returns the URL of a callback
+// server that forwards the callbacks it receives to the returned channel
+func startDispatcher(function http.HandlerFunc, config DispatcherConfig) (*MemoryQueue, string, chan callback, func()) {
+	q := NewMemoryQueue(10)
+	callbackURL, callbacks, stop := dispatchQueue(q, function, config)
+	return q, callbackURL, callbacks, stop
+}
+
+// dispatchQueue dispatches q to function in the same way as startDispatcher
+func dispatchQueue(q Queue, function http.HandlerFunc, config DispatcherConfig) (string, chan callback, func()) {
+	callbacks := make(chan callback, 10)
+
+	functionSrv := httptest.NewServer(function)
+	callbackSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		callbacks <- callback{header: r.Header, body: string(body)}
+	}))
+
+	functionURL, _ := url.Parse(functionSrv.URL)
+	d := NewDispatcher(q, staticResolver{url: *functionURL}, http.DefaultClient, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx)
+
+	return callbackSrv.URL, callbacks, func() {
+		cancel()
+		functionSrv.Close()
+		callbackSrv.Close()
+	}
+}
+
+func waitForCallback(t *testing.T, callbacks chan callback) callback {
+	select {
+	case c := <-callbacks:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("want callback, got none")
+	}
+	return callback{}
+}
+
+func Test_Dispatcher_RetriesUnavailableFunction(t *testing.T) {
+	var calls int32
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/resize" || r.URL.RawQuery != "width=10" {
+			t.Errorf("want /resize?width=10, got: %s", r.URL.String())
+		}
+		if value := r.Header.Get(CallbackHeader); len(value) > 0 {
+			t.Errorf("want %s to be removed, got: %s", CallbackHeader, value)
+		}
+		if value := r.Header.Get(CallIDHeader); value != "abc" {
+			t.Errorf("want %s abc, got: %s", CallIDHeader, value)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}, DispatcherConfig{MaxInflight: 1, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	defer stop()
+
+	q.Enqueue(&Request{
+		CallID:      "abc",
+		Function:    "resizer",
+		Method:      http.MethodPost,
+		Path:        "resize",
+		QueryString: "width=10",
+		Header:      http.Header{CallbackHeader: []string{callbackURL}},
+		CallbackURL: callbackURL,
+	})
+
+	c := waitForCallback(t, callbacks)
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("want 3 invocations, got: %d", got)
+	}
+	if c.body != `{"ok":true}` {
+		t.Errorf("want callback body of the function, got: %s", c.body)
+	}
+
+	want := map[string]string{
+		CallIDHeader:        "abc",
+		"X-Function-Name":   "resizer",
+		"X-Function-Status": "200",
+		"Content-Type":      "application/json",
+	}
+	for k, v := range want {
+		if got := c.header.Get(k); got != v {
+			t.Errorf("want callback header %s: %s, got: %s", k, v, got)
+		}
+	}
+}
+
+func Test_Dispatcher_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}, DispatcherConfig{MaxInflight: 1, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	defer stop()
+
+	q.Enqueue(&Request{CallID: "abc", Function: "resizer", Method: http.MethodGet, CallbackURL: callbackURL})
+
+	c := waitForCallback(t, callbacks)
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("want 3 invocations, got: %d", got)
+	}
+	if got := c.header.Get("X-Function-Status"); got != "502" {
+		t.Errorf("want callback status 502, got: %s", got)
+	}
+}
+
+func Test_Dispatcher_DoesNotRetryFunctionErrors(t *testing.T) {
+	var calls int32
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}, DispatcherConfig{MaxInflight: 1, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	defer stop()
+
+	q.Enqueue(&Request{CallID: "abc", Function: "resizer", Method: http.MethodGet, CallbackURL: callbackURL})
+
+	c := waitForCallback(t, callbacks)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("want 1 invocation, got: %d", got)
+	}
+	if got := c.header.Get("X-Function-Status"); got != "500" {
+		t.Errorf("want callback status 500, got: %s", got)
+	}
+}
+
+func Test_Dispatcher_LimitsInflightPerFunction(t *testing.T) {
+	var inflight, peak int32
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+	}, DispatcherConfig{MaxWorkers: 10, MaxInflight: 2, MaxRetries: 0})
+	defer stop()
+
+	for i := 0; i < 6; i++ {
+		q.Enqueue(&Request{CallID: "abc", Function: "resizer", Method: http.MethodGet, CallbackURL: callbackURL})
+	}
+	for i := 0; i < 6; i++ {
+		waitForCallback(t, callbacks)
+	}
+
+	if got := atomic.LoadInt32(&peak); got != 2 {
+		t.Errorf("want at most 2 concurrent invocations, got: %d", got)
+	}
+}
+
+func Test_Dispatcher_LeavesRequestsQueuedWhileWorkersAreBusy(t *testing.T) {
+	release := make(chan struct{})
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}, DispatcherConfig{MaxWorkers: 2, MaxInflight: 10, MaxRetries: 0})
+	defer stop()
+
+	for i := 0; i < 5; i++ {
+		q.Enqueue(&Request{CallID: "abc", Function: "resizer", Method: http.MethodGet, CallbackURL: callbackURL})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := q.Len(); got != 3 {
+		t.Errorf("want 3 requests to stay queued, got: %d", got)
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		waitForCallback(t, callbacks)
+	}
+}
+
+// fullQueue returns a single request and then rejects every request that is enqueued
+type fullQueue struct {
+	requests chan *Request
+}
+
+func (q *fullQueue) Enqueue(req *Request) error {
+	return ErrQueueFull
+}
+
+func (q *fullQueue) Dequeue(ctx context.Context) (*Request, error) {
+	select {
+	case req := <-q.requests:
+		return req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func Test_Dispatcher_SendsFailureWhenRetryIsDropped(t *testing.T) {
+	var calls int32
+	q := &fullQueue{requests: make(chan *Request, 1)}
+	callbackURL, callbacks, stop := dispatchQueue(q, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, DispatcherConfig{MaxInflight: 1, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	defer stop()
+
+	q.requests <- &Request{CallID: "abc", Function: "resizer", Method: http.MethodGet, CallbackURL: callbackURL}
+
+	c := waitForCallback(t, callbacks)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("want 1 invocation, got: %d", got)
+	}
+	if got := c.header.Get("X-Function-Status"); got != "503" {
+		t.Errorf("want callback status 503, got: %s", got)
+	}
+}
+
+func Test_Dispatcher_DispatchesOtherFunctionsWhileOneIsSaturated(t *testing.T) {
+	release := make(chan struct{})
+	q, callbackURL, callbacks, stop := startDispatcher(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}, DispatcherConfig{MaxWorkers: 2, MaxInflight: 1, MaxParked: 10, MaxRetries: 0})
+	defer stop()
+
+	for i := 0; i < 5; i++ {
+		q.Enqueue(&Request{CallID: "slow", Function: "slow", Method: http.MethodGet, Path: "slow", CallbackURL: callbackURL})
+	}
+	q.Enqueue(&Request{CallID: "fast", Function: "fast", Method: http.MethodGet, Path: "fast", CallbackURL: callbackURL})
+
+	c := waitForCallback(t, callbacks)
+	if got := c.header.Get("X-Function-Name"); got != "fast" {
+		t.Errorf("want fast to complete while slow is saturated, got: %s", got)
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		waitForCallback(t, callbacks)
+	}
+}
+
+func Test_Dispatcher_ReleasesSlotsOfIdleFunctions(t *testing.T) {
+	d := NewDispatcher(NewMemoryQueue(1), staticResolver{}, http.DefaultClient, DispatcherConfig{MaxInflight: 1, MaxParked: 1})
+
+	first := &Request{CallID: "1", Function: "resizer"}
+	second := &Request{CallID: "2", Function: "resizer"}
+
+	if !d.acquire(first) {
+		t.Fatalf("want a free slot for the first request")
+	}
+	d.parking <- struct{}{}
+	if d.acquire(second) {
+		t.Fatalf("want the second request to be parked")
+	}
+
+	if next := d.release("resizer"); next != second {
+		t.Fatalf("want the slot to be handed to the parked request, got: %v", next)
+	}
+	if next := d.release("resizer"); next != nil {
+		t.Fatalf("want no parked request, got: %v", next)
+	}
+
+	if len(d.inflight) != 0 || len(d.parked) != 0 {
+		t.Errorf("want no state left for idle functions, got: %v %v", d.inflight, d.parked)
+	}
+}
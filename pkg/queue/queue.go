@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrQueueFull is returned by Enqueue when the queue has no capacity left
+var ErrQueueFull = errors.New("queue is full")
+
+// Request is an invocation of a function that is dispatched asynchronously
+type Request struct {
+	// CallID identifies the invocation and is passed to the function and the callback
+	CallID string `json:"callId"`
+
+	// Function is the name of the function in the form <function_name>[.<namespace>]
+	Function string `json:"function"`
+
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	QueryString string      `json:"queryString"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+
+	// CallbackURL receives the result of the invocation when it is set
+	CallbackURL string `json:"callbackUrl,omitempty"`
+
+	// Attempts is the number of times that the invocation was retried
+	Attempts int `json:"attempts"`
+
+	Enqueued time.Time `json:"enqueued"`
+}
+
+// Queue holds asynchronous invocations until they are dispatched. Only the in-memory
+// implementation is bundled, a durable backend such as NATS Streaming can be used by
+// implementing this interface.
+type Queue interface {
+	// Enqueue adds a request to the queue, ErrQueueFull is returned when the queue
+	// has no capacity left
+	Enqueue(req *Request) error
+
+	// Dequeue blocks until a request is available or ctx is done
+	Dequeue(ctx context.Context) (*Request, error)
+}
+
+// MemoryQueue is a bounded Queue that is held in memory, queued requests are lost
+// when the provider restarts
+type MemoryQueue struct {
+	requests chan *Request
+}
+
+// NewMemoryQueue creates a MemoryQueue that holds up to size requests
+func NewMemoryQueue(size int) *MemoryQueue {
+	return &MemoryQueue{
+		requests: make(chan *Request, size),
+	}
+}
+
+// Enqueue adds a request to the queue without blocking
+func (q *MemoryQueue) Enqueue(req *Request) error {
+	select {
+	case q.requests <- req:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Dequeue returns the oldest request in the queue
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*Request, error) {
+	select {
+	case req := <-q.requests:
+		return req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Len returns the number of queued requests
+func (q *MemoryQueue) Len() int {
+	return len(q.requests)
+}
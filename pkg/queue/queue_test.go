@@ -0,0 +1,47 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_MemoryQueue_Full(t *testing.T) {
+	q := NewMemoryQueue(1)
+
+	if err := q.Enqueue(&Request{CallID: "1"}); err != nil {
+		t.Fatalf("want first request to be queued, got: %s", err)
+	}
+	if err := q.Enqueue(&Request{CallID: "2"}); err != ErrQueueFull {
+		t.Fatalf("want %s, got: %v", ErrQueueFull, err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("want 1 queued request, got: %d", q.Len())
+	}
+}
+
+func Test_MemoryQueue_Dequeue(t *testing.T) {
+	q := NewMemoryQueue(2)
+	q.Enqueue(&Request{CallID: "1"})
+	q.Enqueue(&Request{CallID: "2"})
+
+	for _, want := range []string{"1", "2"} {
+		req, err := q.Dequeue(context.Background())
+		if err != nil {
+			t.Fatalf("want request %s, got: %s", want, err)
+		}
+		if req.CallID != want {
+			t.Errorf("want request %s, got: %s", want, req.CallID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Dequeue(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %s from empty queue, got: %v", context.DeadlineExceeded, err)
+	}
+}
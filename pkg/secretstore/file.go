@@ -0,0 +1,200 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package secretstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileSecret is a secret as it is encoded in the file
+type fileSecret struct {
+	Type string            `json:"type,omitempty"`
+	Data map[string][]byte `json:"data"`
+}
+
+// File is a Store in a single file that is encrypted with AES-256-GCM. The file holds
+// the nonce followed by the sealed JSON of the secrets, by namespace and then by name.
+// It is read for each call and written to a temporary file that replaces it, so that
+// it can be copied into clusters without network access to a secret manager.
+type File struct {
+	Path string
+
+	aead cipher.AEAD
+	lock sync.Mutex
+}
+
+// NewFile returns a File store at path, with the key in keyFile. The key is 32 bytes,
+// either raw or base64 encoded. The file is created by the first Put.
+func NewFile(path, keyFile string) (*File, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the key of the secret store: %s", err.Error())
+	}
+
+	key := data
+	if len(key) != 32 {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("the key of the secret store must be 32 bytes, raw or base64")
+		}
+		key = decoded
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Path: path, aead: aead}, nil
+}
+
+// Backend returns file
+func (f *File) Backend() string {
+	return BackendFile
+}
+
+// Get returns the secret
+func (f *File) Get(namespace, name string) (*Secret, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	secrets, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := secrets[namespace][name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Secret{Name: name, Type: secret.Type, Data: secret.Data}, nil
+}
+
+// Put creates the secret or replaces all of its keys
+func (f *File) Put(namespace string, secret Secret) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := secrets[namespace]; !ok {
+		secrets[namespace] = map[string]fileSecret{}
+	}
+	secrets[namespace][secret.Name] = fileSecret{Type: secret.Type, Data: secret.Data}
+
+	return f.write(secrets)
+}
+
+// Delete removes the secret
+func (f *File) Delete(namespace, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := secrets[namespace][name]; !ok {
+		return ErrNotFound
+	}
+	delete(secrets[namespace], name)
+
+	return f.write(secrets)
+}
+
+// List returns the names of the secrets of namespace
+func (f *File) List(namespace string) ([]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	secrets, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range secrets[namespace] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// read decrypts the secrets of the file, a file that does not exist has none
+func (f *File) read() (map[string]map[string]fileSecret, error) {
+	secrets := map[string]map[string]fileSecret{}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the secret store: %s", err.Error())
+	}
+
+	size := f.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("the secret store %s is not encrypted", f.Path)
+	}
+
+	plain, err := f.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the secret store %s, check the key: %s", f.Path, err.Error())
+	}
+
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("unable to decode the secret store %s: %s", f.Path, err.Error())
+	}
+	return secrets, nil
+}
+
+// write encrypts the secrets with a new nonce and replaces the file
+func (f *File) write(secrets map[string]map[string]fileSecret) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := f.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write the secret store: %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write the secret store: %s", err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write the secret store: %s", err.Error())
+	}
+
+	return os.Rename(tmp.Name(), f.Path)
+}
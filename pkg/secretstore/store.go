@@ -0,0 +1,67 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package secretstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+)
+
+const (
+	// BackendVault keeps function secrets in the KV version 2 secrets engine of Vault,
+	// or of a server with the same HTTP API
+	BackendVault = "vault"
+	// BackendFile keeps function secrets in a file encrypted with AES-256-GCM, for
+	// clusters without access to a secret manager
+	BackendFile = "file"
+)
+
+// ErrNotFound is returned when a secret is not in the store
+var ErrNotFound = errors.New("secret not found")
+
+// Secret is a function secret as it is kept in a store
+type Secret struct {
+	Name string
+	// Type is the type of the Kubernetes secret, Opaque when it is empty
+	Type string
+	Data map[string][]byte
+}
+
+// Store holds the values of function secrets outside of Kubernetes. The Kubernetes
+// Secrets that functions mount are materialised from it when they are deployed.
+type Store interface {
+	// Backend is the name of the store, such as vault
+	Backend() string
+	// Get returns the secret, or ErrNotFound
+	Get(namespace, name string) (*Secret, error)
+	// Put creates the secret or replaces all of its keys
+	Put(namespace string, secret Secret) error
+	// Delete removes the secret, or returns ErrNotFound
+	Delete(namespace, name string) error
+	// List returns the names of the secrets of namespace
+	List(namespace string) ([]string, error)
+}
+
+// New returns the store that is configured in cfg, or nil when function secrets are
+// kept in Kubernetes Secrets
+func New(cfg config.BootstrapConfig) (Store, error) {
+	switch cfg.SecretStore {
+	case "":
+		return nil, nil
+	case BackendVault:
+		if len(cfg.SecretStoreURL) == 0 {
+			return nil, fmt.Errorf("secret_store_url is required for the %s secret store", BackendVault)
+		}
+		return NewVault(cfg.SecretStoreURL, cfg.SecretStoreMount, cfg.SecretStoreTokenFile, 10*time.Second), nil
+	case BackendFile:
+		if len(cfg.SecretStoreURL) == 0 || len(cfg.SecretStoreKeyFile) == 0 {
+			return nil, fmt.Errorf("secret_store_url and secret_store_key_file are required for the %s secret store", BackendFile)
+		}
+		return NewFile(cfg.SecretStoreURL, cfg.SecretStoreKeyFile)
+	}
+	return nil, fmt.Errorf("unknown secret store %q, use %s or %s", cfg.SecretStore, BackendVault, BackendFile)
+}
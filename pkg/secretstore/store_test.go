@@ -0,0 +1,207 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package secretstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault is a stand-in for the KV version 2 secrets engine of Vault
+type fakeVault struct {
+	token  string
+	lock   sync.Mutex
+	fields map[string]map[string]string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != v.token {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			fields, ok := v.fields[path]
+			if !ok {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": fields}})
+		case http.MethodPost:
+			req := struct {
+				Data map[string]string `json:"data"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&req)
+			v.fields[path] = req.Data
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+		switch {
+		case r.Method == http.MethodDelete:
+			delete(v.fields, path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Query().Get("list") == "true":
+			keys := []string{}
+			for key := range v.fields {
+				if strings.HasPrefix(key, path+"/") {
+					keys = append(keys, strings.TrimPrefix(key, path+"/"))
+				}
+			}
+			if len(keys) == 0 {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": append(keys, "nested/")}})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	tls := Secret{
+		Name: "tls",
+		Type: "kubernetes.io/tls",
+		Data: map[string][]byte{"tls.crt": []byte("certificate"), "tls.key": {0xff, 0x00, 0xfe}},
+	}
+
+	if _, err := store.Get("openfaas-fn", "tls"); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got: %v", err)
+	}
+	if names, err := store.List("openfaas-fn"); err != nil || len(names) != 0 {
+		t.Fatalf("want no secrets, got: %v, %v", names, err)
+	}
+
+	if err := store.Put("openfaas-fn", tls); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("openfaas-fn", Secret{Name: "db-password", Data: map[string][]byte{"db-password": []byte("s3cr3t")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get("openfaas-fn", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, tls) {
+		t.Errorf("want %+v, got: %+v", tls, *got)
+	}
+
+	names, err := store.List("openfaas-fn")
+	if err != nil || !reflect.DeepEqual(names, []string{"db-password", "tls"}) {
+		t.Errorf("want the names of both secrets, got: %v, %v", names, err)
+	}
+	if names, _ := store.List("team-a"); len(names) != 0 {
+		t.Errorf("want no secrets in another namespace, got: %v", names)
+	}
+
+	if err := store.Delete("openfaas-fn", "tls"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("openfaas-fn", "tls"); err != ErrNotFound {
+		t.Errorf("want the secret to be deleted, got: %v", err)
+	}
+	if err := store.Delete("openfaas-fn", "tls"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got: %v", err)
+	}
+}
+
+func Test_Vault(t *testing.T) {
+	vault := &fakeVault{token: "root", fields: map[string]map[string]string{}}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("root\n"), 0600)
+
+	testStore(t, NewVault(server.URL+"/", "secret", tokenFile, time.Second))
+
+	t.Run("values are readable in Vault", func(t *testing.T) {
+		store := NewVault(server.URL, "secret", tokenFile, time.Second)
+		store.Put("openfaas-fn", Secret{Name: "tls", Type: "kubernetes.io/tls", Data: map[string][]byte{"tls.crt": []byte("certificate"), "tls.key": {0xff}}})
+
+		want := map[string]string{"tls.crt": "certificate", "tls.key": "/w==", "@base64": "tls.key", "@type": "kubernetes.io/tls"}
+		if got := vault.fields["openfaas/openfaas-fn/tls"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("want fields %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("the token is required", func(t *testing.T) {
+		store := NewVault(server.URL, "secret", "", time.Second)
+		if _, err := store.Get("openfaas-fn", "tls"); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("want a permission error, got: %v", err)
+		}
+	})
+}
+
+func Test_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	ioutil.WriteFile(keyFile, []byte("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n"), 0600)
+	path := filepath.Join(dir, "secrets.enc")
+
+	store, err := NewFile(path, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	t.Run("the file is encrypted", func(t *testing.T) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("s3cr3t")) || bytes.Contains(data, []byte("db-password")) {
+			t.Errorf("want no plain text in the file")
+		}
+	})
+
+	t.Run("another key can not read it", func(t *testing.T) {
+		otherKey := filepath.Join(dir, "other")
+		ioutil.WriteFile(otherKey, []byte("fedcba9876543210fedcba9876543210"), 0600)
+
+		other, err := NewFile(path, otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.Get("openfaas-fn", "db-password"); err == nil || err == ErrNotFound {
+			t.Errorf("want an error to decrypt, got: %v", err)
+		}
+	})
+
+	t.Run("short keys are rejected", func(t *testing.T) {
+		ioutil.WriteFile(keyFile, []byte("short"), 0600)
+		if _, err := NewFile(path, keyFile); err == nil {
+			t.Errorf("want an error for a short key")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package secretstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// vaultPrefix is the path under the mount where function secrets are kept, by
+	// namespace and then by name
+	vaultPrefix = "openfaas"
+
+	// vaultTypeField holds the type of the Kubernetes secret. Field names that start
+	// with @ can not be keys of a Kubernetes secret.
+	vaultTypeField = "@type"
+	// vaultBase64Field lists the keys whose values are base64, for values that are
+	// not text
+	vaultBase64Field = "@base64"
+)
+
+// Vault is a Store on the KV version 2 secrets engine of Vault. Each function secret is
+// kept at <mount>/openfaas/<namespace>/<name> with a field per key. Values that are
+// not text are base64 encoded.
+type Vault struct {
+	URL       string
+	Mount     string
+	TokenFile string
+	Client    *http.Client
+}
+
+// NewVault returns a Vault store for the server at url. The token is read from
+// tokenFile for each call, so that it can be rotated.
+func NewVault(url, mount, tokenFile string, timeout time.Duration) *Vault {
+	return &Vault{
+		URL:       strings.TrimSuffix(url, "/"),
+		Mount:     strings.Trim(mount, "/"),
+		TokenFile: tokenFile,
+		Client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Backend returns vault
+func (v *Vault) Backend() string {
+	return BackendVault
+}
+
+// Get reads the latest version of the secret
+func (v *Vault) Get(namespace, name string) (*Secret, error) {
+	res := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+
+	if err := v.do(http.MethodGet, v.path("data", namespace, name), nil, &res); err != nil {
+		return nil, err
+	}
+
+	// a secret whose latest version was deleted has no data
+	if res.Data.Data == nil {
+		return nil, ErrNotFound
+	}
+
+	encoded := map[string]bool{}
+	for _, key := range strings.Split(res.Data.Data[vaultBase64Field], ",") {
+		encoded[key] = len(key) > 0
+	}
+
+	secret := &Secret{
+		Name: name,
+		Type: res.Data.Data[vaultTypeField],
+		Data: map[string][]byte{},
+	}
+	for key, value := range res.Data.Data {
+		if strings.HasPrefix(key, "@") {
+			continue
+		}
+		if !encoded[key] {
+			secret.Data[key] = []byte(value)
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s of secret %s.%s is not base64: %s", key, name, namespace, err.Error())
+		}
+		secret.Data[key] = data
+	}
+
+	return secret, nil
+}
+
+// Put writes a new version of the secret
+func (v *Vault) Put(namespace string, secret Secret) error {
+	fields := map[string]string{}
+	encoded := []string{}
+	for key, value := range secret.Data {
+		if utf8.Valid(value) {
+			fields[key] = string(value)
+			continue
+		}
+		fields[key] = base64.StdEncoding.EncodeToString(value)
+		encoded = append(encoded, key)
+	}
+	if len(encoded) > 0 {
+		sort.Strings(encoded)
+		fields[vaultBase64Field] = strings.Join(encoded, ",")
+	}
+	if len(secret.Type) > 0 {
+		fields[vaultTypeField] = secret.Type
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"data": fields})
+	if err != nil {
+		return err
+	}
+	return v.do(http.MethodPost, v.path("data", namespace, secret.Name), body, nil)
+}
+
+// Delete removes all versions of the secret
+func (v *Vault) Delete(namespace, name string) error {
+	if _, err := v.Get(namespace, name); err != nil {
+		return err
+	}
+	return v.do(http.MethodDelete, v.path("metadata", namespace, name), nil, nil)
+}
+
+// List returns the names of the secrets of namespace
+func (v *Vault) List(namespace string) ([]string, error) {
+	res := struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}{}
+
+	err := v.do(http.MethodGet, v.path("metadata", namespace, "")+"?list=true", nil, &res)
+	if err == ErrNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, key := range res.Data.Keys {
+		// keys that end with / are folders, not secrets
+		if !strings.HasSuffix(key, "/") {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (v *Vault) path(kind, namespace, name string) string {
+	path := fmt.Sprintf("%s/v1/%s/%s/%s/%s", v.URL, v.Mount, kind, vaultPrefix, url.PathEscape(namespace))
+	if len(name) > 0 {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+// do calls the Vault API and decodes the response into out, when it is set. A 404
+// is returned as ErrNotFound.
+func (v *Vault) do(method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if len(v.TokenFile) > 0 {
+		token, err := ioutil.ReadFile(v.TokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read the token of the secret store: %s", err.Error())
+		}
+		req.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach the secret store: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	data, _ := ioutil.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("secret store returned %d for %s: %s", res.StatusCode, method, strings.TrimSpace(string(data)))
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -8,6 +8,9 @@ import (
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
+	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	"github.com/openfaas/faas-provider/types"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -15,7 +18,9 @@ import (
 	"k8s.io/klog"
 )
 
-func makeApplyHandler(defaultNamespace string, client clientset.Interface) http.HandlerFunc {
+func makeApplyHandler(defaultNamespace string, client clientset.Interface, factory k8s.FunctionFactory) http.HandlerFunc {
+	secrets := factory.SecretsClient()
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if r.Body != nil {
@@ -37,6 +42,38 @@ func makeApplyHandler(defaultNamespace string, client clientset.Interface) http.
 			namespace = req.Namespace
 		}
 
+		if err := handlers.ValidateFunctionRequest(r.Context(), &req, namespace, factory); err != nil {
+			klog.Infof("Deployment request for %s.%s rejected: %s\n", req.Service, namespace, err.Error())
+			handlers.WriteValidationError(w, err)
+			return
+		}
+
+		if handlers.IsDryRun(r) {
+			var annotations map[string]string
+			if req.Annotations != nil {
+				annotations = *req.Annotations
+			}
+
+			existingSecrets, err := secrets.GetSecrets(namespace, k8s.RequiredSecrets(req.Secrets, annotations))
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(fmt.Sprintf("Error fetching secrets: %s", err.Error())))
+				return
+			}
+
+			function := &faasv1.Function{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      req.Service,
+					Namespace: namespace,
+				},
+				Spec: toFunctionSpec(req),
+			}
+
+			deployment, service := controller.RenderFunction(function, existingSecrets, controller.FunctionFactory{Factory: factory})
+			handlers.WriteDryRun(w, namespace, deployment, service)
+			return
+		}
+
 		opts := metav1.GetOptions{}
 		got, err := client.OpenfaasV1().Functions(namespace).Get(r.Context(), req.Service, opts)
 		miss := false
@@ -60,7 +97,8 @@ func makeApplyHandler(defaultNamespace string, client clientset.Interface) http.
 
 			if _, err = client.OpenfaasV1().Functions(namespace).
 				Update(r.Context(), updated, metav1.UpdateOptions{}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				status, _ := handlers.ProcessErrorReasons(err)
+				w.WriteHeader(status)
 				w.Write([]byte(fmt.Sprintf("Error updating function: %s", err.Error())))
 				return
 			}
@@ -76,7 +114,8 @@ func makeApplyHandler(defaultNamespace string, client clientset.Interface) http.
 
 			if _, err = client.OpenfaasV1().Functions(namespace).
 				Create(r.Context(), newFunc, metav1.CreateOptions{}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				status, _ := handlers.ProcessErrorReasons(err)
+				w.WriteHeader(status)
 				w.Write([]byte(fmt.Sprintf("Error creating function: %s", err.Error())))
 				return
 			}
@@ -9,11 +9,24 @@ import (
 	"testing"
 
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 
 	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
+func testFactory(objects ...runtime.Object) k8s.FunctionFactory {
+	return k8s.NewFunctionFactory(fake.NewSimpleClientset(objects...), k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+}
+
 func Test_makeApplyHandler(t *testing.T) {
 	namespace := "openfaas-fn"
 	createVal := "test1"
@@ -29,7 +42,11 @@ func Test_makeApplyHandler(t *testing.T) {
 	}
 
 	kube := clientset.NewSimpleClientset()
-	applyHandler := makeApplyHandler(namespace, kube).ServeHTTP
+	factory := testFactory(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: createVal, Namespace: namespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: updateVal, Namespace: namespace}},
+	)
+	applyHandler := makeApplyHandler(namespace, kube, factory).ServeHTTP
 
 	// test create fn
 	fnJson, _ := json.Marshal(fn)
@@ -113,3 +130,82 @@ func Test_makeApplyHandler(t *testing.T) {
 		t.Errorf("expected secret '%s' got: '%s'", updateVal, updatedFunction.Spec.Secrets[0])
 	}
 }
+
+func Test_makeApplyHandler_InvalidRequest(t *testing.T) {
+	namespace := "openfaas-fn"
+	fn := types.FunctionDeployment{
+		Service: "nodeinfo",
+		Image:   "functions/nodeinfo",
+		Limits:  &types.FunctionResources{Memory: "lots"},
+		Secrets: []string{"missing"},
+	}
+
+	kube := clientset.NewSimpleClientset()
+	applyHandler := makeApplyHandler(namespace, kube, testFactory()).ServeHTTP
+
+	fnJson, _ := json.Marshal(fn)
+	req := httptest.NewRequest("POST", "http://system/functions", bytes.NewBuffer(fnJson))
+	w := httptest.NewRecorder()
+
+	applyHandler(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status code '%d', got '%d'", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	validationErr := handlers.ValidationError{}
+	if err := json.NewDecoder(resp.Body).Decode(&validationErr); err != nil {
+		t.Fatalf("error decoding validation errors: %v", err)
+	}
+
+	if len(validationErr.Errors) != 2 {
+		t.Errorf("expected 2 field errors, got: %v", validationErr.Errors)
+	}
+
+	if _, err := kube.OpenfaasV1().Functions(namespace).Get(context.TODO(), fn.Service, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected invalid function not to be created")
+	}
+}
+
+func Test_makeApplyHandler_DryRun(t *testing.T) {
+	namespace := "openfaas-fn"
+	fn := types.FunctionDeployment{
+		Service: "nodeinfo",
+		Image:   "functions/nodeinfo",
+	}
+
+	kube := clientset.NewSimpleClientset()
+	applyHandler := makeApplyHandler(namespace, kube, testFactory()).ServeHTTP
+
+	fnJson, _ := json.Marshal(fn)
+	req := httptest.NewRequest("POST", "http://system/functions?dryRun=true", bytes.NewBuffer(fnJson))
+	w := httptest.NewRecorder()
+
+	applyHandler(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code '%d', got '%d'", http.StatusOK, resp.StatusCode)
+	}
+
+	rendered := struct {
+		Deployment appsv1.Deployment `json:"deployment"`
+		Service    corev1.Service    `json:"service"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&rendered); err != nil {
+		t.Fatalf("error decoding dry-run response: %v", err)
+	}
+
+	if rendered.Deployment.Spec.Template.Spec.Containers[0].Image != fn.Image {
+		t.Errorf("expected image '%s' got: '%s'", fn.Image, rendered.Deployment.Spec.Template.Spec.Containers[0].Image)
+	}
+
+	if rendered.Service.Name != fn.Service {
+		t.Errorf("expected service '%s' got: '%s'", fn.Service, rendered.Service.Name)
+	}
+
+	if _, err := kube.OpenfaasV1().Functions(namespace).Get(context.TODO(), fn.Service, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected dry-run not to create the function")
+	}
+}
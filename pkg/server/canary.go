@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// makeCanaryPromoteHandler sets the spec of the Function to the spec that its canary was
+// last deployed with, then deletes the canary. The request is built and validated in
+// the same way as by the REST API, so that the image is pinned to the canary's digest.
+func makeCanaryPromoteHandler(defaultNamespace string, client clientset.Interface, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		namespace := defaultNamespace
+		if val := r.URL.Query().Get("namespace"); len(val) > 0 {
+			namespace = val
+		}
+
+		if namespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		functions := client.OpenfaasV1().Functions(namespace)
+
+		canary, err := functions.Get(r.Context(), k8s.CanaryName(functionName), metav1.GetOptions{})
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		req, err := handlers.ReadCanaryPromoteRequest(r.Context(), namespace, functionName, factory)
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := handlers.ValidateFunctionRequest(r.Context(), req, namespace, factory); err != nil {
+			klog.Infof("Promotion of canary for %s.%s rejected: %s\n", functionName, namespace, err.Error())
+			handlers.WriteValidationError(w, err)
+			return
+		}
+
+		got, err := functions.Get(r.Context(), functionName, metav1.GetOptions{})
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		updated := got.DeepCopy()
+		updated.Spec = toFunctionSpec(*req)
+
+		if _, err := functions.Update(r.Context(), updated, metav1.UpdateOptions{}); err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(fmt.Sprintf("Error updating function: %s", err.Error())))
+			return
+		}
+
+		if err := functions.Delete(r.Context(), canary.Name, metav1.DeleteOptions{}); err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(fmt.Sprintf("Canary promoted, but unable to delete it: %s", err.Error())))
+			return
+		}
+
+		klog.Infof("Canary promoted: %s.%s to %s\n", functionName, namespace, updated.Spec.Image)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// makeCanaryAbortHandler deletes the canary Function
+func makeCanaryAbortHandler(defaultNamespace string, client clientset.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		namespace := defaultNamespace
+		if val := r.URL.Query().Get("namespace"); len(val) > 0 {
+			namespace = val
+		}
+
+		if namespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		err := client.OpenfaasV1().Functions(namespace).
+			Delete(r.Context(), k8s.CanaryName(functionName), metav1.DeleteOptions{})
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		klog.Infof("Canary aborted: %s.%s\n", functionName, namespace)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_makeCanaryPromoteHandler(t *testing.T) {
+	namespace := "openfaas-fn"
+
+	cases := []struct {
+		name      string
+		namespace string
+		secrets   []string
+		status    int
+		image     string
+	}{
+		{name: "pinned to the canary digest", status: http.StatusAccepted, image: "functions/nodeinfo@sha256:2c1b"},
+		{name: "invalid canary spec", secrets: []string{"missing"}, status: http.StatusBadRequest, image: "functions/nodeinfo:1"},
+		{name: "kube-system", namespace: "kube-system", status: http.StatusUnauthorized, image: "functions/nodeinfo:1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			canaryName := k8s.CanaryName("nodeinfo")
+
+			client := clientset.NewSimpleClientset(
+				&faasv1.Function{
+					ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: namespace},
+					Spec:       faasv1.FunctionSpec{Name: "nodeinfo", Image: "functions/nodeinfo:1"},
+				},
+				&faasv1.Function{
+					ObjectMeta: metav1.ObjectMeta{Name: canaryName, Namespace: namespace, UID: "canary"},
+					Spec:       faasv1.FunctionSpec{Name: canaryName, Image: "functions/nodeinfo:2"},
+				},
+			)
+			factory := testFactory(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: canaryName + "-1", Namespace: namespace, Labels: map[string]string{"faas_function": canaryName}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: canaryName, Image: "functions/nodeinfo:2"}}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+					Name:    canaryName,
+					ImageID: "docker-pullable://functions/nodeinfo@sha256:2c1b",
+				}}},
+			})
+
+			// the controller records the canary when it is applied, and fills in the
+			// digest when it records the canary again
+			canary := types.FunctionDeployment{
+				Service:     canaryName,
+				Image:       "functions/nodeinfo:2",
+				Secrets:     tc.secrets,
+				Annotations: &map[string]string{k8s.CanaryWeightAnnotation: "10"},
+			}
+			owner := metav1.OwnerReference{Kind: "Function", Name: canaryName, UID: "canary"}
+			for i := 0; i < 2; i++ {
+				if _, err := factory.RecordRevision(context.TODO(), namespace, canary, owner); err != nil {
+					t.Fatalf("unable to record revision: %s", err)
+				}
+			}
+
+			url := "http://system/function/nodeinfo/canary/promote"
+			if len(tc.namespace) > 0 {
+				url += "?namespace=" + tc.namespace
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, url, nil)
+			makeCanaryPromoteHandler(namespace, client, factory).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"name": "nodeinfo"}))
+
+			if w.Code != tc.status {
+				t.Fatalf("want status code '%d', got '%d': %s", tc.status, w.Code, w.Body.String())
+			}
+
+			function, err := client.OpenfaasV1().Functions(namespace).Get(context.TODO(), "nodeinfo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("want Function to exist, got: %s", err)
+			}
+
+			if function.Spec.Image != tc.image {
+				t.Errorf("want image %s, got: %s", tc.image, function.Spec.Image)
+			}
+
+			_, err = client.OpenfaasV1().Functions(namespace).Get(context.TODO(), canaryName, metav1.GetOptions{})
+			if tc.status != http.StatusAccepted {
+				if err != nil {
+					t.Errorf("want canary to be kept, got: %s", err)
+				}
+				return
+			}
+
+			if !errors.IsNotFound(err) {
+				t.Errorf("want canary to be deleted, got: %v", err)
+			}
+
+			if function.Spec.Name != "nodeinfo" {
+				t.Errorf("want the spec to be renamed to nodeinfo, got: %s", function.Spec.Name)
+			}
+
+			if _, ok := (*function.Spec.Annotations)[k8s.CanaryWeightAnnotation]; ok {
+				t.Errorf("want the weight to be dropped, got: %v", *function.Spec.Annotations)
+			}
+		})
+	}
+}
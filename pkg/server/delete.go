@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
+	"github.com/openfaas/faas-netes/pkg/handlers"
 	"github.com/openfaas/faas/gateway/requests"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	glog "k8s.io/klog"
@@ -50,7 +51,8 @@ func makeDeleteHandler(defaultNamespace string, client clientset.Interface) http
 		err = client.OpenfaasV1().Functions(lookupNamespace).
 			Delete(r.Context(), request.FunctionName, metav1.DeleteOptions{})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
 			w.Write([]byte(err.Error()))
 			glog.Errorf("Function %s delete error: %v", request.FunctionName, err)
 			return
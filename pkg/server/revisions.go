@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// makeRollbackHandler sets the spec of the Function to a stored revision, the
+// controller then applies it and records it as a new revision
+func makeRollbackHandler(defaultNamespace string, client clientset.Interface, factory k8s.FunctionFactory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		namespace := defaultNamespace
+		if val := r.URL.Query().Get("namespace"); len(val) > 0 {
+			namespace = val
+		}
+
+		if namespace == "kube-system" {
+			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+			return
+		}
+
+		req, err := handlers.ReadRollbackRequest(r.Context(), r, namespace, functionName, factory)
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := handlers.ValidateFunctionRequest(r.Context(), req, namespace, factory); err != nil {
+			klog.Infof("Rollback request for %s.%s rejected: %s\n", functionName, namespace, err.Error())
+			handlers.WriteValidationError(w, err)
+			return
+		}
+
+		got, err := client.OpenfaasV1().Functions(namespace).Get(r.Context(), functionName, metav1.GetOptions{})
+		if err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		updated := got.DeepCopy()
+		updated.Spec = toFunctionSpec(*req)
+
+		if _, err = client.OpenfaasV1().Functions(namespace).
+			Update(r.Context(), updated, metav1.UpdateOptions{}); err != nil {
+			status, _ := handlers.ProcessErrorReasons(err)
+			w.WriteHeader(status)
+			w.Write([]byte(fmt.Sprintf("Error updating function: %s", err.Error())))
+			return
+		}
+
+		klog.Infof("Function rolled back: %s.%s to %s\n", functionName, namespace, req.Image)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+)
+
+func Test_makeRollbackHandler_KubeSystem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "http://system/function/nodeinfo/rollback?namespace=kube-system", nil)
+	makeRollbackHandler("openfaas-fn", clientset.NewSimpleClientset(), testFactory()).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"name": "nodeinfo"}))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want status code '%d', got '%d': %s", http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+}
@@ -5,16 +5,18 @@ import (
 	_ "net/http/pprof"
 	"os"
 
+	"github.com/openfaas/faas-netes/pkg/audit"
+	"github.com/openfaas/faas-netes/pkg/auth"
 	"github.com/openfaas/faas-netes/pkg/config"
 
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	"github.com/openfaas/faas-netes/pkg/handlers"
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	faasnetesk8s "github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/queue"
 	bootstrap "github.com/openfaas/faas-provider"
 	v1apps "k8s.io/client-go/listers/apps/v1"
 
-	"github.com/openfaas/faas-provider/logs"
 	"github.com/openfaas/faas-provider/proxy"
 	"github.com/openfaas/faas-provider/types"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -36,7 +38,13 @@ func New(client clientset.Interface,
 	endpointsInformer coreinformer.EndpointsInformer,
 	deploymentLister v1apps.DeploymentLister,
 	clusterRole bool,
-	cfg config.BootstrapConfig) *Server {
+	cfg config.BootstrapConfig,
+	factory k8s.FunctionFactory,
+	authenticator auth.Authenticator,
+	policy *auth.Policy,
+	auditor *audit.Auditor,
+	logStore *k8s.LogStore,
+	stopCh <-chan struct{}) *Server {
 
 	functionNamespace := "openfaas-fn"
 	if namespace, exists := os.LookupEnv("function_namespace"); exists {
@@ -50,6 +58,7 @@ func New(client clientset.Interface,
 
 	lister := endpointsInformer.Lister()
 	functionLookup := k8s.NewFunctionLookup(functionNamespace, lister)
+	functionLookup.DeploymentLister = deploymentLister
 
 	bootstrapConfig := types.FaaSConfig{
 		ReadTimeout:  cfg.FaaSConfig.ReadTimeout,
@@ -58,21 +67,45 @@ func New(client clientset.Interface,
 		EnableHealth: true,
 	}
 
+	authorize := handlers.NewAuthorize(authenticator, policy, functionNamespace)
+	audited := handlers.NewAudit(auditor, authenticator, deploymentLister, functionNamespace)
+
 	bootstrapHandlers := types.FaaSHandlers{
-		FunctionProxy:        proxy.NewHandlerFunc(bootstrapConfig, functionLookup),
-		DeleteHandler:        makeDeleteHandler(functionNamespace, client),
-		DeployHandler:        makeApplyHandler(functionNamespace, client),
-		FunctionReader:       makeListHandler(functionNamespace, client, deploymentLister),
-		ReplicaReader:        makeReplicaReader(functionNamespace, client, deploymentLister),
-		ReplicaUpdater:       makeReplicaHandler(functionNamespace, kube),
-		UpdateHandler:        makeApplyHandler(functionNamespace, client),
+		FunctionProxy:        handlers.MakeAuthHandler(handlers.MakeCanaryRoutingHandler(proxy.NewHandlerFunc(bootstrapConfig, functionLookup)), authenticator, deploymentLister, functionNamespace),
+		DeleteHandler:        audited(audit.KindFunction, auth.VerbDelete, handlers.NamespaceFromQuery, authorize(auth.VerbDelete, handlers.NamespaceFromQuery, makeDeleteHandler(functionNamespace, client))),
+		DeployHandler:        audited(audit.KindFunction, auth.VerbDeploy, handlers.NamespaceFromBody, authorize(auth.VerbDeploy, handlers.NamespaceFromBody, makeApplyHandler(functionNamespace, client, factory))),
+		FunctionReader:       authorize(auth.VerbRead, handlers.NamespaceFromQuery, makeListHandler(functionNamespace, client, deploymentLister)),
+		ReplicaReader:        authorize(auth.VerbRead, handlers.NamespaceFromQuery, makeReplicaReader(functionNamespace, client, deploymentLister)),
+		ReplicaUpdater:       audited(audit.KindFunction, auth.VerbScale, handlers.NamespaceFromQuery, authorize(auth.VerbScale, handlers.NamespaceFromQuery, makeReplicaHandler(functionNamespace, kube))),
+		UpdateHandler:        audited(audit.KindFunction, "update", handlers.NamespaceFromBody, authorize(auth.VerbDeploy, handlers.NamespaceFromBody, makeApplyHandler(functionNamespace, client, factory))),
 		HealthHandler:        makeHealthHandler(),
 		InfoHandler:          makeInfoHandler(),
-		SecretHandler:        handlers.MakeSecretHandler(functionNamespace, kube),
-		LogHandler:           logs.NewLogHandlerFunc(faasnetesk8s.NewLogRequestor(kube, functionNamespace), bootstrapConfig.WriteTimeout),
+		SecretHandler:        audited(audit.KindSecret, "", handlers.NamespaceFromQueryOrBody, authorize(auth.VerbSecrets, handlers.NamespaceFromQueryOrBody, handlers.MakeSecretHandler(functionNamespace, kube, factory.SecretsClient(), deploymentLister))),
+		LogHandler:           authorize(auth.VerbLogs, handlers.NamespaceFromQuery, handlers.MakeLogHandler(faasnetesk8s.NewLogRequestor(kube, functionNamespace, logStore), bootstrapConfig.WriteTimeout)),
 		ListNamespaceHandler: handlers.MakeNamespacesLister(functionNamespace, clusterRole, kube),
 	}
 
+	handlers.RegisterSystemRoute("/system/function/{name:["+bootstrap.NameExpression+"]+}/revisions",
+		authorize(auth.VerbRead, handlers.NamespaceFromQuery, handlers.MakeRevisionsHandler(functionNamespace, factory)), bootstrapConfig, http.MethodGet)
+	handlers.RegisterSystemRoute("/system/function/{name:["+bootstrap.NameExpression+"]+}/rollback",
+		audited(audit.KindFunction, "rollback", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, makeRollbackHandler(functionNamespace, client, factory))), bootstrapConfig, http.MethodPost)
+	handlers.RegisterSystemRoute("/system/function/{name:["+bootstrap.NameExpression+"]+}/canary/promote",
+		audited(audit.KindFunction, "canary-promote", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, makeCanaryPromoteHandler(functionNamespace, client, factory))), bootstrapConfig, http.MethodPost)
+	handlers.RegisterSystemRoute("/system/function/{name:["+bootstrap.NameExpression+"]+}/canary/abort",
+		audited(audit.KindFunction, "canary-abort", handlers.NamespaceFromQuery, authorize(auth.VerbDeploy, handlers.NamespaceFromQuery, makeCanaryAbortHandler(functionNamespace, client))), bootstrapConfig, http.MethodPost)
+
+	// namespaces can only be created and deleted with a ClusterRole
+	if clusterRole {
+		namespaces := k8s.NewNamespacesClient(factory, functionNamespace, deploymentLister)
+		handlers.RegisterSystemRoute("/system/namespaces",
+			audited(audit.KindNamespace, "", handlers.NamespaceFromName, authorize(auth.VerbNamespaces, handlers.NamespaceFromName, handlers.MakeNamespaceHandler(namespaces))), bootstrapConfig, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+
+	if cfg.AsyncEnabled {
+		asyncHandler := handlers.MakeAsyncHandler(queue.Start(cfg, functionLookup, stopCh))
+		handlers.RegisterAsyncRoutes(handlers.MakeAuthHandler(asyncHandler, authenticator, deploymentLister, functionNamespace))
+	}
+
 	if pprof == "true" {
 		bootstrap.Router().PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 	}
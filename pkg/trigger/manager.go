@@ -0,0 +1,432 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/config"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/proxy"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// dedupeTTL is how long a delivered event is remembered, so that it is not delivered
+// again by an overlapping watch or a relist
+const dedupeTTL = 10 * time.Minute
+
+// Event is the body that is sent to a function when one of its triggers fires
+type Event struct {
+	Kind      string `json:"kind"`
+	Event     string `json:"event"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// Object is the Pod, ConfigMap or Secret, the data of a Secret is removed
+	Object runtime.Object `json:"object"`
+}
+
+// subscription is a trigger of a function
+type subscription struct {
+	function string
+	trigger  Trigger
+	selector labels.Selector
+}
+
+// watchKey identifies an informer, every trigger of the same kind and namespace
+// shares one informer
+type watchKey struct {
+	kind      string
+	namespace string
+}
+
+// Manager invokes functions when the cluster events of their triggers happen. It
+// starts an informer for each kind and namespace that a trigger refers to, and stops
+// it when no trigger refers to it anymore.
+type Manager struct {
+	kube     kubernetes.Interface
+	resolver proxy.BaseURLResolver
+	client   *http.Client
+
+	// namespaces can be watched by the triggers of any function, besides its own
+	// namespace. * allows every namespace.
+	namespaces []string
+
+	lock          sync.Mutex
+	subscriptions map[string][]subscription
+	watches       map[watchKey]chan struct{}
+	changed       chan struct{}
+
+	seenLock sync.Mutex
+	seen     map[string]time.Time
+
+	deliveries sync.WaitGroup
+}
+
+// NewManager creates a Manager that invokes functions through resolver with client.
+// The triggers of a function may only watch its own namespace and namespaces.
+func NewManager(kube kubernetes.Interface, resolver proxy.BaseURLResolver, client *http.Client, namespaces []string) *Manager {
+	return &Manager{
+		kube:          kube,
+		resolver:      resolver,
+		client:        client,
+		namespaces:    namespaces,
+		subscriptions: map[string][]subscription{},
+		watches:       map[watchKey]chan struct{}{},
+		changed:       make(chan struct{}, 1),
+		seen:          map[string]time.Time{},
+	}
+}
+
+// Start creates a Manager for the triggers of the function Deployments of informer,
+// which runs until stopCh is closed
+func Start(cfg config.BootstrapConfig, kube kubernetes.Interface, informer cache.SharedIndexInformer, resolver proxy.BaseURLResolver, stopCh <-chan struct{}) *Manager {
+	manager := NewManager(kube, resolver, proxy.NewProxyClientFromConfig(cfg.FaaSConfig), cfg.TriggersNamespaces)
+	manager.Watch(informer)
+	go manager.Run(stopCh)
+
+	return manager
+}
+
+// Watch keeps the triggers up to date with the annotations of the function
+// Deployments of informer. The annotations of a Function are copied onto its
+// Deployment, so this works both as a controller and as an operator.
+func (m *Manager) Watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: m.updateFunction,
+		UpdateFunc: func(old, new interface{}) {
+			m.updateFunction(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				m.Set(deployment.Name+"."+deployment.Namespace, nil, nil)
+			}
+		},
+	})
+}
+
+func (m *Manager) updateFunction(obj interface{}) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return
+	}
+
+	function := deployment.Name + "." + deployment.Namespace
+	if !k8s.IsFunctionDeployment(deployment) || k8s.IsCanary(deployment.Name) {
+		m.Set(function, nil, nil)
+		return
+	}
+
+	if _, ok := deployment.Annotations[TriggerAnnotation]; !ok {
+		m.Set(function, nil, nil)
+		return
+	}
+
+	if err := ValidateAnnotations(deployment.Annotations); err != nil {
+		log.Printf("Ignoring the triggers of %s: %s\n", function, err.Error())
+		m.Set(function, nil, nil)
+		return
+	}
+
+	triggers, _ := ParseTriggers(deployment.Annotations[TriggerAnnotation])
+	for _, trigger := range triggers {
+		if !m.allowed(deployment.Namespace, trigger) {
+			log.Printf("Ignoring the triggers of %s: %s watches a namespace that is not allowed\n", function, trigger)
+			m.Set(function, nil, nil)
+			return
+		}
+	}
+	selector, _ := labels.Parse(deployment.Annotations[SelectorAnnotation])
+
+	m.Set(function, triggers, selector)
+}
+
+// allowed returns true when a function in namespace may use trigger
+func (m *Manager) allowed(namespace string, trigger Trigger) bool {
+	if trigger.Namespace == namespace {
+		return true
+	}
+
+	for _, allowed := range m.namespaces {
+		if allowed == "*" || allowed == trigger.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Set replaces the triggers of a function, which is in the form
+// <function_name>.<namespace>. The objects of the triggers have to match selector,
+// unless it is nil.
+func (m *Manager) Set(function string, triggers []Trigger, selector labels.Selector) {
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	subscriptions := []subscription{}
+	for _, trigger := range triggers {
+		subscriptions = append(subscriptions, subscription{function: function, trigger: trigger, selector: selector})
+	}
+
+	m.lock.Lock()
+	if len(subscriptions) == 0 {
+		if _, ok := m.subscriptions[function]; !ok {
+			m.lock.Unlock()
+			return
+		}
+		delete(m.subscriptions, function)
+	} else {
+		m.subscriptions[function] = subscriptions
+	}
+	m.lock.Unlock()
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts and stops informers as the triggers change, until stopCh is closed
+func (m *Manager) Run(stopCh <-chan struct{}) {
+	m.syncWatches()
+
+	for {
+		select {
+		case <-m.changed:
+			m.syncWatches()
+		case <-stopCh:
+			m.lock.Lock()
+			for key, stop := range m.watches {
+				close(stop)
+				delete(m.watches, key)
+			}
+			m.lock.Unlock()
+			return
+		}
+	}
+}
+
+// Wait blocks until the deliveries that were started have completed
+func (m *Manager) Wait() {
+	m.deliveries.Wait()
+}
+
+func (m *Manager) syncWatches() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	wanted := map[watchKey]bool{}
+	for _, subscriptions := range m.subscriptions {
+		for _, s := range subscriptions {
+			wanted[watchKey{kind: s.trigger.Kind, namespace: s.trigger.Namespace}] = true
+		}
+	}
+
+	for key := range wanted {
+		if _, ok := m.watches[key]; ok {
+			continue
+		}
+
+		stop := make(chan struct{})
+		m.watches[key] = stop
+		go m.watch(key, stop)
+		log.Printf("Watching %s in %q for triggers\n", key.kind, key.namespace)
+	}
+
+	for key, stop := range m.watches {
+		if !wanted[key] {
+			close(stop)
+			delete(m.watches, key)
+			log.Printf("Stopped watching %s in %q for triggers\n", key.kind, key.namespace)
+		}
+	}
+}
+
+// watch runs an informer for the objects of key until stop is closed
+func (m *Manager) watch(key watchKey, stop chan struct{}) {
+	var informer cache.SharedIndexInformer
+	switch key.kind {
+	case KindPod:
+		informer = coreinformers.NewPodInformer(m.kube, key.namespace, 0, cache.Indexers{})
+	case KindConfigMap:
+		informer = coreinformers.NewConfigMapInformer(m.kube, key.namespace, 0, cache.Indexers{})
+	case KindSecret:
+		informer = coreinformers.NewSecretInformer(m.kube, key.namespace, 0, cache.Indexers{})
+	default:
+		return
+	}
+
+	// the initial list of the informer is reported as added objects, which did not
+	// happen while the trigger was in place. Creation timestamps have a precision of a
+	// second.
+	started := metav1.NewTime(time.Now().Truncate(time.Second))
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			object, ok := obj.(metav1.Object)
+			if !ok {
+				return
+			}
+			if created := object.GetCreationTimestamp(); created.Before(&started) {
+				return
+			}
+			m.fire(key.kind, EventAdd, obj)
+			if key.kind == KindPod && podFailed(obj) {
+				m.fire(key.kind, EventFailed, obj)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldObject, ok := old.(metav1.Object)
+			newObject, ok2 := new.(metav1.Object)
+			if !ok || !ok2 || oldObject.GetResourceVersion() == newObject.GetResourceVersion() {
+				return
+			}
+			m.fire(key.kind, EventUpdate, new)
+			if key.kind == KindPod && !podFailed(old) && podFailed(new) {
+				m.fire(key.kind, EventFailed, new)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			m.fire(key.kind, EventDelete, obj)
+		},
+	})
+
+	informer.Run(stop)
+}
+
+func podFailed(obj interface{}) bool {
+	pod, ok := obj.(*corev1.Pod)
+	return ok && pod.Status.Phase == corev1.PodFailed
+}
+
+// fire delivers an event to every function with a matching trigger
+func (m *Manager) fire(kind, event string, obj interface{}) {
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	m.lock.Lock()
+	var functions []string
+	for function, subscriptions := range m.subscriptions {
+		for _, s := range subscriptions {
+			if s.trigger.Kind == kind && s.trigger.Event == event &&
+				(s.trigger.Namespace == metav1.NamespaceAll || s.trigger.Namespace == object.GetNamespace()) &&
+				s.selector.Matches(labels.Set(object.GetLabels())) {
+				functions = append(functions, function)
+				break
+			}
+		}
+	}
+	m.lock.Unlock()
+
+	for _, function := range functions {
+		if m.delivered(function, kind, event, object) {
+			continue
+		}
+
+		body, err := json.Marshal(Event{
+			Kind:      kind,
+			Event:     event,
+			Namespace: object.GetNamespace(),
+			Name:      object.GetName(),
+			Object:    redact(obj),
+		})
+		if err != nil {
+			log.Printf("Unable to marshal %s %s/%s: %s\n", kind, object.GetNamespace(), object.GetName(), err.Error())
+			continue
+		}
+
+		m.deliveries.Add(1)
+		go func(function string) {
+			defer m.deliveries.Done()
+			m.invoke(function, kind+"/"+object.GetNamespace()+"/"+event, body)
+		}(function)
+	}
+}
+
+// delivered returns true when the event was already delivered to the function, and
+// otherwise remembers it
+func (m *Manager) delivered(function, kind, event string, object metav1.Object) bool {
+	key := function + "/" + kind + "/" + string(object.GetUID()) + "/" + object.GetResourceVersion() + "/" + event
+	now := time.Now()
+
+	m.seenLock.Lock()
+	defer m.seenLock.Unlock()
+
+	if seen, ok := m.seen[key]; ok && now.Sub(seen) < dedupeTTL {
+		return true
+	}
+
+	for k, seen := range m.seen {
+		if now.Sub(seen) >= dedupeTTL {
+			delete(m.seen, k)
+		}
+	}
+	m.seen[key] = now
+	return false
+}
+
+// redact removes the data of a Secret, along with its annotations and managed fields
+// which can hold a copy of it, such as kubectl.kubernetes.io/last-applied-configuration
+func redact(obj interface{}) runtime.Object {
+	if secret, ok := obj.(*corev1.Secret); ok {
+		redacted := secret.DeepCopy()
+		redacted.Data = nil
+		redacted.StringData = nil
+		redacted.Annotations = nil
+		redacted.ManagedFields = nil
+		return redacted
+	}
+
+	object, _ := obj.(runtime.Object)
+	return object
+}
+
+func (m *Manager) invoke(function, trigger string, body []byte) {
+	functionURL, err := m.resolver.Resolve(function)
+	if err != nil {
+		log.Printf("Unable to resolve %s for trigger %s: %s\n", function, trigger, err.Error())
+		return
+	}
+	functionURL.Path = "/"
+
+	req, err := http.NewRequest(http.MethodPost, functionURL.String(), bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Unable to invoke %s for trigger %s: %s\n", function, trigger, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Trigger", trigger)
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		log.Printf("Unable to invoke %s for trigger %s: %s\n", function, trigger, err.Error())
+		return
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	log.Printf("Invoked %s for trigger %s: status %d\n", function, trigger, res.StatusCode)
+}
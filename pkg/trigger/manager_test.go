@@ -0,0 +1,243 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package trigger
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+type delivery struct {
+	trigger string
+	body    []byte
+	event   map[string]interface{}
+}
+
+func newTestManager(t *testing.T, namespaces ...string) (*Manager, *fake.Clientset, chan delivery, func()) {
+	deliveries := make(chan delivery, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		d := delivery{trigger: r.Header.Get("X-Trigger"), body: body}
+		if err := json.Unmarshal(body, &d.event); err != nil {
+			t.Errorf("want JSON body, got: %s", err)
+		}
+		deliveries <- d
+	}))
+	srvURL, _ := url.Parse(srv.URL)
+
+	kube := fake.NewSimpleClientset()
+	return NewManager(kube, staticResolver{url: *srvURL}, http.DefaultClient, namespaces), kube, deliveries, srv.Close
+}
+
+func waitForDelivery(t *testing.T, deliveries chan delivery) delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("want delivery, got none")
+	}
+	return delivery{}
+}
+
+func Test_Manager_PodFailed(t *testing.T) {
+	m, kube, deliveries, stop := newTestManager(t)
+	defer stop()
+
+	m.Set("cleanup.openfaas-fn", []Trigger{{Kind: KindPod, Namespace: "batch", Event: EventFailed}}, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go m.Run(stopCh)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "job-1", Namespace: "batch", UID: "1", CreationTimestamp: metav1.Now()},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	// the informer is started in the background, so create the Pod once it is watched
+	time.Sleep(100 * time.Millisecond)
+	created, err := kube.CoreV1().Pods("batch").Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("want Pod to be created, got: %s", err)
+	}
+
+	failed := created.DeepCopy()
+	failed.ResourceVersion = "2"
+	failed.Status.Phase = corev1.PodFailed
+	if _, err := kube.CoreV1().Pods("batch").UpdateStatus(context.TODO(), failed, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("want Pod to be updated, got: %s", err)
+	}
+
+	d := waitForDelivery(t, deliveries)
+	if d.trigger != "pod/batch/failed" {
+		t.Errorf("want trigger pod/batch/failed, got: %s", d.trigger)
+	}
+	if d.event["name"] != "job-1" || d.event["event"] != EventFailed {
+		t.Errorf("want failed event of job-1, got: %v", d.event)
+	}
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("want only the failed event to be delivered, got: %s", d.trigger)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_Manager_Fire(t *testing.T) {
+	m, _, deliveries, stop := newTestManager(t)
+	defer stop()
+
+	selector, _ := labels.Parse("app=web")
+	m.Set("audit.openfaas-fn", []Trigger{{Kind: KindSecret, Namespace: "", Event: EventUpdate}}, selector)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "web", UID: "1", ResourceVersion: "2", Labels: map[string]string{"app": "web"}},
+		Data:       map[string][]byte{"key": []byte("secret")},
+	}
+
+	m.fire(KindSecret, EventUpdate, secret)
+	// delivered by an overlapping watch
+	m.fire(KindSecret, EventUpdate, secret)
+	// the selector does not match
+	m.fire(KindSecret, EventUpdate, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web", UID: "2", ResourceVersion: "2"}})
+	m.Wait()
+
+	if len(deliveries) != 1 {
+		t.Fatalf("want 1 delivery, got: %d", len(deliveries))
+	}
+
+	d := <-deliveries
+	object := d.event["object"].(map[string]interface{})
+	if _, ok := object["data"]; ok {
+		t.Errorf("want the data of the Secret to be removed, got: %v", object["data"])
+	}
+}
+
+func Test_Manager_RedactsAppliedSecret(t *testing.T) {
+	m, _, deliveries, stop := newTestManager(t)
+	defer stop()
+
+	m.Set("audit.openfaas-fn", []Trigger{{Kind: KindSecret, Namespace: "openfaas-fn", Event: EventUpdate}}, nil)
+
+	// a Secret created with kubectl apply keeps a copy of itself in an annotation
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "api-key",
+			Namespace:       "openfaas-fn",
+			UID:             "1",
+			ResourceVersion: "2",
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"api-key","namespace":"openfaas-fn"},"stringData":{"key":"s3cr3t-value"}}`,
+			},
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:    "kubectl-client-side-apply",
+				Operation:  metav1.ManagedFieldsOperationUpdate,
+				FieldsType: "FieldsV1",
+				FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:data":{".":{},"f:key":{}}}`)},
+			}},
+		},
+		Data: map[string][]byte{"key": []byte("s3cr3t-value")},
+	}
+
+	m.fire(KindSecret, EventUpdate, secret)
+	m.Wait()
+
+	d := waitForDelivery(t, deliveries)
+	if strings.Contains(string(d.body), "s3cr3t-value") || strings.Contains(string(d.body), base64.StdEncoding.EncodeToString([]byte("s3cr3t-value"))) {
+		t.Errorf("want the value of the Secret to be removed, got: %s", string(d.body))
+	}
+	if strings.Contains(string(d.body), "managedFields") {
+		t.Errorf("want the managed fields of the Secret to be removed, got: %s", string(d.body))
+	}
+	if d.event["name"] != "api-key" {
+		t.Errorf("want the event of api-key, got: %v", d.event)
+	}
+}
+
+func Test_Manager_TriggerNamespaces(t *testing.T) {
+	cases := []struct {
+		name       string
+		namespaces []string
+		trigger    string
+		want       bool
+	}{
+		{name: "own namespace", trigger: "secret/openfaas-fn/update", want: true},
+		{name: "other namespace", trigger: "secret/kube-system/update"},
+		{name: "every namespace", trigger: "secret/*/update"},
+		{name: "one of many not allowed", trigger: "pod/openfaas-fn/failed,secret/kube-system/update"},
+		{name: "allowed namespace", namespaces: []string{"batch"}, trigger: "pod/batch/failed", want: true},
+		{name: "all namespaces allowed", namespaces: []string{"*"}, trigger: "secret/*/update", want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _, _, stop := newTestManager(t, tc.namespaces...)
+			defer stop()
+
+			m.updateFunction(functionDeployment("audit", "openfaas-fn", map[string]string{TriggerAnnotation: tc.trigger}))
+
+			_, got := m.subscriptions["audit.openfaas-fn"]
+			if got != tc.want {
+				t.Errorf("want triggers to be set: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_Manager_OperatorDeployment(t *testing.T) {
+	m, _, _, stop := newTestManager(t)
+	defer stop()
+
+	// the operator only sets the faas_function label on the pod template
+	deployment := functionDeployment("audit", "openfaas-fn", map[string]string{TriggerAnnotation: "secret/openfaas-fn/update"})
+	deployment.Labels = nil
+	deployment.Spec.Template.Labels = map[string]string{"faas_function": "audit"}
+	m.updateFunction(deployment)
+
+	if _, ok := m.subscriptions["audit.openfaas-fn"]; !ok {
+		t.Errorf("want the triggers of the operator's Deployment to be set")
+	}
+
+	m.updateFunction(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "gateway",
+		Namespace:   "openfaas-fn",
+		Annotations: map[string]string{TriggerAnnotation: "secret/openfaas-fn/update"},
+	}})
+	if _, ok := m.subscriptions["gateway.openfaas-fn"]; ok {
+		t.Errorf("want the triggers of a Deployment that is not a function to be ignored")
+	}
+}
+
+func functionDeployment(name, namespace string, annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{"faas_function": name},
+			Annotations: annotations,
+		},
+	}
+}
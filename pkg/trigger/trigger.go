@@ -0,0 +1,140 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package trigger
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// TriggerAnnotation lists the cluster events that invoke a function, separated by
+	// commas, in the form <kind>/<namespace>/<event>. The namespace * matches every
+	// namespace.
+	TriggerAnnotation = "com.openfaas.trigger.k8s"
+
+	// SelectorAnnotation is a label selector that the objects of the triggers have to
+	// match
+	SelectorAnnotation = "com.openfaas.trigger.k8s.selector"
+)
+
+const (
+	// KindPod triggers on Pods
+	KindPod = "pod"
+	// KindConfigMap triggers on ConfigMaps
+	KindConfigMap = "configmap"
+	// KindSecret triggers on Secrets, their data is not sent to the function
+	KindSecret = "secret"
+)
+
+const (
+	// EventAdd is an object that was created
+	EventAdd = "add"
+	// EventUpdate is an object that was changed
+	EventUpdate = "update"
+	// EventDelete is an object that was removed
+	EventDelete = "delete"
+	// EventFailed is a Pod that moved to the Failed phase
+	EventFailed = "failed"
+)
+
+var kindEvents = map[string][]string{
+	KindPod:       {EventAdd, EventUpdate, EventDelete, EventFailed},
+	KindConfigMap: {EventAdd, EventUpdate, EventDelete},
+	KindSecret:    {EventAdd, EventUpdate, EventDelete},
+}
+
+// Trigger is a cluster event that invokes a function
+type Trigger struct {
+	Kind string
+
+	// Namespace is empty when the trigger matches every namespace
+	Namespace string
+
+	Event string
+}
+
+// String returns the trigger in the form of the annotation
+func (t Trigger) String() string {
+	namespace := t.Namespace
+	if namespace == metav1.NamespaceAll {
+		namespace = "*"
+	}
+	return t.Kind + "/" + namespace + "/" + t.Event
+}
+
+// ParseTriggers parses the value of TriggerAnnotation
+func ParseTriggers(value string) ([]Trigger, error) {
+	triggers := []Trigger{}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		fields := strings.Split(part, "/")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid trigger %q, expected <kind>/<namespace>/<event>", part)
+		}
+
+		kind := strings.ToLower(fields[0])
+		events, ok := kindEvents[kind]
+		if !ok {
+			return nil, fmt.Errorf("invalid trigger %q, kind must be one of %s, %s or %s", part, KindPod, KindConfigMap, KindSecret)
+		}
+
+		event := strings.ToLower(fields[2])
+		if !contains(events, event) {
+			return nil, fmt.Errorf("invalid trigger %q, event must be one of %s for %s", part, strings.Join(events, ", "), kind)
+		}
+
+		namespace := fields[1]
+		if namespace == "*" {
+			namespace = metav1.NamespaceAll
+		} else if len(namespace) == 0 {
+			return nil, fmt.Errorf("invalid trigger %q, namespace must not be empty", part)
+		}
+
+		triggers = append(triggers, Trigger{Kind: kind, Namespace: namespace, Event: event})
+	}
+
+	return triggers, nil
+}
+
+// ValidateAnnotations returns an error when the trigger annotations of a function are
+// invalid
+func ValidateAnnotations(annotations map[string]string) error {
+	value, ok := annotations[TriggerAnnotation]
+	if !ok {
+		return nil
+	}
+
+	triggers, err := ParseTriggers(value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", TriggerAnnotation, err.Error())
+	}
+	if len(triggers) == 0 {
+		return fmt.Errorf("%s: at least one trigger is required", TriggerAnnotation)
+	}
+
+	if selector, ok := annotations[SelectorAnnotation]; ok {
+		if _, err := labels.Parse(selector); err != nil {
+			return fmt.Errorf("%s: %s", SelectorAnnotation, err.Error())
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
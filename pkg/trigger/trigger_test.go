@@ -0,0 +1,53 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package trigger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseTriggers(t *testing.T) {
+	triggers, err := ParseTriggers("pod/batch/failed, ConfigMap/*/update")
+	if err != nil {
+		t.Fatalf("want triggers to parse, got: %s", err)
+	}
+
+	want := []Trigger{
+		{Kind: KindPod, Namespace: "batch", Event: EventFailed},
+		{Kind: KindConfigMap, Namespace: "", Event: EventUpdate},
+	}
+	if !reflect.DeepEqual(triggers, want) {
+		t.Errorf("want %v, got: %v", want, triggers)
+	}
+	if triggers[1].String() != "configmap/*/update" {
+		t.Errorf("want configmap/*/update, got: %s", triggers[1].String())
+	}
+}
+
+func Test_ValidateAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "no triggers", annotations: map[string]string{}},
+		{name: "valid", annotations: map[string]string{TriggerAnnotation: "secret/openfaas-fn/delete", SelectorAnnotation: "app=web"}},
+		{name: "empty", annotations: map[string]string{TriggerAnnotation: ""}, wantErr: true},
+		{name: "missing event", annotations: map[string]string{TriggerAnnotation: "pod/openfaas-fn"}, wantErr: true},
+		{name: "unknown kind", annotations: map[string]string{TriggerAnnotation: "service/openfaas-fn/add"}, wantErr: true},
+		{name: "failed is only for pods", annotations: map[string]string{TriggerAnnotation: "configmap/openfaas-fn/failed"}, wantErr: true},
+		{name: "empty namespace", annotations: map[string]string{TriggerAnnotation: "pod//add"}, wantErr: true},
+		{name: "invalid selector", annotations: map[string]string{TriggerAnnotation: "pod/*/add", SelectorAnnotation: "app in (web"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAnnotations(tc.annotations)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("want error: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	glog "k8s.io/klog"
+)
+
+const (
+	caCertKey = "ca.crt"
+
+	// managedByLabel marks the certificate Secret as generated by faas-netes, a Secret
+	// without it is never overwritten
+	managedByLabel = "app.kubernetes.io/managed-by"
+
+	// certValidity is how long generated certificates are valid for
+	certValidity = 365 * 24 * time.Hour
+	// certRenewBefore is how long before expiry the certificates are regenerated
+	certRenewBefore = 30 * 24 * time.Hour
+)
+
+// Certificates holds the PEM encoded CA certificate and the serving key pair of the webhook
+type Certificates struct {
+	CACert []byte
+	Cert   []byte
+	Key    []byte
+}
+
+// EnsureCertificates returns the serving certificates for the webhook Service. They are
+// read from the Secret in the webhook namespace, a new self-signed CA and serving
+// certificate are generated and stored when the Secret is missing, expiring or was
+// issued for a different Service. When several replicas generate certificates at the
+// same time, only the first one is stored and the others return it.
+func EnsureCertificates(ctx context.Context, kube kubernetes.Interface, cfg Config) (*Certificates, error) {
+	secrets := kube.CoreV1().Secrets(cfg.Namespace)
+
+	existing, err := secrets.Get(ctx, cfg.SecretName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	found := err == nil
+	if found {
+		if existing.Labels[managedByLabel] != "openfaas" {
+			return nil, fmt.Errorf("secret %s.%s is not managed by openfaas", cfg.SecretName, cfg.Namespace)
+		}
+
+		certs := secretCertificates(existing)
+		if certs.valid(cfg.dnsName(), time.Now()) {
+			return certs, nil
+		}
+		glog.Infof("Webhook certificates in %s.%s are invalid or expiring, generating new certificates", cfg.SecretName, cfg.Namespace)
+	}
+
+	certs, err := NewCertificates(cfg.dnsNames(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.SecretName,
+			Namespace: cfg.Namespace,
+			Labels: map[string]string{
+				managedByLabel: "openfaas",
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			caCertKey:               certs.CACert,
+			corev1.TLSCertKey:       certs.Cert,
+			corev1.TLSPrivateKeyKey: certs.Key,
+		},
+	}
+
+	// the resourceVersion makes the update fail when another replica replaced the
+	// certificates since they were read
+	if found {
+		secret.ResourceVersion = existing.ResourceVersion
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	} else {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	}
+
+	if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+		stored, getErr := secrets.Get(ctx, cfg.SecretName, metav1.GetOptions{})
+		if getErr != nil {
+			return nil, getErr
+		}
+
+		if certs := secretCertificates(stored); certs.valid(cfg.dnsName(), time.Now()) {
+			glog.Infof("Webhook certificates in %s.%s were generated by another replica", cfg.SecretName, cfg.Namespace)
+			return certs, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to store webhook certificates in %s.%s: %s", cfg.SecretName, cfg.Namespace, err.Error())
+	}
+
+	return certs, nil
+}
+
+func secretCertificates(secret *corev1.Secret) *Certificates {
+	return &Certificates{
+		CACert: secret.Data[caCertKey],
+		Cert:   secret.Data[corev1.TLSCertKey],
+		Key:    secret.Data[corev1.TLSPrivateKeyKey],
+	}
+}
+
+// NewCertificates generates a self-signed CA and a serving certificate for the given
+// DNS names, signed by that CA
+func NewCertificates(dnsNames []string, now time.Time) (*Certificates, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: "faas-netes-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano() + 1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificates{
+		CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		Cert:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// valid checks that the serving certificate is signed by the CA, was issued for
+// dnsName and is not about to expire
+func (c *Certificates) valid(dnsName string, now time.Time) bool {
+	if len(c.CACert) == 0 || len(c.Cert) == 0 || len(c.Key) == 0 {
+		return false
+	}
+
+	block, _ := pem.Decode(c.Cert)
+	if block == nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(c.CACert) {
+		return false
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		DNSName:     dnsName,
+		Roots:       roots,
+		CurrentTime: now.Add(certRenewBefore),
+	})
+
+	return err == nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var testConfig = Config{
+	Name:        "openfaas-functions",
+	Namespace:   "openfaas",
+	Service:     "faas-netes-webhook",
+	ServicePort: 443,
+	SecretName:  "faas-netes-webhook-certs",
+}
+
+func Test_NewCertificates_Valid(t *testing.T) {
+	now := time.Now()
+	certs, err := NewCertificates(testConfig.dnsNames(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !certs.valid(testConfig.dnsName(), now) {
+		t.Errorf("want certificates to be valid for %s", testConfig.dnsName())
+	}
+
+	if certs.valid("other.openfaas.svc", now) {
+		t.Errorf("want certificates to be invalid for a different Service")
+	}
+
+	if certs.valid(testConfig.dnsName(), now.Add(certValidity-certRenewBefore+time.Hour)) {
+		t.Errorf("want certificates to be invalid when they are about to expire")
+	}
+}
+
+func Test_EnsureCertificates_ReusesSecret(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+
+	first, err := EnsureCertificates(context.Background(), kube, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	secret, err := kube.CoreV1().Secrets(testConfig.Namespace).Get(context.Background(), testConfig.SecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want certificate Secret to be created: %s", err)
+	}
+
+	if !bytes.Equal(secret.Data[caCertKey], first.CACert) {
+		t.Errorf("want Secret to contain the generated CA certificate")
+	}
+
+	second, err := EnsureCertificates(context.Background(), kube, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !bytes.Equal(first.Cert, second.Cert) {
+		t.Errorf("want existing certificates to be reused")
+	}
+}
+
+func Test_EnsureCertificates_ReplacesInvalidSecret(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+
+	other := testConfig
+	other.Service = "other"
+	stale, err := EnsureCertificates(context.Background(), kube, other)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	certs, err := EnsureCertificates(context.Background(), kube, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if bytes.Equal(stale.Cert, certs.Cert) {
+		t.Errorf("want certificates issued for a different Service to be replaced")
+	}
+
+	if !certs.valid(testConfig.dnsName(), time.Now()) {
+		t.Errorf("want new certificates to be valid for %s", testConfig.dnsName())
+	}
+}
+
+func Test_EnsureCertificates_RefusesUnmanagedSecret(t *testing.T) {
+	kube := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testConfig.SecretName, Namespace: testConfig.Namespace},
+	})
+
+	if _, err := EnsureCertificates(context.Background(), kube, testConfig); err == nil {
+		t.Errorf("want an error for a Secret that was not created by faas-netes")
+	}
+}
+
+func Test_EnsureCertificates_UsesCertificatesOfOtherReplica(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+
+	winner, err := NewCertificates(testConfig.dnsNames(), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// another replica stores its certificates between the Get and the Create
+	kube.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*corev1.Secret).DeepCopy()
+		secret.Data = map[string][]byte{
+			caCertKey:               winner.CACert,
+			corev1.TLSCertKey:       winner.Cert,
+			corev1.TLSPrivateKeyKey: winner.Key,
+		}
+		if err := kube.Tracker().Add(secret); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return true, nil, errors.NewAlreadyExists(corev1.Resource("secrets"), secret.Name)
+	})
+
+	certs, err := EnsureCertificates(context.Background(), kube, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !bytes.Equal(certs.Cert, winner.Cert) {
+		t.Errorf("want the certificates that the other replica stored")
+	}
+}
+
+func Test_RegisterWebhooks_CreatesAndUpdates(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	if err := RegisterWebhooks(ctx, kube, testConfig, []byte("first")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RegisterWebhooks(ctx, kube, testConfig, []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	validating, err := kube.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, testConfig.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want ValidatingWebhookConfiguration to exist: %s", err)
+	}
+
+	if got := string(validating.Webhooks[0].ClientConfig.CABundle); got != "second" {
+		t.Errorf("want CA bundle to be updated to %q, got %q", "second", got)
+	}
+
+	if got := *validating.Webhooks[0].ClientConfig.Service.Path; got != ValidatePath {
+		t.Errorf("want validating path %q, got %q", ValidatePath, got)
+	}
+
+	mutating, err := kube.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, testConfig.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want MutatingWebhookConfiguration to exist: %s", err)
+	}
+
+	if got := *mutating.Webhooks[0].ClientConfig.Service.Path; got != MutatePath {
+		t.Errorf("want mutating path %q, got %q", MutatePath, got)
+	}
+}
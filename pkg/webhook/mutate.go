@@ -0,0 +1,82 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// patchOperation is a single RFC 6902 JSON patch operation
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// mutate fills in the defaults of a Function before it is persisted so that the
+// stored object matches what the operator will deploy
+func (s *Server) mutate(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Kind.Kind != functionKind || req.Operation == admissionv1.Delete {
+		return allow()
+	}
+
+	function := &faasv1.Function{}
+	if err := json.Unmarshal(req.Object.Raw, function); err != nil {
+		return deny(fmt.Errorf("unable to unmarshal Function: %s", err.Error()))
+	}
+
+	spec := function.Spec.DeepCopy()
+	SetFunctionDefaults(function)
+	if reflect.DeepEqual(*spec, function.Spec) {
+		return allow()
+	}
+
+	patch, err := json.Marshal([]patchOperation{
+		{Op: "replace", Path: "/spec", Value: function.Spec},
+	})
+	if err != nil {
+		return deny(fmt.Errorf("unable to marshal Function patch: %s", err.Error()))
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	res := allow()
+	res.Patch = patch
+	res.PatchType = &patchType
+	return res
+}
+
+// SetFunctionDefaults sets the values that are optional in a Function spec but are
+// required by the operator
+func SetFunctionDefaults(function *faasv1.Function) {
+	if len(function.Spec.Name) == 0 {
+		function.Spec.Name = function.Name
+	}
+
+	function.Spec.Image = strings.TrimSpace(function.Spec.Image)
+
+	for i, constraint := range function.Spec.Constraints {
+		function.Spec.Constraints[i] = strings.TrimSpace(constraint)
+	}
+
+	if len(function.Spec.Secrets) > 0 {
+		seen := map[string]bool{}
+		secrets := []string{}
+		for _, secret := range function.Spec.Secrets {
+			secret = strings.TrimSpace(secret)
+			if len(secret) == 0 || seen[secret] {
+				continue
+			}
+			seen[secret] = true
+			secrets = append(secrets, secret)
+		}
+		function.Spec.Secrets = secrets
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	glog "k8s.io/klog"
+)
+
+// Config describes how the webhook Server is exposed to the Kubernetes API server
+type Config struct {
+	// Name of the ValidatingWebhookConfiguration and MutatingWebhookConfiguration
+	Name string
+	// Namespace of the webhook Service and certificate Secret
+	Namespace string
+	// Service that routes to the webhook Server
+	Service string
+	// ServicePort is the port exposed by the Service
+	ServicePort int32
+	// SecretName is the Secret used to store the generated certificates
+	SecretName string
+}
+
+func (c Config) dnsName() string {
+	return fmt.Sprintf("%s.%s.svc", c.Service, c.Namespace)
+}
+
+func (c Config) dnsNames() []string {
+	return []string{
+		c.dnsName(),
+		c.Service,
+		fmt.Sprintf("%s.%s", c.Service, c.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", c.Service, c.Namespace),
+	}
+}
+
+// RegisterWebhooks creates or updates the ValidatingWebhookConfiguration and the
+// MutatingWebhookConfiguration that route Function and Profile admission requests to
+// the webhook Service, trusting caBundle.
+func RegisterWebhooks(ctx context.Context, kube kubernetes.Interface, cfg Config, caBundle []byte) error {
+	// Ignore means that Functions can still be created when faas-netes is unavailable,
+	// for example while it is being installed or upgraded.
+	failurePolicy := admissionregistrationv1.Ignore
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	rules := []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{
+				admissionregistrationv1.Create,
+				admissionregistrationv1.Update,
+			},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{faasv1.SchemeGroupVersion.Group},
+				APIVersions: []string{faasv1.SchemeGroupVersion.Version},
+				Resources:   []string{"functions", "profiles"},
+			},
+		},
+	}
+
+	clientConfig := func(path string) admissionregistrationv1.WebhookClientConfig {
+		return admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: cfg.Namespace,
+				Name:      cfg.Service,
+				Path:      &path,
+				Port:      &cfg.ServicePort,
+			},
+			CABundle: caBundle,
+		}
+	}
+
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: cfg.Name},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name:                    "validate.openfaas.com",
+				ClientConfig:            clientConfig(ValidatePath),
+				Rules:                   rules,
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+
+	validatingClient := kube.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	existingValidating, err := validatingClient.Get(ctx, cfg.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		if _, err := validatingClient.Create(ctx, validating, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create ValidatingWebhookConfiguration %s: %s", cfg.Name, err.Error())
+		}
+		glog.Infof("Created ValidatingWebhookConfiguration %s", cfg.Name)
+	case err != nil:
+		return err
+	default:
+		validating.ResourceVersion = existingValidating.ResourceVersion
+		if _, err := validatingClient.Update(ctx, validating, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("unable to update ValidatingWebhookConfiguration %s: %s", cfg.Name, err.Error())
+		}
+		glog.Infof("Updated ValidatingWebhookConfiguration %s", cfg.Name)
+	}
+
+	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: cfg.Name},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:                    "mutate.openfaas.com",
+				ClientConfig:            clientConfig(MutatePath),
+				Rules:                   rules,
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+
+	mutatingClient := kube.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	existingMutating, err := mutatingClient.Get(ctx, cfg.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		if _, err := mutatingClient.Create(ctx, mutating, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create MutatingWebhookConfiguration %s: %s", cfg.Name, err.Error())
+		}
+		glog.Infof("Created MutatingWebhookConfiguration %s", cfg.Name)
+	case err != nil:
+		return err
+	default:
+		mutating.ResourceVersion = existingMutating.ResourceVersion
+		if _, err := mutatingClient.Update(ctx, mutating, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("unable to update MutatingWebhookConfiguration %s: %s", cfg.Name, err.Error())
+		}
+		glog.Infof("Updated MutatingWebhookConfiguration %s", cfg.Name)
+	}
+
+	return nil
+}
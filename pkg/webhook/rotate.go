@@ -0,0 +1,69 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	glog "k8s.io/klog"
+)
+
+// CertCheckInterval is how often the certificates are checked for expiry, and for new
+// certificates that another replica stored
+const CertCheckInterval = time.Hour
+
+// Rotate checks the certificates every interval until stopCh is closed, starting from
+// the certificates that are served. Certificates that are about to expire are replaced,
+// and new certificates in the Secret are served as soon as they are found, whether this
+// replica or another one generated them.
+func (s *Server) Rotate(kube kubernetes.Interface, cfg Config, current *Certificates, interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			certs, err := s.rotate(context.Background(), kube, cfg, current)
+			if err != nil {
+				glog.Errorf("Unable to rotate webhook certificates: %s", err.Error())
+				continue
+			}
+			current = certs
+		}
+	}
+}
+
+// rotate serves the certificates from the Secret when they differ from current. The
+// webhooks are registered again to trust both the new and the previous CA, so that the
+// replicas that still serve the previous certificates are trusted until they rotate too.
+func (s *Server) rotate(ctx context.Context, kube kubernetes.Interface, cfg Config, current *Certificates) (*Certificates, error) {
+	certs, err := EnsureCertificates(ctx, kube, cfg)
+	if err != nil {
+		return current, err
+	}
+
+	if bytes.Equal(certs.Cert, current.Cert) {
+		return current, nil
+	}
+
+	if err := s.SetCertificates(certs); err != nil {
+		return current, err
+	}
+
+	bundle := certs.CACert
+	if !bytes.Equal(certs.CACert, current.CACert) {
+		bundle = append(append([]byte{}, certs.CACert...), current.CACert...)
+	}
+	if err := RegisterWebhooks(ctx, kube, cfg, bundle); err != nil {
+		return current, err
+	}
+
+	glog.Infof("Rotated webhook certificates from %s.%s", cfg.SecretName, cfg.Namespace)
+	return certs, nil
+}
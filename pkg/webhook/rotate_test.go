@@ -0,0 +1,77 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Server_rotate(t *testing.T) {
+	ctx := context.Background()
+	kube := fake.NewSimpleClientset()
+
+	current, err := EnsureCertificates(ctx, kube, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	srv := &Server{}
+	if err := srv.SetCertificates(current); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	unchanged, err := srv.rotate(ctx, kube, testConfig, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if unchanged != current {
+		t.Errorf("want valid certificates to be kept")
+	}
+
+	// certificates that are about to expire are replaced
+	expiring, err := NewCertificates(testConfig.dnsNames(), time.Now().Add(-certValidity+24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	secret, _ := kube.CoreV1().Secrets(testConfig.Namespace).Get(ctx, testConfig.SecretName, metav1.GetOptions{})
+	secret.Data = map[string][]byte{
+		caCertKey:               expiring.CACert,
+		corev1.TLSCertKey:       expiring.Cert,
+		corev1.TLSPrivateKeyKey: expiring.Key,
+	}
+	if _, err := kube.CoreV1().Secrets(testConfig.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rotated, err := srv.rotate(ctx, kube, testConfig, expiring)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bytes.Equal(rotated.Cert, expiring.Cert) || !rotated.valid(testConfig.dnsName(), time.Now()) {
+		t.Fatalf("want expiring certificates to be replaced")
+	}
+
+	served, _ := srv.getCertificate(nil)
+	block, _ := pem.Decode(rotated.Cert)
+	if !bytes.Equal(served.Certificate[0], block.Bytes) {
+		t.Errorf("want the new certificate to be served")
+	}
+
+	validating, err := kube.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, testConfig.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the webhooks to be registered again: %s", err)
+	}
+	bundle := validating.Webhooks[0].ClientConfig.CABundle
+	if !bytes.Contains(bundle, rotated.CACert) || !bytes.Contains(bundle, expiring.CACert) {
+		t.Errorf("want the CA bundle to trust the new and the previous CA")
+	}
+}
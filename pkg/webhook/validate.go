@@ -0,0 +1,120 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	glog "k8s.io/klog"
+)
+
+// validate rejects Functions that the operator would not be able to turn into a
+// working Deployment and Profiles that can not be applied to a Pod
+func (s *Server) validate(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation == admissionv1.Delete {
+		return allow()
+	}
+
+	switch req.Kind.Kind {
+	case functionKind:
+		function := &faasv1.Function{}
+		if err := json.Unmarshal(req.Object.Raw, function); err != nil {
+			return deny(fmt.Errorf("unable to unmarshal Function: %s", err.Error()))
+		}
+
+		request := controller.FunctionSpecToRequest(function)
+		if err := handlers.ValidateFunctionRequest(ctx, &request, function.Namespace, s.factory.Factory); err != nil {
+			err = functionFieldErrors(err)
+			glog.Infof("Rejected Function %s.%s: %s", req.Name, req.Namespace, err.Error())
+			return deny(err)
+		}
+	case profileKind:
+		profile := &faasv1.Profile{}
+		if err := json.Unmarshal(req.Object.Raw, profile); err != nil {
+			return deny(fmt.Errorf("unable to unmarshal Profile: %s", err.Error()))
+		}
+
+		if err := validateProfile(profile); err != nil {
+			glog.Infof("Rejected Profile %s.%s: %s", req.Name, req.Namespace, err.Error())
+			return deny(err)
+		}
+	}
+
+	return allow()
+}
+
+// functionFieldErrors names the fields of a *handlers.ValidationError after the fields
+// of the FunctionSpec, rather than those of the deploy request
+func functionFieldErrors(err error) error {
+	validationErr, ok := err.(*handlers.ValidationError)
+	if !ok {
+		return err
+	}
+
+	var errs []error
+	for _, fieldErr := range validationErr.Errors {
+		name := fieldErr.Field
+		switch {
+		case name == "service":
+			name = "name"
+		case strings.HasPrefix(name, "envVars"):
+			name = "environment" + strings.TrimPrefix(name, "envVars")
+		}
+		errs = append(errs, fmt.Errorf("spec.%s: %s", name, fieldErr.Message))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateProfile checks the parts of the ProfileSpec that are otherwise only
+// validated by the API server once the Profile is applied to a Deployment
+func validateProfile(profile *faasv1.Profile) error {
+	var errs []error
+
+	if profile.Spec.RuntimeClassName != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(*profile.Spec.RuntimeClassName) {
+			errs = append(errs, fmt.Errorf("spec.runtimeClassName: %s", msg))
+		}
+	}
+
+	for i, toleration := range profile.Spec.Tolerations {
+		field := fmt.Sprintf("spec.tolerations[%d]", i)
+
+		switch toleration.Operator {
+		case corev1.TolerationOpExists:
+			if len(toleration.Value) > 0 {
+				errs = append(errs, fmt.Errorf("%s.value: must be empty when operator is %s", field, toleration.Operator))
+			}
+		case corev1.TolerationOpEqual, "":
+			if len(toleration.Key) == 0 {
+				errs = append(errs, fmt.Errorf("%s.key: must be set when operator is %s", field, corev1.TolerationOpEqual))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s.operator: unsupported value %q", field, toleration.Operator))
+		}
+
+		if len(toleration.Key) > 0 {
+			for _, msg := range validation.IsQualifiedName(toleration.Key) {
+				errs = append(errs, fmt.Errorf("%s.key: %s", field, msg))
+			}
+		}
+
+		switch toleration.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			errs = append(errs, fmt.Errorf("%s.effect: unsupported value %q", field, toleration.Effect))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/controller"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+)
+
+const (
+	// ValidatePath is the route of the validating admission webhook
+	ValidatePath = "/validate"
+	// MutatePath is the route of the mutating admission webhook
+	MutatePath = "/mutate"
+
+	functionKind = "Function"
+	profileKind  = "Profile"
+)
+
+// admitFunc reviews a single AdmissionRequest
+type admitFunc func(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
+// Server serves the validating and mutating admission webhooks for the
+// openfaas.com Function and Profile resources
+type Server struct {
+	factory controller.FunctionFactory
+	port    int
+
+	lock sync.RWMutex
+	pair *tls.Certificate
+}
+
+// New creates a webhook Server, the factory is used to parse Functions in exactly
+// the same way that the operator does when it creates the function Deployment
+func New(factory controller.FunctionFactory, port int) *Server {
+	return &Server{
+		factory: factory,
+		port:    port,
+	}
+}
+
+// Handler returns the HTTP routes for the admission webhooks
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatePath, serve(s.validate))
+	mux.HandleFunc(MutatePath, serve(s.mutate))
+	return mux
+}
+
+// SetCertificates replaces the key pair that is served, new TLS connections use it
+// straight away
+func (s *Server) SetCertificates(certs *Certificates) error {
+	pair, err := tls.X509KeyPair(certs.Cert, certs.Key)
+	if err != nil {
+		return fmt.Errorf("unable to load webhook key pair: %s", err.Error())
+	}
+
+	s.lock.Lock()
+	s.pair = &pair
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.pair, nil
+}
+
+// Start serves the webhooks over TLS with the given certificates, it blocks until
+// stopCh is closed
+func (s *Server) Start(certs *Certificates, stopCh <-chan struct{}) error {
+	if err := s.SetCertificates(certs); err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", s.port),
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			GetCertificate: s.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	glog.Infof("Starting admission webhook server on port %d", s.port)
+	if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// serve decodes the AdmissionReview, passes the request to admit and writes the
+// response back using the same apiVersion that the API server sent
+func serve(admit admitFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		review := admissionv1.AdmissionReview{}
+		if err := json.Unmarshal(body, &review); err != nil {
+			http.Error(w, fmt.Sprintf("unable to unmarshal AdmissionReview: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if review.Request == nil {
+			http.Error(w, "AdmissionReview does not contain a request", http.StatusBadRequest)
+			return
+		}
+
+		res := admit(r.Context(), review.Request)
+		res.UID = review.Request.UID
+
+		review.Response = res
+		review.Request = nil
+
+		out, err := json.Marshal(review)
+		if err != nil {
+			glog.Errorf("Failed to marshal AdmissionReview: %s", err.Error())
+			http.Error(w, "Failed to marshal AdmissionReview", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	}
+}
+
+func allow() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func deny(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
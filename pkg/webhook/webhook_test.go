@@ -0,0 +1,300 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestServer(t *testing.T, profiles ...*faasv1.Profile) *httptest.Server {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, p := range profiles {
+		if err := indexer.Add(p); err != nil {
+			t.Fatalf("unable to add profile: %s", err)
+		}
+	}
+
+	factory := controller.FunctionFactory{
+		Factory: k8s.NewFunctionFactory(fake.NewSimpleClientset(), k8s.DeploymentConfig{
+			ProfilesNamespace: "openfaas",
+			LivenessProbe:     &k8s.ProbeConfig{},
+			ReadinessProbe:    &k8s.ProbeConfig{},
+		}, listers.NewProfileLister(indexer)),
+	}
+
+	return httptest.NewServer(New(factory, 0).Handler())
+}
+
+func review(t *testing.T, url, kind string, obj runtime.Object) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("unable to marshal object: %s", err)
+	}
+
+	body, _ := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test-uid"),
+			Kind:      metav1.GroupVersionKind{Group: "openfaas.com", Version: "v1", Kind: kind},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+
+	res, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unable to post AdmissionReview: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	out := admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("unable to decode AdmissionReview: %s", err)
+	}
+
+	if out.Response == nil {
+		t.Fatalf("AdmissionReview does not contain a response")
+	}
+
+	if out.Response.UID != "test-uid" {
+		t.Fatalf("want response UID %q, got %q", "test-uid", out.Response.UID)
+	}
+
+	return out.Response
+}
+
+func Test_validate_Function(t *testing.T) {
+	srv := newTestServer(t, &faasv1.Profile{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "openfaas"},
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		name    string
+		spec    faasv1.FunctionSpec
+		allowed bool
+		message string
+	}{
+		{
+			name:    "valid function",
+			spec:    faasv1.FunctionSpec{Name: "nodeinfo", Image: "functions/nodeinfo"},
+			allowed: true,
+		},
+		{
+			name:    "invalid name",
+			spec:    faasv1.FunctionSpec{Name: "Node_Info", Image: "functions/nodeinfo"},
+			message: "spec.name",
+		},
+		{
+			name:    "missing image",
+			spec:    faasv1.FunctionSpec{Name: "nodeinfo"},
+			message: "spec.image",
+		},
+		{
+			name: "invalid memory limit",
+			spec: faasv1.FunctionSpec{
+				Name:   "nodeinfo",
+				Image:  "functions/nodeinfo",
+				Limits: &faasv1.FunctionResources{Memory: "128 megs"},
+			},
+			message: "spec.limits",
+		},
+		{
+			name: "invalid probe delay",
+			spec: faasv1.FunctionSpec{
+				Name:        "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{"com.openfaas.health.http.initialDelay": "soon"},
+			},
+			message: "spec.annotations",
+		},
+		{
+			name: "invalid environment variable name",
+			spec: faasv1.FunctionSpec{
+				Name:        "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Environment: &map[string]string{"1_invalid": "value"},
+			},
+			message: "spec.environment[1_invalid]",
+		},
+		{
+			name: "known profile",
+			spec: faasv1.FunctionSpec{
+				Name:        "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{k8s.ProfileAnnotationKey: "gpu"},
+			},
+			allowed: true,
+		},
+		{
+			name: "unknown profile",
+			spec: faasv1.FunctionSpec{
+				Name:        "nodeinfo",
+				Image:       "functions/nodeinfo",
+				Annotations: &map[string]string{k8s.ProfileAnnotationKey: "gpu,missing"},
+			},
+			message: "missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			function := &faasv1.Function{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+				Spec:       tc.spec,
+			}
+
+			res := review(t, srv.URL+ValidatePath, functionKind, function)
+			if res.Allowed != tc.allowed {
+				t.Fatalf("want allowed %v, got %v: %v", tc.allowed, res.Allowed, res.Result)
+			}
+
+			if !tc.allowed && !strings.Contains(res.Result.Message, tc.message) {
+				t.Errorf("want message to contain %q, got %q", tc.message, res.Result.Message)
+			}
+		})
+	}
+}
+
+func Test_validate_Profile(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	invalidRuntimeClass := "Not_Valid"
+	cases := []struct {
+		name    string
+		spec    faasv1.ProfileSpec
+		allowed bool
+	}{
+		{
+			name: "valid toleration",
+			spec: faasv1.ProfileSpec{
+				Tolerations: []corev1.Toleration{
+					{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+				},
+			},
+			allowed: true,
+		},
+		{
+			name: "unknown operator",
+			spec: faasv1.ProfileSpec{
+				Tolerations: []corev1.Toleration{{Key: "gpu", Operator: "In"}},
+			},
+		},
+		{
+			name: "unknown effect",
+			spec: faasv1.ProfileSpec{
+				Tolerations: []corev1.Toleration{{Key: "gpu", Value: "true", Effect: "Sometimes"}},
+			},
+		},
+		{
+			name: "invalid runtime class",
+			spec: faasv1.ProfileSpec{RuntimeClassName: &invalidRuntimeClass},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			profile := &faasv1.Profile{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "openfaas"},
+				Spec:       tc.spec,
+			}
+
+			res := review(t, srv.URL+ValidatePath, profileKind, profile)
+			if res.Allowed != tc.allowed {
+				t.Errorf("want allowed %v, got %v: %v", tc.allowed, res.Allowed, res.Result)
+			}
+		})
+	}
+}
+
+func Test_mutate_SetsDefaults(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Image:   " functions/nodeinfo ",
+			Secrets: []string{"api-key", "api-key", ""},
+		},
+	}
+
+	res := review(t, srv.URL+MutatePath, functionKind, function)
+	if !res.Allowed {
+		t.Fatalf("want mutate to allow the Function, got %v", res.Result)
+	}
+
+	if res.PatchType == nil || *res.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("want a JSONPatch, got %v", res.PatchType)
+	}
+
+	patch := []struct {
+		Op    string              `json:"op"`
+		Path  string              `json:"path"`
+		Value faasv1.FunctionSpec `json:"value"`
+	}{}
+	if err := json.Unmarshal(res.Patch, &patch); err != nil {
+		t.Fatalf("unable to unmarshal patch: %s", err)
+	}
+
+	if len(patch) != 1 || patch[0].Path != "/spec" {
+		t.Fatalf("want a single patch of /spec, got %s", string(res.Patch))
+	}
+
+	spec := patch[0].Value
+	if spec.Name != "nodeinfo" {
+		t.Errorf("want spec.name %q, got %q", "nodeinfo", spec.Name)
+	}
+	if spec.Image != "functions/nodeinfo" {
+		t.Errorf("want spec.image %q, got %q", "functions/nodeinfo", spec.Image)
+	}
+	if len(spec.Secrets) != 1 || spec.Secrets[0] != "api-key" {
+		t.Errorf("want spec.secrets [api-key], got %v", spec.Secrets)
+	}
+}
+
+func Test_mutate_NoPatchWhenDefaulted(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+		Spec:       faasv1.FunctionSpec{Name: "nodeinfo", Image: "functions/nodeinfo"},
+	}
+
+	res := review(t, srv.URL+MutatePath, functionKind, function)
+	if !res.Allowed {
+		t.Fatalf("want mutate to allow the Function, got %v", res.Result)
+	}
+
+	if len(res.Patch) != 0 {
+		t.Errorf("want no patch, got %s", string(res.Patch))
+	}
+}